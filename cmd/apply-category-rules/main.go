@@ -0,0 +1,67 @@
+// Command apply-category-rules applies the categorization rules of users to
+// their transaction history, e.g. after rules were added or changed. Categories
+// users assigned themselves are kept.
+//
+//	go run ./cmd/apply-category-rules -user <user ID>
+//
+// Without -user the rules of every user that has rules are applied.
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+
+	"FinMa/config"
+	"FinMa/internal/repository/postgres"
+	"FinMa/internal/service"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	user := flag.String("user", "", "ID of the user whose rules are applied, every user with rules when empty")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	db, err := postgres.NewDB(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database", "error", err)
+	}
+	defer db.Close()
+
+	categoryRuleRepo := postgres.NewCategoryRuleRepository(db.DB)
+	categorizationService := service.NewCategorizationService(
+		categoryRuleRepo,
+		postgres.NewTransactionRepository(db.DB),
+		postgres.NewBankAccountRepository(db.DB),
+		cfg,
+	)
+
+	ctx := context.Background()
+	var userIDs []uuid.UUID
+	if *user != "" {
+		userID, err := uuid.Parse(*user)
+		if err != nil {
+			log.Fatal("Invalid user ID", "user", *user)
+		}
+		userIDs = append(userIDs, userID)
+	} else if userIDs, err = categoryRuleRepo.GetUserIDs(ctx); err != nil {
+		log.Fatal("Failed to get users with category rules", "error", err)
+	}
+
+	var total int
+	for _, userID := range userIDs {
+		updated, err := categorizationService.ApplyRules(ctx, userID)
+		total += updated
+		if err != nil {
+			log.Error("Failed to apply category rules", "error", err, "userID", userID)
+		}
+	}
+	log.Info("Category rules applied", "users", len(userIDs), "updated", total)
+}
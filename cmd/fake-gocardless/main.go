@@ -0,0 +1,74 @@
+// Command fake-gocardless runs the fake GoCardless Bank Account Data API for
+// local development. Point the backend at it with GOCARDLESS_BASE_URL.
+//
+//	go run ./cmd/fake-gocardless -addr :8081 -latency 200ms -rate-limit-rate 0.05
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/joho/godotenv"
+
+	"FinMa/pkg/gocardless/fake"
+)
+
+func main() {
+	// The credentials default to the ones the backend uses
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	addr := flag.String("addr", ":8081", "address to listen on")
+	baseURL := flag.String("base-url", "", "public URL of the server, defaults to the request host")
+	secretID := flag.String("secret-id", os.Getenv("GOCARDLESS_CLIENT_ID"), "secret ID accepted by the token endpoint, any when empty")
+	secretKey := flag.String("secret-key", os.Getenv("GOCARDLESS_SECRET"), "secret key accepted by the token endpoint")
+	latency := flag.Duration("latency", 0, "delay added to every response")
+	jitter := flag.Duration("jitter", 0, "maximum random delay added on top of the latency")
+	rateLimitRate := flag.Float64("rate-limit-rate", 0, "fraction of requests answered with 429 Too Many Requests")
+	errorRate := flag.Float64("error-rate", 0, "fraction of requests answered with 500 Internal Server Error")
+	accountDailyLimit := flag.Int("account-daily-limit", 0, "successful calls allowed per account endpoint per day, unlimited when 0")
+	accessTokenTTL := flag.Duration("access-token-ttl", 24*time.Hour, "lifetime of access tokens")
+	flag.Parse()
+
+	server := fake.NewServer(fake.Options{
+		SecretID:          *secretID,
+		SecretKey:         *secretKey,
+		BaseURL:           *baseURL,
+		Latency:           *latency,
+		Jitter:            *jitter,
+		RateLimitRate:     *rateLimitRate,
+		ErrorRate:         *errorRate,
+		AccountDailyLimit: *accountDailyLimit,
+		AccessTokenTTL:    *accessTokenTTL,
+	})
+
+	log.Info("Fake GoCardless API listening", "addr", *addr)
+	if err := http.ListenAndServe(*addr, logRequests(server)); err != nil {
+		log.Fatal("Fake GoCardless API stopped", "error", err)
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request with its status and duration
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		log.Debug("Request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "duration", time.Since(start))
+	})
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type DatabaseConfig struct {
@@ -19,26 +22,139 @@ type GoCardlessConfig struct {
 	RedirectURL string
 	ClientID    string
 	Secret      string
+	// BaseURL overrides the API URL, e.g. to use the fake server in development
+	BaseURL string
+
+	// Frontend pages the bank callback redirects to, with the sync job to poll
+	LinkSuccessURL string
+	LinkFailureURL string
+
+	// End-user agreement defaults, capped by each institution's own limits
+	MaxHistoricalDays  int
+	AccessValidForDays int
+	AccessScope        []string
+
+	// Days before consent expiry at which users are asked to reconnect
+	ExpiryWarningDays int
+	// How often requisitions the user has not finished giving consent for are checked
+	PendingPollInterval time.Duration
+	// How often linked requisitions are synced in the background, 0 disables it
+	RefreshInterval time.Duration
+
+	// Accounts of a requisition synced in parallel, and the minimum interval
+	// between provider requests across all syncs
+	SyncWorkers         int
+	SyncRequestInterval time.Duration
+
+	// How long the institutions of a country are cached, and where logos are stored
+	InstitutionsCacheTTL time.Duration
+	LogoCacheDir         string
+}
+
+// PlaidConfig configures Plaid, used for the countries GoCardless does not cover.
+// Plaid is disabled when no client ID is set.
+type PlaidConfig struct {
+	ClientID    string
+	Secret      string
+	Environment string // sandbox, development or production
+	Countries   []string
+	ClientName  string // Shown to the user in Plaid Link
+	Language    string
+	RedirectURL string // Only needed for institutions with an OAuth flow
+}
+
+// CategorizationConfig configures the classifier suggesting categories from
+// the categories each user assigned to their transactions
+type CategorizationConfig struct {
+	// Suggestions at least this confident (0 to 1) are assigned automatically
+	AutoAssignConfidence float64
+	// Categorized transactions a user needs before categories are suggested
+	MinTrainingTransactions int
+	// How long a trained classifier is reused before it is trained again
+	ModelTTL time.Duration
+}
+
+// RecurringConfig configures the detection of recurring transactions
+type RecurringConfig struct {
+	// How much, as a fraction, the amount of a recurring transaction may differ from the previous one
+	AmountTolerance float64
+	// Transactions a weekly or monthly series needs; yearly series need two
+	MinOccurrences int
+}
+
+// TransferConfig configures the detection of transfers between the accounts of a user
+type TransferConfig struct {
+	// How far apart the two sides of a transfer may be booked
+	DateWindow time.Duration
 }
 
 type Config struct {
 	Port               string
 	AccessTokenSecret  string
 	RefreshTokenSecret string
+	// TokenEncryptionKey is the base64 encoded AES-256 key encrypting the provider tokens stored in the database
+	TokenEncryptionKey string
 	Database           DatabaseConfig
 	GoCardless         GoCardlessConfig
+	Plaid              PlaidConfig
+	Categorization     CategorizationConfig
+	Recurring          RecurringConfig
+	Transfer           TransferConfig
 }
 
+// minInstitutionsCacheTTL keeps the institutions from being refreshed more than twice a minute
+const minInstitutionsCacheTTL = time.Minute
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	config := &Config{
 		AccessTokenSecret:  getEnv("ACCESS_TOKEN_SECRET", "default_secret"),
 		RefreshTokenSecret: getEnv("REFRESH_TOKEN_SECRET", "default_secret"),
+		TokenEncryptionKey: getEnv("TOKEN_ENCRYPTION_KEY", ""),
 		Port:               getEnv("PORT", "8080"),
 		GoCardless: GoCardlessConfig{
-			RedirectURL: getEnv("GOCARDLESS_REDIRECT_URL", "http://localhost:3000/gocardless/callback"),
+			RedirectURL: getEnv("GOCARDLESS_REDIRECT_URL", "http://localhost:8080/api/gocardless/callback"),
 			ClientID:    getEnv("GOCARDLESS_CLIENT_ID", ""),
 			Secret:      getEnv("GOCARDLESS_SECRET", ""),
+			BaseURL:     getEnv("GOCARDLESS_BASE_URL", ""),
+
+			LinkSuccessURL: getEnv("GOCARDLESS_LINK_SUCCESS_URL", "http://localhost:3000/accounts/linked"),
+			LinkFailureURL: getEnv("GOCARDLESS_LINK_FAILURE_URL", "http://localhost:3000/accounts/link-failed"),
+
+			MaxHistoricalDays:  getEnvInt("GOCARDLESS_MAX_HISTORICAL_DAYS", 730),
+			AccessValidForDays: getEnvInt("GOCARDLESS_ACCESS_VALID_FOR_DAYS", 90),
+			AccessScope:        getEnvList("GOCARDLESS_ACCESS_SCOPE", []string{"balances", "details", "transactions"}),
+			ExpiryWarningDays:  getEnvInt("GOCARDLESS_EXPIRY_WARNING_DAYS", 7),
+
+			PendingPollInterval: getEnvDuration("GOCARDLESS_PENDING_POLL_INTERVAL", 5*time.Minute),
+			RefreshInterval:     getEnvDuration("GOCARDLESS_REFRESH_INTERVAL", 8*time.Hour),
+
+			SyncWorkers:         getEnvInt("GOCARDLESS_SYNC_WORKERS", 4),
+			SyncRequestInterval: getEnvDuration("GOCARDLESS_SYNC_REQUEST_INTERVAL", 100*time.Millisecond),
+
+			InstitutionsCacheTTL: getEnvDuration("GOCARDLESS_INSTITUTIONS_CACHE_TTL", 24*time.Hour),
+			LogoCacheDir:         getEnv("GOCARDLESS_LOGO_CACHE_DIR", "cache/logos"),
+		},
+		Plaid: PlaidConfig{
+			ClientID:    getEnv("PLAID_CLIENT_ID", ""),
+			Secret:      getEnv("PLAID_SECRET", ""),
+			Environment: getEnv("PLAID_ENV", "sandbox"),
+			Countries:   getEnvList("PLAID_COUNTRIES", []string{"US", "CA"}),
+			ClientName:  getEnv("PLAID_CLIENT_NAME", "FinMa"),
+			Language:    getEnv("PLAID_LANGUAGE", "en"),
+			RedirectURL: getEnv("PLAID_REDIRECT_URL", ""),
+		},
+		Categorization: CategorizationConfig{
+			AutoAssignConfidence:    getEnvFloat("CATEGORIZATION_AUTO_ASSIGN_CONFIDENCE", 0.9),
+			MinTrainingTransactions: getEnvInt("CATEGORIZATION_MIN_TRAINING_TRANSACTIONS", 20),
+			ModelTTL:                getEnvDuration("CATEGORIZATION_MODEL_TTL", time.Hour),
+		},
+		Recurring: RecurringConfig{
+			AmountTolerance: getEnvFloat("RECURRING_AMOUNT_TOLERANCE", 0.2),
+			MinOccurrences:  getEnvInt("RECURRING_MIN_OCCURRENCES", 3),
+		},
+		Transfer: TransferConfig{
+			DateWindow: getEnvDuration("TRANSFER_DATE_WINDOW", 72*time.Hour),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -50,6 +166,11 @@ func LoadConfig() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 	}
+	// The institutions are refreshed every half TTL in the background
+	if config.GoCardless.InstitutionsCacheTTL < minInstitutionsCacheTTL {
+		log.Printf("Warning: GOCARDLESS_INSTITUTIONS_CACHE_TTL is below %s, using %s", minInstitutionsCacheTTL, minInstitutionsCacheTTL)
+		config.GoCardless.InstitutionsCacheTTL = minInstitutionsCacheTTL
+	}
 	// Set default values
 	if config.GoCardless.ClientID == "" || config.GoCardless.Secret == "" || config.Database.User == "" || config.Database.Password == "" {
 		log.Fatal("Error: GOCARDLESS_CLIENT_ID, GOCARDLESS_SECRET, DB_USERNAME or DB_PASSWORD is not set. Did you copy .env.example to .env and fill it out?")
@@ -66,3 +187,60 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: %s is not a valid integer, using default %d", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvFloat gets a decimal environment variable or returns a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Warning: %s is not a valid number, using default %g", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "12h") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Warning: %s is not a valid duration, using default %s", key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvList gets a comma-separated environment variable or returns a default value
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,12 +2,96 @@ package constants
 
 // Constants for the application.
 
-var TRANSACTION_TYPES = []string{"income", "expense"}
+var TRANSACTION_TYPES = []string{TRANSACTION_TYPE_INCOME, TRANSACTION_TYPE_EXPENSE}
 
 var TRANSACTION_CATEGORIES = []string{"food", "transport", "shopping", "bills", "others"}
 
 var USER_ROLES = []string{"user", "admin"}
 
+// Transaction statuses as reported by the bank
+const (
+	TRANSACTION_STATUS_BOOKED  = "booked"
+	TRANSACTION_STATUS_PENDING = "pending"
+)
+
+var TRANSACTION_STATUSES = []string{TRANSACTION_STATUS_BOOKED, TRANSACTION_STATUS_PENDING}
+
+// Transaction types, derived from the sign of the amount when not given
+const (
+	TRANSACTION_TYPE_INCOME  = "income"
+	TRANSACTION_TYPE_EXPENSE = "expense"
+)
+
+// Who assigned the category of a transaction
+const (
+	CATEGORY_SOURCE_RULE       = "rule"
+	CATEGORY_SOURCE_USER       = "user"
+	CATEGORY_SOURCE_CLASSIFIER = "classifier" // Learned from the categories the user assigned
+)
+
+// Cadences of recurring transactions
+const (
+	RECURRING_CADENCE_WEEKLY  = "weekly"
+	RECURRING_CADENCE_MONTHLY = "monthly"
+	RECURRING_CADENCE_YEARLY  = "yearly"
+)
+
+// Statuses of a recurring series, derived from when its next transaction is expected
+const (
+	RECURRING_STATUS_ACTIVE = "active"
+	RECURRING_STATUS_MISSED = "missed" // The expected transaction is overdue
+	RECURRING_STATUS_ENDED  = "ended"  // Several expected transactions did not happen, likely cancelled
+)
+
+// Types of manual accounts, whose balance and transactions the user enters
+const (
+	MANUAL_ACCOUNT_TYPE_CASH   = "cash"
+	MANUAL_ACCOUNT_TYPE_WALLET = "wallet"
+	MANUAL_ACCOUNT_TYPE_BANK   = "bank" // A bank no provider supports
+)
+
+// Sort orders of transaction listings
+const (
+	TRANSACTION_SORT_DATE_DESC   = "date_desc" // Newest first, the default
+	TRANSACTION_SORT_DATE_ASC    = "date_asc"
+	TRANSACTION_SORT_AMOUNT_DESC = "amount_desc"
+	TRANSACTION_SORT_AMOUNT_ASC  = "amount_asc"
+)
+
+var TRANSACTION_SORTS = []string{TRANSACTION_SORT_DATE_DESC, TRANSACTION_SORT_DATE_ASC, TRANSACTION_SORT_AMOUNT_DESC, TRANSACTION_SORT_AMOUNT_ASC}
+
+// Notification types
+const (
+	NOTIFICATION_REQUISITION_EXPIRING = "requisition_expiring"
+	NOTIFICATION_REQUISITION_EXPIRED  = "requisition_expired"
+	NOTIFICATION_REQUISITION_REJECTED = "requisition_rejected"
+	NOTIFICATION_REQUISITION_FAILED   = "requisition_failed"
+)
+
+// What happens to the bank accounts of an unlinked bank connection
+const (
+	UNLINK_MODE_ARCHIVE = "archive" // Keep the accounts and transactions, hidden from listings
+	UNLINK_MODE_PURGE   = "purge"   // Delete the accounts and transactions
+)
+
+// Sync job statuses
+const (
+	SYNC_JOB_STATUS_QUEUED    = "queued"
+	SYNC_JOB_STATUS_RUNNING   = "running"
+	SYNC_JOB_STATUS_PARTIAL   = "partial" // Some accounts could not be synced
+	SYNC_JOB_STATUS_SUCCEEDED = "succeeded"
+	SYNC_JOB_STATUS_FAILED    = "failed"
+)
+
+// Statuses of an account within a sync job
+const (
+	SYNC_ACCOUNT_STATUS_RUNNING   = "running"
+	SYNC_ACCOUNT_STATUS_SUCCEEDED = "succeeded"
+	SYNC_ACCOUNT_STATUS_FAILED    = "failed"
+	SYNC_ACCOUNT_STATUS_DEFERRED  = "deferred" // Postponed until a rate limit resets
+	SYNC_ACCOUNT_STATUS_SKIPPED   = "skipped"  // Synced by the job just before
+)
+
 func GetTransactionTypes() []string {
 	return append([]string(nil), TRANSACTION_TYPES...)
 }
@@ -16,6 +100,10 @@ func GetTransactionCategories() []string {
 	return append([]string(nil), TRANSACTION_CATEGORIES...)
 }
 
+func GetTransactionStatuses() []string {
+	return append([]string(nil), TRANSACTION_STATUSES...)
+}
+
 func GetUserRoles() []string {
 	return append([]string(nil), USER_ROLES...)
 }
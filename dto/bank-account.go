@@ -9,14 +9,85 @@ import (
 // BankAccountResponse represents the data returned for a bank account to the client
 type BankAccountResponse struct {
 	ID               uuid.UUID `json:"id"`
-	AccountID        string    `json:"account_id"`
+	AccountID        string    `json:"account_id,omitempty"` // Empty for manual accounts
 	Name             string    `json:"name"`
 	Type             string    `json:"type"`
 	Currency         string    `json:"currency"`
 	InstitutionName  string    `json:"institution_name"`
 	BalanceAvailable float64   `json:"balance_available"`
 	BalanceCurrent   float64   `json:"balance_current"`
+	PendingAmount    float64   `json:"pending_amount"` // Sum of transactions not yet booked
+	PendingCount     int       `json:"pending_count"`
 	IBAN             string    `json:"iban,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-}
\ No newline at end of file
+	DisplayName      string    `json:"display_name,omitempty"` // Set by the user, shown instead of name
+	HiddenFromTotals bool      `json:"hidden_from_totals"`
+	DisplayOrder     int       `json:"display_order"`
+	RequisitionID    string    `json:"requisition_id,omitempty"`
+	Manual           bool      `json:"manual"` // Balance and transactions are entered by the user
+	// SyncDeferredUntil is set while the account waits for a provider rate limit to reset
+	SyncDeferredUntil *time.Time `json:"sync_deferred_until,omitempty"`
+	ArchivedAt        *time.Time `json:"archived_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// CreateManualAccountRequest creates an account whose balance and transactions the user enters
+type CreateManualAccountRequest struct {
+	Name            string  `json:"name" validate:"required,max=100"`
+	Type            string  `json:"type" validate:"required,oneof=cash wallet bank"`
+	Currency        string  `json:"currency" validate:"required,currency"`
+	InstitutionName string  `json:"institution_name" validate:"omitempty,max=100"`
+	IBAN            string  `json:"iban" validate:"omitempty,max=34"`
+	Balance         float64 `json:"balance"` // Balance as of today
+}
+
+// UpdateBankAccountRequest changes how an account is shown. Omitted fields are
+// left unchanged; an empty display name restores the bank's name.
+type UpdateBankAccountRequest struct {
+	DisplayName      *string `json:"display_name" validate:"omitempty,max=100"`
+	HiddenFromTotals *bool   `json:"hidden_from_totals"`
+	DisplayOrder     *int    `json:"display_order" validate:"omitempty,min=0"`
+	// Balance corrects the balance of a manual account as of today
+	Balance *float64 `json:"balance"`
+}
+
+// LatestBalance is the latest balance of one type the bank reported for an account
+type LatestBalance struct {
+	BalanceType   string     `json:"balance_type"`
+	Amount        float64    `json:"amount"`
+	Currency      string     `json:"currency"`
+	Date          string     `json:"date"` // YYYY-MM-DD, the day it was synced
+	ReferenceDate *time.Time `json:"reference_date,omitempty"`
+}
+
+// AccountBalancesResponse breaks down the balance of an account
+type AccountBalancesResponse struct {
+	BankAccountID    uuid.UUID       `json:"bank_account_id"`
+	Currency         string          `json:"currency"`
+	BalanceAvailable float64         `json:"balance_available"`
+	BalanceCurrent   float64         `json:"balance_current"`
+	PendingAmount    float64         `json:"pending_amount"` // Sum of transactions not yet booked
+	PendingCount     int             `json:"pending_count"`
+	Balances         []LatestBalance `json:"balances"` // Every balance type the bank reports
+}
+
+// BalancePoint is a balance on a given day
+type BalancePoint struct {
+	Date   string  `json:"date"` // YYYY-MM-DD
+	Amount float64 `json:"amount"`
+}
+
+// BalanceSeries is the history of one balance type in one currency
+type BalanceSeries struct {
+	BalanceType string         `json:"balance_type"`
+	Currency    string         `json:"currency"`
+	Points      []BalancePoint `json:"points"`
+}
+
+// BalanceHistoryResponse represents the balances of one or all accounts over time
+type BalanceHistoryResponse struct {
+	BankAccountID *uuid.UUID      `json:"bank_account_id,omitempty"` // Empty for the total of all accounts
+	From          string          `json:"from"`
+	To            string          `json:"to"`
+	Series        []BalanceSeries `json:"series"`
+}
@@ -0,0 +1,37 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BudgetRequest creates or replaces a budget limiting the spending of a
+// category between two dates inclusive, formatted as YYYY-MM-DD
+type BudgetRequest struct {
+	Category  string  `json:"category" validate:"required,max=50"`
+	Amount    float64 `json:"amount" validate:"gt=0"`
+	Currency  string  `json:"currency" validate:"required,len=3"`
+	StartDate string  `json:"start_date" validate:"required"`
+	EndDate   string  `json:"end_date" validate:"required"`
+}
+
+// BudgetResponse represents a budget returned to the client with what was
+// spent of it. Split transactions count towards the categories of their
+// splits; transfers between the user's accounts do not count.
+type BudgetResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Category  string    `json:"category"`
+	Currency  string    `json:"currency"`
+	Amount    float64   `json:"amount"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	// Spent is the expenses of the category less its refunds, positive
+	Spent        float64 `json:"spent"`
+	Remaining    float64 `json:"remaining"` // Negative when the budget is exceeded
+	Exceeded     bool    `json:"exceeded"`
+	Transactions int     `json:"transactions"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,89 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CategoryRuleRequest creates or replaces a categorization rule. A rule needs
+// at least one condition and assigns at least a category, a type or tags.
+type CategoryRuleRequest struct {
+	Name     string `json:"name" validate:"required,max=100"`
+	Priority int    `json:"priority"` // Higher priorities are applied first
+	Enabled  *bool  `json:"enabled"`  // Enabled when omitted
+
+	DescriptionContains  string     `json:"description_contains" validate:"max=100"`
+	CounterpartyContains string     `json:"counterparty_contains" validate:"max=100"`
+	CounterpartyIBAN     string     `json:"counterparty_iban" validate:"max=34"`
+	MinAmount            *float64   `json:"min_amount"` // Signed, expenses are negative
+	MaxAmount            *float64   `json:"max_amount"`
+	BankAccountID        *uuid.UUID `json:"bank_account_id"`
+
+	Category string   `json:"category" validate:"max=50"`
+	Type     string   `json:"type" validate:"omitempty,oneof=income expense"`
+	Tags     []string `json:"tags" validate:"max=10,dive,max=30"`
+}
+
+// CategoryRuleResponse represents a categorization rule returned to the client
+type CategoryRuleResponse struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Priority int       `json:"priority"`
+	Enabled  bool      `json:"enabled"`
+
+	DescriptionContains  string     `json:"description_contains,omitempty"`
+	CounterpartyContains string     `json:"counterparty_contains,omitempty"`
+	CounterpartyIBAN     string     `json:"counterparty_iban,omitempty"`
+	MinAmount            *float64   `json:"min_amount,omitempty"`
+	MaxAmount            *float64   `json:"max_amount,omitempty"`
+	BankAccountID        *uuid.UUID `json:"bank_account_id,omitempty"`
+
+	Category string   `json:"category,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Tags     []string `json:"tags"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RulePreviewMatch is a transaction a rule matches, with what the rule would assign to it
+type RulePreviewMatch struct {
+	Transaction TransactionResponse `json:"transaction"`
+	Category    string              `json:"category"`
+	Type        string              `json:"type"`
+	Tags        []string            `json:"tags"`
+}
+
+// RulePreviewResponse is what a rule would do to the existing transactions, without saving it
+type RulePreviewResponse struct {
+	Matched int `json:"matched"` // Transactions the rule would categorize
+	// Skipped transactions match, but keep the category the user assigned
+	Skipped      int                `json:"skipped"`
+	Transactions []RulePreviewMatch `json:"transactions"` // The most recent of the matched
+}
+
+// ApplyRulesResponse reports the outcome of re-applying the rules to the transaction history
+type ApplyRulesResponse struct {
+	Updated int `json:"updated"` // Transactions whose category, type or tags changed
+}
+
+// SetCategoryRequest assigns a category to a transaction, overriding what rules
+// or the classifier assigned. An empty category hands the transaction back to them.
+type SetCategoryRequest struct {
+	Category string    `json:"category" validate:"max=50"`
+	Tags     *[]string `json:"tags" validate:"omitempty,max=10,dive,max=30"` // Left unchanged when omitted
+}
+
+// CategorySuggestion is a category the classifier suggests, with its confidence between 0 and 1
+type CategorySuggestion struct {
+	Category   string  `json:"category"`
+	Confidence float64 `json:"confidence"`
+}
+
+// CategorySuggestionsResponse lists the likeliest categories of a transaction,
+// empty until the user has categorized enough transactions
+type CategorySuggestionsResponse struct {
+	TransactionID uuid.UUID            `json:"transaction_id"`
+	Suggestions   []CategorySuggestion `json:"suggestions"`
+}
@@ -1,11 +1,27 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Institution struct {
-	ID        string   `json:"id"`
-	Name      string   `json:"name"`
-	BIC       string   `json:"bic"`
-	Countries []string `json:"countries"`
-	Logo      string   `json:"logo"`
+	ID                    string   `json:"id"`
+	Name                  string   `json:"name"`
+	BIC                   string   `json:"bic"`
+	TransactionTotalDays  string   `json:"transaction_total_days"`    // Maximum days of history the bank provides
+	MaxAccessValidForDays string   `json:"max_access_valid_for_days"` // Maximum consent duration the bank allows
+	Countries             []string `json:"countries"`
+	Logo                  string   `json:"logo"`
+	SupportedFeatures     []string `json:"supported_features"`
+	Provider              string   `json:"provider"` // Bank data provider serving the institution
+}
+
+// InstitutionFilter narrows down the institutions of a country
+type InstitutionFilter struct {
+	Query          string   // Matches the name or BIC, case-insensitively
+	Features       []string // Every feature must be supported
+	MinHistoryDays int      // Minimum days of transaction history provided
 }
 
 type TokenRequest struct {
@@ -13,6 +29,11 @@ type TokenRequest struct {
 	SecretKey string `json:"secret_key"`
 }
 
+// GoCardlessRefreshTokenRequest is the request body for refreshing a GoCardless access token
+type GoCardlessRefreshTokenRequest struct {
+	Refresh string `json:"refresh"`
+}
+
 type TokenResponse struct {
 	Access         string `json:"access"`
 	AccessExpires  int    `json:"access_expires"`
@@ -21,19 +42,48 @@ type TokenResponse struct {
 }
 
 type LinkAccountRequest struct {
-	InstitutionID string `json:"institution_id"`
+	InstitutionID      string `json:"institution_id" validate:"required"`
+	Provider           string `json:"provider,omitempty" validate:"omitempty,oneof=gocardless plaid"`     // Provider of the institution, defaults to GoCardless
+	MaxHistoricalDays  int    `json:"max_historical_days,omitempty" validate:"omitempty,gte=1,lte=730"`   // Defaults to the configured value
+	AccessValidForDays int    `json:"access_valid_for_days,omitempty" validate:"omitempty,gte=1,lte=180"` // Defaults to the configured value
 }
 
 type LinkAccountResponse struct {
-	Link string `json:"link"` // URL to redirect user to for linking account
+	Link      string `json:"link"`      // URL to redirect user to for linking account, or the Plaid link token
+	Reference string `json:"reference"` // Reference to sync the requisition with once the user is done
+	Provider  string `json:"provider"`
 }
 
+// SyncRequisitionRequest is the optional body of a requisition sync
+type SyncRequisitionRequest struct {
+	PublicToken string `json:"public_token,omitempty"` // Returned by Plaid Link
+}
 
 // GoCardlessCreateRequisitionRequest is the request body for creating a requisition
 type GoCardlessCreateRequisitionRequest struct {
 	InstitutionID string `json:"institution_id"`
 	RedirectURL   string `json:"redirect"`
 	Reference     string `json:"reference"`
+	Agreement     string `json:"agreement,omitempty"`
+}
+
+// GoCardlessCreateAgreementRequest is the request body for creating an end-user agreement
+type GoCardlessCreateAgreementRequest struct {
+	InstitutionID      string   `json:"institution_id"`
+	MaxHistoricalDays  int      `json:"max_historical_days"`
+	AccessValidForDays int      `json:"access_valid_for_days"`
+	AccessScope        []string `json:"access_scope"`
+}
+
+// GoCardlessAgreement is an end-user agreement as returned by GoCardless
+type GoCardlessAgreement struct {
+	ID                 string     `json:"id"`
+	Created            time.Time  `json:"created"`
+	InstitutionID      string     `json:"institution_id"`
+	MaxHistoricalDays  int        `json:"max_historical_days"`
+	AccessValidForDays int        `json:"access_valid_for_days"`
+	AccessScope        []string   `json:"access_scope"`
+	Accepted           *time.Time `json:"accepted"` // Set once the user gave consent
 }
 
 // AccountDetails represents the details of a bank account
@@ -69,18 +119,48 @@ type AccountBalances struct {
 
 // Transaction represents a single transaction
 type Transaction struct {
-	TransactionID             string `json:"transactionId"`
-	BookingDate               string `json:"bookingDate"`
-	ValueDate                 string `json:"valueDate"`
-	BookingDateTime           string `json:"bookingDateTime"`
-	ValueDateTime             string `json:"valueDateTime"`
-	TransactionAmount         struct {
+	TransactionID         string `json:"transactionId"`
+	EntryReference        string `json:"entryReference"`
+	EndToEndID            string `json:"endToEndId"`
+	InternalTransactionID string `json:"internalTransactionId"`
+	BookingDate           string `json:"bookingDate"`
+	ValueDate             string `json:"valueDate"`
+	BookingDateTime       string `json:"bookingDateTime"`
+	ValueDateTime         string `json:"valueDateTime"`
+	TransactionAmount     struct {
 		Amount   string `json:"amount"`
 		Currency string `json:"currency"`
 	} `json:"transactionAmount"`
-	CreditorName          string `json:"creditorName"`
-	DebtorName            string `json:"debtorName"`
-	RemittanceInformation string `json:"remittanceInformationUnstructured"`
+	CreditorName                    string           `json:"creditorName"`
+	CreditorAccount                 TransactionParty `json:"creditorAccount"`
+	DebtorName                      string           `json:"debtorName"`
+	DebtorAccount                   TransactionParty `json:"debtorAccount"`
+	RemittanceInformation           string           `json:"remittanceInformationUnstructured"`
+	RemittanceInformationStructured string           `json:"remittanceInformationStructured"`
+	BankTransactionCode             string           `json:"bankTransactionCode"`
+	ProprietaryBankTransactionCode  string           `json:"proprietaryBankTransactionCode"`
+	MerchantCategoryCode            string           `json:"merchantCategoryCode"`
+
+	// Raw is the transaction exactly as the provider returned it
+	Raw json.RawMessage `json:"-"`
+}
+
+// TransactionParty identifies the account of a creditor or debtor
+type TransactionParty struct {
+	IBAN string `json:"iban"`
+	BBAN string `json:"bban"`
+}
+
+// UnmarshalJSON decodes a transaction and keeps a copy of the raw payload
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type transaction Transaction
+	var decoded transaction
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*t = Transaction(decoded)
+	t.Raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 // AccountTransactions represents the transactions of a bank account
@@ -91,7 +171,6 @@ type AccountTransactions struct {
 	} `json:"transactions"`
 }
 
-
 // Internal GoCardless API DTO (for communicating with GoCardless)
 type GoCardlessCreateRequisitionResponse struct {
 	ID                string   `json:"id"`
@@ -125,6 +204,27 @@ type GoCardlessGetRequisitionResponse struct {
 	RedirectImmediate bool     `json:"redirect_immediate"`
 }
 
+// RequisitionResponse represents a bank connection returned to the client
+type RequisitionResponse struct {
+	ID                    string     `json:"id"`
+	Status                string     `json:"status"`
+	StatusDescription     string     `json:"status_description"`
+	InstitutionID         string     `json:"institution_id"`
+	Reference             string     `json:"reference"`
+	Provider              string     `json:"provider"`
+	PreviousRequisitionID string     `json:"previous_requisition_id,omitempty"`
+	ExpiresAt             *time.Time `json:"expires_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// RequisitionTransitionResponse is a status change of a bank connection
+type RequisitionTransitionResponse struct {
+	FromStatus  string    `json:"from_status,omitempty"`
+	ToStatus    string    `json:"to_status"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 type GoCardlessGetRequisitionRequest struct {
 	RequisitionID string `json:"requisition_id"`
 }
@@ -133,7 +233,15 @@ type GoCardlessUpdateRequisitionRequest struct {
 	RequisitionReference string `json:"requisition_reference"` // Reference to update the requisition
 }
 type GoCardlessUpdateRequisitionResponse struct {
-	Status        string `json:"status"`
-	InstitutionID string `json:"institution_id"`
-	Reference     string `json:"reference"`
+	Status           string                `json:"status"`
+	InstitutionID    string                `json:"institution_id"`
+	Reference        string                `json:"reference"`
+	DeferredAccounts []DeferredAccountSync `json:"deferred_accounts,omitempty"` // Accounts not synced because of rate limits
+	Accounts         []AccountSyncResult   `json:"accounts,omitempty"`          // Outcome of every account
+}
+
+// DeferredAccountSync describes an account whose sync was postponed until a rate limit resets
+type DeferredAccountSync struct {
+	AccountID string    `json:"account_id"`
+	RetryAt   time.Time `json:"retry_at"`
 }
@@ -0,0 +1,47 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecurringSeriesResponse represents a recurring series returned to the client.
+// Amounts are signed, payments are negative.
+type RecurringSeriesResponse struct {
+	ID                 uuid.UUID  `json:"id"`
+	BankAccountID      uuid.UUID  `json:"bank_account_id"`
+	Counterparty       string     `json:"counterparty"`
+	Cadence            string     `json:"cadence"` // "weekly", "monthly" or "yearly"
+	Category           string     `json:"category,omitempty"`
+	Currency           string     `json:"currency,omitempty"`
+	Amount             float64    `json:"amount"`
+	PreviousAmount     float64    `json:"previous_amount"` // Before the amount last changed
+	PriceChangedAt     *time.Time `json:"price_changed_at,omitempty"`
+	AverageAmount      float64    `json:"average_amount"`
+	Occurrences        int        `json:"occurrences"`
+	FirstDate          string     `json:"first_date"`
+	LastDate           string     `json:"last_date"`
+	NextExpectedDate   string     `json:"next_expected_date"`
+	NextExpectedAmount float64    `json:"next_expected_amount"`
+	// Status is "active", "missed" when the expected transaction is overdue, or
+	// "ended" when several expected transactions did not happen
+	Status string `json:"status"`
+	// PriceIncreased tells whether the amount last changed to a larger one
+	PriceIncreased bool      `json:"price_increased"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SubscriptionsResponse lists the recurring payments of a user that have not ended
+type SubscriptionsResponse struct {
+	Subscriptions []RecurringSeriesResponse `json:"subscriptions"`
+	// MonthlyCosts are the subscriptions averaged over a month, by currency, as positive amounts
+	MonthlyCosts   map[string]float64 `json:"monthly_costs"`
+	PriceIncreases int                `json:"price_increases"`
+	MissedCharges  int                `json:"missed_charges"`
+}
+
+// DetectRecurringResponse reports how many recurring series were found
+type DetectRecurringResponse struct {
+	Series int `json:"series"`
+}
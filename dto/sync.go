@@ -0,0 +1,36 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StartSyncRequest starts a background sync of a bank connection
+type StartSyncRequest struct {
+	Reference   string `json:"reference" validate:"required"`
+	PublicToken string `json:"public_token"` // Returned by Plaid Link, empty for other providers
+}
+
+// SyncJobResponse is the status of a background sync of a bank connection
+type SyncJobResponse struct {
+	ID                string              `json:"id"`
+	Status            string              `json:"status"` // queued, running, partial, succeeded or failed
+	RequisitionID     string              `json:"requisition_id"`
+	Error             string              `json:"error,omitempty"`
+	TotalAccounts     int                 `json:"total_accounts"`
+	CompletedAccounts int                 `json:"completed_accounts"`
+	Accounts          []AccountSyncResult `json:"accounts"`
+	StartedAt         *time.Time          `json:"started_at,omitempty"`
+	FinishedAt        *time.Time          `json:"finished_at,omitempty"`
+	CreatedAt         time.Time           `json:"created_at"`
+}
+
+// AccountSyncResult is the outcome of syncing one account of a bank connection
+type AccountSyncResult struct {
+	AccountID     string     `json:"account_id"` // Provider account ID
+	BankAccountID *uuid.UUID `json:"bank_account_id,omitempty"`
+	Status        string     `json:"status"` // running, succeeded, failed, deferred or skipped
+	Error         string     `json:"error,omitempty"`
+	RetryAt       *time.Time `json:"retry_at,omitempty"` // When a deferred account can be synced again
+}
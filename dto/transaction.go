@@ -0,0 +1,137 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TransactionQuery selects and orders the transactions of a user. Zero fields do not filter.
+type TransactionQuery struct {
+	BankAccountIDs []uuid.UUID
+	From           *time.Time
+	To             *time.Time
+	MinAmount      *float64
+	MaxAmount      *float64
+	Category       string
+	Type           string
+	Status         string
+	Search         string
+	Sort           string
+	Cursor         string // Returned as next_cursor by the previous page
+	Limit          int
+}
+
+// TransactionResponse represents the data returned for a transaction to the client
+type TransactionResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	BankAccountID uuid.UUID  `json:"bank_account_id"`
+	Date          time.Time  `json:"date"`
+	ValueDate     *time.Time `json:"value_date,omitempty"`
+	Amount        float64    `json:"amount"`
+	Currency      string     `json:"currency,omitempty"`
+	Description   string     `json:"description"`
+	Category      string     `json:"category"`
+	// CategorySource is "rule", "user" or "classifier" when one of them assigned the category
+	CategorySource string `json:"category_source,omitempty"`
+	// CategoryConfidence is how sure the classifier was of the category it assigned
+	CategoryConfidence float64    `json:"category_confidence,omitempty"`
+	Tags               []string   `json:"tags,omitempty"`
+	Type               string     `json:"type"`
+	Status             string     `json:"status"`
+	IsRecurring        bool       `json:"is_recurring"`
+	RecurringSeriesID  *uuid.UUID `json:"recurring_series_id,omitempty"`
+	// TransferTransactionID is the other side of a transfer between accounts of the user
+	TransferTransactionID *uuid.UUID `json:"transfer_transaction_id,omitempty"`
+	// Splits divide the amount across categories, their categories replace Category
+	Splits       []TransactionSplitResponse `json:"splits,omitempty"`
+	Manual       bool                       `json:"manual"` // Entered by the user, can be changed and deleted
+	CreditorName string                     `json:"creditor_name,omitempty"`
+	CreditorIBAN string                     `json:"creditor_iban,omitempty"`
+	DebtorName   string                     `json:"debtor_name,omitempty"`
+	DebtorIBAN   string                     `json:"debtor_iban,omitempty"`
+	CreatedAt    time.Time                  `json:"created_at"`
+	UpdatedAt    time.Time                  `json:"updated_at"`
+}
+
+// CreateTransactionRequest adds a transaction to a manual account. Negative
+// amounts are expenses; the type is derived from the sign when omitted.
+type CreateTransactionRequest struct {
+	BankAccountID uuid.UUID `json:"bank_account_id" validate:"required"`
+	Date          string    `json:"date" validate:"required,datetime=2006-01-02"`
+	Amount        float64   `json:"amount" validate:"required"`
+	Description   string    `json:"description" validate:"max=255"`
+	Category      string    `json:"category" validate:"max=50"`
+	Type          string    `json:"type" validate:"omitempty,oneof=income expense"`
+	Counterparty  string    `json:"counterparty" validate:"max=100"` // Who was paid, or who paid
+}
+
+// UpdateTransactionRequest changes a transaction of a manual account. Omitted fields are left unchanged.
+type UpdateTransactionRequest struct {
+	Date         *string  `json:"date" validate:"omitempty,datetime=2006-01-02"`
+	Amount       *float64 `json:"amount" validate:"omitempty,ne=0"`
+	Description  *string  `json:"description" validate:"omitempty,max=255"`
+	Category     *string  `json:"category" validate:"omitempty,max=50"`
+	Type         *string  `json:"type" validate:"omitempty,oneof=income expense"`
+	Counterparty *string  `json:"counterparty" validate:"omitempty,max=100"`
+}
+
+// TransactionListResponse is a page of transactions. NextCursor is empty on the last page.
+type TransactionListResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+}
+
+// TransactionSplitResponse represents a split of a transaction returned to the client
+type TransactionSplitResponse struct {
+	ID       uuid.UUID `json:"id"`
+	Amount   float64   `json:"amount"`
+	Category string    `json:"category"`
+	Note     string    `json:"note,omitempty"`
+}
+
+// TransactionSplitRequest is a part of a transaction with its own category
+type TransactionSplitRequest struct {
+	Amount   float64 `json:"amount" validate:"required"` // Signed like the amount of the transaction
+	Category string  `json:"category" validate:"max=50"`
+	Note     string  `json:"note" validate:"max=255"`
+}
+
+// SplitTransactionRequest replaces the splits of a transaction. The amounts of
+// the splits must sum to the amount of the transaction; no splits removes them.
+type SplitTransactionRequest struct {
+	Splits []TransactionSplitRequest `json:"splits" validate:"max=20,dive"`
+}
+
+// CategorySummaryResponse is the income and expenses of a user by category
+// over a period. Split transactions count towards the categories of their
+// splits; transfers between the user's accounts do not count.
+type CategorySummaryResponse struct {
+	From       string          `json:"from"`
+	To         string          `json:"to"`
+	Categories []CategoryTotal `json:"categories"` // Largest expenses first
+	Totals     []CurrencyTotal `json:"totals"`
+}
+
+// CategoryTotal is the income and expenses of a category in one currency.
+// Uncategorized transactions have an empty category.
+type CategoryTotal struct {
+	Category     string  `json:"category"`
+	Currency     string  `json:"currency"`
+	Income       float64 `json:"income"`
+	Expense      float64 `json:"expense"` // Positive
+	Transactions int     `json:"transactions"`
+}
+
+// CurrencyTotal is the income and expenses of all categories in one currency
+type CurrencyTotal struct {
+	Currency string  `json:"currency"`
+	Income   float64 `json:"income"`
+	Expense  float64 `json:"expense"` // Positive
+	Net      float64 `json:"net"`
+}
+
+// DetectTransfersResponse reports how many transfers were linked
+type DetectTransfersResponse struct {
+	Linked int `json:"linked"`
+}
@@ -0,0 +1,205 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/pkg/gocardless"
+)
+
+// GoCardless provides bank data through GoCardless Bank Account Data, covering Europe
+type GoCardless struct {
+	client      *gocardless.Client
+	accessScope []string
+}
+
+// NewGoCardless creates a GoCardless provider
+func NewGoCardless(client *gocardless.Client, accessScope []string) *GoCardless {
+	return &GoCardless{
+		client:      client,
+		accessScope: accessScope,
+	}
+}
+
+func (p *GoCardless) Name() string {
+	return ProviderGoCardless
+}
+
+func (p *GoCardless) GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error) {
+	institutions, err := p.client.GetInstitutions(ctx, countryCode)
+	if err != nil {
+		return nil, gclError(err)
+	}
+	for i := range institutions {
+		institutions[i].Provider = ProviderGoCardless
+	}
+	return institutions, nil
+}
+
+func (p *GoCardless) GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error) {
+	institution, err := p.client.GetInstitution(ctx, institutionID)
+	if err != nil {
+		if errors.Is(err, gocardless.ErrNotFound) {
+			return nil, ErrInstitutionNotFound
+		}
+		return nil, gclError(err)
+	}
+	institution.Provider = ProviderGoCardless
+	return institution, nil
+}
+
+// CreateLink creates an end-user agreement for the requested history and access
+// duration, capped by the limits the institution supports, and a requisition using it
+func (p *GoCardless) CreateLink(ctx context.Context, req LinkRequest) (*Connection, error) {
+	institution, err := p.client.GetInstitution(ctx, req.InstitutionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get institution %s: %w", req.InstitutionID, gclError(err))
+	}
+
+	agreement, err := p.client.CreateEndUserAgreement(ctx, dto.GoCardlessCreateAgreementRequest{
+		InstitutionID:      req.InstitutionID,
+		MaxHistoricalDays:  capDays(req.MaxHistoricalDays, institution.TransactionTotalDays),
+		AccessValidForDays: capDays(req.AccessValidForDays, institution.MaxAccessValidForDays),
+		AccessScope:        p.accessScope,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create end-user agreement: %w", gclError(err))
+	}
+
+	requisition, err := p.client.CreateRequisition(ctx, req.UserID, req.InstitutionID, req.RedirectURL, agreement.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create requisition: %w", gclError(err))
+	}
+
+	// Consent runs from acceptance, so this is refined once the user accepts
+	expiresAt := agreement.Created.Add(days(agreement.AccessValidForDays))
+
+	return &Connection{
+		ID:                 requisition.ID,
+		Status:             domain.RequisitionStatus(requisition.Status),
+		InstitutionID:      req.InstitutionID,
+		Reference:          requisition.Reference,
+		Link:               requisition.Link,
+		AgreementID:        agreement.ID,
+		MaxHistoricalDays:  agreement.MaxHistoricalDays,
+		AccessValidForDays: agreement.AccessValidForDays,
+		ExpiresAt:          &expiresAt,
+	}, nil
+}
+
+// GetConnection returns the requisition status and accounts. Once the user
+// accepted the agreement the consent expiry is known exactly.
+func (p *GoCardless) GetConnection(ctx context.Context, requisition *domain.Requisition, _ string) (*Connection, error) {
+	response, err := p.client.GetRequisition(ctx, requisition.UserID, requisition.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisition: %w", gclError(err))
+	}
+
+	connection := &Connection{
+		ID:                 response.ID,
+		Status:             domain.RequisitionStatus(response.Status),
+		InstitutionID:      response.InstitutionID,
+		Reference:          response.Reference,
+		Link:               response.Link,
+		AgreementID:        response.Agreement,
+		MaxHistoricalDays:  requisition.MaxHistoricalDays,
+		AccessValidForDays: requisition.AccessValidForDays,
+		AcceptedAt:         requisition.AgreementAcceptedAt,
+		ExpiresAt:          requisition.ExpiresAt,
+		Accounts:           response.Accounts,
+	}
+
+	if response.Agreement != "" && connection.AcceptedAt == nil {
+		agreement, err := p.client.GetEndUserAgreement(ctx, response.Agreement)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get end-user agreement: %w", gclError(err))
+		}
+		if agreement.Accepted != nil {
+			expiresAt := agreement.Accepted.Add(days(agreement.AccessValidForDays))
+			connection.AcceptedAt = agreement.Accepted
+			connection.ExpiresAt = &expiresAt
+		}
+	}
+
+	return connection, nil
+}
+
+func (p *GoCardless) Unlink(ctx context.Context, requisition *domain.Requisition) error {
+	if err := p.client.DeleteRequisition(ctx, requisition.ID); err != nil {
+		// Deleted at GoCardless already, e.g. by a previous attempt
+		if errors.Is(err, gocardless.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete requisition: %w", gclError(err))
+	}
+	return nil
+}
+
+func (p *GoCardless) GetAccountDetails(ctx context.Context, _ *domain.Requisition, accountID string) (*dto.AccountDetails, error) {
+	details, err := p.client.GetAccountDetails(ctx, accountID)
+	return details, gclError(err)
+}
+
+func (p *GoCardless) GetAccountBalances(ctx context.Context, _ *domain.Requisition, accountID string) (*dto.AccountBalances, error) {
+	balances, err := p.client.GetAccountBalances(ctx, accountID)
+	return balances, gclError(err)
+}
+
+func (p *GoCardless) GetAccountTransactions(ctx context.Context, _ *domain.Requisition, accountID string) (*dto.AccountTransactions, error) {
+	transactions, err := p.client.GetAccountTransactions(ctx, accountID)
+	return transactions, gclError(err)
+}
+
+// gclClassifiedErrors maps the GoCardless client errors to the provider errors
+var gclClassifiedErrors = []struct {
+	gcl, provider error
+}{
+	{gocardless.ErrUnauthorized, ErrProviderAuth},
+	{gocardless.ErrNotFound, ErrNotFound},
+	{gocardless.ErrConsentExpired, ErrConsentExpired},
+	{gocardless.ErrAccountSuspended, ErrAccountSuspended},
+	{gocardless.ErrInstitutionDown, ErrInstitutionDown},
+}
+
+// gclError translates GoCardless errors to the provider errors; unclassified
+// errors are returned as is
+func gclError(err error) error {
+	var rateLimitErr *gocardless.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		scope := RateLimitScopeGeneral
+		if rateLimitErr.Scope == gocardless.RateLimitScopeAccount {
+			scope = RateLimitScopeAccount
+		}
+		return &RateLimitError{
+			Scope:   scope,
+			ResetAt: rateLimitErr.ResetAt,
+			Err:     err,
+		}
+	}
+	for _, classified := range gclClassifiedErrors {
+		if errors.Is(err, classified.gcl) {
+			return fmt.Errorf("%w: %w", classified.provider, err)
+		}
+	}
+	return err
+}
+
+// capDays caps a number of days to an institution limit. Institutions report
+// their limits as strings and leave them empty when they have none.
+func capDays(days int, limit string) int {
+	max, err := strconv.Atoi(limit)
+	if err != nil || max <= 0 || days <= max {
+		return days
+	}
+	return max
+}
+
+// days converts a number of days to a duration
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
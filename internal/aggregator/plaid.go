@@ -0,0 +1,450 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/plaid/plaid-go/plaid"
+
+	"FinMa/config"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+)
+
+// Plaid lists are fetched in pages of this size, the maximum Plaid allows
+const plaidPageSize = 500
+
+// Plaid error codes that mean the user has to go through Link again
+var plaidReauthErrorCodes = map[string]bool{
+	"ITEM_LOGIN_REQUIRED":     true,
+	"PENDING_EXPIRATION":      true,
+	"ACCESS_NOT_GRANTED":      true,
+	"NO_ACCOUNTS":             true,
+	"USER_PERMISSION_REVOKED": true,
+}
+
+// Plaid provides bank data through Plaid, covering North America.
+//
+// Plaid connections (items) are not created by redirecting the user to a URL:
+// the frontend opens Plaid Link with the link token returned by CreateLink and
+// receives a public token, which is exchanged for the item's access token the
+// first time the connection is synced.
+type Plaid struct {
+	client      *plaid.APIClient
+	clientName  string
+	language    string
+	countries   []plaid.CountryCode
+	redirectURL string
+}
+
+// NewPlaid creates a Plaid provider
+func NewPlaid(cfg config.PlaidConfig) *Plaid {
+	configuration := plaid.NewConfiguration()
+	configuration.AddDefaultHeader("PLAID-CLIENT-ID", cfg.ClientID)
+	configuration.AddDefaultHeader("PLAID-SECRET", cfg.Secret)
+	configuration.UseEnvironment(plaidEnvironment(cfg.Environment))
+
+	countries := make([]plaid.CountryCode, 0, len(cfg.Countries))
+	for _, country := range cfg.Countries {
+		countries = append(countries, plaid.CountryCode(strings.ToUpper(country)))
+	}
+
+	return &Plaid{
+		client:      plaid.NewAPIClient(configuration),
+		clientName:  cfg.ClientName,
+		language:    cfg.Language,
+		countries:   countries,
+		redirectURL: cfg.RedirectURL,
+	}
+}
+
+// plaidEnvironment returns the Plaid API host of an environment name
+func plaidEnvironment(name string) plaid.Environment {
+	switch strings.ToLower(name) {
+	case "production":
+		return plaid.Production
+	case "development":
+		return plaid.Development
+	default:
+		return plaid.Sandbox
+	}
+}
+
+func (p *Plaid) Name() string {
+	return ProviderPlaid
+}
+
+func (p *Plaid) GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error) {
+	var institutions []dto.Institution
+	countries := []plaid.CountryCode{plaid.CountryCode(strings.ToUpper(countryCode))}
+
+	options := plaid.NewInstitutionsGetRequestOptions()
+	options.SetIncludeOptionalMetadata(true)
+
+	for offset := int32(0); ; {
+		request := plaid.NewInstitutionsGetRequest(plaidPageSize, offset, countries)
+		request.SetOptions(*options)
+
+		response, _, err := p.client.PlaidApi.InstitutionsGet(ctx).InstitutionsGetRequest(*request).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get institutions: %w", plaidError(err))
+		}
+
+		for _, institution := range response.Institutions {
+			institutions = append(institutions, plaidInstitution(institution))
+		}
+
+		offset += int32(len(response.Institutions))
+		if len(response.Institutions) == 0 || offset >= response.Total {
+			break
+		}
+	}
+
+	return institutions, nil
+}
+
+func (p *Plaid) GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error) {
+	options := plaid.NewInstitutionsGetByIdRequestOptions()
+	options.SetIncludeOptionalMetadata(true)
+
+	request := plaid.NewInstitutionsGetByIdRequest(institutionID, p.countries)
+	request.SetOptions(*options)
+
+	response, _, err := p.client.PlaidApi.InstitutionsGetById(ctx).InstitutionsGetByIdRequest(*request).Execute()
+	if err != nil {
+		if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && plaidErr.ErrorCode == "INVALID_INSTITUTION" {
+			return nil, ErrInstitutionNotFound
+		}
+		return nil, fmt.Errorf("failed to get institution %s: %w", institutionID, plaidError(err))
+	}
+
+	institution := plaidInstitution(response.Institution)
+	return &institution, nil
+}
+
+// CreateLink creates a link token. Plaid only hands out the item ID once the
+// user finished Plaid Link, so the connection is identified by our own ID.
+func (p *Plaid) CreateLink(ctx context.Context, req LinkRequest) (*Connection, error) {
+	request := plaid.NewLinkTokenCreateRequest(p.clientName, p.language, p.countries, *plaid.NewLinkTokenCreateRequestUser(req.UserID.String()))
+	request.SetProducts([]plaid.Products{plaid.PRODUCTS_TRANSACTIONS})
+	if p.redirectURL != "" {
+		request.SetRedirectUri(p.redirectURL)
+	}
+
+	response, _, err := p.client.PlaidApi.LinkTokenCreate(ctx).LinkTokenCreateRequest(*request).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create link token: %w", plaidError(err))
+	}
+
+	id := uuid.New().String()
+	return &Connection{
+		ID:                 ProviderPlaid + "_" + id,
+		Status:             domain.RequisitionStatusCreated,
+		InstitutionID:      req.InstitutionID,
+		Reference:          fmt.Sprintf("%s_%s_%s", req.UserID, req.InstitutionID, id[:8]),
+		Link:               response.LinkToken,
+		LinkExpiresAt:      &response.Expiration,
+		MaxHistoricalDays:  req.MaxHistoricalDays,
+		AccessValidForDays: req.AccessValidForDays,
+	}, nil
+}
+
+// GetConnection exchanges the public token on the first call after Plaid Link
+// and returns the item's accounts. Items whose login must be renewed are
+// reported as expired so the user is asked to reconnect.
+func (p *Plaid) GetConnection(ctx context.Context, requisition *domain.Requisition, publicToken string) (*Connection, error) {
+	connection := &Connection{
+		ID:                 requisition.ID,
+		Status:             requisition.Status,
+		InstitutionID:      requisition.InstitutionID,
+		Reference:          requisition.Reference,
+		Link:               requisition.Link,
+		LinkExpiresAt:      requisition.LinkExpiresAt,
+		MaxHistoricalDays:  requisition.MaxHistoricalDays,
+		AccessValidForDays: requisition.AccessValidForDays,
+		AcceptedAt:         requisition.AgreementAcceptedAt,
+		AccessToken:        requisition.AccessToken,
+	}
+
+	if connection.AccessToken == "" {
+		if publicToken == "" {
+			return connection, nil
+		}
+
+		request := plaid.NewItemPublicTokenExchangeRequest(publicToken)
+		response, _, err := p.client.PlaidApi.ItemPublicTokenExchange(ctx).ItemPublicTokenExchangeRequest(*request).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to exchange public token: %w", plaidError(err))
+		}
+
+		now := time.Now()
+		connection.AccessToken = response.AccessToken
+		connection.AcceptedAt = &now
+	}
+
+	response, _, err := p.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*plaid.NewAccountsGetRequest(connection.AccessToken)).Execute()
+	if err != nil {
+		if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && plaidReauthErrorCodes[plaidErr.ErrorCode] {
+			connection.Status = domain.RequisitionStatusExpired
+			return connection, nil
+		}
+		return nil, fmt.Errorf("failed to get accounts: %w", plaidError(err))
+	}
+
+	connection.Status = domain.RequisitionStatusLinked
+	// European items carry a consent expiry, North American ones don't
+	connection.ExpiresAt = response.Item.ConsentExpirationTime.Get()
+	if institutionID := response.Item.InstitutionId.Get(); institutionID != nil && *institutionID != "" {
+		connection.InstitutionID = *institutionID
+	}
+	for _, account := range response.Accounts {
+		connection.Accounts = append(connection.Accounts, account.AccountId)
+	}
+
+	return connection, nil
+}
+
+func (p *Plaid) Unlink(ctx context.Context, requisition *domain.Requisition) error {
+	// Plaid Link was never finished, there is no item to remove
+	if requisition.AccessToken == "" {
+		return nil
+	}
+
+	_, _, err := p.client.PlaidApi.ItemRemove(ctx).ItemRemoveRequest(*plaid.NewItemRemoveRequest(requisition.AccessToken)).Execute()
+	if err != nil {
+		if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && plaidErr.ErrorCode == "ITEM_NOT_FOUND" {
+			return nil
+		}
+		return fmt.Errorf("failed to remove item: %w", plaidError(err))
+	}
+	return nil
+}
+
+func (p *Plaid) GetAccountDetails(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountDetails, error) {
+	request := plaid.NewAccountsGetRequest(requisition.AccessToken)
+	request.SetOptions(plaid.AccountsGetRequestOptions{AccountIds: &[]string{accountID}})
+
+	response, _, err := p.client.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*request).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account %s: %w", accountID, plaidError(err))
+	}
+	account, err := findPlaidAccount(response.Accounts, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &dto.AccountDetails{}
+	details.Account.ResourceID = account.AccountId
+	details.Account.Name = account.Name
+	if officialName := account.OfficialName.Get(); officialName != nil && *officialName != "" {
+		details.Account.Name = *officialName
+	}
+	details.Account.Product = string(account.Type)
+	if subtype := account.Subtype.Get(); subtype != nil {
+		details.Account.Product = string(*subtype)
+	}
+	details.Account.Currency = plaidCurrency(account.Balances.IsoCurrencyCode, account.Balances.UnofficialCurrencyCode)
+
+	// Account details don't carry the institution, look it up by the item's institution
+	if institution, err := p.GetInstitution(ctx, requisition.InstitutionID); err == nil {
+		details.Account.InstitutionName = institution.Name
+	}
+
+	return details, nil
+}
+
+func (p *Plaid) GetAccountBalances(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountBalances, error) {
+	request := plaid.NewAccountsBalanceGetRequest(requisition.AccessToken)
+	request.SetOptions(plaid.AccountsBalanceGetRequestOptions{AccountIds: &[]string{accountID}})
+
+	response, _, err := p.client.PlaidApi.AccountsBalanceGet(ctx).AccountsBalanceGetRequest(*request).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances of account %s: %w", accountID, plaidError(err))
+	}
+	account, err := findPlaidAccount(response.Accounts, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := plaidCurrency(account.Balances.IsoCurrencyCode, account.Balances.UnofficialCurrencyCode)
+	balances := &dto.AccountBalances{}
+	for balanceType, amount := range map[string]*float32{
+		BalanceTypeAvailable: account.Balances.Available.Get(),
+		BalanceTypeCurrent:   account.Balances.Current.Get(),
+	} {
+		if amount == nil {
+			continue
+		}
+		var balance dto.AccountBalance
+		balance.BalanceType = balanceType
+		balance.BalanceAmount.Amount = plaidAmount(*amount)
+		balance.BalanceAmount.Currency = currency
+		balances.Balances = append(balances.Balances, balance)
+	}
+
+	return balances, nil
+}
+
+// GetAccountTransactions fetches the transactions of the requested history.
+// Plaid reports outflows as positive amounts, they are negated to match
+// the sign convention of the other providers.
+func (p *Plaid) GetAccountTransactions(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountTransactions, error) {
+	historyDays := requisition.MaxHistoricalDays
+	if historyDays <= 0 {
+		historyDays = 730
+	}
+	end := time.Now()
+	start := end.AddDate(0, 0, -historyDays)
+
+	transactions := &dto.AccountTransactions{}
+	for offset := int32(0); ; {
+		count := int32(plaidPageSize)
+		request := plaid.NewTransactionsGetRequest(requisition.AccessToken, start.Format("2006-01-02"), end.Format("2006-01-02"))
+		request.SetOptions(plaid.TransactionsGetRequestOptions{
+			AccountIds: &[]string{accountID},
+			Count:      &count,
+			Offset:     &offset,
+		})
+
+		response, _, err := p.client.PlaidApi.TransactionsGet(ctx).TransactionsGetRequest(*request).Execute()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transactions of account %s: %w", accountID, plaidError(err))
+		}
+
+		for _, tx := range response.Transactions {
+			transaction := plaidTransaction(tx)
+			if tx.Pending {
+				transactions.Transactions.Pending = append(transactions.Transactions.Pending, transaction)
+			} else {
+				transactions.Transactions.Booked = append(transactions.Transactions.Booked, transaction)
+			}
+		}
+
+		offset += int32(len(response.Transactions))
+		if len(response.Transactions) == 0 || offset >= response.TotalTransactions {
+			break
+		}
+	}
+
+	return transactions, nil
+}
+
+// plaidInstitution maps a Plaid institution to the institution DTO. Plaid
+// returns logos inline, they are passed on as data URLs.
+func plaidInstitution(institution plaid.Institution) dto.Institution {
+	result := dto.Institution{
+		ID:       institution.InstitutionId,
+		Name:     institution.Name,
+		Provider: ProviderPlaid,
+		// Plaid provides up to two years of history for every institution
+		TransactionTotalDays: "730",
+	}
+	for _, country := range institution.CountryCodes {
+		result.Countries = append(result.Countries, string(country))
+	}
+	for _, product := range institution.Products {
+		result.SupportedFeatures = append(result.SupportedFeatures, string(product))
+	}
+	if logo := institution.Logo.Get(); logo != nil && *logo != "" {
+		result.Logo = "data:image/png;base64," + *logo
+	}
+	return result
+}
+
+// plaidTransaction maps a Plaid transaction to the transaction DTO
+func plaidTransaction(tx plaid.Transaction) dto.Transaction {
+	var transaction dto.Transaction
+	transaction.TransactionID = tx.TransactionId
+	transaction.BookingDate = tx.Date
+	if authorizedDate := tx.AuthorizedDate.Get(); authorizedDate != nil {
+		transaction.ValueDate = *authorizedDate
+	}
+	transaction.TransactionAmount.Amount = plaidAmount(-tx.Amount)
+	transaction.TransactionAmount.Currency = plaidCurrency(tx.IsoCurrencyCode, tx.UnofficialCurrencyCode)
+	transaction.RemittanceInformation = tx.Name
+	if merchant := tx.MerchantName.Get(); merchant != nil && *merchant != "" {
+		if tx.Amount > 0 {
+			transaction.CreditorName = *merchant
+		} else {
+			transaction.DebtorName = *merchant
+		}
+	}
+	if datetime := tx.Datetime.Get(); datetime != nil {
+		transaction.BookingDateTime = datetime.Format(time.RFC3339)
+	}
+	if code := tx.TransactionCode.Get(); code != nil {
+		transaction.ProprietaryBankTransactionCode = string(*code)
+	}
+	if raw, err := json.Marshal(tx); err == nil {
+		transaction.Raw = raw
+	}
+	return transaction
+}
+
+// plaidAmount formats an amount the way the other providers do
+func plaidAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', 2, 32)
+}
+
+// plaidCurrency returns the ISO currency code, or the unofficial one Plaid uses for e.g. cryptocurrencies
+func plaidCurrency(iso, unofficial plaid.NullableString) string {
+	if code := iso.Get(); code != nil {
+		return *code
+	}
+	if code := unofficial.Get(); code != nil {
+		return *code
+	}
+	return ""
+}
+
+// findPlaidAccount returns the account with the given ID from a Plaid response
+func findPlaidAccount(accounts []plaid.AccountBase, accountID string) (*plaid.AccountBase, error) {
+	for i := range accounts {
+		if accounts[i].AccountId == accountID {
+			return &accounts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("account %s not found in item: %w", accountID, ErrNotFound)
+}
+
+// Plaid error codes meaning the institution cannot be reached at the moment
+var plaidInstitutionDownErrorCodes = map[string]bool{
+	"INSTITUTION_DOWN":           true,
+	"INSTITUTION_NOT_RESPONDING": true,
+	"INSTITUTION_NOT_AVAILABLE":  true,
+}
+
+// plaidError translates Plaid rate limit errors, adds Plaid's error code to
+// other errors and classifies them with the provider errors
+func plaidError(err error) error {
+	plaidErr, convErr := plaid.ToPlaidError(err)
+	if convErr != nil {
+		return err
+	}
+	if plaidErr.ErrorType == "RATE_LIMIT_EXCEEDED" {
+		// Plaid does not say when its limits reset; they are per minute
+		return &RateLimitError{
+			Scope:   RateLimitScopeGeneral,
+			ResetAt: time.Now().Add(time.Minute),
+			Err:     errors.New(plaidErr.ErrorMessage),
+		}
+	}
+	err = fmt.Errorf("plaid error %s: %s: %w", plaidErr.ErrorCode, plaidErr.ErrorMessage, err)
+	switch {
+	case plaidReauthErrorCodes[plaidErr.ErrorCode]:
+		return fmt.Errorf("%w: %w", ErrConsentExpired, err)
+	case plaidInstitutionDownErrorCodes[plaidErr.ErrorCode]:
+		return fmt.Errorf("%w: %w", ErrInstitutionDown, err)
+	case plaidErr.ErrorCode == "INVALID_API_KEYS":
+		return fmt.Errorf("%w: %w", ErrProviderAuth, err)
+	case plaidErr.ErrorCode == "ITEM_NOT_FOUND" || plaidErr.ErrorCode == "INVALID_ACCOUNT_ID":
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+)
+
+// Provider names, stored on each requisition
+const (
+	ProviderGoCardless = "gocardless"
+	ProviderPlaid      = "plaid"
+)
+
+// Balance types used in dto.AccountBalances, following the Berlin Group naming
+const (
+	BalanceTypeAvailable = "interimAvailable"
+	BalanceTypeCurrent   = "interimBooked"
+)
+
+// Rate limit scopes
+const (
+	RateLimitScopeGeneral = "general"
+	RateLimitScopeAccount = "account"
+)
+
+// ErrInstitutionNotFound is returned when a provider does not know an institution
+var ErrInstitutionNotFound = errors.New("institution not found")
+
+// Errors classifying provider failures, matched with errors.Is. Rate limits are
+// reported with a RateLimitError instead.
+var (
+	// ErrProviderAuth means the provider rejected our credentials
+	ErrProviderAuth = errors.New("provider authentication failed")
+	// ErrNotFound means the provider does not know the requisition or account
+	ErrNotFound = errors.New("not found at provider")
+	// ErrConsentExpired means the user has to reconnect the bank
+	ErrConsentExpired = errors.New("consent expired")
+	// ErrAccountSuspended means the bank no longer gives access to the account
+	ErrAccountSuspended = errors.New("account suspended")
+	// ErrInstitutionDown means the bank cannot be reached at the moment
+	ErrInstitutionDown = errors.New("institution unavailable")
+)
+
+// RateLimitError is returned when a provider rejected a request because a rate
+// limit was reached. The account scope only applies to a single bank account.
+type RateLimitError struct {
+	Scope   string
+	ResetAt time.Time
+	Err     error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit reached (%s), resets at %s: %v", e.Scope, e.ResetAt.Format(time.RFC3339), e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns how long to wait before the limit resets
+func (e *RateLimitError) RetryAfter() time.Duration {
+	wait := time.Until(e.ResetAt)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// LinkRequest describes a new bank connection
+type LinkRequest struct {
+	UserID             uuid.UUID
+	InstitutionID      string
+	RedirectURL        string
+	MaxHistoricalDays  int
+	AccessValidForDays int
+}
+
+// Connection is the state of a bank connection at the provider
+type Connection struct {
+	ID            string
+	Status        domain.RequisitionStatus
+	InstitutionID string
+	Reference     string
+	// Link is where the user gives consent. For Plaid it is the link token the frontend opens Plaid Link with.
+	Link          string
+	LinkExpiresAt *time.Time
+
+	AgreementID        string
+	MaxHistoricalDays  int
+	AccessValidForDays int
+	AcceptedAt         *time.Time
+	ExpiresAt          *time.Time
+
+	// AccessToken is the secret giving access to the connection's data, for providers that use one
+	AccessToken string
+
+	// Accounts are the provider IDs of the connected bank accounts
+	Accounts []string
+}
+
+// Provider is a bank data aggregator. Providers translate their data to the
+// formats of the dto package so the service layer handles them all alike.
+type Provider interface {
+	// Name returns the provider name stored on requisitions
+	Name() string
+
+	GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error)
+	GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error)
+
+	// CreateLink starts a new bank connection
+	CreateLink(ctx context.Context, req LinkRequest) (*Connection, error)
+	// GetConnection returns the current state of a connection. publicToken is
+	// what the frontend received when the user finished the provider's link
+	// flow, for providers that hand one out; it is empty otherwise.
+	GetConnection(ctx context.Context, requisition *domain.Requisition, publicToken string) (*Connection, error)
+	// Unlink removes a connection at the provider. A connection that no longer exists is not an error.
+	Unlink(ctx context.Context, requisition *domain.Requisition) error
+
+	GetAccountDetails(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountDetails, error)
+	GetAccountBalances(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountBalances, error)
+	GetAccountTransactions(ctx context.Context, requisition *domain.Requisition, accountID string) (*dto.AccountTransactions, error)
+}
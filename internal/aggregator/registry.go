@@ -0,0 +1,68 @@
+package aggregator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Registry holds the configured providers and picks one for a country or requisition
+type Registry struct {
+	providers map[string]Provider
+	order     []Provider
+	countries map[string]Provider
+	fallback  Provider
+}
+
+// NewRegistry creates a registry. The fallback provider serves every country
+// that no other provider was registered for.
+func NewRegistry(fallback Provider) *Registry {
+	r := &Registry{
+		providers: make(map[string]Provider),
+		countries: make(map[string]Provider),
+		fallback:  fallback,
+	}
+	r.add(fallback)
+	return r
+}
+
+// Register adds a provider serving the given countries
+func (r *Registry) Register(provider Provider, countries []string) {
+	r.add(provider)
+	for _, country := range countries {
+		r.countries[strings.ToUpper(country)] = provider
+	}
+}
+
+func (r *Registry) add(provider Provider) {
+	if _, ok := r.providers[provider.Name()]; ok {
+		return
+	}
+	r.providers[provider.Name()] = provider
+	r.order = append(r.order, provider)
+}
+
+// Get returns a provider by name. Requisitions created before providers were
+// stored have no name and belong to the fallback provider.
+func (r *Registry) Get(name string) (Provider, error) {
+	if name == "" {
+		return r.fallback, nil
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bank data provider %q", name)
+	}
+	return provider, nil
+}
+
+// ForCountry returns the provider serving a country
+func (r *Registry) ForCountry(countryCode string) Provider {
+	if provider, ok := r.countries[strings.ToUpper(countryCode)]; ok {
+		return provider
+	}
+	return r.fallback
+}
+
+// All returns every registered provider, fallback first
+func (r *Registry) All() []Provider {
+	return append([]Provider(nil), r.order...)
+}
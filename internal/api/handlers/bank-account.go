@@ -1,22 +1,39 @@
 package handlers
 
 import (
+	"errors"
+	"time"
+
 	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 
+	"FinMa/dto"
+	"FinMa/internal/aggregator"
 	"FinMa/internal/domain"
+	"FinMa/internal/repository"
 	"FinMa/internal/service"
 )
 
+// defaultHistoryDays is the period balance history covers when no start date is given
+const defaultHistoryDays = 90
+
+// maxHistoryDays bounds the period of a balance history request
+const maxHistoryDays = 3 * 366
+
 // BankAccountHandler handles bank account related HTTP requests
 type BankAccountHandler struct {
 	bankAccountService service.BankAccountService
+	transactionService service.TransactionService
+	validator          service.ValidatorService
 }
 
 // NewBankAccountHandler creates a new bank account handler
-func NewBankAccountHandler(bankAccountService service.BankAccountService) *BankAccountHandler {
+func NewBankAccountHandler(bankAccountService service.BankAccountService, transactionService service.TransactionService, validator service.ValidatorService) *BankAccountHandler {
 	return &BankAccountHandler{
 		bankAccountService: bankAccountService,
+		transactionService: transactionService,
+		validator:          validator,
 	}
 }
 
@@ -40,4 +57,356 @@ func (h *BankAccountHandler) GetAccounts(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(accounts)
-}
\ No newline at end of file
+}
+
+// CreateAccount creates a manual account, e.g. for cash, a wallet or a bank no provider supports
+func (h *BankAccountHandler) CreateAccount(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	var req dto.CreateManualAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	account, err := h.bankAccountService.CreateManualAccount(c.Context(), user.ID, req)
+	if err != nil {
+		log.Error("Failed to create manual account", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create account",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
+// GetAccountDetails retrieves a bank account of the authenticated user
+func (h *BankAccountHandler) GetAccountDetails(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	account, err := h.bankAccountService.GetBankAccount(c.Context(), user.ID, accountID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		log.Error("Failed to get bank account", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve bank account",
+		})
+	}
+
+	return c.JSON(account)
+}
+
+// UpdateAccount renames a bank account, hides it from totals or changes its
+// display order. The balance can only be set on manual accounts.
+func (h *BankAccountHandler) UpdateAccount(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	var req dto.UpdateBankAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	account, err := h.bankAccountService.UpdateBankAccount(c.Context(), user.ID, accountID, req)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		if errors.Is(err, service.ErrNotManualAccount) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "The balance of an account synced from a bank cannot be changed",
+			})
+		}
+		log.Error("Failed to update bank account", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update bank account",
+		})
+	}
+
+	return c.JSON(account)
+}
+
+// DeleteAccount deletes a manual account with its transactions. Synced accounts
+// are removed by unlinking their bank connection.
+func (h *BankAccountHandler) DeleteAccount(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	if err := h.bankAccountService.DeleteManualAccount(c.Context(), user.ID, accountID); err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		if errors.Is(err, service.ErrNotManualAccount) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Accounts synced from a bank are removed by unlinking the bank connection",
+			})
+		}
+		log.Error("Failed to delete manual account", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete account",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetAccountBalances returns the balance breakdown of a bank account
+func (h *BankAccountHandler) GetAccountBalances(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	balances, err := h.bankAccountService.GetBankAccountBalances(c.Context(), user.ID, accountID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		log.Error("Failed to get bank account balances", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve balances",
+		})
+	}
+
+	return c.JSON(balances)
+}
+
+// GetAccountTransactions lists the transactions of a bank account, with the
+// filters, sorting and pagination of TransactionHandler.GetTransactions
+func (h *BankAccountHandler) GetAccountTransactions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	query, message := transactionQuery(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	query.BankAccountIDs = []uuid.UUID{accountID}
+
+	if _, err := h.bankAccountService.GetBankAccount(c.Context(), user.ID, accountID); err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		log.Error("Failed to get bank account", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve transactions",
+		})
+	}
+
+	transactions, err := h.transactionService.ListTransactions(c.Context(), user.ID, query)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		log.Error("Failed to list account transactions", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve transactions",
+		})
+	}
+
+	return c.JSON(transactions)
+}
+
+// GetBalanceHistory returns the balances of an account over time.
+// Query: ?from=YYYY-MM-DD&to=YYYY-MM-DD, the last 90 days by default.
+func (h *BankAccountHandler) GetBalanceHistory(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	accountID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid bank account ID",
+		})
+	}
+
+	from, to, message := historyRange(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	history, err := h.bankAccountService.GetBalanceHistory(c.Context(), user.ID, accountID, from, to)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		}
+		log.Error("Failed to get balance history", "error", err, "accountID", accountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve balance history",
+		})
+	}
+
+	return c.JSON(history)
+}
+
+// GetTotalBalanceHistory returns the total balance of all accounts over time, per currency.
+// Query: ?from=YYYY-MM-DD&to=YYYY-MM-DD&type=<balance type>, interimBooked by default.
+func (h *BankAccountHandler) GetTotalBalanceHistory(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	from, to, message := historyRange(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	balanceType := c.Query("type", aggregator.BalanceTypeCurrent)
+
+	history, err := h.bankAccountService.GetTotalBalanceHistory(c.Context(), user.ID, balanceType, from, to)
+	if err != nil {
+		log.Error("Failed to get total balance history", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve balance history",
+		})
+	}
+
+	return c.JSON(history)
+}
+
+// historyRange reads the from and to query parameters. It returns why they are invalid, empty if they are valid.
+func historyRange(c *fiber.Ctx) (time.Time, time.Time, string) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if parsed, message := dateQuery(c, "to"); message != "" {
+		return time.Time{}, time.Time{}, message
+	} else if parsed != nil {
+		to = *parsed
+	}
+
+	from := to.AddDate(0, 0, -defaultHistoryDays)
+	if parsed, message := dateQuery(c, "from"); message != "" {
+		return time.Time{}, time.Time{}, message
+	} else if parsed != nil {
+		from = *parsed
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, "from must not be after to"
+	}
+	if to.Sub(from) > maxHistoryDays*24*time.Hour {
+		return time.Time{}, time.Time{}, "the period cannot exceed three years"
+	}
+	return from, to, ""
+}
+
+// dateQuery reads a YYYY-MM-DD query parameter, nil when it is absent. It
+// returns why the parameter is invalid, empty if it is valid.
+func dateQuery(c *fiber.Ctx, key string) (*time.Time, string) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, ""
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, key + " must be a date formatted as YYYY-MM-DD"
+	}
+	return &parsed, ""
+}
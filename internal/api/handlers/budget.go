@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/internal/service"
+)
+
+// BudgetHandler handles the budget related HTTP requests
+type BudgetHandler struct {
+	budgetService service.BudgetService
+	validator     service.ValidatorService
+}
+
+// NewBudgetHandler creates a new budget handler
+func NewBudgetHandler(budgetService service.BudgetService, validator service.ValidatorService) *BudgetHandler {
+	return &BudgetHandler{
+		budgetService: budgetService,
+		validator:     validator,
+	}
+}
+
+// GetBudgets lists the budgets of the authenticated user with what was spent of each
+func (h *BudgetHandler) GetBudgets(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	budgets, err := h.budgetService.GetBudgets(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get budgets", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve budgets",
+		})
+	}
+
+	return c.JSON(budgets)
+}
+
+// CreateBudget adds a budget for a category of the authenticated user
+func (h *BudgetHandler) CreateBudget(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	req, message := h.budgetRequest(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	budget, err := h.budgetService.CreateBudget(c.Context(), user.ID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidBudget) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to create budget", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create budget",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(budget)
+}
+
+// UpdateBudget replaces a budget of the authenticated user
+func (h *BudgetHandler) UpdateBudget(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	budgetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid budget ID",
+		})
+	}
+
+	req, message := h.budgetRequest(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	budget, err := h.budgetService.UpdateBudget(c.Context(), user.ID, budgetID, req)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Budget not found",
+			})
+		}
+		if errors.Is(err, service.ErrInvalidBudget) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to update budget", "error", err, "budgetID", budgetID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update budget",
+		})
+	}
+
+	return c.JSON(budget)
+}
+
+// DeleteBudget deletes a budget of the authenticated user
+func (h *BudgetHandler) DeleteBudget(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	budgetID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid budget ID",
+		})
+	}
+
+	if err := h.budgetService.DeleteBudget(c.Context(), user.ID, budgetID); err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Budget not found",
+			})
+		}
+		log.Error("Failed to delete budget", "error", err, "budgetID", budgetID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete budget",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// budgetRequest reads and validates a budget from the request body. It returns
+// why the budget is invalid, empty if it is valid.
+func (h *BudgetHandler) budgetRequest(c *fiber.Ctx) (dto.BudgetRequest, string) {
+	var req dto.BudgetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return req, "Invalid request body"
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return req, err.Error()
+	}
+	return req, ""
+}
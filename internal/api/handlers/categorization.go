@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/internal/service"
+)
+
+// CategorizationHandler handles the categorization rule related HTTP requests
+type CategorizationHandler struct {
+	categorizationService service.CategorizationService
+	validator             service.ValidatorService
+}
+
+// NewCategorizationHandler creates a new categorization handler
+func NewCategorizationHandler(categorizationService service.CategorizationService, validator service.ValidatorService) *CategorizationHandler {
+	return &CategorizationHandler{
+		categorizationService: categorizationService,
+		validator:             validator,
+	}
+}
+
+// GetRules lists the categorization rules of the authenticated user, highest priority first
+func (h *CategorizationHandler) GetRules(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	rules, err := h.categorizationService.GetRules(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get category rules", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve category rules",
+		})
+	}
+
+	return c.JSON(rules)
+}
+
+// CreateRule adds a categorization rule, applied to transactions imported from now on
+func (h *CategorizationHandler) CreateRule(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	req, message := h.ruleRequest(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	rule, err := h.categorizationService.CreateRule(c.Context(), user.ID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCategoryRule) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to create category rule", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create category rule",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// UpdateRule replaces a categorization rule of the authenticated user
+func (h *CategorizationHandler) UpdateRule(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	ruleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category rule ID",
+		})
+	}
+
+	req, message := h.ruleRequest(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	rule, err := h.categorizationService.UpdateRule(c.Context(), user.ID, ruleID, req)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category rule not found",
+			})
+		}
+		if errors.Is(err, service.ErrInvalidCategoryRule) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to update category rule", "error", err, "ruleID", ruleID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update category rule",
+		})
+	}
+
+	return c.JSON(rule)
+}
+
+// DeleteRule deletes a categorization rule of the authenticated user. The
+// categories it assigned stay until the rules are applied again.
+func (h *CategorizationHandler) DeleteRule(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	ruleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid category rule ID",
+		})
+	}
+
+	if err := h.categorizationService.DeleteRule(c.Context(), user.ID, ruleID); err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Category rule not found",
+			})
+		}
+		log.Error("Failed to delete category rule", "error", err, "ruleID", ruleID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete category rule",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// PreviewRule shows which transactions a rule would categorize and how, without saving it
+func (h *CategorizationHandler) PreviewRule(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	req, message := h.ruleRequest(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	preview, err := h.categorizationService.PreviewRule(c.Context(), user.ID, req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCategoryRule) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to preview category rule", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to preview category rule",
+		})
+	}
+
+	return c.JSON(preview)
+}
+
+// ApplyRules applies the enabled rules of the authenticated user to all of their transactions
+func (h *CategorizationHandler) ApplyRules(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	updated, err := h.categorizationService.ApplyRules(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to apply category rules", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to apply category rules",
+		})
+	}
+
+	return c.JSON(dto.ApplyRulesResponse{Updated: updated})
+}
+
+// SetTransactionCategory assigns the category the authenticated user chose to one of their transactions
+func (h *CategorizationHandler) SetTransactionCategory(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	transactionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid transaction ID",
+		})
+	}
+
+	var req dto.SetCategoryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	transaction, err := h.categorizationService.SetTransactionCategory(c.Context(), user.ID, transactionID, req)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Transaction not found",
+			})
+		}
+		log.Error("Failed to set transaction category", "error", err, "transactionID", transactionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to set transaction category",
+		})
+	}
+
+	return c.JSON(transaction)
+}
+
+// GetCategorySuggestions lists the categories likeliest for a transaction of the
+// authenticated user, learned from the categories they assigned before
+func (h *CategorizationHandler) GetCategorySuggestions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	transactionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid transaction ID",
+		})
+	}
+
+	suggestions, err := h.categorizationService.SuggestCategories(c.Context(), user.ID, transactionID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Transaction not found",
+			})
+		}
+		log.Error("Failed to suggest categories", "error", err, "transactionID", transactionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to suggest categories",
+		})
+	}
+
+	return c.JSON(suggestions)
+}
+
+// ruleRequest reads and validates a rule from the request body. It returns why
+// the rule is invalid, empty if it is valid.
+func (h *CategorizationHandler) ruleRequest(c *fiber.Ctx) (dto.CategoryRuleRequest, string) {
+	var req dto.CategoryRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return req, "Invalid request body"
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return req, err.Error()
+	}
+	return req, ""
+}
@@ -1,28 +1,41 @@
 package handlers
 
 import (
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
 	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
 
 	"FinMa/config"
+	"FinMa/constants"
 	"FinMa/dto"
+	"FinMa/internal/aggregator"
 	"FinMa/internal/domain"
+	"FinMa/internal/repository"
 	"FinMa/internal/service"
 )
 
 // GclHandler handles gocardless-related HTTP requests
 type GclHandler struct {
-	goCardlessService service.GclService
-	cfg               *config.Config
-	validator         service.ValidatorService
+	goCardlessService  service.GclService
+	institutionService service.InstitutionService
+	syncService        service.SyncService
+	cfg                *config.Config
+	validator          service.ValidatorService
 }
 
 // NewGclHandler creates a new gocardless handler
-func NewGclHandler(goCardlessService service.GclService, validator service.ValidatorService, cfg *config.Config) *GclHandler {
+func NewGclHandler(goCardlessService service.GclService, institutionService service.InstitutionService, syncService service.SyncService, validator service.ValidatorService, cfg *config.Config) *GclHandler {
 	return &GclHandler{
-		goCardlessService: goCardlessService,
-		cfg:               cfg,
-		validator:         validator,
+		goCardlessService:  goCardlessService,
+		institutionService: institutionService,
+		syncService:        syncService,
+		cfg:                cfg,
+		validator:          validator,
 	}
 }
 
@@ -46,13 +59,17 @@ func (h *GclHandler) LinkAccount(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	// Call GoCardless service to create requisition
-	requisition, err := h.goCardlessService.LinkAccount(c.Context(), user.ID, req.InstitutionID, h.cfg.GoCardless.RedirectURL)
+	requisition, err := h.goCardlessService.LinkAccount(c.Context(), user.ID, req, h.cfg.GoCardless.RedirectURL)
 	if err != nil {
 		log.Error("Failed to create requisition", "error", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create requisition",
-		})
+		return providerFailure(c, err, "Failed to create requisition")
 	}
 
 	return c.JSON(requisition)
@@ -75,18 +92,79 @@ func (h *GclHandler) SyncRequisition(c *fiber.Ctx) error {
 		})
 	}
 
+	// Plaid connections are completed with the public token returned by Plaid Link
+	var req dto.SyncRequisitionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
 	// Call GoCardless service to update requisition
-	response, err := h.goCardlessService.SyncRequisition(c.Context(), requisitionReference, user.ID)
+	response, err := h.goCardlessService.SyncRequisition(c.Context(), requisitionReference, user.ID, req.PublicToken, nil)
 	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Requisition not found",
+			})
+		}
 		log.Error("Failed to sync requisition", "error", err, "requisitionReference", requisitionReference)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to sync requisition",
-		})
+		return providerFailure(c, err, "Failed to sync requisition")
 	}
 
 	return c.JSON(response)
 }
 
+// Callback is where GoCardless redirects the user after they gave, or refused,
+// consent at their bank. The session cookie is not sent on this cross-site
+// redirect; the single-use state the link was created with authenticates it.
+// The requisition is synced in the background and the user is sent to the
+// frontend with the sync job to poll.
+func (h *GclHandler) Callback(c *fiber.Ctx) error {
+	failureURL := h.cfg.GoCardless.LinkFailureURL
+
+	reference := c.Query("ref")
+	if reference == "" {
+		return redirectWithParams(c, failureURL, map[string]string{"error": "missing_reference"})
+	}
+	state := c.Query("state")
+	if state == "" {
+		return redirectWithParams(c, failureURL, map[string]string{"error": "invalid_state", "reference": reference})
+	}
+
+	// Even a refused consent is synced so the requisition gets its final status
+	job, err := h.syncService.StartCallbackSync(c.Context(), reference, state)
+	if err != nil {
+		params := map[string]string{"error": "sync_failed", "reference": reference}
+		if repository.IsNotFoundError(err) {
+			// Unknown, expired or already used; the frontend can still sync the
+			// requisition by its reference for the logged in user
+			params["error"] = "invalid_state"
+		} else {
+			log.Error("Failed to start requisition sync", "error", err, "requisitionReference", reference)
+		}
+		return redirectWithParams(c, failureURL, params)
+	}
+
+	params := map[string]string{
+		"job_id":    job.ID.String(),
+		"reference": reference,
+	}
+
+	// GoCardless reports why the user did not complete the flow, e.g. UserCancelledSession
+	if bankError := c.Query("error"); bankError != "" {
+		params["error"] = bankError
+		if details := c.Query("details"); details != "" {
+			params["details"] = details
+		}
+		return redirectWithParams(c, failureURL, params)
+	}
+
+	return redirectWithParams(c, h.cfg.GoCardless.LinkSuccessURL, params)
+}
+
 // GetInstitutions retrieves available financial institutions for a country
 func (h *GclHandler) GetInstitutions(c *fiber.Ctx) error {
 	// Get country code from URL params
@@ -104,13 +182,30 @@ func (h *GclHandler) GetInstitutions(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get institutions from GoCardless service
-	institutions, err := h.goCardlessService.GetInstitutions(c.Context(), countryCode)
+	// Optional filters: ?q=<name or BIC>&features=a,b&min_history_days=365
+	filter := dto.InstitutionFilter{
+		Query: c.Query("q"),
+	}
+	for _, feature := range strings.Split(c.Query("features"), ",") {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			filter.Features = append(filter.Features, feature)
+		}
+	}
+	if minHistoryDays := c.Query("min_history_days"); minHistoryDays != "" {
+		days, err := strconv.Atoi(minHistoryDays)
+		if err != nil || days < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "min_history_days must be a positive number",
+			})
+		}
+		filter.MinHistoryDays = days
+	}
+
+	// Get institutions from the cached catalogue
+	institutions, err := h.institutionService.GetInstitutions(c.Context(), countryCode, filter)
 	if err != nil {
 		log.Error("Failed to get institutions", "error", err, "countryCode", countryCode)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve institutions",
-		})
+		return providerFailure(c, err, "Failed to retrieve institutions")
 	}
 
 	return c.JSON(fiber.Map{
@@ -119,6 +214,209 @@ func (h *GclHandler) GetInstitutions(c *fiber.Ctx) error {
 	})
 }
 
+// GetInstitutionLogo serves an institution logo from the local cache
+func (h *GclHandler) GetInstitutionLogo(c *fiber.Ctx) error {
+	institutionID := c.Params("id")
+
+	data, contentType, err := h.institutionService.GetLogo(c.Context(), institutionID)
+	if err != nil {
+		if errors.Is(err, service.ErrInstitutionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Institution logo not found",
+			})
+		}
+		log.Error("Failed to get institution logo", "error", err, "institutionID", institutionID)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Failed to retrieve institution logo",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.Send(data)
+}
+
+// GetRequisitions lists the bank connections of the authenticated user
+func (h *GclHandler) GetRequisitions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	requisitions, err := h.goCardlessService.GetRequisitions(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get requisitions", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve requisitions",
+		})
+	}
+
+	return c.JSON(requisitions)
+}
+
+// GetRequisitionHistory lists the status changes of a bank connection of the authenticated user
+func (h *GclHandler) GetRequisitionHistory(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	requisitionID := c.Params("id")
+	history, err := h.goCardlessService.GetRequisitionHistory(c.Context(), user.ID, requisitionID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Requisition not found",
+			})
+		}
+		log.Error("Failed to get requisition history", "error", err, "requisitionID", requisitionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve requisition history",
+		})
+	}
+
+	return c.JSON(history)
+}
+
+// ReconnectRequisition creates a new requisition replacing an expired or expiring one
+func (h *GclHandler) ReconnectRequisition(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	requisitionID := c.Params("id")
+	if requisitionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Requisition ID is required",
+		})
+	}
+
+	response, err := h.goCardlessService.ReconnectRequisition(c.Context(), user.ID, requisitionID, h.cfg.GoCardless.RedirectURL)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Requisition not found",
+			})
+		}
+		log.Error("Failed to reconnect requisition", "error", err, "requisitionID", requisitionID)
+		return providerFailure(c, err, "Failed to reconnect requisition")
+	}
+
+	return c.JSON(response)
+}
+
+// UnlinkRequisition disconnects a bank. The mode query parameter decides whether
+// its accounts are archived (default) or purged with their transactions.
+func (h *GclHandler) UnlinkRequisition(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	requisitionID := c.Params("id")
+	if requisitionID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Requisition ID is required",
+		})
+	}
+
+	mode := c.Query("mode", constants.UNLINK_MODE_ARCHIVE)
+	if mode != constants.UNLINK_MODE_ARCHIVE && mode != constants.UNLINK_MODE_PURGE {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Mode must be 'archive' or 'purge'",
+		})
+	}
+
+	if err := h.goCardlessService.UnlinkRequisition(c.Context(), user.ID, requisitionID, mode); err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Requisition not found",
+			})
+		}
+		log.Error("Failed to unlink requisition", "error", err, "requisitionID", requisitionID)
+		return providerFailure(c, err, "Failed to unlink requisition")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// rateLimited tells the client to retry once the GoCardless rate limit resets
+func rateLimited(c *fiber.Ctx, err *aggregator.RateLimitError) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(err.RetryAfter().Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":    "Bank data provider rate limit reached, please retry later",
+		"code":     "rate_limited",
+		"retry_at": err.ResetAt,
+	})
+}
+
+// providerFailures maps the errors of bank data providers to a response. The
+// code lets the frontend tell them apart, e.g. to offer reconnecting the bank.
+var providerFailures = []struct {
+	err     error
+	status  int
+	code    string
+	message string
+}{
+	{aggregator.ErrConsentExpired, fiber.StatusConflict, "consent_expired", "Access to the bank has expired, please reconnect it"},
+	{aggregator.ErrAccountSuspended, fiber.StatusConflict, "account_suspended", "The bank has suspended access to this account"},
+	{aggregator.ErrInstitutionDown, fiber.StatusServiceUnavailable, "institution_unavailable", "The bank cannot be reached at the moment, please retry later"},
+	{aggregator.ErrNotFound, fiber.StatusNotFound, "not_found", "The bank data provider does not know this connection"},
+	{aggregator.ErrProviderAuth, fiber.StatusBadGateway, "provider_unavailable", "The bank data provider rejected the request, please retry later"},
+}
+
+// providerFailure responds to a failed call to a bank data provider with the
+// status matching the error, or 500 with message for unexpected errors
+func providerFailure(c *fiber.Ctx, err error, message string) error {
+	var rateLimitErr *aggregator.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimited(c, rateLimitErr)
+	}
+	for _, failure := range providerFailures {
+		if errors.Is(err, failure.err) {
+			return c.Status(failure.status).JSON(fiber.Map{
+				"error": failure.message,
+				"code":  failure.code,
+			})
+		}
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// redirectWithParams redirects to a URL with extra query parameters
+func redirectWithParams(c *fiber.Ctx, target string, params map[string]string) error {
+	redirectURL, err := url.Parse(target)
+	if err != nil {
+		log.Error("Invalid redirect URL", "error", err, "url", target)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Invalid redirect URL",
+		})
+	}
+
+	query := redirectURL.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	return c.Redirect(redirectURL.String(), fiber.StatusFound)
+}
+
 func (h *GclHandler) GetTokenStatus(c *fiber.Ctx) error {
 	status := h.goCardlessService.GetTokenStatus()
 	return c.JSON(status)
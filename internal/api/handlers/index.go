@@ -1,8 +1,14 @@
 package handlers
 
 type Handlers struct {
-	Auth        AuthHandler
-	User        UserHandler
-	GoCardless  GclHandler
-	BankAccount BankAccountHandler
+	Auth           AuthHandler
+	User           UserHandler
+	GoCardless     GclHandler
+	BankAccount    BankAccountHandler
+	Notification   NotificationHandler
+	Sync           SyncHandler
+	Transaction    TransactionHandler
+	Categorization CategorizationHandler
+	Recurring      RecurringHandler
+	Budget         BudgetHandler
 }
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/internal/service"
+)
+
+// NotificationHandler handles notification related HTTP requests
+type NotificationHandler struct {
+	notificationService service.NotificationService
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(notificationService service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notificationService: notificationService,
+	}
+}
+
+// GetNotifications retrieves the active notifications of the authenticated user
+func (h *NotificationHandler) GetNotifications(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	notifications, err := h.notificationService.GetNotifications(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get notifications", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve notifications",
+		})
+	}
+
+	return c.JSON(notifications)
+}
+
+// DismissNotification dismisses a notification of the authenticated user
+func (h *NotificationHandler) DismissNotification(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	notificationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid notification ID",
+		})
+	}
+
+	if err := h.notificationService.DismissNotification(c.Context(), user.ID, notificationID); err != nil {
+		if repository.IsNotFoundError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Notification not found",
+			})
+		}
+		log.Error("Failed to dismiss notification", "error", err, "notificationID", notificationID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to dismiss notification",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notification dismissed",
+	})
+}
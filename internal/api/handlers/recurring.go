@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/service"
+)
+
+// RecurringHandler handles the recurring transaction related HTTP requests
+type RecurringHandler struct {
+	recurringService service.RecurringService
+}
+
+// NewRecurringHandler creates a new recurring transaction handler
+func NewRecurringHandler(recurringService service.RecurringService) *RecurringHandler {
+	return &RecurringHandler{
+		recurringService: recurringService,
+	}
+}
+
+// GetRecurring lists the recurring series of the authenticated user, payments and income alike
+func (h *RecurringHandler) GetRecurring(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	series, err := h.recurringService.GetRecurring(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get recurring series", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve recurring transactions",
+		})
+	}
+
+	return c.JSON(series)
+}
+
+// DetectRecurring searches the transactions of the authenticated user for
+// recurring series again, e.g. after entering manual transactions
+func (h *RecurringHandler) DetectRecurring(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	count, err := h.recurringService.DetectRecurring(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to detect recurring series", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to detect recurring transactions",
+		})
+	}
+
+	return c.JSON(dto.DetectRecurringResponse{Series: count})
+}
+
+// GetSubscriptions lists the recurring payments of the authenticated user
+// with their monthly cost, price increases and missed charges
+func (h *RecurringHandler) GetSubscriptions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	subscriptions, err := h.recurringService.GetSubscriptions(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to get subscriptions", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve subscriptions",
+		})
+	}
+
+	return c.JSON(subscriptions)
+}
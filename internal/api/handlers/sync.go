@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/internal/service"
+)
+
+const (
+	// syncStreamInterval is how often a streamed sync job is checked for changes
+	syncStreamInterval = time.Second
+	// syncStreamKeepAlive is how often a comment is sent while a streamed job does not change,
+	// so proxies keep the connection open
+	syncStreamKeepAlive = 15 * time.Second
+	// syncStreamTimeout bounds how long a sync job is streamed
+	syncStreamTimeout = 15 * time.Minute
+)
+
+// SyncHandler handles HTTP requests about background syncs
+type SyncHandler struct {
+	syncService service.SyncService
+	validator   service.ValidatorService
+}
+
+// NewSyncHandler creates a new sync handler
+func NewSyncHandler(syncService service.SyncService, validator service.ValidatorService) *SyncHandler {
+	return &SyncHandler{
+		syncService: syncService,
+		validator:   validator,
+	}
+}
+
+// StartSync starts a background sync of a bank connection of the authenticated user.
+// The returned job is polled, or streamed, for the outcome.
+func (h *SyncHandler) StartSync(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	var req dto.StartSyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	job, err := h.syncService.StartRequisitionSync(c.Context(), user.ID, req.Reference, req.PublicToken)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Requisition not found",
+			})
+		}
+		log.Error("Failed to start requisition sync", "error", err, "requisitionReference", req.Reference)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start sync",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(syncJobResponse(job))
+}
+
+// GetSyncJob returns the status of a sync job of the authenticated user
+func (h *SyncHandler) GetSyncJob(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sync job ID",
+		})
+	}
+
+	job, err := h.syncService.GetJob(c.Context(), user.ID, jobID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Sync job not found",
+			})
+		}
+		log.Error("Failed to get sync job", "error", err, "jobID", jobID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve sync job",
+		})
+	}
+
+	return c.JSON(syncJobResponse(job))
+}
+
+// StreamSyncJob streams the status of a sync job of the authenticated user as
+// server-sent events. A "status" event is sent whenever the job changes; the
+// stream ends after the event of the finished job.
+func (h *SyncHandler) StreamSyncJob(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sync job ID",
+		})
+	}
+
+	// Check the job before the response is committed to a stream
+	job, err := h.syncService.GetJob(c.Context(), user.ID, jobID)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Sync job not found",
+			})
+		}
+		log.Error("Failed to get sync job", "error", err, "jobID", jobID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve sync job",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The writer runs after the handler returned, it must not use c
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), syncStreamTimeout)
+		defer cancel()
+
+		ticker := time.NewTicker(syncStreamInterval)
+		defer ticker.Stop()
+
+		var last []byte
+		lastWrite := time.Now()
+		for {
+			event, err := json.Marshal(syncJobResponse(job))
+			if err != nil {
+				log.Error("Failed to encode sync job", "error", err, "jobID", jobID)
+				return
+			}
+
+			if string(event) != string(last) {
+				fmt.Fprintf(w, "event: status\ndata: %s\n\n", event)
+				last = event
+				lastWrite = time.Now()
+			} else if time.Since(lastWrite) >= syncStreamKeepAlive {
+				fmt.Fprint(w, ": keep-alive\n\n")
+				lastWrite = time.Now()
+			}
+			// Flushing fails once the client disconnected
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			if syncJobFinished(job) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			job, err = h.syncService.GetJob(ctx, user.ID, jobID)
+			if err != nil {
+				log.Error("Failed to get sync job", "error", err, "jobID", jobID)
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// syncJobFinished reports whether a sync job reached its final status
+func syncJobFinished(job *domain.SyncJob) bool {
+	return job.Status != constants.SYNC_JOB_STATUS_QUEUED && job.Status != constants.SYNC_JOB_STATUS_RUNNING
+}
+
+func syncJobResponse(job *domain.SyncJob) dto.SyncJobResponse {
+	accounts := make([]dto.AccountSyncResult, 0, len(job.Accounts))
+	for _, account := range job.Accounts {
+		accounts = append(accounts, dto.AccountSyncResult{
+			AccountID:     account.AccountID,
+			BankAccountID: account.BankAccountID,
+			Status:        account.Status,
+			Error:         account.Error,
+			RetryAt:       account.RetryAt,
+		})
+	}
+
+	return dto.SyncJobResponse{
+		ID:                job.ID.String(),
+		Status:            job.Status,
+		RequisitionID:     job.RequisitionID,
+		Error:             job.Error,
+		TotalAccounts:     job.TotalAccounts,
+		CompletedAccounts: job.CompletedAccounts,
+		Accounts:          accounts,
+		StartedAt:         job.StartedAt,
+		FinishedAt:        job.FinishedAt,
+		CreatedAt:         job.CreatedAt,
+	}
+}
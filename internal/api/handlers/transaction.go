@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/internal/service"
+)
+
+// TransactionHandler handles transaction related HTTP requests
+type TransactionHandler struct {
+	transactionService service.TransactionService
+	validator          service.ValidatorService
+}
+
+// NewTransactionHandler creates a new transaction handler
+func NewTransactionHandler(transactionService service.TransactionService, validator service.ValidatorService) *TransactionHandler {
+	return &TransactionHandler{
+		transactionService: transactionService,
+		validator:          validator,
+	}
+}
+
+// GetTransactions lists the transactions of the authenticated user, newest first by default.
+// Query: ?account_ids=<id>,<id>&from=YYYY-MM-DD&to=YYYY-MM-DD&min_amount=&max_amount=
+// &category=&type=&status=&q=<text>&sort=date_desc|date_asc|amount_desc|amount_asc&limit=&cursor=
+func (h *TransactionHandler) GetTransactions(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	query, message := transactionQuery(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	transactions, err := h.transactionService.ListTransactions(c.Context(), user.ID, query)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		log.Error("Failed to list transactions", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve transactions",
+		})
+	}
+
+	return c.JSON(transactions)
+}
+
+// CreateTransaction adds a transaction to a manual account of the authenticated user
+func (h *TransactionHandler) CreateTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	var req dto.CreateTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	transaction, err := h.transactionService.CreateTransaction(c.Context(), user.ID, req)
+	if err != nil {
+		switch {
+		case repository.IsNotFoundError(err) || repository.IsAuthorizationError(err):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Bank account not found",
+			})
+		case errors.Is(err, service.ErrNotManualAccount):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Transactions can only be added to manual accounts",
+			})
+		case repository.IsValidationError(err):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid transaction",
+			})
+		}
+		log.Error("Failed to create transaction", "error", err, "accountID", req.BankAccountID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create transaction",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(transaction)
+}
+
+// UpdateTransaction changes a manual transaction of the authenticated user
+func (h *TransactionHandler) UpdateTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	transactionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid transaction ID",
+		})
+	}
+
+	var req dto.UpdateTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	transaction, err := h.transactionService.UpdateTransaction(c.Context(), user.ID, transactionID, req)
+	if err != nil {
+		if message, status := manualTransactionFailure(err); status != 0 {
+			return c.Status(status).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+		log.Error("Failed to update transaction", "error", err, "transactionID", transactionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update transaction",
+		})
+	}
+
+	return c.JSON(transaction)
+}
+
+// DeleteTransaction deletes a manual transaction of the authenticated user
+func (h *TransactionHandler) DeleteTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	transactionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid transaction ID",
+		})
+	}
+
+	if err := h.transactionService.DeleteTransaction(c.Context(), user.ID, transactionID); err != nil {
+		if message, status := manualTransactionFailure(err); status != 0 {
+			return c.Status(status).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+		log.Error("Failed to delete transaction", "error", err, "transactionID", transactionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete transaction",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// SplitTransaction replaces the splits of a transaction of the authenticated user
+func (h *TransactionHandler) SplitTransaction(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	transactionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid transaction ID",
+		})
+	}
+
+	var req dto.SplitTransactionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if err := h.validator.Validate(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	transaction, err := h.transactionService.SplitTransaction(c.Context(), user.ID, transactionID, req)
+	if err != nil {
+		if repository.IsNotFoundError(err) || repository.IsAuthorizationError(err) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Transaction not found",
+			})
+		}
+		if errors.Is(err, service.ErrInvalidSplits) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Error("Failed to split transaction", "error", err, "transactionID", transactionID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to split transaction",
+		})
+	}
+
+	return c.JSON(transaction)
+}
+
+// GetCategorySummary sums the income and expenses of the authenticated user by
+// category between the from and to query parameters
+func (h *TransactionHandler) GetCategorySummary(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	from, to, message := historyRange(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	summary, err := h.transactionService.GetCategorySummary(c.Context(), user.ID, from, to)
+	if err != nil {
+		log.Error("Failed to get category summary", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve category summary",
+		})
+	}
+
+	return c.JSON(summary)
+}
+
+// DetectTransfers links the transactions moving money between accounts of the
+// authenticated user, e.g. after entering manual transactions
+func (h *TransactionHandler) DetectTransfers(c *fiber.Ctx) error {
+	user, ok := c.Locals("user").(domain.User)
+	if !ok {
+		log.Error("Failed to get user ID from context")
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Not authenticated",
+		})
+	}
+
+	linked, err := h.transactionService.DetectTransfers(c.Context(), user.ID)
+	if err != nil {
+		log.Error("Failed to detect transfers", "error", err, "userID", user.ID)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to detect transfers",
+		})
+	}
+
+	return c.JSON(dto.DetectTransfersResponse{Linked: linked})
+}
+
+// manualTransactionFailure maps why a manual transaction could not be changed
+// to a message and status, a zero status for unexpected errors
+func manualTransactionFailure(err error) (string, int) {
+	switch {
+	case repository.IsNotFoundError(err) || repository.IsAuthorizationError(err):
+		return "Transaction not found", fiber.StatusNotFound
+	case errors.Is(err, service.ErrNotManualTransaction):
+		return "Transactions synced from a bank cannot be changed", fiber.StatusConflict
+	case repository.IsValidationError(err):
+		return "Invalid transaction", fiber.StatusBadRequest
+	}
+	return "", 0
+}
+
+// transactionQuery reads the filters of a transaction listing. It returns why
+// they are invalid, empty if they are valid.
+func transactionQuery(c *fiber.Ctx) (dto.TransactionQuery, string) {
+	query := dto.TransactionQuery{
+		Category: c.Query("category"),
+		Type:     c.Query("type"),
+		Status:   c.Query("status"),
+		Search:   strings.TrimSpace(c.Query("q")),
+		Sort:     c.Query("sort", constants.TRANSACTION_SORT_DATE_DESC),
+		Cursor:   c.Query("cursor"),
+	}
+
+	for _, value := range strings.Split(c.Query("account_ids"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return query, "Invalid account ID: " + value
+		}
+		query.BankAccountIDs = append(query.BankAccountIDs, id)
+	}
+
+	var message string
+	if query.From, message = dateQuery(c, "from"); message != "" {
+		return query, message
+	}
+	if query.To, message = dateQuery(c, "to"); message != "" {
+		return query, message
+	}
+	if query.From != nil && query.To != nil && query.From.After(*query.To) {
+		return query, "from must not be after to"
+	}
+
+	if query.MinAmount, message = amountQuery(c, "min_amount"); message != "" {
+		return query, message
+	}
+	if query.MaxAmount, message = amountQuery(c, "max_amount"); message != "" {
+		return query, message
+	}
+	if query.MinAmount != nil && query.MaxAmount != nil && *query.MinAmount > *query.MaxAmount {
+		return query, "min_amount must not be greater than max_amount"
+	}
+
+	if query.Type != "" && !slices.Contains(constants.GetTransactionTypes(), query.Type) {
+		return query, "type must be one of " + strings.Join(constants.GetTransactionTypes(), ", ")
+	}
+	if query.Status != "" && !slices.Contains(constants.GetTransactionStatuses(), query.Status) {
+		return query, "status must be one of " + strings.Join(constants.GetTransactionStatuses(), ", ")
+	}
+	if !slices.Contains(constants.TRANSACTION_SORTS, query.Sort) {
+		return query, "sort must be one of " + strings.Join(constants.TRANSACTION_SORTS, ", ")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, "limit must be a positive number"
+		}
+		query.Limit = limit
+	}
+
+	return query, ""
+}
+
+// amountQuery reads a decimal query parameter, nil when it is absent. It
+// returns why the parameter is invalid, empty if it is valid.
+func amountQuery(c *fiber.Ctx, key string) (*float64, string) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, ""
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, key + " must be a number"
+	}
+	return &amount, ""
+}
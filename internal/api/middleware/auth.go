@@ -11,43 +11,49 @@ import (
 // AuthMiddleware creates middleware for authentication validation
 func AuthMiddleware(authService service.AuthService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get the access token from cookies or Authorization header
-		var accessToken string
-
-		// Try cookie first
-		accessToken = c.Cookies("access_token")
-
-		// If not in cookie, try Authorization header
-		if accessToken == "" {
-			authHeader := c.Get("Authorization")
-			if authHeader == "" {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Missing authentication token",
-				})
-			}
-
-			// Check for Bearer token format
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error": "Invalid authorization format",
-				})
-			}
-
-			accessToken = parts[1]
-		}
-
-		// Verify the token
-		user, err := authService.GetUserByAccessToken(c.Context(), accessToken)
-		if err != nil {
+		if message := authenticate(c, authService); message != "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
+				"error": message,
 			})
 		}
 
-		// Add user to context
-		c.Locals("user", user)
-
 		return c.Next()
 	}
 }
+
+// authenticate verifies the access token of the request and adds the user to
+// the context. It returns why authentication failed, empty on success.
+func authenticate(c *fiber.Ctx, authService service.AuthService) string {
+	// Get the access token from cookies or Authorization header
+	var accessToken string
+
+	// Try cookie first
+	accessToken = c.Cookies("access_token")
+
+	// If not in cookie, try Authorization header
+	if accessToken == "" {
+		authHeader := c.Get("Authorization")
+		if authHeader == "" {
+			return "Missing authentication token"
+		}
+
+		// Check for Bearer token format
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return "Invalid authorization format"
+		}
+
+		accessToken = parts[1]
+	}
+
+	// Verify the token
+	user, err := authService.GetUserByAccessToken(c.Context(), accessToken)
+	if err != nil {
+		return "Invalid or expired token"
+	}
+
+	// Add user to context
+	c.Locals("user", user)
+
+	return ""
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"FinMa/config"
 	"FinMa/internal/api/handlers"
 	"FinMa/internal/api/middleware"
 	"FinMa/internal/service"
@@ -9,7 +10,7 @@ import (
 )
 
 // SetupRoutes configures all the routes for the application
-func SetupRoutes(app *fiber.App, services *service.Services, handlers *handlers.Handlers) {
+func SetupRoutes(app *fiber.App, cfg *config.Config, services *service.Services, handlers *handlers.Handlers) {
 	// API group
 	api := app.Group("/api")
 
@@ -20,6 +21,10 @@ func SetupRoutes(app *fiber.App, services *service.Services, handlers *handlers.
 	auth.Post("/refresh", handlers.Auth.Refresh)
 	auth.Post("/logout", handlers.Auth.Logout)
 
+	// Banks redirect the browser here after consent, authenticated by the state of the link
+	// rather than the session cookie. Registered before the protected group.
+	api.Get("/gocardless/callback", handlers.GoCardless.Callback)
+
 	// Protected routes
 	protected := api.Group("", middleware.AuthMiddleware(services.Auth))
 	protected.Get("/me", handlers.Auth.Me)
@@ -31,17 +36,72 @@ func SetupRoutes(app *fiber.App, services *service.Services, handlers *handlers.
 	// GoCardless routes
 	gocardless := protected.Group("/gocardless")
 	gocardless.Get("/institutions/:country_code", handlers.GoCardless.GetInstitutions)
+	gocardless.Get("/institutions/:id/logo", handlers.GoCardless.GetInstitutionLogo)
 	gocardless.Post("/link", handlers.GoCardless.LinkAccount)
+	gocardless.Get("/requisitions", handlers.GoCardless.GetRequisitions)
 	gocardless.Patch("/requisitions/:id", handlers.GoCardless.SyncRequisition)
+	gocardless.Get("/requisitions/:id/history", handlers.GoCardless.GetRequisitionHistory)
+	gocardless.Post("/requisitions/:id/reconnect", handlers.GoCardless.ReconnectRequisition)
+	gocardless.Delete("/requisitions/:id", handlers.GoCardless.UnlinkRequisition)
 	gocardless.Get("/token/status", handlers.GoCardless.GetTokenStatus)
 
+	// Sync job routes
+	syncJobs := protected.Group("/sync-jobs")
+	syncJobs.Post("/", handlers.Sync.StartSync)
+	syncJobs.Get("/:id", handlers.Sync.GetSyncJob)
+	syncJobs.Get("/:id/events", handlers.Sync.StreamSyncJob)
+
 	// Bank Account routes
 	bankAccounts := protected.Group("/bank-accounts")
 	bankAccounts.Get("/", handlers.BankAccount.GetAccounts)
 
+	// Transaction routes
+	transactions := protected.Group("/transactions")
+	transactions.Get("/", handlers.Transaction.GetTransactions)
+	transactions.Post("/", handlers.Transaction.CreateTransaction)
+	transactions.Get("/summary", handlers.Transaction.GetCategorySummary)
+	transactions.Post("/transfers/detect", handlers.Transaction.DetectTransfers)
+	transactions.Patch("/:id", handlers.Transaction.UpdateTransaction)
+	transactions.Delete("/:id", handlers.Transaction.DeleteTransaction)
+	transactions.Put("/:id/splits", handlers.Transaction.SplitTransaction)
+	transactions.Put("/:id/category", handlers.Categorization.SetTransactionCategory)
+	transactions.Get("/:id/category-suggestions", handlers.Categorization.GetCategorySuggestions)
+
+	// Categorization rule routes
+	categoryRules := protected.Group("/category-rules")
+	categoryRules.Get("/", handlers.Categorization.GetRules)
+	categoryRules.Post("/", handlers.Categorization.CreateRule)
+	categoryRules.Post("/preview", handlers.Categorization.PreviewRule)
+	categoryRules.Post("/apply", handlers.Categorization.ApplyRules)
+	categoryRules.Put("/:id", handlers.Categorization.UpdateRule)
+	categoryRules.Delete("/:id", handlers.Categorization.DeleteRule)
+
+	// Recurring transaction routes
+	recurring := protected.Group("/recurring")
+	recurring.Get("/", handlers.Recurring.GetRecurring)
+	recurring.Post("/detect", handlers.Recurring.DetectRecurring)
+	recurring.Get("/subscriptions", handlers.Recurring.GetSubscriptions)
+
+	// Budget routes
+	budgets := protected.Group("/budgets")
+	budgets.Get("/", handlers.Budget.GetBudgets)
+	budgets.Post("/", handlers.Budget.CreateBudget)
+	budgets.Put("/:id", handlers.Budget.UpdateBudget)
+	budgets.Delete("/:id", handlers.Budget.DeleteBudget)
+
+	// Notification routes
+	notifications := protected.Group("/notifications")
+	notifications.Get("/", handlers.Notification.GetNotifications)
+	notifications.Patch("/:id/dismiss", handlers.Notification.DismissNotification)
+
 	accounts := protected.Group("/accounts")
 	accounts.Get("/", handlers.BankAccount.GetAccounts)
-	// accounts.Get("/:id", handlers.BankAccount.GetAccountDetails)
-	// accounts.Get("/:id/balances", handlers.BankAccount.GetAccountBalances)
-	// accounts.Get("/:id/transactions", handlers.BankAccount.GetAccountTransactions)
+	accounts.Post("/", handlers.BankAccount.CreateAccount)
+	accounts.Get("/balances/history", handlers.BankAccount.GetTotalBalanceHistory)
+	accounts.Get("/:id", handlers.BankAccount.GetAccountDetails)
+	accounts.Patch("/:id", handlers.BankAccount.UpdateAccount)
+	accounts.Delete("/:id", handlers.BankAccount.DeleteAccount)
+	accounts.Get("/:id/balances", handlers.BankAccount.GetAccountBalances)
+	accounts.Get("/:id/balances/history", handlers.BankAccount.GetBalanceHistory)
+	accounts.Get("/:id/transactions", handlers.BankAccount.GetAccountTransactions)
 }
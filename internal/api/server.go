@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,10 +15,12 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 
 	"FinMa/config"
+	"FinMa/internal/aggregator"
 	"FinMa/internal/api/handlers"
 	"FinMa/internal/repository/postgres"
 	"FinMa/internal/service"
 	"FinMa/pkg/gocardless"
+	"FinMa/utils"
 )
 
 // Server represents the API server
@@ -48,12 +51,51 @@ func NewServer(config *config.Config, db *postgres.DB) *Server {
 
 	// Create Gocardless client
 	gocardlessClient := gocardless.NewClient(config.GoCardless.ClientID, config.GoCardless.Secret)
+	if config.GoCardless.BaseURL != "" {
+		gocardlessClient.BaseURL = strings.TrimSuffix(config.GoCardless.BaseURL, "/")
+	}
+
+	// Provider tokens are encrypted at rest with this key
+	var tokenKey []byte
+	if config.TokenEncryptionKey != "" {
+		var err error
+		if tokenKey, err = utils.ParseEncryptionKey(config.TokenEncryptionKey); err != nil {
+			log.Fatal("Invalid TOKEN_ENCRYPTION_KEY", "error", err)
+		}
+	}
+
+	// Bank data providers: GoCardless covers every country Plaid is not configured for.
+	// Plaid access tokens are long-lived credentials, never stored unencrypted.
+	providers := aggregator.NewRegistry(aggregator.NewGoCardless(gocardlessClient, config.GoCardless.AccessScope))
+	if config.Plaid.ClientID != "" {
+		if tokenKey != nil {
+			providers.Register(aggregator.NewPlaid(config.Plaid), config.Plaid.Countries)
+		} else {
+			log.Warn("TOKEN_ENCRYPTION_KEY is not set, Plaid is disabled")
+		}
+	}
 
 	// Create repositories
 	userRepo := postgres.NewUserRepository(db.DB)
 	bankAccountRepo := postgres.NewBankAccountRepository(db.DB)
-	requisitionRepo := postgres.NewRequisitionRepository(db.DB)
+	requisitionRepo := postgres.NewRequisitionRepository(db.DB, tokenKey)
 	transactionRepo := postgres.NewTransactionRepository(db.DB)
+	notificationRepo := postgres.NewNotificationRepository(db.DB)
+	syncJobRepo := postgres.NewSyncJobRepository(db.DB)
+	balanceSnapshotRepo := postgres.NewBalanceSnapshotRepository(db.DB)
+	categoryRuleRepo := postgres.NewCategoryRuleRepository(db.DB)
+	recurringSeriesRepo := postgres.NewRecurringSeriesRepository(db.DB)
+	budgetRepo := postgres.NewBudgetRepository(db.DB)
+
+	// Persist the GoCardless tokens so restarts and other instances reuse them
+	if tokenKey != nil {
+		gocardlessClient.Store = service.NewGclTokenStore(postgres.NewTokenRepository(db.DB, tokenKey))
+		if err := gocardlessClient.LoadTokens(context.Background()); err != nil {
+			log.Warn("Failed to load stored GoCardless tokens", "error", err)
+		}
+	} else {
+		log.Warn("TOKEN_ENCRYPTION_KEY is not set, GoCardless tokens are not persisted")
+	}
 
 	// Create validator service
 	validatorService := service.NewValidatorService()
@@ -61,32 +103,72 @@ func NewServer(config *config.Config, db *postgres.DB) *Server {
 	// Create services
 	authService := service.NewAuthService(userRepo, config)
 	userService := service.NewUserService(userRepo)
-	bankAccountService := service.NewBankAccountService(bankAccountRepo)
-	gclService := service.NewGclService(bankAccountRepo, userRepo, requisitionRepo, transactionRepo, gocardlessClient)
+	bankAccountService := service.NewBankAccountService(bankAccountRepo, transactionRepo, balanceSnapshotRepo)
+	categorizationService := service.NewCategorizationService(categoryRuleRepo, transactionRepo, bankAccountRepo, config)
+	transactionService := service.NewTransactionService(transactionRepo, bankAccountRepo, balanceSnapshotRepo, categorizationService, config)
+	recurringService := service.NewRecurringService(recurringSeriesRepo, transactionRepo, config)
+	budgetService := service.NewBudgetService(budgetRepo, transactionRepo)
+	notificationService := service.NewNotificationService(notificationRepo)
+	institutionService := service.NewInstitutionService(providers, config)
+	gclService := service.NewGclService(bankAccountRepo, userRepo, requisitionRepo, transactionRepo, notificationRepo, balanceSnapshotRepo, providers, gocardlessClient, categorizationService, transactionService, recurringService, config)
+	syncService := service.NewSyncService(gclService, requisitionRepo, syncJobRepo)
 
 	// Create services container
 	services := &service.Services{
-		Auth:        authService,
-		User:        userService,
-		GoCardless:  gclService,
-		BankAccount: bankAccountService,
-		Validator:   validatorService,
+		Auth:           authService,
+		User:           userService,
+		GoCardless:     gclService,
+		Institution:    institutionService,
+		Sync:           syncService,
+		BankAccount:    bankAccountService,
+		Transaction:    transactionService,
+		Categorization: categorizationService,
+		Recurring:      recurringService,
+		Budget:         budgetService,
+		Notification:   notificationService,
+		Validator:      validatorService,
 	}
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService, validatorService)
 	userHandler := handlers.NewUserHandler(userService, validatorService)
-	gclHandler := handlers.NewGclHandler(gclService, validatorService, config)
-	bankAccountHandler := handlers.NewBankAccountHandler(bankAccountService)
+	gclHandler := handlers.NewGclHandler(gclService, institutionService, syncService, validatorService, config)
+	bankAccountHandler := handlers.NewBankAccountHandler(bankAccountService, transactionService, validatorService)
+	transactionHandler := handlers.NewTransactionHandler(transactionService, validatorService)
+	categorizationHandler := handlers.NewCategorizationHandler(categorizationService, validatorService)
+	recurringHandler := handlers.NewRecurringHandler(recurringService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService, validatorService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	syncHandler := handlers.NewSyncHandler(syncService, validatorService)
 
 	// Create handlers container
 	handlers := &handlers.Handlers{
-		Auth:        *authHandler,
-		User:        *userHandler,
-		GoCardless:  *gclHandler,
-		BankAccount: *bankAccountHandler,
+		Auth:           *authHandler,
+		User:           *userHandler,
+		GoCardless:     *gclHandler,
+		BankAccount:    *bankAccountHandler,
+		Notification:   *notificationHandler,
+		Sync:           *syncHandler,
+		Transaction:    *transactionHandler,
+		Categorization: *categorizationHandler,
+		Recurring:      *recurringHandler,
+		Budget:         *budgetHandler,
 	}
 
+	// Jobs of instances that stopped while running them will never finish, and
+	// would keep their requisitions from being synced again
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			if err := syncService.FailStaleJobs(context.Background()); err != nil {
+				log.Error("Failed to mark interrupted sync jobs as failed", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+
 	// Initialize GoCardless token on startup and then refresh every 12 hours
 	go func() {
 		// Get initial token on startup
@@ -111,6 +193,58 @@ func NewServer(config *config.Config, db *postgres.DB) *Server {
 		}
 	}()
 
+	// Check bank consents for expiry on startup and then once a day
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			log.Info("Checking requisitions for expiry")
+			if err := gclService.CheckRequisitionExpiry(context.Background()); err != nil {
+				log.Error("Failed to check requisitions for expiry", "error", err)
+			}
+			<-ticker.C
+		}
+	}()
+
+	// Pick up consents given without the bank redirecting the user back
+	go func() {
+		ticker := time.NewTicker(config.GoCardless.PendingPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := gclService.RefreshPendingRequisitions(context.Background()); err != nil {
+				log.Error("Failed to refresh pending requisitions", "error", err)
+			}
+		}
+	}()
+
+	// Keep the accounts of linked requisitions up to date
+	if config.GoCardless.RefreshInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(config.GoCardless.RefreshInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := syncService.RefreshLinkedRequisitions(context.Background(), config.GoCardless.RefreshInterval/2); err != nil {
+					log.Error("Failed to refresh linked requisitions", "error", err)
+				}
+			}
+		}()
+	}
+
+	// Keep the cached institution catalogues fresh in the background
+	go func() {
+		ticker := time.NewTicker(config.GoCardless.InstitutionsCacheTTL / 2)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := institutionService.RefreshInstitutions(context.Background()); err != nil {
+				log.Error("Failed to refresh institutions", "error", err)
+			}
+		}
+	}()
+
 	// Create server
 	server := &Server{
 		app:      app,
@@ -120,7 +254,7 @@ func NewServer(config *config.Config, db *postgres.DB) *Server {
 	}
 
 	// Setup routes
-	SetupRoutes(app, services, handlers)
+	SetupRoutes(app, config, services, handlers)
 
 	return server
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,12 +31,37 @@ type User struct {
 }
 
 type Requisition struct {
-	ID            string `gorm:"primaryKey;not null" json:"id"` // GoCardless Requisition ID as primary key
-	Status        string `gorm:"not null" json:"status"`        // e.g., "created", "redirected", "linked", "expired"
-	RedirectURI   string `gorm:"not null" json:"redirect_uri"`
-	InstitutionID string `gorm:"not null" json:"institution_id"`
-	Link          string `json:"link"`      // Authorization link provided by GoCardless
-	Reference     string `json:"reference"` // Unique ID for internal reference
+	ID            string            `gorm:"primaryKey;not null" json:"id"` // GoCardless Requisition ID as primary key
+	Status        RequisitionStatus `gorm:"not null" json:"status"`        // One of the RequisitionStatus constants
+	RedirectURI   string            `gorm:"not null" json:"redirect_uri"`
+	InstitutionID string            `gorm:"not null" json:"institution_id"`
+	Link          string            `json:"link"`      // Authorization link provided by GoCardless
+	Reference     string            `json:"reference"` // Unique ID for internal reference
+
+	// Provider is the bank data aggregator the requisition was created with
+	Provider string `gorm:"not null;default:gocardless" json:"provider"`
+	// AccessToken gives access to the connection's data for providers that use one, e.g. Plaid
+	AccessToken string `json:"-"`
+	// LinkExpiresAt is when Link stops working, for providers whose links expire before consent is given
+	LinkExpiresAt *time.Time `json:"link_expires_at,omitempty"`
+	// CallbackStateHash is the SHA-256 of the single-use state the bank's redirect
+	// to the callback carries, which authenticates the redirect instead of the
+	// session cookie. It is cleared once used.
+	CallbackStateHash      string     `json:"-"`
+	CallbackStateExpiresAt *time.Time `json:"-"`
+
+	// End-user agreement the requisition was created with
+	AgreementID         string     `json:"agreement_id,omitempty"`
+	MaxHistoricalDays   int        `json:"max_historical_days"`
+	AccessValidForDays  int        `json:"access_valid_for_days"`
+	AgreementAcceptedAt *time.Time `json:"agreement_accepted_at,omitempty"`
+
+	// PreviousRequisitionID is the expired requisition this one reconnects.
+	// Its bank accounts are moved over once this requisition is linked.
+	PreviousRequisitionID string `gorm:"index" json:"previous_requisition_id,omitempty"`
+
+	// UnlinkedAt is set when the user disconnected the bank but kept its accounts archived
+	UnlinkedAt *time.Time `gorm:"index" json:"unlinked_at,omitempty"`
 
 	UserID uuid.UUID `gorm:"not null;index" json:"user_id"`
 	User   User      `gorm:"foreignKey:UserID" json:"-"`
@@ -48,6 +74,15 @@ type Requisition struct {
 	UpdatedAt time.Time  `json:"updated_at"`
 }
 
+// RequisitionTransition records when a requisition changed status
+type RequisitionTransition struct {
+	ID            uuid.UUID         `gorm:"type:uuid;primaryKey" json:"id"`
+	RequisitionID string            `gorm:"not null;index" json:"requisition_id"`
+	FromStatus    RequisitionStatus `json:"from_status"`
+	ToStatus      RequisitionStatus `gorm:"not null" json:"to_status"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
 type EmailVerificationToken struct {
 	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
@@ -68,9 +103,85 @@ type RefreshToken struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// SyncJob tracks a sync of a requisition running in the background
+type SyncJob struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Status        string    `gorm:"not null;index" json:"status"` // One of the SYNC_JOB_STATUS constants
+	Error         string    `json:"error,omitempty"`
+	RequisitionID string    `gorm:"not null;index" json:"requisition_id"`
+
+	UserID uuid.UUID `gorm:"not null;index" json:"user_id"`
+	User   User      `gorm:"foreignKey:UserID" json:"-"`
+
+	// Progress, known once the bank returned the accounts of the requisition
+	TotalAccounts     int              `json:"total_accounts"`
+	CompletedAccounts int              `json:"completed_accounts"`
+	Accounts          []SyncJobAccount `gorm:"foreignKey:SyncJobID" json:"accounts,omitempty"`
+
+	// Owner is the server instance running the job. It renews HeartbeatAt while
+	// the job runs; a job whose heartbeat stopped was interrupted.
+	Owner       string     `gorm:"not null;default:''" json:"-"`
+	HeartbeatAt *time.Time `json:"-"`
+
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SyncJobAccount is the outcome of one account within a sync job
+type SyncJobAccount struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	SyncJobID uuid.UUID `gorm:"not null;uniqueIndex:idx_sync_job_accounts_job_account,priority:1" json:"sync_job_id"`
+	// AccountID is the provider's account ID, BankAccountID is set once the account is stored
+	AccountID     string     `gorm:"not null;uniqueIndex:idx_sync_job_accounts_job_account,priority:2" json:"account_id"`
+	BankAccountID *uuid.UUID `json:"bank_account_id,omitempty"`
+	Status        string     `gorm:"not null" json:"status"` // One of the SYNC_ACCOUNT_STATUS constants
+	Error         string     `json:"error,omitempty"`
+	RetryAt       *time.Time `json:"retry_at,omitempty"` // When a deferred account can be synced again
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BalanceSnapshot is a balance of a bank account as reported on a given day.
+// Each balance type the bank returns is kept, one row per account, type and day.
+type BalanceSnapshot struct {
+	ID            uuid.UUID   `gorm:"type:uuid;primaryKey" json:"id"`
+	BankAccountID uuid.UUID   `gorm:"not null;uniqueIndex:idx_balance_snapshots_account_type_date,priority:1" json:"bank_account_id"`
+	BankAccount   BankAccount `gorm:"foreignKey:BankAccountID" json:"-"`
+	BalanceType   string      `gorm:"not null;uniqueIndex:idx_balance_snapshots_account_type_date,priority:2" json:"balance_type"` // E.g., "interimAvailable", "closingBooked"
+	Date          time.Time   `gorm:"type:date;not null;uniqueIndex:idx_balance_snapshots_account_type_date,priority:3" json:"date"`
+	Amount        float64     `json:"amount"`
+	Currency      string      `json:"currency"`
+	ReferenceDate *time.Time  `gorm:"type:date" json:"reference_date,omitempty"` // Date the bank says the balance refers to
+
+	UserID uuid.UUID `gorm:"not null;index" json:"user_id"`
+	User   User      `gorm:"foreignKey:UserID" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProviderToken is the API token pair of a bank data provider, shared by every
+// instance of the backend. The tokens are stored encrypted.
+type ProviderToken struct {
+	Provider       string    `gorm:"primaryKey" json:"provider"`
+	AccessToken    string    `gorm:"not null" json:"-"`
+	RefreshToken   string    `gorm:"not null" json:"-"`
+	AccessExpires  time.Time `json:"access_expires"`
+	RefreshExpires time.Time `json:"refresh_expires"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BankAccount is an account synced from a bank connection, or a manual account
+// (cash, wallets, unsupported banks) whose balance and transactions the user
+// enters. Manual accounts have neither a provider account ID nor a requisition.
 type BankAccount struct {
 	ID               uuid.UUID `gorm:"primaryKey" json:"id"`
-	AccountID        string    `gorm:"uniqueIndex;not null" json:"account_id"` // GoCardless account ID
+	AccountID        *string   `gorm:"uniqueIndex" json:"account_id,omitempty"` // GoCardless account ID
 	Name             string    `gorm:"not null" json:"name"`
 	Type             string    `gorm:"not null" json:"type"`
 	Currency         string    `gorm:"not null" json:"currency"`
@@ -79,9 +190,21 @@ type BankAccount struct {
 	BalanceCurrent   float64   `json:"balance_current"`
 	IBAN             string    `json:"iban,omitempty"`
 
+	// Set by the user: DisplayName replaces the bank's name, hidden accounts are
+	// left out of totals, and accounts are listed by ascending DisplayOrder
+	DisplayName      string `json:"display_name,omitempty"`
+	HiddenFromTotals bool   `gorm:"not null;default:false" json:"hidden_from_totals"`
+	DisplayOrder     int    `gorm:"not null;default:0" json:"display_order"`
+
+	// SyncDeferredUntil is set when GoCardless rate limited the account; syncs are skipped until then
+	SyncDeferredUntil *time.Time `json:"sync_deferred_until,omitempty"`
+
+	// ArchivedAt is set when the bank connection was unlinked; archived accounts keep their history but are no longer listed or synced
+	ArchivedAt *time.Time `gorm:"index" json:"archived_at,omitempty"`
+
 	UserID        uuid.UUID   `gorm:"not null;index" json:"user_id"`
 	User          User        `gorm:"foreignKey:UserID" json:"-"`
-	RequisitionID string      `gorm:"not null;index" json:"requisition_id"` // Link to requisition
+	RequisitionID *string     `gorm:"index" json:"requisition_id,omitempty"` // Link to requisition
 	Requisition   Requisition `gorm:"foreignKey:RequisitionID" json:"-"`
 
 	// Association with transactions
@@ -91,28 +214,158 @@ type BankAccount struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// IsManual reports whether the account is maintained by the user rather than synced
+func (a *BankAccount) IsManual() bool {
+	return a.RequisitionID == nil
+}
+
+// Transaction listings are paginated by (date, id) or (amount, id) per user or
+// account, which the composite indexes below serve.
 type Transaction struct {
-	ID          uuid.UUID `json:"id" gorm:"primary_key"`
+	ID          uuid.UUID `json:"id" gorm:"primary_key;index:idx_transactions_user_date,priority:3;index:idx_transactions_user_amount,priority:3;index:idx_transactions_account_date,priority:3"`
 	Category    string    `json:"category"`
-	Amount      float64   `json:"amount"`
-	Date        time.Time `json:"date"`
-	Type        string    `json:"type"` // E.g., "expense", "income"
-	IsRecurring bool      `json:"is_recurring"`
+	Amount      float64   `json:"amount" gorm:"index:idx_transactions_user_amount,priority:2"`
+	Date        time.Time `json:"date" gorm:"index:idx_transactions_user_date,priority:2;index:idx_transactions_account_date,priority:2"`
+	Type        string    `json:"type"`                                        // E.g., "expense", "income"
+	Status      string    `gorm:"not null;default:booked;index" json:"status"` // "booked" or "pending"
+	IsRecurring bool      `json:"is_recurring"`                                // Part of a detected recurring series
 	Description string    `json:"description"`
+	Manual      bool      `gorm:"not null;default:false" json:"manual"` // Entered by the user on a manual account
+	Tags        Tags      `gorm:"type:jsonb" json:"tags,omitempty"`
+	// CategorySource tells who assigned the category: a rule, the user, the
+	// classifier, or nobody when empty. Categories the user assigned are never
+	// overwritten, and are what the classifier learns from.
+	CategorySource string `json:"category_source,omitempty"`
+	// CategoryConfidence is how sure the classifier was of the category it assigned
+	CategoryConfidence float64 `json:"category_confidence,omitempty"`
+	// RecurringSeriesID is the recurring series the transaction was detected to be part of
+	RecurringSeriesID *uuid.UUID `gorm:"type:uuid;index" json:"recurring_series_id,omitempty"`
+	// TransferTransactionID links a transfer between two accounts of the user to
+	// its other side. Transfers are neither income nor expenses.
+	TransferTransactionID *uuid.UUID `gorm:"type:uuid;index" json:"transfer_transaction_id,omitempty"`
+	// Splits divide the amount across categories, e.g. the food and household
+	// goods of a supermarket receipt. When present they sum to Amount and their
+	// categories count instead of Category.
+	Splits []TransactionSplit `gorm:"foreignKey:TransactionID" json:"splits,omitempty"`
+
+	// Details reported by the bank, empty when the provider does not supply them
+	Currency             string     `json:"currency,omitempty"`
+	ValueDate            *time.Time `json:"value_date,omitempty"`
+	BookingDateTime      *time.Time `json:"booking_date_time,omitempty"`
+	CreditorName         string     `json:"creditor_name,omitempty"`
+	CreditorIBAN         string     `json:"creditor_iban,omitempty"`
+	DebtorName           string     `json:"debtor_name,omitempty"`
+	DebtorIBAN           string     `json:"debtor_iban,omitempty"`
+	RemittanceStructured string     `json:"remittance_structured,omitempty"`
+	BankTransactionCode  string     `json:"bank_transaction_code,omitempty"`
+	MerchantCategoryCode string     `json:"merchant_category_code,omitempty"`
+	EndToEndID           string     `json:"end_to_end_id,omitempty"`
 
-	UserID        uuid.UUID   `json:"user_id"`
+	// RawData is the transaction as the provider returned it, kept for reprocessing
+	RawData json.RawMessage `gorm:"type:jsonb" json:"-"`
+
+	// ProviderTransactionID is the bank's transaction ID, or a fingerprint of the
+	// transaction when the bank does not provide one. Unique per bank account.
+	ProviderTransactionID string `gorm:"uniqueIndex:idx_transactions_account_provider_id,priority:2,where:provider_transaction_id <> ''" json:"provider_transaction_id,omitempty"`
+
+	UserID        uuid.UUID   `gorm:"index:idx_transactions_user_date,priority:1;index:idx_transactions_user_amount,priority:1" json:"user_id"`
 	User          User        `json:"user"`
-	BankAccountID uuid.UUID   `json:"bank_account_id"`
+	BankAccountID uuid.UUID   `gorm:"uniqueIndex:idx_transactions_account_provider_id,priority:1,where:provider_transaction_id <> '';index:idx_transactions_account_date,priority:1" json:"bank_account_id"`
 	BankAccount   BankAccount `json:"bank_account"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// TransactionSplit is a part of a transaction with its own category and note
+type TransactionSplit struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	TransactionID uuid.UUID `gorm:"type:uuid;not null;index" json:"transaction_id"`
+	Position      int       `gorm:"not null;default:0" json:"position"` // Order of the split within the transaction
+	Amount        float64   `gorm:"not null" json:"amount"`             // Signed like the amount of the transaction
+	Category      string    `json:"category"`
+	Note          string    `json:"note,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CategoryRule assigns a category, tags and type to the transactions of a user
+// that meet all of its conditions. Empty conditions are ignored. Rules are
+// applied from the highest priority down; each field is taken from the first
+// matching rule that sets it, and the tags of every matching rule are combined.
+type CategoryRule struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Name     string    `gorm:"not null" json:"name"`
+	Priority int       `gorm:"not null;default:0" json:"priority"`
+	Enabled  bool      `gorm:"not null" json:"enabled"`
+
+	// Conditions
+	DescriptionContains  string     `json:"description_contains,omitempty"`  // Case-insensitive
+	CounterpartyContains string     `json:"counterparty_contains,omitempty"` // Case-insensitive, the creditor or debtor name
+	CounterpartyIBAN     string     `json:"counterparty_iban,omitempty"`     // The creditor or debtor IBAN
+	MinAmount            *float64   `json:"min_amount,omitempty"`            // Signed, expenses are negative
+	MaxAmount            *float64   `json:"max_amount,omitempty"`
+	BankAccountID        *uuid.UUID `gorm:"type:uuid" json:"bank_account_id,omitempty"`
+
+	// Assignments, empty ones are left to other rules
+	Category string `json:"category,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Tags     Tags   `gorm:"type:jsonb" json:"tags,omitempty"`
+
+	UserID uuid.UUID `gorm:"not null;index" json:"user_id"`
+	User   User      `gorm:"foreignKey:UserID" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecurringSeries is a payment or income repeating at a regular cadence, such as
+// a subscription or a salary. Series are detected from the booked transactions
+// of an account with the same counterparty and a similar amount, and replaced
+// whenever they are detected again.
+type RecurringSeries struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Counterparty string    `gorm:"not null" json:"counterparty"` // As the latest transaction names it
+	// CounterpartyKey is the normalized counterparty the transactions were grouped by
+	CounterpartyKey string `gorm:"not null" json:"-"`
+	Cadence         string `gorm:"not null" json:"cadence"` // One of the RECURRING_CADENCE constants
+	Category        string `json:"category,omitempty"`      // Of the latest transaction
+	Currency        string `json:"currency,omitempty"`
+
+	// Amounts are signed, payments are negative
+	Amount float64 `json:"amount"` // Of the latest transaction
+	// PreviousAmount is the amount before it last changed to Amount on
+	// PriceChangedAt, the same as Amount when it never changed
+	PreviousAmount float64    `json:"previous_amount"`
+	PriceChangedAt *time.Time `json:"price_changed_at,omitempty"`
+	AverageAmount  float64    `json:"average_amount"`
+	Occurrences    int        `json:"occurrences"`
+
+	FirstDate          time.Time `json:"first_date"`
+	LastDate           time.Time `json:"last_date"`
+	NextExpectedDate   time.Time `gorm:"index" json:"next_expected_date"`
+	NextExpectedAmount float64   `json:"next_expected_amount"`
+
+	// TransactionIDs are the transactions of the series when it is detected, not stored
+	TransactionIDs []uuid.UUID `gorm:"-" json:"-"`
+
+	BankAccountID uuid.UUID   `gorm:"type:uuid;not null;index" json:"bank_account_id"`
+	BankAccount   BankAccount `gorm:"foreignKey:BankAccountID" json:"-"`
+	UserID        uuid.UUID   `gorm:"not null;index" json:"user_id"`
+	User          User        `gorm:"foreignKey:UserID" json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Budget limits the spending of a category between two dates inclusive.
+// Split transactions count towards the categories of their splits.
 type Budget struct {
 	ID        uuid.UUID `json:"id" gorm:"primary_key"`
 	Category  string    `json:"category"`
 	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
 	StartDate time.Time `json:"start_date"`
 	EndDate   time.Time `json:"end_date"`
 
@@ -124,10 +377,11 @@ type Budget struct {
 }
 
 type Notification struct {
-	ID       uuid.UUID `json:"id" gorm:"primary_key"`
-	Type     string    `json:"type"`
-	Message  string    `json:"message"`
-	IsActive bool      `json:"is_active"`
+	ID        uuid.UUID `json:"id" gorm:"primary_key"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	IsActive  bool      `json:"is_active"`
+	Reference string    `gorm:"index" json:"reference,omitempty"` // ID of the entity the notification is about
 
 	UserID uuid.UUID `json:"user_id"`
 	User   User      `json:"user"`
@@ -0,0 +1,102 @@
+package domain
+
+// RequisitionStatus is the status of a requisition. Every provider reports the
+// status of a connection with the GoCardless requisition status codes.
+type RequisitionStatus string
+
+const (
+	RequisitionStatusCreated                  RequisitionStatus = "CR"
+	RequisitionStatusGivingConsent            RequisitionStatus = "GC"
+	RequisitionStatusUndergoingAuthentication RequisitionStatus = "UA"
+	RequisitionStatusIdentityVerification     RequisitionStatus = "ID"
+	RequisitionStatusSelectingAccounts        RequisitionStatus = "SA"
+	RequisitionStatusGrantingAccess           RequisitionStatus = "GA"
+	RequisitionStatusLinked                   RequisitionStatus = "LN"
+	RequisitionStatusRejected                 RequisitionStatus = "RJ"
+	RequisitionStatusExpired                  RequisitionStatus = "EX"
+	RequisitionStatusInstitutionError         RequisitionStatus = "IE"
+)
+
+// requisitionConsentSteps are the statuses a requisition goes through while the
+// user gives consent, in order. Statuses are polled, so steps may be skipped.
+var requisitionConsentSteps = []RequisitionStatus{
+	RequisitionStatusCreated,
+	RequisitionStatusGivingConsent,
+	RequisitionStatusUndergoingAuthentication,
+	RequisitionStatusIdentityVerification,
+	RequisitionStatusSelectingAccounts,
+	RequisitionStatusGrantingAccess,
+}
+
+// requisitionTransitions lists the statuses each status may change to
+var requisitionTransitions = buildRequisitionTransitions()
+
+func buildRequisitionTransitions() map[RequisitionStatus][]RequisitionStatus {
+	transitions := make(map[RequisitionStatus][]RequisitionStatus)
+
+	// While consent is given a requisition moves forward, or ends linked, rejected,
+	// expired or failed at the bank
+	for i, status := range requisitionConsentSteps {
+		next := append([]RequisitionStatus(nil), requisitionConsentSteps[i+1:]...)
+		transitions[status] = append(next,
+			RequisitionStatusLinked,
+			RequisitionStatusRejected,
+			RequisitionStatusExpired,
+			RequisitionStatusInstitutionError,
+		)
+	}
+	// A linked requisition only ends when its consent runs out or is revoked
+	transitions[RequisitionStatusLinked] = []RequisitionStatus{RequisitionStatusExpired}
+
+	// Rejected, expired and failed requisitions are final, a new one is created to reconnect
+	return transitions
+}
+
+var requisitionDescriptions = map[RequisitionStatus]string{
+	RequisitionStatusCreated:                  "The connection was created and is waiting for you to give consent",
+	RequisitionStatusGivingConsent:            "You are giving consent to share your account information",
+	RequisitionStatusUndergoingAuthentication: "You are logging in at your bank",
+	RequisitionStatusIdentityVerification:     "Your bank is verifying your identity",
+	RequisitionStatusSelectingAccounts:        "You are selecting the accounts to share",
+	RequisitionStatusGrantingAccess:           "You are granting access to your account information",
+	RequisitionStatusLinked:                   "Your accounts are connected",
+	RequisitionStatusRejected:                 "Your bank rejected the connection, e.g. because the login failed",
+	RequisitionStatusExpired:                  "Access to your accounts has expired, reconnect to keep them up to date",
+	RequisitionStatusInstitutionError:         "Your bank reported an error while connecting, try again later",
+}
+
+// PendingRequisitionStatuses returns the statuses of requisitions the user has not finished giving consent for
+func PendingRequisitionStatuses() []RequisitionStatus {
+	return append([]RequisitionStatus(nil), requisitionConsentSteps...)
+}
+
+// Valid reports whether the status is a known status
+func (s RequisitionStatus) Valid() bool {
+	_, ok := requisitionDescriptions[s]
+	return ok
+}
+
+// Description explains the status to the user
+func (s RequisitionStatus) Description() string {
+	if description, ok := requisitionDescriptions[s]; ok {
+		return description
+	}
+	return "The status of the connection is unknown"
+}
+
+// CanTransitionTo reports whether a requisition may change from this status to next.
+// An unknown current status, e.g. of a legacy row, may change to any known status.
+func (s RequisitionStatus) CanTransitionTo(next RequisitionStatus) bool {
+	if !next.Valid() || s == next {
+		return false
+	}
+	if !s.Valid() {
+		return true
+	}
+	for _, allowed := range requisitionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package domain
+
+import "testing"
+
+func TestRequisitionStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to RequisitionStatus
+		want     bool
+	}{
+		{"consent moves forward", RequisitionStatusCreated, RequisitionStatusGivingConsent, true},
+		{"consent steps may be skipped", RequisitionStatusCreated, RequisitionStatusGrantingAccess, true},
+		{"consent does not move back", RequisitionStatusSelectingAccounts, RequisitionStatusGivingConsent, false},
+		{"created to linked", RequisitionStatusCreated, RequisitionStatusLinked, true},
+		{"consent step to linked", RequisitionStatusGrantingAccess, RequisitionStatusLinked, true},
+		{"consent step to rejected", RequisitionStatusUndergoingAuthentication, RequisitionStatusRejected, true},
+		{"consent step to expired", RequisitionStatusGivingConsent, RequisitionStatusExpired, true},
+		{"consent step to institution error", RequisitionStatusIdentityVerification, RequisitionStatusInstitutionError, true},
+		{"linked to expired", RequisitionStatusLinked, RequisitionStatusExpired, true},
+		{"linked to rejected", RequisitionStatusLinked, RequisitionStatusRejected, false},
+		{"linked back to created", RequisitionStatusLinked, RequisitionStatusCreated, false},
+		{"rejected is final", RequisitionStatusRejected, RequisitionStatusLinked, false},
+		{"expired is final", RequisitionStatusExpired, RequisitionStatusLinked, false},
+		{"institution error is final", RequisitionStatusInstitutionError, RequisitionStatusCreated, false},
+		{"same status", RequisitionStatusLinked, RequisitionStatusLinked, false},
+		{"unknown next status", RequisitionStatusCreated, RequisitionStatus("XX"), false},
+		{"unknown current status", RequisitionStatus("XX"), RequisitionStatusLinked, true},
+		{"empty current status", RequisitionStatus(""), RequisitionStatusExpired, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("%q.CanTransitionTo(%q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
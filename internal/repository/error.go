@@ -33,10 +33,26 @@ var (
 	ErrRequisitionAlreadyExists = errors.New("requisition already exists")
 	ErrInvalidRequisitionID     = errors.New("invalid requisition ID")
 
+	// Notification errors
+	ErrNotificationNotFound = errors.New("notification not found")
+
 	// Transaction errors
 	ErrTransactionNotFound    = errors.New("transaction not found")
 	ErrInvalidTransactionData = errors.New("invalid transaction data")
 
+	// Category rule errors
+	ErrCategoryRuleNotFound = errors.New("category rule not found")
+
+	// Budget errors
+	ErrBudgetNotFound = errors.New("budget not found")
+
+	// Sync job errors
+	ErrSyncJobNotFound      = errors.New("sync job not found")
+	ErrSyncJobAlreadyActive = errors.New("requisition already has a queued or running sync job")
+
+	// Token errors
+	ErrTokenNotFound = errors.New("token not found")
+
 	// Authorization errors
 	ErrUnauthorized = errors.New("unauthorized access")
 	ErrForbidden    = errors.New("forbidden operation")
@@ -95,10 +111,38 @@ func NewRequisitionError(operation string, err error, context ...map[string]inte
 	return NewRepositoryError(operation, "requisition", err, context...)
 }
 
+func NewNotificationError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "notification", err, context...)
+}
+
 func NewTransactionError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
 	return NewRepositoryError(operation, "transaction", err, context...)
 }
 
+func NewSyncJobError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "sync_job", err, context...)
+}
+
+func NewBalanceSnapshotError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "balance_snapshot", err, context...)
+}
+
+func NewCategoryRuleError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "category_rule", err, context...)
+}
+
+func NewRecurringSeriesError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "recurring_series", err, context...)
+}
+
+func NewBudgetError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "budget", err, context...)
+}
+
+func NewTokenError(operation string, err error, context ...map[string]interface{}) *RepositoryError {
+	return NewRepositoryError(operation, "provider_token", err, context...)
+}
+
 // IsNotFoundError checks if an error is a "not found" error
 func IsNotFoundError(err error) bool {
 	if err == nil {
@@ -111,7 +155,12 @@ func IsNotFoundError(err error) bool {
 		errors.Is(err, ErrBankAccountNotFound) ||
 		errors.Is(err, ErrGclItemNotFound) ||
 		errors.Is(err, ErrRequisitionNotFound) ||
-		errors.Is(err, ErrTransactionNotFound) {
+		errors.Is(err, ErrNotificationNotFound) ||
+		errors.Is(err, ErrTransactionNotFound) ||
+		errors.Is(err, ErrTokenNotFound) ||
+		errors.Is(err, ErrSyncJobNotFound) ||
+		errors.Is(err, ErrCategoryRuleNotFound) ||
+		errors.Is(err, ErrBudgetNotFound) {
 		return true
 	}
 
@@ -135,7 +184,8 @@ func IsAlreadyExistsError(err error) bool {
 		errors.Is(err, ErrUserAlreadyExists) ||
 		errors.Is(err, ErrBankAccountAlreadyExists) ||
 		errors.Is(err, ErrGclItemAlreadyExists) ||
-		errors.Is(err, ErrRequisitionAlreadyExists) {
+		errors.Is(err, ErrRequisitionAlreadyExists) ||
+		errors.Is(err, ErrSyncJobAlreadyActive) {
 		return true
 	}
 
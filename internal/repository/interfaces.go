@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -22,12 +23,23 @@ type UserRepository interface {
 type BankAccountRepository interface {
 	Create(ctx context.Context, bankAccount *domain.BankAccount) error
 	Update(ctx context.Context, bankAccount *domain.BankAccount) error
+	// Delete removes a bank account along with its transactions, balance history and recurring series in a single
+	// transaction. Transfers to other accounts are unlinked.
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (domain.BankAccount, error)
 	GetUserAccountsWithBalance(ctx context.Context, userID uuid.UUID) ([]domain.BankAccount, error)
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.BankAccount, error)
 	GetByAccountID(ctx context.Context, accountID string) (*domain.BankAccount, error)
 	ExistsByAccountID(ctx context.Context, accountID string) (bool, error)
+	GetByRequisitionID(ctx context.Context, requisitionID string) ([]domain.BankAccount, error)
+	// UpdateSettings saves the display name, totals visibility and display order of an account
+	UpdateSettings(ctx context.Context, bankAccount *domain.BankAccount) error
+	// UpdateBalances sets the available and current balance of an account
+	UpdateBalances(ctx context.Context, id uuid.UUID, balanceAvailable, balanceCurrent float64) error
+	// WithSyncLock runs sync while holding a lock on the provider account ID shared
+	// by every instance, so that syncs of the same account never interleave.
+	// The error of sync is returned as it is.
+	WithSyncLock(ctx context.Context, accountID string, sync func() error) error
 }
 
 type RequisitionRepository interface {
@@ -43,13 +55,206 @@ type RequisitionRepository interface {
 	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Requisition, error)
 	// GetByUserIDAndInstitutionID retrieves a requisition by user ID and institution ID
 	GetByUserIDAndInstitutionID(ctx context.Context, userID uuid.UUID, institutionID string) (*domain.Requisition, error)
+	// GetActiveByUserIDAndInstitutionID retrieves the most recent requisition of a user for an institution that has not expired or been rejected
+	GetActiveByUserIDAndInstitutionID(ctx context.Context, userID uuid.UUID, institutionID string) (*domain.Requisition, error)
+	// ConsumeCallbackState clears the callback state of the requisition with the given
+	// reference and returns the requisition, if the state has the given hash and has
+	// not expired. A state is consumed at most once.
+	ConsumeCallbackState(ctx context.Context, reference, stateHash string) (*domain.Requisition, error)
+	// GetByStatus retrieves all requisitions with one of the given statuses
+	GetByStatus(ctx context.Context, statuses ...domain.RequisitionStatus) ([]domain.Requisition, error)
+	// Transition updates a requisition and records its status change in a single transaction
+	Transition(ctx context.Context, requisition *domain.Requisition, transition *domain.RequisitionTransition) error
+	// GetTransitions retrieves the status changes of a requisition, oldest first
+	GetTransitions(ctx context.Context, requisitionID string) ([]domain.RequisitionTransition, error)
+	// Unlink removes a requisition in a single transaction. With purge its bank accounts and their
+	// transactions are deleted along with it, otherwise the accounts are archived and the requisition kept as unlinked.
+	Unlink(ctx context.Context, requisitionID string, purge bool) error
+}
+
+// TransactionFilter selects the transactions of a user. Zero fields do not filter.
+type TransactionFilter struct {
+	UserID         uuid.UUID
+	BankAccountIDs []uuid.UUID
+	From           *time.Time // Inclusive
+	To             *time.Time // Inclusive, the whole day
+	MinAmount      *float64
+	MaxAmount      *float64
+	Category       string
+	Type           string
+	Status         string
+	Search         string // Matched case-insensitively against the description and counterparties
+
+	Sort  string             // One of constants.TRANSACTION_SORTS, newest first when empty
+	After *TransactionCursor // Position of the last transaction of the previous page
+	Limit int
+}
+
+// TransactionCursor is the position of a transaction in a sorted listing
+type TransactionCursor struct {
+	Date   time.Time
+	Amount float64
+	ID     uuid.UUID
+}
+
+// CategoryTotal is the income and expenses of a category in one currency
+type CategoryTotal struct {
+	Category     string
+	Currency     string
+	Income       float64 // Sum of the positive amounts
+	Expense      float64 // Sum of the negative amounts, as a positive number
+	Transactions int
+}
+
+// PendingTotal is the sum and number of the pending transactions of a bank account
+type PendingTotal struct {
+	BankAccountID uuid.UUID
+	Amount        float64
+	Count         int
+}
+
+// TransferPair is a transfer between two accounts of a user
+type TransferPair struct {
+	OutgoingID uuid.UUID
+	IncomingID uuid.UUID
 }
 
 // TransactionRepository defines operations for transaction data access
 type TransactionRepository interface {
 	Create(ctx context.Context, transaction *domain.Transaction) error
 	CreateInBatches(ctx context.Context, transactions []*domain.Transaction) error
+	// UpsertInBatches inserts transactions, skipping those whose provider transaction ID already exists for the bank account
+	UpsertInBatches(ctx context.Context, transactions []*domain.Transaction) error
+	Update(ctx context.Context, transaction *domain.Transaction) error
+	// CreateManual adds a transaction entered by the user and moves the balances of its account by its amount, in a single transaction
+	CreateManual(ctx context.Context, transaction *domain.Transaction) error
+	// UpdateManual saves a transaction entered by the user and moves the balances of its account by the change of its amount.
+	// When the amount changed, the splits of the transaction are removed and its transfer is unlinked.
+	UpdateManual(ctx context.Context, transaction *domain.Transaction, previousAmount float64) error
+	// DeleteManual removes a transaction entered by the user with its splits, unlinks the other side of its
+	// transfer and takes its amount back out of the balances of its account
+	DeleteManual(ctx context.Context, transaction *domain.Transaction) error
+	// UpdateCategorization saves the category, type, tags, category source and confidence of a transaction
+	UpdateCategorization(ctx context.Context, transaction *domain.Transaction) error
+	// LinkTransfers links the two sides of transfers to each other, skipping sides already linked
+	LinkTransfers(ctx context.Context, pairs []TransferPair) error
+	// GetBookedByUserIDSince retrieves the booked transactions of a user from since on, oldest first
+	GetBookedByUserIDSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]domain.Transaction, error)
+	// GetUserCategorized retrieves the most recent transactions of a user whose category the user assigned, newest first
+	GetUserCategorized(ctx context.Context, userID uuid.UUID, limit int) ([]domain.Transaction, error)
+	// DeleteByIDs removes transactions along with their splits, unlinking the other side of their transfers
+	DeleteByIDs(ctx context.Context, ids []uuid.UUID) error
+	// ReplaceSplits swaps the splits of a transaction for the given ones; none removes them
+	ReplaceSplits(ctx context.Context, transactionID uuid.UUID, splits []domain.TransactionSplit) error
+	// GetCategoryTotals sums the booked transactions of a user between from and to inclusive by
+	// category and currency. Split transactions count towards the categories of their splits,
+	// transfers between accounts of the user are left out.
+	GetCategoryTotals(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]CategoryTotal, error)
+	// GetPendingTotals sums the pending transactions of each of the given bank accounts.
+	// Accounts without pending transactions are left out.
+	GetPendingTotals(ctx context.Context, bankAccountIDs []uuid.UUID) (map[uuid.UUID]PendingTotal, error)
 	GetByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error)
+	// List returns a page of the transactions matching the filter, in its sort order
+	List(ctx context.Context, filter TransactionFilter) ([]domain.Transaction, error)
+	GetPendingByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error)
+	// GetWithoutProviderIDByBankAccountID retrieves transactions imported before provider transaction IDs were stored
+	GetWithoutProviderIDByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error)
+	GetProviderTransactionIDs(ctx context.Context, bankAccountID uuid.UUID) (map[string]bool, error)
 	GetByTransactionID(ctx context.Context, transactionID string) (domain.Transaction, error)
-	ExistsByTransactionID(ctx context.Context, transactionID string) (bool, error)
+	ExistsByProviderTransactionID(ctx context.Context, bankAccountID uuid.UUID, providerTransactionID string) (bool, error)
+}
+
+// NotificationRepository defines operations for notification data access
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *domain.Notification) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Notification, error)
+	// GetActiveByUserID retrieves the notifications a user has not dismissed, newest first
+	GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Notification, error)
+	// ExistsByReference checks if a notification of the given type was already created for an entity
+	ExistsByReference(ctx context.Context, userID uuid.UUID, notificationType, reference string) (bool, error)
+	Deactivate(ctx context.Context, id uuid.UUID) error
+	// DeactivateByReference dismisses every notification about an entity
+	DeactivateByReference(ctx context.Context, userID uuid.UUID, reference string) error
+}
+
+// SyncJobRepository defines operations for sync job data access
+type SyncJobRepository interface {
+	// Create adds a sync job. It fails with ErrSyncJobAlreadyActive when the
+	// requisition already has a queued or running job.
+	Create(ctx context.Context, job *domain.SyncJob) error
+	// Update saves a sync job, except its heartbeat
+	Update(ctx context.Context, job *domain.SyncJob) error
+	// Heartbeat renews the heartbeat of a job run by owner
+	Heartbeat(ctx context.Context, id uuid.UUID, owner string) error
+	// GetByID retrieves a sync job with the results of its accounts
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.SyncJob, error)
+	// GetActiveByRequisitionID retrieves the queued or running sync job of a requisition
+	GetActiveByRequisitionID(ctx context.Context, requisitionID string) (*domain.SyncJob, error)
+	// GetLatestByRequisitionID retrieves the most recent sync job of a requisition with the results of its accounts
+	GetLatestByRequisitionID(ctx context.Context, requisitionID string) (*domain.SyncJob, error)
+	// SaveAccount stores the result of an account, replacing the previous result of the same account in the job
+	SaveAccount(ctx context.Context, account *domain.SyncJobAccount) error
+	// FailStale marks the queued or running jobs whose heartbeat is older than
+	// staleBefore as failed, as the instance running them stopped
+	FailStale(ctx context.Context, staleBefore time.Time, reason string) (int64, error)
+}
+
+// BalanceSnapshotRepository defines operations for balance history data access
+type BalanceSnapshotRepository interface {
+	// Upsert stores snapshots, replacing those already taken for the same account, balance type and day
+	Upsert(ctx context.Context, snapshots []*domain.BalanceSnapshot) error
+	// GetByBankAccountID retrieves the snapshots of an account between from and to inclusive, oldest first
+	GetByBankAccountID(ctx context.Context, bankAccountID uuid.UUID, from, to time.Time) ([]domain.BalanceSnapshot, error)
+	// GetLatestByBankAccountID retrieves the most recent snapshot of each balance type of an account
+	GetLatestByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.BalanceSnapshot, error)
+	// GetByUserID retrieves the snapshots of a balance type across the user's active accounts that are
+	// not hidden from totals, between from and to inclusive, oldest first, along with the latest
+	// snapshot of each account taken before from
+	GetByUserID(ctx context.Context, userID uuid.UUID, balanceType string, from, to time.Time) ([]domain.BalanceSnapshot, error)
+}
+
+// CategoryRuleRepository defines operations for categorization rule data access
+type CategoryRuleRepository interface {
+	Create(ctx context.Context, rule *domain.CategoryRule) error
+	Update(ctx context.Context, rule *domain.CategoryRule) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.CategoryRule, error)
+	// GetByUserID retrieves the rules of a user in the order they are applied, highest priority first
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.CategoryRule, error)
+	// GetEnabledByUserID retrieves the enabled rules of a user in the order they are applied
+	GetEnabledByUserID(ctx context.Context, userID uuid.UUID) ([]domain.CategoryRule, error)
+	// GetUserIDs retrieves the users that have rules
+	GetUserIDs(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// BudgetRepository defines operations for budget data access
+type BudgetRepository interface {
+	Create(ctx context.Context, budget *domain.Budget) error
+	Update(ctx context.Context, budget *domain.Budget) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Budget, error)
+	// GetByUserID retrieves the budgets of a user, the latest period first
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Budget, error)
+}
+
+// RecurringSeriesRepository defines operations for recurring series data access
+type RecurringSeriesRepository interface {
+	// Replace swaps the recurring series of a user for those detected and flags
+	// their transactions as recurring, in a single transaction. Series whose ID
+	// is not among those detected are removed.
+	Replace(ctx context.Context, userID uuid.UUID, series []*domain.RecurringSeries) error
+	// GetByUserID retrieves the recurring series of a user, the next expected first
+	GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.RecurringSeries, error)
+}
+
+// TokenRepository defines operations for the API tokens of bank data providers.
+// Tokens are encrypted at rest and returned decrypted.
+type TokenRepository interface {
+	GetByProvider(ctx context.Context, provider string) (*domain.ProviderToken, error)
+	Save(ctx context.Context, token *domain.ProviderToken) error
+	Delete(ctx context.Context, provider string) error
+	// WithRefreshLock runs renew while holding a lock on the provider's token
+	// shared by every instance, then saves and returns the token renew returned.
+	// renew receives the stored token, nil if there is none.
+	WithRefreshLock(ctx context.Context, provider string, renew func(stored *domain.ProviderToken) (*domain.ProviderToken, error)) (*domain.ProviderToken, error)
 }
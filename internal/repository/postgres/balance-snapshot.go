@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// BalanceSnapshotRepository implements the repository.BalanceSnapshotRepository interface
+type BalanceSnapshotRepository struct {
+	db *gorm.DB
+}
+
+// NewBalanceSnapshotRepository creates a new balance snapshot repository
+func NewBalanceSnapshotRepository(db *gorm.DB) *BalanceSnapshotRepository {
+	return &BalanceSnapshotRepository{
+		db: db,
+	}
+}
+
+// Upsert stores snapshots, a later sync on the same day replaces the earlier values
+func (r *BalanceSnapshotRepository) Upsert(ctx context.Context, snapshots []*domain.BalanceSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	err := r.db.WithContext(ctx).
+		Omit("BankAccount", "User").
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "bank_account_id"}, {Name: "balance_type"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"amount", "currency", "reference_date", "updated_at"}),
+		}).
+		Create(snapshots).Error
+	if err != nil {
+		return repository.NewBalanceSnapshotError("upsert", err, map[string]interface{}{
+			"bank_account_id": snapshots[0].BankAccountID,
+			"count":           len(snapshots),
+		})
+	}
+	return nil
+}
+
+// GetByBankAccountID retrieves the snapshots of an account between from and to inclusive, oldest first
+func (r *BalanceSnapshotRepository) GetByBankAccountID(ctx context.Context, bankAccountID uuid.UUID, from, to time.Time) ([]domain.BalanceSnapshot, error) {
+	var snapshots []domain.BalanceSnapshot
+	err := r.db.WithContext(ctx).
+		Where("bank_account_id = ? AND date BETWEEN ? AND ?", bankAccountID, from, to).
+		Order("date ASC, balance_type ASC").
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, repository.NewBalanceSnapshotError("get_by_bank_account_id", err, map[string]interface{}{
+			"bank_account_id": bankAccountID,
+		})
+	}
+	return snapshots, nil
+}
+
+// GetLatestByBankAccountID retrieves the most recent snapshot of each balance type of an account
+func (r *BalanceSnapshotRepository) GetLatestByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.BalanceSnapshot, error) {
+	var snapshots []domain.BalanceSnapshot
+	err := r.db.WithContext(ctx).
+		Raw(`SELECT DISTINCT ON (balance_type) * FROM balance_snapshots
+			WHERE bank_account_id = ?
+			ORDER BY balance_type, date DESC`, bankAccountID).
+		Scan(&snapshots).Error
+	if err != nil {
+		return nil, repository.NewBalanceSnapshotError("get_latest_by_bank_account_id", err, map[string]interface{}{
+			"bank_account_id": bankAccountID,
+		})
+	}
+	return snapshots, nil
+}
+
+// GetByUserID retrieves the snapshots of a balance type across the user's
+// accounts that are neither archived nor hidden from totals. The latest
+// snapshot of each account before from is included, so totals can carry
+// balances into the start of the range.
+func (r *BalanceSnapshotRepository) GetByUserID(ctx context.Context, userID uuid.UUID, balanceType string, from, to time.Time) ([]domain.BalanceSnapshot, error) {
+	activeAccounts := r.db.Model(&domain.BankAccount{}).
+		Select("id").
+		Where("user_id = ? AND archived_at IS NULL AND NOT hidden_from_totals", userID)
+
+	var earlier []domain.BalanceSnapshot
+	err := r.db.WithContext(ctx).
+		Raw(`SELECT DISTINCT ON (bank_account_id) * FROM balance_snapshots
+			WHERE bank_account_id IN (?) AND balance_type = ? AND date < ?
+			ORDER BY bank_account_id, date DESC`, activeAccounts, balanceType, from).
+		Scan(&earlier).Error
+	if err != nil {
+		return nil, repository.NewBalanceSnapshotError("get_by_user_id", err, map[string]interface{}{
+			"user_id":      userID,
+			"balance_type": balanceType,
+		})
+	}
+
+	var snapshots []domain.BalanceSnapshot
+	err = r.db.WithContext(ctx).
+		Where("bank_account_id IN (?) AND balance_type = ? AND date BETWEEN ? AND ?", activeAccounts, balanceType, from, to).
+		Order("date ASC").
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, repository.NewBalanceSnapshotError("get_by_user_id", err, map[string]interface{}{
+			"user_id":      userID,
+			"balance_type": balanceType,
+		})
+	}
+
+	return append(earlier, snapshots...), nil
+}
@@ -3,9 +3,11 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"FinMa/internal/domain"
 	"FinMa/internal/repository"
@@ -28,17 +30,18 @@ func (r *BankAccountRepository) Create(ctx context.Context, bankAccount *domain.
 	return r.db.WithContext(ctx).Create(bankAccount).Error
 }
 
-// GetByID retrieves a bank account by ID with related data
+// GetByID retrieves a bank account by ID with its user
 func (r *BankAccountRepository) GetByID(ctx context.Context, id uuid.UUID) (domain.BankAccount, error) {
 	var bankAccount domain.BankAccount
 	result := r.db.WithContext(ctx).
 		Preload("User").
-		Preload("Transactions").
 		First(&bankAccount, "id = ?", id)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return domain.BankAccount{}, errors.New("bank account not found")
+			return domain.BankAccount{}, repository.NewBankAccountError("get_by_id", repository.ErrBankAccountNotFound, map[string]interface{}{
+				"bank_account_id": id,
+			})
 		}
 		return domain.BankAccount{}, result.Error
 	}
@@ -49,8 +52,21 @@ func (r *BankAccountRepository) GetByID(ctx context.Context, id uuid.UUID) (doma
 func (r *BankAccountRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.BankAccount, error) {
 	var bankAccounts []domain.BankAccount
 	result := r.db.WithContext(ctx).
-		Preload("Transactions").
-		Where("user_id = ?", userID).
+		Where("user_id = ? AND archived_at IS NULL", userID).
+		Order("display_order ASC, created_at ASC").
+		Find(&bankAccounts)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return bankAccounts, nil
+}
+
+// GetByRequisitionID retrieves all bank accounts linked through a requisition
+func (r *BankAccountRepository) GetByRequisitionID(ctx context.Context, requisitionID string) ([]domain.BankAccount, error) {
+	var bankAccounts []domain.BankAccount
+	result := r.db.WithContext(ctx).
+		Where("requisition_id = ?", requisitionID).
 		Find(&bankAccounts)
 
 	if result.Error != nil {
@@ -64,8 +80,6 @@ func (r *BankAccountRepository) GetByAccountID(ctx context.Context, accountID st
 	var bankAccount domain.BankAccount
 	result := r.db.WithContext(ctx).
 		Preload("User").
-		Preload("Requisition").
-		Preload("Transactions").
 		First(&bankAccount, "account_id = ?", accountID)
 
 	if result.Error != nil {
@@ -77,16 +91,96 @@ func (r *BankAccountRepository) GetByAccountID(ctx context.Context, accountID st
 	return &bankAccount, nil
 }
 
+// Update updates a bank account in the database. Its associations are left
+// alone: saving them would reset the requisition ID to the one of a loaded
+// requisition and write every loaded transaction again.
+func (r *BankAccountRepository) Update(ctx context.Context, bankAccount *domain.BankAccount) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(bankAccount).Error
+}
 
+// UpdateSettings saves the display name, totals visibility and display order
+// of a bank account, leaving the data synced from the bank untouched
+func (r *BankAccountRepository) UpdateSettings(ctx context.Context, bankAccount *domain.BankAccount) error {
+	err := r.db.WithContext(ctx).
+		Model(bankAccount).
+		Select("display_name", "hidden_from_totals", "display_order").
+		Updates(bankAccount).Error
+	if err != nil {
+		return repository.NewBankAccountError("update_settings", err, map[string]interface{}{
+			"bank_account_id": bankAccount.ID,
+		})
+	}
+	return nil
+}
 
-// Update updates a bank account in the database
-func (r *BankAccountRepository) Update(ctx context.Context, bankAccount *domain.BankAccount) error {
-	return r.db.WithContext(ctx).Save(bankAccount).Error
+// UpdateBalances sets the available and current balance of a bank account
+func (r *BankAccountRepository) UpdateBalances(ctx context.Context, id uuid.UUID, balanceAvailable, balanceCurrent float64) error {
+	err := r.db.WithContext(ctx).
+		Model(&domain.BankAccount{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"balance_available": balanceAvailable,
+			"balance_current":   balanceCurrent,
+		}).Error
+	if err != nil {
+		return repository.NewBankAccountError("update_balances", err, map[string]interface{}{
+			"bank_account_id": id,
+		})
+	}
+	return nil
+}
+
+// WithSyncLock serializes syncs of an account across instances with a
+// transaction-scoped advisory lock, released when the transaction ends. The
+// account ID is locked rather than the row, which the first sync has yet to
+// create.
+func (r *BankAccountRepository) WithSyncLock(ctx context.Context, accountID string, sync func() error) error {
+	var syncErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "bank_account_sync:"+accountID).Error; err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		syncErr = sync()
+		return nil
+	})
+	if err != nil {
+		return repository.NewBankAccountError("sync_lock", err, map[string]interface{}{
+			"account_id": accountID,
+		})
+	}
+	return syncErr
 }
 
-// Delete soft deletes a bank account from the database
+// Delete removes a bank account with its transactions, balance snapshots and
+// recurring series. Transfers to other accounts lose their link.
 func (r *BankAccountRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	return r.db.WithContext(ctx).Delete(&domain.BankAccount{}, "id = ?", id).Error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		transactionIDs := tx.Model(&domain.Transaction{}).Select("id").Where("bank_account_id = ?", id)
+		if err := tx.Where("transaction_id IN (?)", transactionIDs).Delete(&domain.TransactionSplit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&domain.Transaction{}).
+			Where("transfer_transaction_id IN (?)", transactionIDs).
+			Update("transfer_transaction_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bank_account_id = ?", id).Delete(&domain.Transaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bank_account_id = ?", id).Delete(&domain.BalanceSnapshot{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bank_account_id = ?", id).Delete(&domain.RecurringSeries{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&domain.BankAccount{}).Error
+	})
+	if err != nil {
+		return repository.NewBankAccountError("delete", err, map[string]interface{}{
+			"bank_account_id": id,
+		})
+	}
+	return nil
 }
 
 // ExistsByAccountID checks if a bank account with the given account ID exists
@@ -96,8 +190,6 @@ func (r *BankAccountRepository) ExistsByAccountID(ctx context.Context, accountID
 	return count > 0, err
 }
 
-
-
 // GetUserAccountsWithBalance retrieves user's bank accounts with current balance information
 func (r *BankAccountRepository) GetUserAccountsWithBalance(ctx context.Context, userID uuid.UUID) ([]domain.BankAccount, error) {
 	var bankAccounts []domain.BankAccount
@@ -105,7 +197,7 @@ func (r *BankAccountRepository) GetUserAccountsWithBalance(ctx context.Context,
 		Select("id", "account_id", "name", "type", "currency", "institution_name",
 			"balance_available", "balance_current", "iban", "user_id",
 			"created_at", "updated_at").
-		Where("user_id = ?", userID).
+		Where("user_id = ? AND archived_at IS NULL", userID).
 		Find(&bankAccounts)
 
 	if result.Error != nil {
@@ -131,5 +223,3 @@ func (r *BankAccountRepository) CountByUserID(ctx context.Context, userID uuid.U
 	err := r.db.WithContext(ctx).Model(&domain.BankAccount{}).Where("user_id = ?", userID).Count(&count).Error
 	return count, err
 }
-
-
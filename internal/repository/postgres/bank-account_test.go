@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	pgdriver "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"FinMa/internal/domain"
+)
+
+// statementLogger records the SQL of every statement gorm runs
+type statementLogger struct {
+	logger.Interface
+	statements []string
+}
+
+func (l *statementLogger) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	l.statements = append(l.statements, sql)
+}
+
+// newDryRunDB returns a database that builds statements without running them
+func newDryRunDB(t *testing.T) (*gorm.DB, *statementLogger) {
+	t.Helper()
+	statements := &statementLogger{Interface: logger.Discard}
+	db, err := gorm.Open(pgdriver.New(pgdriver.Config{DSN: "host=localhost", PreferSimpleProtocol: true}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 statements,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+	return db, statements
+}
+
+func TestBankAccountUpdateMovesRequisition(t *testing.T) {
+	db, statements := newDryRunDB(t)
+	r := NewBankAccountRepository(db)
+
+	// An account loaded with its previous requisition, moved to the new one
+	// after a reconnect
+	previous, current := "previous-requisition", "current-requisition"
+	accountID := uuid.New()
+	account := &domain.BankAccount{
+		ID:            accountID,
+		Name:          "Current account",
+		RequisitionID: &current,
+		Requisition:   domain.Requisition{ID: previous},
+		User:          domain.User{ID: uuid.New()},
+		Transactions:  []domain.Transaction{{ID: uuid.New(), BankAccountID: accountID}},
+	}
+	if err := r.Update(context.Background(), account); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if len(statements.statements) != 1 {
+		t.Fatalf("Update() ran %d statements, want only the update of the account: %q", len(statements.statements), statements.statements)
+	}
+	sql := statements.statements[0]
+	if !strings.HasPrefix(sql, `UPDATE "bank_accounts"`) || !strings.Contains(sql, `"requisition_id"='`+current+`'`) {
+		t.Errorf("Update() SQL = %s, want the account moved to %s", sql, current)
+	}
+	if account.RequisitionID == nil || *account.RequisitionID != current {
+		t.Errorf("requisition ID after Update() = %v, want %s", account.RequisitionID, current)
+	}
+}
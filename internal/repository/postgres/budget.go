@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// BudgetRepository implements the repository.BudgetRepository interface
+type BudgetRepository struct {
+	db *gorm.DB
+}
+
+// NewBudgetRepository creates a new budget repository
+func NewBudgetRepository(db *gorm.DB) *BudgetRepository {
+	return &BudgetRepository{
+		db: db,
+	}
+}
+
+// Create adds a new budget to the database
+func (r *BudgetRepository) Create(ctx context.Context, budget *domain.Budget) error {
+	if err := r.db.WithContext(ctx).Omit("User").Create(budget).Error; err != nil {
+		return repository.NewBudgetError("create", err, map[string]interface{}{
+			"user_id": budget.UserID,
+		})
+	}
+	return nil
+}
+
+// Update saves every field of a budget
+func (r *BudgetRepository) Update(ctx context.Context, budget *domain.Budget) error {
+	if err := r.db.WithContext(ctx).Omit("User").Save(budget).Error; err != nil {
+		return repository.NewBudgetError("update", err, map[string]interface{}{
+			"budget_id": budget.ID,
+		})
+	}
+	return nil
+}
+
+// Delete removes a budget
+func (r *BudgetRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.Budget{}, "id = ?", id).Error; err != nil {
+		return repository.NewBudgetError("delete", err, map[string]interface{}{
+			"budget_id": id,
+		})
+	}
+	return nil
+}
+
+// GetByID retrieves a budget by ID
+func (r *BudgetRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Budget, error) {
+	var budget domain.Budget
+	result := r.db.WithContext(ctx).First(&budget, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewBudgetError("get_by_id", repository.ErrBudgetNotFound, map[string]interface{}{
+				"budget_id": id,
+			})
+		}
+		return nil, repository.NewBudgetError("get_by_id", result.Error, map[string]interface{}{
+			"budget_id": id,
+		})
+	}
+	return &budget, nil
+}
+
+// GetByUserID retrieves the budgets of a user, the latest period first and
+// budgets of the same period by category
+func (r *BudgetRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Budget, error) {
+	var budgets []domain.Budget
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("start_date DESC, category ASC").
+		Find(&budgets).Error
+	if err != nil {
+		return nil, repository.NewBudgetError("get_by_user_id", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return budgets, nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// CategoryRuleRepository implements the repository.CategoryRuleRepository interface
+type CategoryRuleRepository struct {
+	db *gorm.DB
+}
+
+// NewCategoryRuleRepository creates a new category rule repository
+func NewCategoryRuleRepository(db *gorm.DB) *CategoryRuleRepository {
+	return &CategoryRuleRepository{
+		db: db,
+	}
+}
+
+// Create adds a new rule to the database
+func (r *CategoryRuleRepository) Create(ctx context.Context, rule *domain.CategoryRule) error {
+	if err := r.db.WithContext(ctx).Omit("User").Create(rule).Error; err != nil {
+		return repository.NewCategoryRuleError("create", err, map[string]interface{}{
+			"user_id": rule.UserID,
+		})
+	}
+	return nil
+}
+
+// Update saves every field of a rule
+func (r *CategoryRuleRepository) Update(ctx context.Context, rule *domain.CategoryRule) error {
+	if err := r.db.WithContext(ctx).Omit("User").Save(rule).Error; err != nil {
+		return repository.NewCategoryRuleError("update", err, map[string]interface{}{
+			"category_rule_id": rule.ID,
+		})
+	}
+	return nil
+}
+
+// Delete removes a rule. Categories it assigned stay until rules are re-applied.
+func (r *CategoryRuleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.CategoryRule{}, "id = ?", id).Error; err != nil {
+		return repository.NewCategoryRuleError("delete", err, map[string]interface{}{
+			"category_rule_id": id,
+		})
+	}
+	return nil
+}
+
+// GetByID retrieves a rule by ID
+func (r *CategoryRuleRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.CategoryRule, error) {
+	var rule domain.CategoryRule
+	result := r.db.WithContext(ctx).First(&rule, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewCategoryRuleError("get_by_id", repository.ErrCategoryRuleNotFound, map[string]interface{}{
+				"category_rule_id": id,
+			})
+		}
+		return nil, repository.NewCategoryRuleError("get_by_id", result.Error, map[string]interface{}{
+			"category_rule_id": id,
+		})
+	}
+	return &rule, nil
+}
+
+// GetByUserID retrieves the rules of a user, highest priority first. Rules of
+// the same priority apply in the order they were created.
+func (r *CategoryRuleRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.CategoryRule, error) {
+	var rules []domain.CategoryRule
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("priority DESC, created_at ASC").
+		Find(&rules).Error
+	if err != nil {
+		return nil, repository.NewCategoryRuleError("get_by_user_id", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return rules, nil
+}
+
+// GetEnabledByUserID retrieves the enabled rules of a user, highest priority first
+func (r *CategoryRuleRepository) GetEnabledByUserID(ctx context.Context, userID uuid.UUID) ([]domain.CategoryRule, error) {
+	var rules []domain.CategoryRule
+	err := r.db.WithContext(ctx).
+		Where("user_id = ? AND enabled", userID).
+		Order("priority DESC, created_at ASC").
+		Find(&rules).Error
+	if err != nil {
+		return nil, repository.NewCategoryRuleError("get_enabled_by_user_id", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return rules, nil
+}
+
+// GetUserIDs retrieves the users that have rules
+func (r *CategoryRuleRepository) GetUserIDs(ctx context.Context) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	err := r.db.WithContext(ctx).
+		Model(&domain.CategoryRule{}).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error
+	if err != nil {
+		return nil, repository.NewCategoryRuleError("get_user_ids", err)
+	}
+	return userIDs, nil
+}
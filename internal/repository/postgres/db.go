@@ -8,6 +8,7 @@ import (
 	"gorm.io/gorm"
 
 	"FinMa/config"
+	"FinMa/constants"
 	"FinMa/internal/domain"
 )
 
@@ -59,20 +60,54 @@ func (db *DB) Migrate() error {
 		&domain.BankAccount{},
 		&domain.Transaction{},
 		&domain.Requisition{},
+		&domain.RequisitionTransition{},
 		&domain.Budget{},
 		&domain.Notification{},
 		&domain.RefreshToken{},
 		&domain.EmailVerificationToken{},
+		&domain.ProviderToken{},
+		&domain.SyncJob{},
+		&domain.SyncJobAccount{},
+		&domain.BalanceSnapshot{},
+		&domain.CategoryRule{},
+		&domain.RecurringSeries{},
+		&domain.TransactionSplit{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	if err := db.migrateActiveSyncJobIndex(); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
 	log.Info("Database migrations completed successfully")
 	return nil
 }
 
+// migrateActiveSyncJobIndex allows one queued or running sync job per
+// requisition. Jobs started twice before the index existed are failed first,
+// keeping the newest of each requisition.
+func (db *DB) migrateActiveSyncJobIndex() error {
+	active := []string{constants.SYNC_JOB_STATUS_QUEUED, constants.SYNC_JOB_STATUS_RUNNING}
+	err := db.DB.Exec(`
+		UPDATE sync_jobs SET status = ?, error = ?, finished_at = NOW()
+		WHERE status IN ? AND id NOT IN (
+			SELECT DISTINCT ON (requisition_id) id FROM sync_jobs
+			WHERE status IN ?
+			ORDER BY requisition_id, created_at DESC
+		)`, constants.SYNC_JOB_STATUS_FAILED, "superseded by a newer sync job", active, active).Error
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Exec(fmt.Sprintf(
+		"CREATE UNIQUE INDEX IF NOT EXISTS %s ON sync_jobs (requisition_id) WHERE status IN ('%s', '%s')",
+		activeSyncJobIndex, constants.SYNC_JOB_STATUS_QUEUED, constants.SYNC_JOB_STATUS_RUNNING,
+	)).Error
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	sqlDB, err := db.DB.DB()
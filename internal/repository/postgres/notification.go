@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// NotificationRepository implements the repository.NotificationRepository interface
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{
+		db: db,
+	}
+}
+
+// Create adds a new notification to the database
+func (r *NotificationRepository) Create(ctx context.Context, notification *domain.Notification) error {
+	if err := r.db.WithContext(ctx).Omit("User").Create(notification).Error; err != nil {
+		return repository.NewNotificationError("create", err, map[string]interface{}{
+			"user_id": notification.UserID,
+			"type":    notification.Type,
+		})
+	}
+	return nil
+}
+
+// GetByID retrieves a notification by ID
+func (r *NotificationRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Notification, error) {
+	var notification domain.Notification
+	result := r.db.WithContext(ctx).First(&notification, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewNotificationError("get_by_id", repository.ErrNotificationNotFound, map[string]interface{}{
+				"notification_id": id,
+			})
+		}
+		return nil, repository.NewNotificationError("get_by_id", result.Error, map[string]interface{}{
+			"notification_id": id,
+		})
+	}
+	return &notification, nil
+}
+
+// GetActiveByUserID retrieves the active notifications of a user, newest first
+func (r *NotificationRepository) GetActiveByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Notification, error) {
+	var notifications []domain.Notification
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Order("created_at DESC").
+		Find(&notifications)
+	if result.Error != nil {
+		return nil, repository.NewNotificationError("get_active_by_user_id", result.Error, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return notifications, nil
+}
+
+// ExistsByReference checks if a notification of the given type already exists for an entity
+func (r *NotificationRepository) ExistsByReference(ctx context.Context, userID uuid.UUID, notificationType, reference string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).
+		Model(&domain.Notification{}).
+		Where("user_id = ? AND type = ? AND reference = ?", userID, notificationType, reference).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Deactivate dismisses a notification
+func (r *NotificationRepository) Deactivate(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.Notification{}).
+		Where("id = ?", id).
+		Update("is_active", false).Error
+}
+
+// DeactivateByReference dismisses every notification about an entity
+func (r *NotificationRepository) DeactivateByReference(ctx context.Context, userID uuid.UUID, reference string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.Notification{}).
+		Where("user_id = ? AND reference = ?", userID, reference).
+		Update("is_active", false).Error
+}
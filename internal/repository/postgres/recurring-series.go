@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// RecurringSeriesRepository implements the repository.RecurringSeriesRepository interface
+type RecurringSeriesRepository struct {
+	db *gorm.DB
+}
+
+// NewRecurringSeriesRepository creates a new recurring series repository
+func NewRecurringSeriesRepository(db *gorm.DB) *RecurringSeriesRepository {
+	return &RecurringSeriesRepository{
+		db: db,
+	}
+}
+
+// Replace swaps the recurring series of a user for those detected. The
+// transactions of the user are unflagged first, so those no longer part of a
+// series stop being recurring.
+func (r *RecurringSeriesRepository) Replace(ctx context.Context, userID uuid.UUID, series []*domain.RecurringSeries) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&domain.Transaction{}).
+			Where("user_id = ? AND (is_recurring OR recurring_series_id IS NOT NULL)", userID).
+			Updates(map[string]interface{}{
+				"is_recurring":        false,
+				"recurring_series_id": nil,
+			}).Error; err != nil {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(series))
+		for _, s := range series {
+			ids = append(ids, s.ID)
+		}
+		stale := tx.Where("user_id = ?", userID)
+		if len(ids) > 0 {
+			stale = stale.Where("id NOT IN ?", ids)
+		}
+		if err := stale.Delete(&domain.RecurringSeries{}).Error; err != nil {
+			return err
+		}
+
+		for _, s := range series {
+			if err := tx.Omit("User", "BankAccount").Save(s).Error; err != nil {
+				return err
+			}
+			if len(s.TransactionIDs) == 0 {
+				continue
+			}
+			if err := tx.Model(&domain.Transaction{}).
+				Where("id IN ?", s.TransactionIDs).
+				Updates(map[string]interface{}{
+					"is_recurring":        true,
+					"recurring_series_id": s.ID,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return repository.NewRecurringSeriesError("replace", err, map[string]interface{}{
+			"user_id": userID,
+			"series":  len(series),
+		})
+	}
+	return nil
+}
+
+// GetByUserID retrieves the recurring series of a user, the next expected first
+func (r *RecurringSeriesRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.RecurringSeries, error) {
+	var series []domain.RecurringSeries
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("next_expected_date ASC, counterparty ASC").
+		Find(&series).Error
+	if err != nil {
+		return nil, repository.NewRecurringSeriesError("get_by_user_id", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return series, nil
+}
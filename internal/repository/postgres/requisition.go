@@ -3,24 +3,57 @@ package postgres
 import (
 	"FinMa/internal/domain"
 	"FinMa/internal/repository"
+	"FinMa/utils"
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// errNoTokenKey is returned when a provider access token would have to be stored without an encryption key
+var errNoTokenKey = errors.New("access tokens cannot be stored without an encryption key")
+
+// legacyAccessTokenPrefix starts the Plaid access tokens stored before they were
+// encrypted. Encrypted tokens are base64 and never contain a dash.
+const legacyAccessTokenPrefix = "access-"
+
+// callbackStateColumns are only written when a requisition is created and when
+// its state is consumed, so that saving a requisition read earlier cannot bring
+// back a used state
+var callbackStateColumns = []string{"callback_state_hash", "callback_state_expires_at"}
+
+// RequisitionRepository implements the repository.RequisitionRepository
+// interface. Provider access tokens are encrypted with AES-GCM before they are
+// written and returned decrypted.
 type RequisitionRepository struct {
-	db *gorm.DB
+	db  *gorm.DB
+	key []byte
 }
 
-func NewRequisitionRepository(db *gorm.DB) *RequisitionRepository {
+// NewRequisitionRepository creates a new requisition repository encrypting
+// access tokens with key. Without a key, requisitions with an access token
+// cannot be saved.
+func NewRequisitionRepository(db *gorm.DB, key []byte) *RequisitionRepository {
 	return &RequisitionRepository{
-		db: db,
+		db:  db,
+		key: key,
 	}
 }
 
 func (r *RequisitionRepository) Create(ctx context.Context, requisition *domain.Requisition) error {
+	restore, err := r.sealToken(requisition)
+	if err != nil {
+		return repository.NewRequisitionError("create", err, map[string]interface{}{
+			"user_id": requisition.UserID,
+		})
+	}
+	defer restore()
+
 	if err := r.db.WithContext(ctx).Create(requisition).Error; err != nil {
 		return repository.NewRequisitionError("create", err, map[string]interface{}{
 			"user_id":        requisition.UserID,
@@ -30,7 +63,15 @@ func (r *RequisitionRepository) Create(ctx context.Context, requisition *domain.
 	return nil
 }
 func (r *RequisitionRepository) Update(ctx context.Context, requisition *domain.Requisition) error {
-	if err := r.db.WithContext(ctx).Where("id = ?", requisition.ID).Updates(requisition).Error; err != nil {
+	restore, err := r.sealToken(requisition)
+	if err != nil {
+		return repository.NewRequisitionError("update", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
+	defer restore()
+
+	if err := r.db.WithContext(ctx).Omit(callbackStateColumns...).Where("id = ?", requisition.ID).Updates(requisition).Error; err != nil {
 		return repository.NewRequisitionError("update", err, map[string]interface{}{
 			"requisition_id": requisition.ID,
 		})
@@ -51,12 +92,17 @@ func (r *RequisitionRepository) GetByReference(ctx context.Context, reference st
 			"reference": reference,
 		})
 	}
+	if err := r.openToken(&requisition); err != nil {
+		return nil, repository.NewRequisitionError("get_by_reference", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
 	return &requisition, nil
 }
 
 func (r *RequisitionRepository) GetByID(ctx context.Context, id string) (*domain.Requisition, error) {
 	var requisition domain.Requisition
-	result := r.db.WithContext(ctx).First(&requisition, "requisition_id = ?", id)
+	result := r.db.WithContext(ctx).First(&requisition, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, repository.NewRequisitionError("get_by_id", repository.ErrRequisitionNotFound, map[string]interface{}{
@@ -67,17 +113,29 @@ func (r *RequisitionRepository) GetByID(ctx context.Context, id string) (*domain
 			"requisition_id": id,
 		})
 	}
+	if err := r.openToken(&requisition); err != nil {
+		return nil, repository.NewRequisitionError("get_by_id", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
 	return &requisition, nil
 }
 
 func (r *RequisitionRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Requisition, error) {
 	var requisitions []domain.Requisition
-	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&requisitions)
+	result := r.db.WithContext(ctx).Where("user_id = ? AND unlinked_at IS NULL", userID).Find(&requisitions)
 	if result.Error != nil {
 		return nil, repository.NewRequisitionError("get_by_user_id", result.Error, map[string]interface{}{
 			"user_id": userID,
 		})
 	}
+	for i := range requisitions {
+		if err := r.openToken(&requisitions[i]); err != nil {
+			return nil, repository.NewRequisitionError("get_by_user_id", err, map[string]interface{}{
+				"requisition_id": requisitions[i].ID,
+			})
+		}
+	}
 	return requisitions, nil
 }
 
@@ -96,5 +154,214 @@ func (r *RequisitionRepository) GetByUserIDAndInstitutionID(ctx context.Context,
 			"institution_id": institutionID,
 		})
 	}
+	if err := r.openToken(&requisition); err != nil {
+		return nil, repository.NewRequisitionError("get_by_user_and_institution", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
+	return &requisition, nil
+}
+
+func (r *RequisitionRepository) GetActiveByUserIDAndInstitutionID(ctx context.Context, userID uuid.UUID, institutionID string) (*domain.Requisition, error) {
+	var requisition domain.Requisition
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND institution_id = ?", userID, institutionID).
+		Where("status NOT IN ?", []domain.RequisitionStatus{domain.RequisitionStatusExpired, domain.RequisitionStatusRejected, domain.RequisitionStatusInstitutionError}).
+		Where("unlinked_at IS NULL").
+		Where("link_expires_at IS NULL OR link_expires_at > ? OR status = ?", time.Now(), domain.RequisitionStatusLinked).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		First(&requisition)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewRequisitionError("get_active_by_user_and_institution", repository.ErrRequisitionNotFound, map[string]interface{}{
+				"user_id":        userID,
+				"institution_id": institutionID,
+			})
+		}
+		return nil, repository.NewRequisitionError("get_active_by_user_and_institution", result.Error, map[string]interface{}{
+			"user_id":        userID,
+			"institution_id": institutionID,
+		})
+	}
+	if err := r.openToken(&requisition); err != nil {
+		return nil, repository.NewRequisitionError("get_active_by_user_and_institution", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
+	return &requisition, nil
+}
+
+func (r *RequisitionRepository) ConsumeCallbackState(ctx context.Context, reference, stateHash string) (*domain.Requisition, error) {
+	var requisition domain.Requisition
+	result := r.db.WithContext(ctx).
+		Model(&requisition).
+		Clauses(clause.Returning{}).
+		Where("reference = ? AND callback_state_hash = ? AND callback_state_expires_at > ?", reference, stateHash, time.Now()).
+		Updates(map[string]interface{}{
+			"callback_state_hash":       "",
+			"callback_state_expires_at": nil,
+		})
+	if result.Error != nil {
+		return nil, repository.NewRequisitionError("consume_callback_state", result.Error, map[string]interface{}{
+			"reference": reference,
+		})
+	}
+	if result.RowsAffected == 0 {
+		return nil, repository.NewRequisitionError("consume_callback_state", repository.ErrRequisitionNotFound, map[string]interface{}{
+			"reference": reference,
+		})
+	}
+	if err := r.openToken(&requisition); err != nil {
+		return nil, repository.NewRequisitionError("consume_callback_state", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
 	return &requisition, nil
 }
+
+func (r *RequisitionRepository) GetByStatus(ctx context.Context, statuses ...domain.RequisitionStatus) ([]domain.Requisition, error) {
+	var requisitions []domain.Requisition
+	result := r.db.WithContext(ctx).Where("status IN ? AND unlinked_at IS NULL", statuses).Find(&requisitions)
+	if result.Error != nil {
+		return nil, repository.NewRequisitionError("get_by_status", result.Error, map[string]interface{}{
+			"statuses": statuses,
+		})
+	}
+	for i := range requisitions {
+		if err := r.openToken(&requisitions[i]); err != nil {
+			return nil, repository.NewRequisitionError("get_by_status", err, map[string]interface{}{
+				"requisition_id": requisitions[i].ID,
+			})
+		}
+	}
+	return requisitions, nil
+}
+
+func (r *RequisitionRepository) Transition(ctx context.Context, requisition *domain.Requisition, transition *domain.RequisitionTransition) error {
+	restore, err := r.sealToken(requisition)
+	if err != nil {
+		return repository.NewRequisitionError("transition", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+		})
+	}
+	defer restore()
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(callbackStateColumns...).Where("id = ?", requisition.ID).Updates(requisition).Error; err != nil {
+			return err
+		}
+		return tx.Create(transition).Error
+	})
+	if err != nil {
+		return repository.NewRequisitionError("transition", err, map[string]interface{}{
+			"requisition_id": requisition.ID,
+			"from_status":    transition.FromStatus,
+			"to_status":      transition.ToStatus,
+		})
+	}
+	return nil
+}
+
+func (r *RequisitionRepository) GetTransitions(ctx context.Context, requisitionID string) ([]domain.RequisitionTransition, error) {
+	var transitions []domain.RequisitionTransition
+	result := r.db.WithContext(ctx).
+		Where("requisition_id = ?", requisitionID).
+		Order("created_at ASC").
+		Find(&transitions)
+	if result.Error != nil {
+		return nil, repository.NewRequisitionError("get_transitions", result.Error, map[string]interface{}{
+			"requisition_id": requisitionID,
+		})
+	}
+	return transitions, nil
+}
+
+func (r *RequisitionRepository) Unlink(ctx context.Context, requisitionID string, purge bool) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		accountIDs := tx.Model(&domain.BankAccount{}).Select("id").Where("requisition_id = ?", requisitionID)
+
+		if purge {
+			transactionIDs := tx.Model(&domain.Transaction{}).Select("id").Where("bank_account_id IN (?)", accountIDs)
+			if err := tx.Where("transaction_id IN (?)", transactionIDs).Delete(&domain.TransactionSplit{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&domain.Transaction{}).
+				Where("transfer_transaction_id IN (?)", transactionIDs).
+				Update("transfer_transaction_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("bank_account_id IN (?)", accountIDs).Delete(&domain.Transaction{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("bank_account_id IN (?)", accountIDs).Delete(&domain.BalanceSnapshot{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("bank_account_id IN (?)", accountIDs).Delete(&domain.RecurringSeries{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("requisition_id = ?", requisitionID).Delete(&domain.BankAccount{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("requisition_id = ?", requisitionID).Delete(&domain.RequisitionTransition{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id = ?", requisitionID).Delete(&domain.Requisition{}).Error
+		}
+
+		now := time.Now()
+		if err := tx.Model(&domain.BankAccount{}).
+			Where("requisition_id = ? AND archived_at IS NULL", requisitionID).
+			Update("archived_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Requisition{}).
+			Where("id = ?", requisitionID).
+			Update("unlinked_at", now).Error
+	})
+	if err != nil {
+		return repository.NewRequisitionError("unlink", err, map[string]interface{}{
+			"requisition_id": requisitionID,
+			"purge":          purge,
+		})
+	}
+	return nil
+}
+
+// sealToken encrypts the access token of a requisition in place for writing. The
+// returned function puts the plaintext back once the requisition is written.
+func (r *RequisitionRepository) sealToken(requisition *domain.Requisition) (func(), error) {
+	plaintext := requisition.AccessToken
+	if plaintext == "" {
+		return func() {}, nil
+	}
+	if r.key == nil {
+		return nil, errNoTokenKey
+	}
+
+	encrypted, err := utils.Encrypt(r.key, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	requisition.AccessToken = encrypted
+	return func() { requisition.AccessToken = plaintext }, nil
+}
+
+// openToken decrypts the access token of a requisition read from the database.
+// Tokens stored before they were encrypted are returned as they are, and
+// encrypted the next time the requisition is saved.
+func (r *RequisitionRepository) openToken(requisition *domain.Requisition) error {
+	if requisition.AccessToken == "" || strings.HasPrefix(requisition.AccessToken, legacyAccessTokenPrefix) {
+		return nil
+	}
+	if r.key == nil {
+		return errNoTokenKey
+	}
+
+	plaintext, err := utils.Decrypt(r.key, requisition.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	requisition.AccessToken = plaintext
+	return nil
+}
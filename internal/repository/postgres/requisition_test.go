@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"FinMa/internal/domain"
+)
+
+func TestRequisitionTokenEncryption(t *testing.T) {
+	r := NewRequisitionRepository(nil, make([]byte, 32))
+	requisition := &domain.Requisition{AccessToken: "access-sandbox-0b8e"}
+
+	restore, err := r.sealToken(requisition)
+	if err != nil {
+		t.Fatalf("sealToken() error = %v", err)
+	}
+	sealed := requisition.AccessToken
+	if sealed == "access-sandbox-0b8e" {
+		t.Fatal("sealToken() left the access token in plaintext")
+	}
+	restore()
+	if requisition.AccessToken != "access-sandbox-0b8e" {
+		t.Errorf("restored access token = %q", requisition.AccessToken)
+	}
+
+	read := &domain.Requisition{AccessToken: sealed}
+	if err := r.openToken(read); err != nil || read.AccessToken != "access-sandbox-0b8e" {
+		t.Errorf("openToken() = %q, %v", read.AccessToken, err)
+	}
+
+	// Tokens stored before they were encrypted are read as they are
+	legacy := &domain.Requisition{AccessToken: "access-production-1f2a"}
+	if err := r.openToken(legacy); err != nil || legacy.AccessToken != "access-production-1f2a" {
+		t.Errorf("openToken() of a legacy token = %q, %v", legacy.AccessToken, err)
+	}
+
+	// Without a key access tokens are never stored
+	keyless := NewRequisitionRepository(nil, nil)
+	if _, err := keyless.sealToken(&domain.Requisition{AccessToken: "access-sandbox-0b8e"}); !errors.Is(err, errNoTokenKey) {
+		t.Errorf("sealToken() without a key error = %v, want %v", err, errNoTokenKey)
+	}
+	if _, err := keyless.sealToken(&domain.Requisition{}); err != nil {
+		t.Errorf("sealToken() of a requisition without token error = %v", err)
+	}
+}
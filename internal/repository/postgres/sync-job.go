@@ -0,0 +1,171 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"FinMa/constants"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// SyncJobRepository implements the repository.SyncJobRepository interface
+type SyncJobRepository struct {
+	db *gorm.DB
+}
+
+// NewSyncJobRepository creates a new sync job repository
+func NewSyncJobRepository(db *gorm.DB) *SyncJobRepository {
+	return &SyncJobRepository{
+		db: db,
+	}
+}
+
+// activeSyncJobIndex is the unique index allowing one queued or running sync
+// job per requisition, created by the migrations
+const activeSyncJobIndex = "idx_sync_jobs_active_requisition"
+
+// uniqueViolation is the SQLSTATE of an insert violating a unique index
+const uniqueViolation = "23505"
+
+// Create adds a new sync job to the database
+func (r *SyncJobRepository) Create(ctx context.Context, job *domain.SyncJob) error {
+	if err := r.db.WithContext(ctx).Omit("User", "Accounts").Create(job).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == activeSyncJobIndex {
+			err = repository.ErrSyncJobAlreadyActive
+		}
+		return repository.NewSyncJobError("create", err, map[string]interface{}{
+			"requisition_id": job.RequisitionID,
+		})
+	}
+	return nil
+}
+
+// Update saves the status of a sync job. The heartbeat is only renewed by Heartbeat.
+func (r *SyncJobRepository) Update(ctx context.Context, job *domain.SyncJob) error {
+	if err := r.db.WithContext(ctx).Omit("User", "Accounts", "HeartbeatAt").Save(job).Error; err != nil {
+		return repository.NewSyncJobError("update", err, map[string]interface{}{
+			"sync_job_id": job.ID,
+		})
+	}
+	return nil
+}
+
+// Heartbeat renews the heartbeat of a sync job run by owner
+func (r *SyncJobRepository) Heartbeat(ctx context.Context, id uuid.UUID, owner string) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.SyncJob{}).
+		Where("id = ? AND owner = ?", id, owner).
+		UpdateColumn("heartbeat_at", time.Now())
+	if result.Error != nil {
+		return repository.NewSyncJobError("heartbeat", result.Error, map[string]interface{}{
+			"sync_job_id": id,
+		})
+	}
+	return nil
+}
+
+// GetByID retrieves a sync job by ID with the results of its accounts
+func (r *SyncJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.SyncJob, error) {
+	var job domain.SyncJob
+	result := r.db.WithContext(ctx).
+		Preload("Accounts", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC")
+		}).
+		First(&job, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewSyncJobError("get_by_id", repository.ErrSyncJobNotFound, map[string]interface{}{
+				"sync_job_id": id,
+			})
+		}
+		return nil, repository.NewSyncJobError("get_by_id", result.Error, map[string]interface{}{
+			"sync_job_id": id,
+		})
+	}
+	return &job, nil
+}
+
+// GetActiveByRequisitionID retrieves the most recent queued or running sync job of a requisition
+func (r *SyncJobRepository) GetActiveByRequisitionID(ctx context.Context, requisitionID string) (*domain.SyncJob, error) {
+	var job domain.SyncJob
+	result := r.db.WithContext(ctx).
+		Where("requisition_id = ? AND status IN ?", requisitionID, []string{constants.SYNC_JOB_STATUS_QUEUED, constants.SYNC_JOB_STATUS_RUNNING}).
+		Order("created_at DESC").
+		First(&job)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewSyncJobError("get_active_by_requisition_id", repository.ErrSyncJobNotFound, map[string]interface{}{
+				"requisition_id": requisitionID,
+			})
+		}
+		return nil, repository.NewSyncJobError("get_active_by_requisition_id", result.Error, map[string]interface{}{
+			"requisition_id": requisitionID,
+		})
+	}
+	return &job, nil
+}
+
+// GetLatestByRequisitionID retrieves the most recent sync job of a requisition with the results of its accounts
+func (r *SyncJobRepository) GetLatestByRequisitionID(ctx context.Context, requisitionID string) (*domain.SyncJob, error) {
+	var job domain.SyncJob
+	result := r.db.WithContext(ctx).
+		Preload("Accounts").
+		Where("requisition_id = ?", requisitionID).
+		Order("created_at DESC").
+		First(&job)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, repository.NewSyncJobError("get_latest_by_requisition_id", repository.ErrSyncJobNotFound, map[string]interface{}{
+				"requisition_id": requisitionID,
+			})
+		}
+		return nil, repository.NewSyncJobError("get_latest_by_requisition_id", result.Error, map[string]interface{}{
+			"requisition_id": requisitionID,
+		})
+	}
+	return &job, nil
+}
+
+// SaveAccount upserts the result of an account within a sync job
+func (r *SyncJobRepository) SaveAccount(ctx context.Context, account *domain.SyncJobAccount) error {
+	err := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sync_job_id"}, {Name: "account_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"bank_account_id", "status", "error", "retry_at", "updated_at"}),
+		}).
+		Create(account).Error
+	if err != nil {
+		return repository.NewSyncJobError("save_account", err, map[string]interface{}{
+			"sync_job_id": account.SyncJobID,
+			"account_id":  account.AccountID,
+		})
+	}
+	return nil
+}
+
+// FailStale marks the queued or running jobs whose heartbeat is older than
+// staleBefore as failed. Jobs created before heartbeats were recorded are
+// judged by their last update.
+func (r *SyncJobRepository) FailStale(ctx context.Context, staleBefore time.Time, reason string) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Model(&domain.SyncJob{}).
+		Where("status IN ? AND COALESCE(heartbeat_at, updated_at) < ?",
+			[]string{constants.SYNC_JOB_STATUS_QUEUED, constants.SYNC_JOB_STATUS_RUNNING}, staleBefore).
+		Updates(map[string]interface{}{
+			"status":      constants.SYNC_JOB_STATUS_FAILED,
+			"error":       reason,
+			"finished_at": time.Now(),
+		})
+	if result.Error != nil {
+		return 0, repository.NewSyncJobError("fail_stale", result.Error)
+	}
+	return result.RowsAffected, nil
+}
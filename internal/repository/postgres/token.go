@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/utils"
+)
+
+// errTokenUndecryptable is returned when a stored token cannot be decrypted, e.g. after the key changed
+var errTokenUndecryptable = errors.New("token cannot be decrypted")
+
+// TokenRepository implements the repository.TokenRepository interface.
+// Tokens are encrypted with AES-GCM before they are written.
+type TokenRepository struct {
+	db  *gorm.DB
+	key []byte
+}
+
+// NewTokenRepository creates a new token repository encrypting tokens with key
+func NewTokenRepository(db *gorm.DB, key []byte) *TokenRepository {
+	return &TokenRepository{
+		db:  db,
+		key: key,
+	}
+}
+
+// GetByProvider retrieves the decrypted token of a provider
+func (r *TokenRepository) GetByProvider(ctx context.Context, provider string) (*domain.ProviderToken, error) {
+	token, err := r.get(r.db.WithContext(ctx), provider)
+	if err != nil {
+		return nil, repository.NewTokenError("get_by_provider", err, map[string]interface{}{
+			"provider": provider,
+		})
+	}
+	return token, nil
+}
+
+// Save encrypts and stores the token of a provider, replacing the previous one
+func (r *TokenRepository) Save(ctx context.Context, token *domain.ProviderToken) error {
+	if err := r.save(r.db.WithContext(ctx), token); err != nil {
+		return repository.NewTokenError("save", err, map[string]interface{}{
+			"provider": token.Provider,
+		})
+	}
+	return nil
+}
+
+// Delete removes the token of a provider
+func (r *TokenRepository) Delete(ctx context.Context, provider string) error {
+	if err := r.db.WithContext(ctx).Delete(&domain.ProviderToken{}, "provider = ?", provider).Error; err != nil {
+		return repository.NewTokenError("delete", err, map[string]interface{}{
+			"provider": provider,
+		})
+	}
+	return nil
+}
+
+// WithRefreshLock serializes token renewals across instances with a
+// transaction-scoped advisory lock, released when the transaction ends
+func (r *TokenRepository) WithRefreshLock(ctx context.Context, provider string, renew func(stored *domain.ProviderToken) (*domain.ProviderToken, error)) (*domain.ProviderToken, error) {
+	var renewed *domain.ProviderToken
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "provider_token:"+provider).Error; err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		// Read after locking, another instance may have renewed the token while we
+		// waited. A token that cannot be decrypted is replaced by the renewed one.
+		stored, err := r.get(tx, provider)
+		if err != nil && !errors.Is(err, repository.ErrTokenNotFound) && !errors.Is(err, errTokenUndecryptable) {
+			return err
+		}
+
+		renewed, err = renew(stored)
+		if err != nil {
+			return err
+		}
+		if renewed == stored {
+			return nil
+		}
+
+		renewed.Provider = provider
+		return r.save(tx, renewed)
+	})
+	if err != nil {
+		return nil, repository.NewTokenError("refresh", err, map[string]interface{}{
+			"provider": provider,
+		})
+	}
+
+	return renewed, nil
+}
+
+// get reads and decrypts a token
+func (r *TokenRepository) get(db *gorm.DB, provider string) (*domain.ProviderToken, error) {
+	var token domain.ProviderToken
+	if err := db.First(&token, "provider = ?", provider).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, repository.ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	var err error
+	if token.AccessToken, err = utils.Decrypt(r.key, token.AccessToken); err != nil {
+		return nil, fmt.Errorf("%w: access token: %v", errTokenUndecryptable, err)
+	}
+	if token.RefreshToken, err = utils.Decrypt(r.key, token.RefreshToken); err != nil {
+		return nil, fmt.Errorf("%w: refresh token: %v", errTokenUndecryptable, err)
+	}
+
+	return &token, nil
+}
+
+// save encrypts and upserts a token. The caller's token is left decrypted.
+func (r *TokenRepository) save(db *gorm.DB, token *domain.ProviderToken) error {
+	encrypted := *token
+
+	var err error
+	if encrypted.AccessToken, err = utils.Encrypt(r.key, token.AccessToken); err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	if encrypted.RefreshToken, err = utils.Encrypt(r.key, token.RefreshToken); err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"access_token", "refresh_token", "access_expires", "refresh_expires", "updated_at"}),
+	}).Create(&encrypted).Error
+}
@@ -3,12 +3,16 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"FinMa/constants"
 	"FinMa/internal/domain"
 	"FinMa/internal/repository"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type transactionRepository struct {
@@ -37,6 +41,277 @@ func (r *transactionRepository) CreateInBatches(ctx context.Context, transaction
 	return nil
 }
 
+func (r *transactionRepository) UpsertInBatches(ctx context.Context, transactions []*domain.Transaction) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "bank_account_id"}, {Name: "provider_transaction_id"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "provider_transaction_id <> ''"}}},
+			DoNothing:   true,
+		}).
+		CreateInBatches(transactions, 100)
+	if result.Error != nil {
+		return fmt.Errorf("failed to upsert transactions in batches: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *transactionRepository) Update(ctx context.Context, transaction *domain.Transaction) error {
+	result := r.db.WithContext(ctx).Omit("User", "BankAccount", "Splits").Save(transaction)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update transaction: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *transactionRepository) CreateManual(ctx context.Context, transaction *domain.Transaction) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "BankAccount", "Splits").Create(transaction).Error; err != nil {
+			return err
+		}
+		return adjustBalances(tx, transaction.BankAccountID, transaction.Amount)
+	})
+	if err != nil {
+		return repository.NewTransactionError("create_manual", err, map[string]interface{}{
+			"bank_account_id": transaction.BankAccountID,
+		})
+	}
+	return nil
+}
+
+func (r *transactionRepository) UpdateManual(ctx context.Context, transaction *domain.Transaction, previousAmount float64) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "BankAccount", "Splits").Save(transaction).Error; err != nil {
+			return err
+		}
+		// Splits of the previous amount no longer add up
+		if transaction.Amount != previousAmount && len(transaction.Splits) > 0 {
+			if err := tx.Where("transaction_id = ?", transaction.ID).Delete(&domain.TransactionSplit{}).Error; err != nil {
+				return err
+			}
+			transaction.Splits = nil
+		}
+		// Nor does the other side of its transfer match any more
+		if transaction.Amount != previousAmount && transaction.TransferTransactionID != nil {
+			if err := unlinkTransfers(tx, []uuid.UUID{transaction.ID}); err != nil {
+				return err
+			}
+			transaction.TransferTransactionID = nil
+		}
+		return adjustBalances(tx, transaction.BankAccountID, transaction.Amount-previousAmount)
+	})
+	if err != nil {
+		return repository.NewTransactionError("update_manual", err, map[string]interface{}{
+			"transaction_id": transaction.ID,
+		})
+	}
+	return nil
+}
+
+func (r *transactionRepository) DeleteManual(ctx context.Context, transaction *domain.Transaction) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transaction_id = ?", transaction.ID).Delete(&domain.TransactionSplit{}).Error; err != nil {
+			return err
+		}
+		if err := unlinkTransfers(tx, []uuid.UUID{transaction.ID}); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", transaction.ID).Delete(&domain.Transaction{}).Error; err != nil {
+			return err
+		}
+		return adjustBalances(tx, transaction.BankAccountID, -transaction.Amount)
+	})
+	if err != nil {
+		return repository.NewTransactionError("delete_manual", err, map[string]interface{}{
+			"transaction_id": transaction.ID,
+		})
+	}
+	return nil
+}
+
+func (r *transactionRepository) UpdateCategorization(ctx context.Context, transaction *domain.Transaction) error {
+	err := r.db.WithContext(ctx).
+		Model(transaction).
+		Select("category", "type", "tags", "category_source", "category_confidence").
+		Updates(transaction).Error
+	if err != nil {
+		return repository.NewTransactionError("update_categorization", err, map[string]interface{}{
+			"transaction_id": transaction.ID,
+		})
+	}
+	return nil
+}
+
+func (r *transactionRepository) GetUserCategorized(ctx context.Context, userID uuid.UUID, limit int) ([]domain.Transaction, error) {
+	var transactions []domain.Transaction
+	err := r.db.WithContext(ctx).
+		Select("id", "category", "amount", "description", "creditor_name", "debtor_name").
+		Where("user_id = ? AND category_source = ? AND category <> ''", userID, constants.CATEGORY_SOURCE_USER).
+		Order("date DESC").
+		Limit(limit).
+		Find(&transactions).Error
+	if err != nil {
+		return nil, repository.NewTransactionError("get_user_categorized", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return transactions, nil
+}
+
+func (r *transactionRepository) GetBookedByUserIDSince(ctx context.Context, userID uuid.UUID, since time.Time) ([]domain.Transaction, error) {
+	var transactions []domain.Transaction
+	err := r.db.WithContext(ctx).
+		Select("id", "category", "amount", "date", "description", "currency",
+			"creditor_name", "creditor_iban", "debtor_name", "debtor_iban", "bank_account_id", "user_id", "transfer_transaction_id").
+		Where("user_id = ? AND status = ? AND date >= ?", userID, constants.TRANSACTION_STATUS_BOOKED, since).
+		Order("date ASC, id ASC").
+		Find(&transactions).Error
+	if err != nil {
+		return nil, repository.NewTransactionError("get_booked_by_user_id_since", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return transactions, nil
+}
+
+// adjustBalances moves the balances of a bank account by delta, rounded to
+// cents. The update is relative, so concurrent changes to the same account do
+// not overwrite each other.
+func adjustBalances(tx *gorm.DB, bankAccountID uuid.UUID, delta float64) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Model(&domain.BankAccount{}).
+		Where("id = ?", bankAccountID).
+		Updates(map[string]interface{}{
+			"balance_available": gorm.Expr("ROUND((balance_available + ?)::numeric, 2)", delta),
+			"balance_current":   gorm.Expr("ROUND((balance_current + ?)::numeric, 2)", delta),
+		}).Error
+}
+
+func (r *transactionRepository) DeleteByIDs(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transaction_id IN ?", ids).Delete(&domain.TransactionSplit{}).Error; err != nil {
+			return err
+		}
+		if err := unlinkTransfers(tx, ids); err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&domain.Transaction{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete transactions: %w", err)
+	}
+	return nil
+}
+
+func (r *transactionRepository) ReplaceSplits(ctx context.Context, transactionID uuid.UUID, splits []domain.TransactionSplit) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("transaction_id = ?", transactionID).Delete(&domain.TransactionSplit{}).Error; err != nil {
+			return err
+		}
+		if len(splits) == 0 {
+			return nil
+		}
+		return tx.Create(&splits).Error
+	})
+	if err != nil {
+		return repository.NewTransactionError("replace_splits", err, map[string]interface{}{
+			"transaction_id": transactionID,
+		})
+	}
+	return nil
+}
+
+func (r *transactionRepository) LinkTransfers(ctx context.Context, pairs []repository.TransferPair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, pair := range pairs {
+			ids := []uuid.UUID{pair.OutgoingID, pair.IncomingID}
+			result := tx.Model(&domain.Transaction{}).
+				Where("id IN ? AND transfer_transaction_id IS NULL", ids).
+				Update("transfer_transaction_id", gorm.Expr("CASE WHEN id = ? THEN ?::uuid ELSE ?::uuid END", pair.OutgoingID, pair.IncomingID, pair.OutgoingID))
+			if result.Error != nil {
+				return result.Error
+			}
+			// The other side was linked meanwhile; transfers are only ever linked as pairs
+			if result.RowsAffected == 1 {
+				if err := tx.Model(&domain.Transaction{}).
+					Where("id IN ? AND transfer_transaction_id IN ?", ids, ids).
+					Update("transfer_transaction_id", nil).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return repository.NewTransactionError("link_transfers", err, map[string]interface{}{
+			"pairs": len(pairs),
+		})
+	}
+	return nil
+}
+
+// unlinkTransfers removes the links between the given transactions and the other sides of their transfers
+func unlinkTransfers(tx *gorm.DB, ids []uuid.UUID) error {
+	return tx.Model(&domain.Transaction{}).
+		Where("id IN ? OR transfer_transaction_id IN ?", ids, ids).
+		Update("transfer_transaction_id", nil).Error
+}
+
+func (r *transactionRepository) GetCategoryTotals(ctx context.Context, userID uuid.UUID, from, to time.Time) ([]repository.CategoryTotal, error) {
+	// Split transactions count once per split, each towards its own category
+	const amount = "COALESCE(s.amount, t.amount)"
+	var totals []repository.CategoryTotal
+	err := r.db.WithContext(ctx).
+		Table("transactions AS t").
+		Select("COALESCE(s.category, t.category) AS category, t.currency AS currency, "+
+			"SUM(CASE WHEN "+amount+" > 0 THEN "+amount+" ELSE 0 END) AS income, "+
+			"SUM(CASE WHEN "+amount+" < 0 THEN -"+amount+" ELSE 0 END) AS expense, "+
+			"COUNT(DISTINCT t.id) AS transactions").
+		Joins("LEFT JOIN transaction_splits AS s ON s.transaction_id = t.id").
+		Where("t.user_id = ? AND t.status = ? AND t.transfer_transaction_id IS NULL AND t.date >= ? AND t.date < ?",
+			userID, constants.TRANSACTION_STATUS_BOOKED, from, to.AddDate(0, 0, 1)).
+		Group("COALESCE(s.category, t.category), t.currency").
+		Order("expense DESC, category ASC").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, repository.NewTransactionError("get_category_totals", err, map[string]interface{}{
+			"user_id": userID,
+		})
+	}
+	return totals, nil
+}
+
+func (r *transactionRepository) GetPendingTotals(ctx context.Context, bankAccountIDs []uuid.UUID) (map[uuid.UUID]repository.PendingTotal, error) {
+	totals := make(map[uuid.UUID]repository.PendingTotal)
+	if len(bankAccountIDs) == 0 {
+		return totals, nil
+	}
+
+	var rows []repository.PendingTotal
+	err := r.db.WithContext(ctx).
+		Model(&domain.Transaction{}).
+		Select("bank_account_id, SUM(amount) AS amount, COUNT(*) AS count").
+		Where("bank_account_id IN ? AND status = ?", bankAccountIDs, constants.TRANSACTION_STATUS_PENDING).
+		Group("bank_account_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, repository.NewTransactionError("get_pending_totals", err, map[string]interface{}{
+			"bank_account_ids": bankAccountIDs,
+		})
+	}
+	for _, row := range rows {
+		totals[row.BankAccountID] = row
+	}
+	return totals, nil
+}
+
 func (r *transactionRepository) GetByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error) {
 	var transactions []domain.Transaction
 	result := r.db.WithContext(ctx).Where("bank_account_id = ?", bankAccountID).Find(&transactions)
@@ -46,9 +321,128 @@ func (r *transactionRepository) GetByBankAccountID(ctx context.Context, bankAcco
 	return transactions, nil
 }
 
+func (r *transactionRepository) List(ctx context.Context, filter repository.TransactionFilter) ([]domain.Transaction, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", filter.UserID)
+
+	if len(filter.BankAccountIDs) > 0 {
+		query = query.Where("bank_account_id IN ?", filter.BankAccountIDs)
+	}
+	if filter.From != nil {
+		query = query.Where("date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("date < ?", filter.To.AddDate(0, 0, 1))
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.Category != "" {
+		// The categories of its splits replace the category of a split transaction
+		query = query.Where(
+			"(category = ? AND NOT EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_id = transactions.id)) OR "+
+				"EXISTS (SELECT 1 FROM transaction_splits WHERE transaction_id = transactions.id AND category = ?)",
+			filter.Category, filter.Category)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		query = query.Where("description ILIKE ? OR creditor_name ILIKE ? OR debtor_name ILIKE ?", pattern, pattern, pattern)
+	}
+
+	// Keyset pagination: continue after the (sort value, id) of the previous page
+	column, direction := "date", "DESC"
+	switch filter.Sort {
+	case constants.TRANSACTION_SORT_DATE_ASC:
+		direction = "ASC"
+	case constants.TRANSACTION_SORT_AMOUNT_DESC:
+		column = "amount"
+	case constants.TRANSACTION_SORT_AMOUNT_ASC:
+		column, direction = "amount", "ASC"
+	}
+	if filter.After != nil {
+		comparison := "<"
+		if direction == "ASC" {
+			comparison = ">"
+		}
+		var value interface{} = filter.After.Date
+		if column == "amount" {
+			value = filter.After.Amount
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, comparison), value, filter.After.ID)
+	}
+
+	var transactions []domain.Transaction
+	result := query.
+		Preload("Splits", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(filter.Limit).
+		Find(&transactions)
+	if result.Error != nil {
+		return nil, repository.NewTransactionError("list", result.Error, map[string]interface{}{
+			"user_id": filter.UserID,
+		})
+	}
+	return transactions, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+func (r *transactionRepository) GetPendingByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error) {
+	var transactions []domain.Transaction
+	result := r.db.WithContext(ctx).
+		Where("bank_account_id = ? AND status = ?", bankAccountID, constants.TRANSACTION_STATUS_PENDING).
+		Find(&transactions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get pending transactions by bank account ID: %w", result.Error)
+	}
+	return transactions, nil
+}
+
+func (r *transactionRepository) GetWithoutProviderIDByBankAccountID(ctx context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error) {
+	var transactions []domain.Transaction
+	result := r.db.WithContext(ctx).
+		Where("bank_account_id = ? AND (provider_transaction_id IS NULL OR provider_transaction_id = '')", bankAccountID).
+		Find(&transactions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get transactions without provider ID: %w", result.Error)
+	}
+	return transactions, nil
+}
+
+func (r *transactionRepository) GetProviderTransactionIDs(ctx context.Context, bankAccountID uuid.UUID) (map[string]bool, error) {
+	var ids []string
+	result := r.db.WithContext(ctx).
+		Model(&domain.Transaction{}).
+		Where("bank_account_id = ? AND provider_transaction_id <> ''", bankAccountID).
+		Pluck("provider_transaction_id", &ids)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get provider transaction IDs: %w", result.Error)
+	}
+
+	existing := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
 func (r *transactionRepository) GetByTransactionID(ctx context.Context, transactionID string) (domain.Transaction, error) {
 	var transaction domain.Transaction
-	result := r.db.WithContext(ctx).Where("id = ?", transactionID).First(&transaction)
+	result := r.db.WithContext(ctx).
+		Preload("Splits", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC") }).
+		Where("id = ?", transactionID).
+		First(&transaction)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return domain.Transaction{}, repository.ErrNotFound
@@ -58,9 +452,12 @@ func (r *transactionRepository) GetByTransactionID(ctx context.Context, transact
 	return transaction, nil
 }
 
-func (r *transactionRepository) ExistsByTransactionID(ctx context.Context, transactionID string) (bool, error) {
+func (r *transactionRepository) ExistsByProviderTransactionID(ctx context.Context, bankAccountID uuid.UUID, providerTransactionID string) (bool, error) {
 	var count int64
-	err := r.db.WithContext(ctx).Model(&domain.Transaction{}).Where("id = ?", transactionID).Count(&count).Error
+	err := r.db.WithContext(ctx).
+		Model(&domain.Transaction{}).
+		Where("bank_account_id = ? AND provider_transaction_id = ?", bankAccountID, providerTransactionID).
+		Count(&count).Error
 	if err != nil {
 		return false, fmt.Errorf("failed to check if transaction exists: %w", err)
 	}
@@ -2,25 +2,56 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"FinMa/dto"
+	"FinMa/internal/aggregator"
+	"FinMa/internal/domain"
 	"FinMa/internal/repository"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotManualAccount is returned when what the bank reports is changed on a synced account
+var ErrNotManualAccount = errors.New("bank account is synced from a bank")
+
 type BankAccountService interface {
 	GetBankAccountsForUser(ctx context.Context, userID uuid.UUID) ([]dto.BankAccountResponse, error)
+	// GetBankAccount retrieves an account of the user, archived or not
+	GetBankAccount(ctx context.Context, userID, bankAccountID uuid.UUID) (*dto.BankAccountResponse, error)
+	// GetBankAccountBalances returns the current balances of an account and the latest of every balance type the bank reported
+	GetBankAccountBalances(ctx context.Context, userID, bankAccountID uuid.UUID) (*dto.AccountBalancesResponse, error)
+	// CreateManualAccount creates an account whose balance and transactions the user enters
+	CreateManualAccount(ctx context.Context, userID uuid.UUID, req dto.CreateManualAccountRequest) (*dto.BankAccountResponse, error)
+	// UpdateBankAccount changes the display name, totals visibility or display order of an account,
+	// and the balance of a manual account
+	UpdateBankAccount(ctx context.Context, userID, bankAccountID uuid.UUID, req dto.UpdateBankAccountRequest) (*dto.BankAccountResponse, error)
+	// DeleteManualAccount deletes a manual account with its transactions and balance history.
+	// Synced accounts are removed by unlinking their requisition.
+	DeleteManualAccount(ctx context.Context, userID, bankAccountID uuid.UUID) error
+	// GetBalanceHistory returns every balance type of an account on the days it was synced between from and to
+	GetBalanceHistory(ctx context.Context, userID, bankAccountID uuid.UUID, from, to time.Time) (*dto.BalanceHistoryResponse, error)
+	// GetTotalBalanceHistory returns the daily total of a balance type across the user's accounts, per currency.
+	// Accounts not synced on a day count with their last known balance.
+	GetTotalBalanceHistory(ctx context.Context, userID uuid.UUID, balanceType string, from, to time.Time) (*dto.BalanceHistoryResponse, error)
 }
 
 type bankAccountService struct {
-	bankAccountRepo repository.BankAccountRepository
+	bankAccountRepo     repository.BankAccountRepository
+	transactionRepo     repository.TransactionRepository
+	balanceSnapshotRepo repository.BalanceSnapshotRepository
 }
 
-func NewBankAccountService(bankAccountRepo repository.BankAccountRepository) BankAccountService {
+func NewBankAccountService(bankAccountRepo repository.BankAccountRepository, transactionRepo repository.TransactionRepository, balanceSnapshotRepo repository.BalanceSnapshotRepository) BankAccountService {
 	return &bankAccountService{
-		bankAccountRepo: bankAccountRepo,
+		bankAccountRepo:     bankAccountRepo,
+		transactionRepo:     transactionRepo,
+		balanceSnapshotRepo: balanceSnapshotRepo,
 	}
 }
 
@@ -30,22 +61,343 @@ func (s *bankAccountService) GetBankAccountsForUser(ctx context.Context, userID
 		return nil, fmt.Errorf("failed to get bank accounts for user %s: %w", userID, err)
 	}
 
+	ids := make([]uuid.UUID, 0, len(accounts))
+	for _, account := range accounts {
+		ids = append(ids, account.ID)
+	}
+	pending, err := s.transactionRepo.GetPendingTotals(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending totals for user %s: %w", userID, err)
+	}
+
 	var response []dto.BankAccountResponse
-	for _, acc := range accounts {
-		response = append(response, dto.BankAccountResponse{
-			ID:               acc.ID,
-			AccountID:        acc.AccountID,
-			Name:             acc.Name,
-			Type:             acc.Type,
-			Currency:         acc.Currency,
-			InstitutionName:  acc.InstitutionName,
-			BalanceAvailable: acc.BalanceAvailable,
-			BalanceCurrent:   acc.BalanceCurrent,
-			IBAN:             acc.IBAN,
-			CreatedAt:        acc.CreatedAt,
-			UpdatedAt:        acc.UpdatedAt,
+	for i := range accounts {
+		response = append(response, bankAccountResponse(&accounts[i], pending[accounts[i].ID]))
+	}
+
+	return response, nil
+}
+
+func (s *bankAccountService) GetBankAccount(ctx context.Context, userID, bankAccountID uuid.UUID) (*dto.BankAccountResponse, error) {
+	account, err := s.ownedAccount(ctx, userID, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := s.pendingTotal(ctx, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+	response := bankAccountResponse(account, pending)
+	return &response, nil
+}
+
+func (s *bankAccountService) GetBankAccountBalances(ctx context.Context, userID, bankAccountID uuid.UUID) (*dto.AccountBalancesResponse, error) {
+	account, err := s.ownedAccount(ctx, userID, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.balanceSnapshotRepo.GetLatestByBankAccountID(ctx, bankAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest balances of bank account %s: %w", bankAccountID, err)
+	}
+
+	pending, err := s.pendingTotal(ctx, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+	response := &dto.AccountBalancesResponse{
+		BankAccountID:    account.ID,
+		Currency:         account.Currency,
+		BalanceAvailable: account.BalanceAvailable,
+		BalanceCurrent:   account.BalanceCurrent,
+		PendingAmount:    roundCents(pending.Amount),
+		PendingCount:     pending.Count,
+		Balances:         make([]dto.LatestBalance, 0, len(snapshots)),
+	}
+	for _, snapshot := range snapshots {
+		response.Balances = append(response.Balances, dto.LatestBalance{
+			BalanceType:   snapshot.BalanceType,
+			Amount:        snapshot.Amount,
+			Currency:      snapshot.Currency,
+			Date:          snapshot.Date.Format(time.DateOnly),
+			ReferenceDate: snapshot.ReferenceDate,
 		})
 	}
 
 	return response, nil
 }
+
+func (s *bankAccountService) CreateManualAccount(ctx context.Context, userID uuid.UUID, req dto.CreateManualAccountRequest) (*dto.BankAccountResponse, error) {
+	balance := roundCents(req.Balance)
+	account := &domain.BankAccount{
+		ID:               uuid.New(),
+		Name:             strings.TrimSpace(req.Name),
+		Type:             req.Type,
+		Currency:         req.Currency,
+		InstitutionName:  strings.TrimSpace(req.InstitutionName),
+		IBAN:             normalizeIBAN(req.IBAN),
+		BalanceAvailable: balance,
+		BalanceCurrent:   balance,
+		UserID:           userID,
+	}
+	if err := s.bankAccountRepo.Create(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to create manual account for user %s: %w", userID, err)
+	}
+	if err := s.balanceSnapshotRepo.Upsert(ctx, manualBalanceSnapshots(account)); err != nil {
+		return nil, fmt.Errorf("failed to save balance of manual account %s: %w", account.ID, err)
+	}
+
+	// A new account has no transactions yet
+	response := bankAccountResponse(account, repository.PendingTotal{})
+	return &response, nil
+}
+
+func (s *bankAccountService) UpdateBankAccount(ctx context.Context, userID, bankAccountID uuid.UUID, req dto.UpdateBankAccountRequest) (*dto.BankAccountResponse, error) {
+	account, err := s.ownedAccount(ctx, userID, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+	// The bank reports the balance of synced accounts
+	if req.Balance != nil && !account.IsManual() {
+		return nil, fmt.Errorf("cannot set the balance of bank account %s: %w", bankAccountID, ErrNotManualAccount)
+	}
+
+	if req.DisplayName != nil {
+		account.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.HiddenFromTotals != nil {
+		account.HiddenFromTotals = *req.HiddenFromTotals
+	}
+	if req.DisplayOrder != nil {
+		account.DisplayOrder = *req.DisplayOrder
+	}
+	if err := s.bankAccountRepo.UpdateSettings(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to update bank account %s: %w", bankAccountID, err)
+	}
+
+	if req.Balance != nil {
+		account.BalanceAvailable = roundCents(*req.Balance)
+		account.BalanceCurrent = account.BalanceAvailable
+		if err := s.bankAccountRepo.UpdateBalances(ctx, bankAccountID, account.BalanceAvailable, account.BalanceCurrent); err != nil {
+			return nil, fmt.Errorf("failed to update balance of bank account %s: %w", bankAccountID, err)
+		}
+		if err := s.balanceSnapshotRepo.Upsert(ctx, manualBalanceSnapshots(account)); err != nil {
+			return nil, fmt.Errorf("failed to save balance of manual account %s: %w", bankAccountID, err)
+		}
+	}
+
+	pending, err := s.pendingTotal(ctx, bankAccountID)
+	if err != nil {
+		return nil, err
+	}
+	response := bankAccountResponse(account, pending)
+	return &response, nil
+}
+
+func (s *bankAccountService) DeleteManualAccount(ctx context.Context, userID, bankAccountID uuid.UUID) error {
+	account, err := s.ownedAccount(ctx, userID, bankAccountID)
+	if err != nil {
+		return err
+	}
+	if !account.IsManual() {
+		return fmt.Errorf("cannot delete bank account %s: %w", bankAccountID, ErrNotManualAccount)
+	}
+	if err := s.bankAccountRepo.Delete(ctx, bankAccountID); err != nil {
+		return fmt.Errorf("failed to delete manual account %s: %w", bankAccountID, err)
+	}
+	return nil
+}
+
+// manualBalanceSnapshots records the balance of a manual account as of today,
+// under the balance types synced accounts report, so balance history and
+// totals include it
+func manualBalanceSnapshots(account *domain.BankAccount) []*domain.BalanceSnapshot {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	snapshot := func(balanceType string, amount float64) *domain.BalanceSnapshot {
+		return &domain.BalanceSnapshot{
+			ID:            uuid.New(),
+			BankAccountID: account.ID,
+			BalanceType:   balanceType,
+			Date:          today,
+			Amount:        amount,
+			Currency:      account.Currency,
+			UserID:        account.UserID,
+		}
+	}
+	return []*domain.BalanceSnapshot{
+		snapshot(aggregator.BalanceTypeAvailable, account.BalanceAvailable),
+		snapshot(aggregator.BalanceTypeCurrent, account.BalanceCurrent),
+	}
+}
+
+// ownedAccount retrieves a bank account and checks that it belongs to the user
+func (s *bankAccountService) ownedAccount(ctx context.Context, userID, bankAccountID uuid.UUID) (*domain.BankAccount, error) {
+	account, err := s.bankAccountRepo.GetByID(ctx, bankAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bank account %s: %w", bankAccountID, err)
+	}
+	if account.UserID != userID {
+		return nil, fmt.Errorf("bank account %s does not belong to user: %w", bankAccountID, repository.ErrForbidden)
+	}
+	return &account, nil
+}
+
+// pendingTotal sums the pending transactions of a bank account
+func (s *bankAccountService) pendingTotal(ctx context.Context, bankAccountID uuid.UUID) (repository.PendingTotal, error) {
+	totals, err := s.transactionRepo.GetPendingTotals(ctx, []uuid.UUID{bankAccountID})
+	if err != nil {
+		return repository.PendingTotal{}, fmt.Errorf("failed to get pending total of bank account %s: %w", bankAccountID, err)
+	}
+	return totals[bankAccountID], nil
+}
+
+// bankAccountResponse converts a bank account and the total of its pending transactions to its client representation
+func bankAccountResponse(account *domain.BankAccount, pending repository.PendingTotal) dto.BankAccountResponse {
+	return dto.BankAccountResponse{
+		ID:                account.ID,
+		AccountID:         stringValue(account.AccountID),
+		Name:              account.Name,
+		Type:              account.Type,
+		Currency:          account.Currency,
+		InstitutionName:   account.InstitutionName,
+		BalanceAvailable:  account.BalanceAvailable,
+		BalanceCurrent:    account.BalanceCurrent,
+		PendingAmount:     roundCents(pending.Amount),
+		PendingCount:      pending.Count,
+		IBAN:              account.IBAN,
+		DisplayName:       account.DisplayName,
+		HiddenFromTotals:  account.HiddenFromTotals,
+		DisplayOrder:      account.DisplayOrder,
+		RequisitionID:     stringValue(account.RequisitionID),
+		Manual:            account.IsManual(),
+		SyncDeferredUntil: account.SyncDeferredUntil,
+		ArchivedAt:        account.ArchivedAt,
+		CreatedAt:         account.CreatedAt,
+		UpdatedAt:         account.UpdatedAt,
+	}
+}
+
+// stringValue returns the string a pointer refers to, empty for nil
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func (s *bankAccountService) GetBalanceHistory(ctx context.Context, userID, bankAccountID uuid.UUID, from, to time.Time) (*dto.BalanceHistoryResponse, error) {
+	if _, err := s.ownedAccount(ctx, userID, bankAccountID); err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.balanceSnapshotRepo.GetByBankAccountID(ctx, bankAccountID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance history of bank account %s: %w", bankAccountID, err)
+	}
+
+	// Snapshots come oldest first, so every series stays in date order
+	var series []dto.BalanceSeries
+	index := make(map[[2]string]int)
+	for _, snapshot := range snapshots {
+		key := [2]string{snapshot.BalanceType, snapshot.Currency}
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, dto.BalanceSeries{
+				BalanceType: snapshot.BalanceType,
+				Currency:    snapshot.Currency,
+				Points:      []dto.BalancePoint{},
+			})
+		}
+		series[i].Points = append(series[i].Points, dto.BalancePoint{
+			Date:   snapshot.Date.Format(time.DateOnly),
+			Amount: snapshot.Amount,
+		})
+	}
+	sort.SliceStable(series, func(i, j int) bool {
+		return series[i].BalanceType < series[j].BalanceType
+	})
+
+	return &dto.BalanceHistoryResponse{
+		BankAccountID: &bankAccountID,
+		From:          from.Format(time.DateOnly),
+		To:            to.Format(time.DateOnly),
+		Series:        nonNilSeries(series),
+	}, nil
+}
+
+func (s *bankAccountService) GetTotalBalanceHistory(ctx context.Context, userID uuid.UUID, balanceType string, from, to time.Time) (*dto.BalanceHistoryResponse, error) {
+	snapshots, err := s.balanceSnapshotRepo.GetByUserID(ctx, userID, balanceType, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance history for user %s: %w", userID, err)
+	}
+
+	// Snapshots by day, those taken before the range count for its first day
+	byDay := make(map[string][]domain.BalanceSnapshot)
+	for _, snapshot := range snapshots {
+		day := snapshot.Date
+		if day.Before(from) {
+			day = from
+		}
+		key := day.Format(time.DateOnly)
+		byDay[key] = append(byDay[key], snapshot)
+	}
+
+	var series []dto.BalanceSeries
+	index := make(map[string]int)
+	latest := make(map[uuid.UUID]domain.BalanceSnapshot)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		for _, snapshot := range byDay[key] {
+			latest[snapshot.BankAccountID] = snapshot
+		}
+		if len(latest) == 0 {
+			continue // No account was synced yet
+		}
+
+		totals := make(map[string]float64)
+		for _, snapshot := range latest {
+			totals[snapshot.Currency] += snapshot.Amount
+		}
+		for currency, total := range totals {
+			i, ok := index[currency]
+			if !ok {
+				i = len(series)
+				index[currency] = i
+				series = append(series, dto.BalanceSeries{
+					BalanceType: balanceType,
+					Currency:    currency,
+				})
+			}
+			series[i].Points = append(series[i].Points, dto.BalancePoint{
+				Date:   key,
+				Amount: roundCents(total),
+			})
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Currency < series[j].Currency
+	})
+
+	return &dto.BalanceHistoryResponse{
+		From:   from.Format(time.DateOnly),
+		To:     to.Format(time.DateOnly),
+		Series: nonNilSeries(series),
+	}, nil
+}
+
+// nonNilSeries makes an empty history encode as an empty list rather than null
+func nonNilSeries(series []dto.BalanceSeries) []dto.BalanceSeries {
+	if series == nil {
+		return []dto.BalanceSeries{}
+	}
+	return series
+}
+
+// roundCents rounds away the floating point noise of summing amounts
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// ErrInvalidBudget is returned when a budget request is incomplete or inconsistent
+var ErrInvalidBudget = errors.New("invalid budget")
+
+type BudgetService interface {
+	// GetBudgets lists the budgets of a user with what was spent of each
+	GetBudgets(ctx context.Context, userID uuid.UUID) ([]dto.BudgetResponse, error)
+	CreateBudget(ctx context.Context, userID uuid.UUID, req dto.BudgetRequest) (*dto.BudgetResponse, error)
+	UpdateBudget(ctx context.Context, userID, budgetID uuid.UUID, req dto.BudgetRequest) (*dto.BudgetResponse, error)
+	DeleteBudget(ctx context.Context, userID, budgetID uuid.UUID) error
+}
+
+type budgetService struct {
+	budgetRepo      repository.BudgetRepository
+	transactionRepo repository.TransactionRepository
+}
+
+func NewBudgetService(budgetRepo repository.BudgetRepository, transactionRepo repository.TransactionRepository) BudgetService {
+	return &budgetService{
+		budgetRepo:      budgetRepo,
+		transactionRepo: transactionRepo,
+	}
+}
+
+func (s *budgetService) GetBudgets(ctx context.Context, userID uuid.UUID) ([]dto.BudgetResponse, error) {
+	budgets, err := s.budgetRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budgets for user %s: %w", userID, err)
+	}
+
+	// Budgets of the same period, usually all of a month, share their totals
+	totalsByPeriod := make(map[[2]time.Time][]repository.CategoryTotal)
+	response := make([]dto.BudgetResponse, 0, len(budgets))
+	for i := range budgets {
+		budget := &budgets[i]
+		period := [2]time.Time{budget.StartDate, budget.EndDate}
+		totals, ok := totalsByPeriod[period]
+		if !ok {
+			if totals, err = s.transactionRepo.GetCategoryTotals(ctx, userID, budget.StartDate, budget.EndDate); err != nil {
+				return nil, fmt.Errorf("failed to get category totals for budget %s: %w", budget.ID, err)
+			}
+			totalsByPeriod[period] = totals
+		}
+		response = append(response, budgetResponse(budget, totals))
+	}
+	return response, nil
+}
+
+func (s *budgetService) CreateBudget(ctx context.Context, userID uuid.UUID, req dto.BudgetRequest) (*dto.BudgetResponse, error) {
+	budget := &domain.Budget{
+		ID:     uuid.New(),
+		UserID: userID,
+	}
+	if err := setBudget(budget, req); err != nil {
+		return nil, err
+	}
+	if err := s.budgetRepo.Create(ctx, budget); err != nil {
+		return nil, fmt.Errorf("failed to create budget for user %s: %w", userID, err)
+	}
+	return s.budgetWithSpending(ctx, budget)
+}
+
+func (s *budgetService) UpdateBudget(ctx context.Context, userID, budgetID uuid.UUID, req dto.BudgetRequest) (*dto.BudgetResponse, error) {
+	budget, err := s.ownedBudget(ctx, userID, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setBudget(budget, req); err != nil {
+		return nil, err
+	}
+	if err := s.budgetRepo.Update(ctx, budget); err != nil {
+		return nil, fmt.Errorf("failed to update budget %s: %w", budgetID, err)
+	}
+	return s.budgetWithSpending(ctx, budget)
+}
+
+func (s *budgetService) DeleteBudget(ctx context.Context, userID, budgetID uuid.UUID) error {
+	if _, err := s.ownedBudget(ctx, userID, budgetID); err != nil {
+		return err
+	}
+	if err := s.budgetRepo.Delete(ctx, budgetID); err != nil {
+		return fmt.Errorf("failed to delete budget %s: %w", budgetID, err)
+	}
+	return nil
+}
+
+// budgetWithSpending returns a budget with what was spent of it
+func (s *budgetService) budgetWithSpending(ctx context.Context, budget *domain.Budget) (*dto.BudgetResponse, error) {
+	totals, err := s.transactionRepo.GetCategoryTotals(ctx, budget.UserID, budget.StartDate, budget.EndDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category totals for budget %s: %w", budget.ID, err)
+	}
+	response := budgetResponse(budget, totals)
+	return &response, nil
+}
+
+// ownedBudget returns a budget after checking that it belongs to the user
+func (s *budgetService) ownedBudget(ctx context.Context, userID, budgetID uuid.UUID) (*domain.Budget, error) {
+	budget, err := s.budgetRepo.GetByID(ctx, budgetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget %s: %w", budgetID, err)
+	}
+	if budget.UserID != userID {
+		return nil, fmt.Errorf("budget %s does not belong to user: %w", budgetID, repository.ErrForbidden)
+	}
+	return budget, nil
+}
+
+// setBudget copies a budget request onto a budget after checking its period
+func setBudget(budget *domain.Budget, req dto.BudgetRequest) error {
+	startDate, err := time.Parse(time.DateOnly, req.StartDate)
+	if err != nil {
+		return fmt.Errorf("%w: start_date: %v", ErrInvalidBudget, err)
+	}
+	endDate, err := time.Parse(time.DateOnly, req.EndDate)
+	if err != nil {
+		return fmt.Errorf("%w: end_date: %v", ErrInvalidBudget, err)
+	}
+	if endDate.Before(startDate) {
+		return fmt.Errorf("%w: end_date must not be before start_date", ErrInvalidBudget)
+	}
+
+	budget.Category = strings.TrimSpace(req.Category)
+	budget.Currency = strings.ToUpper(req.Currency)
+	budget.Amount = roundCents(req.Amount)
+	budget.StartDate = startDate
+	budget.EndDate = endDate
+	return nil
+}
+
+// budgetResponse converts a budget to its client representation with what was
+// spent of it according to the category totals of its period. Refunds in the
+// category reduce what was spent.
+func budgetResponse(budget *domain.Budget, totals []repository.CategoryTotal) dto.BudgetResponse {
+	var spent float64
+	var transactions int
+	for _, total := range totals {
+		if total.Category == budget.Category && strings.EqualFold(total.Currency, budget.Currency) {
+			spent += total.Expense - total.Income
+			transactions += total.Transactions
+		}
+	}
+	spent = roundCents(spent)
+
+	return dto.BudgetResponse{
+		ID:           budget.ID,
+		Category:     budget.Category,
+		Currency:     budget.Currency,
+		Amount:       budget.Amount,
+		StartDate:    budget.StartDate.Format(time.DateOnly),
+		EndDate:      budget.EndDate.Format(time.DateOnly),
+		Spent:        spent,
+		Remaining:    roundCents(budget.Amount - spent),
+		Exceeded:     spent > budget.Amount,
+		Transactions: transactions,
+		CreatedAt:    budget.CreatedAt,
+		UpdatedAt:    budget.UpdatedAt,
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+func TestBudgetResponse(t *testing.T) {
+	budget := &domain.Budget{Category: "Groceries", Currency: "EUR", Amount: 300}
+
+	tests := []struct {
+		name          string
+		totals        []repository.CategoryTotal
+		wantSpent     float64
+		wantRemaining float64
+		wantExceeded  bool
+	}{
+		{
+			name:          "nothing spent",
+			wantRemaining: 300,
+		},
+		{
+			name: "expenses of the category and currency",
+			totals: []repository.CategoryTotal{
+				{Category: "Groceries", Currency: "EUR", Expense: 120.5, Transactions: 4},
+				{Category: "Groceries", Currency: "USD", Expense: 50, Transactions: 1},
+				{Category: "Household", Currency: "EUR", Expense: 80, Transactions: 2},
+			},
+			wantSpent:     120.5,
+			wantRemaining: 179.5,
+		},
+		{
+			name: "refunds reduce spending",
+			totals: []repository.CategoryTotal{
+				{Category: "Groceries", Currency: "EUR", Income: 20, Expense: 120, Transactions: 3},
+			},
+			wantSpent:     100,
+			wantRemaining: 200,
+		},
+		{
+			name: "exceeded",
+			totals: []repository.CategoryTotal{
+				{Category: "Groceries", Currency: "EUR", Expense: 300.01, Transactions: 9},
+			},
+			wantSpent:     300.01,
+			wantRemaining: -0.01,
+			wantExceeded:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := budgetResponse(budget, tt.totals)
+			if got.Spent != tt.wantSpent || got.Remaining != tt.wantRemaining || got.Exceeded != tt.wantExceeded {
+				t.Errorf("budgetResponse() spent %v, remaining %v, exceeded %v; want %v, %v, %v",
+					got.Spent, got.Remaining, got.Exceeded, tt.wantSpent, tt.wantRemaining, tt.wantExceeded)
+			}
+		})
+	}
+}
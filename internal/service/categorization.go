@@ -0,0 +1,546 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/config"
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// maxRulePreviewTransactions bounds the transactions a rule preview lists
+const maxRulePreviewTransactions = 100
+
+// categorizationBatchSize is how many transactions are read at once when rules are applied to the history
+const categorizationBatchSize = 500
+
+// maxTrainingTransactions bounds the categorized transactions a classifier learns from, the most recent ones
+const maxTrainingTransactions = 5000
+
+// maxCategorySuggestions bounds the categories suggested for a transaction
+const maxCategorySuggestions = 3
+
+// ErrInvalidCategoryRule is returned when a rule has no condition or assigns nothing
+var ErrInvalidCategoryRule = errors.New("invalid category rule")
+
+type CategorizationService interface {
+	// GetRules lists the rules of a user in the order they are applied
+	GetRules(ctx context.Context, userID uuid.UUID) ([]dto.CategoryRuleResponse, error)
+	CreateRule(ctx context.Context, userID uuid.UUID, req dto.CategoryRuleRequest) (*dto.CategoryRuleResponse, error)
+	// UpdateRule replaces a rule of the user
+	UpdateRule(ctx context.Context, userID, ruleID uuid.UUID, req dto.CategoryRuleRequest) (*dto.CategoryRuleResponse, error)
+	DeleteRule(ctx context.Context, userID, ruleID uuid.UUID) error
+	// PreviewRule lists the transactions of the user a rule would categorize, without saving the rule
+	PreviewRule(ctx context.Context, userID uuid.UUID, req dto.CategoryRuleRequest) (*dto.RulePreviewResponse, error)
+	// ApplyRules applies the enabled rules of a user to all of their transactions and
+	// returns how many changed. Categories the user assigned are left untouched.
+	ApplyRules(ctx context.Context, userID uuid.UUID) (int, error)
+	// Categorize applies the enabled rules of a user to transactions before they are saved.
+	// Transactions no rule categorizes get the category the classifier suggests, when it is confident enough.
+	Categorize(ctx context.Context, userID uuid.UUID, transactions []*domain.Transaction) error
+	// SetTransactionCategory assigns the category the user chose to a transaction, which the classifier learns from
+	SetTransactionCategory(ctx context.Context, userID, transactionID uuid.UUID, req dto.SetCategoryRequest) (*dto.TransactionResponse, error)
+	// SuggestCategories returns the categories the classifier finds likeliest for a transaction
+	SuggestCategories(ctx context.Context, userID, transactionID uuid.UUID) (*dto.CategorySuggestionsResponse, error)
+}
+
+// transactionCategorizer assigns categories to transactions before they are saved
+type transactionCategorizer interface {
+	Categorize(ctx context.Context, userID uuid.UUID, transactions []*domain.Transaction) error
+}
+
+type categorizationService struct {
+	categoryRuleRepo repository.CategoryRuleRepository
+	transactionRepo  repository.TransactionRepository
+	bankAccountRepo  repository.BankAccountRepository
+	cfg              config.CategorizationConfig
+
+	// classifiers caches the classifier of each user until it is older than
+	// the configured TTL or the user categorizes a transaction
+	classifiersMu sync.Mutex
+	classifiers   map[uuid.UUID]*categoryClassifier
+}
+
+func NewCategorizationService(categoryRuleRepo repository.CategoryRuleRepository, transactionRepo repository.TransactionRepository, bankAccountRepo repository.BankAccountRepository, cfg *config.Config) CategorizationService {
+	return &categorizationService{
+		categoryRuleRepo: categoryRuleRepo,
+		transactionRepo:  transactionRepo,
+		bankAccountRepo:  bankAccountRepo,
+		cfg:              cfg.Categorization,
+		classifiers:      make(map[uuid.UUID]*categoryClassifier),
+	}
+}
+
+func (s *categorizationService) GetRules(ctx context.Context, userID uuid.UUID) ([]dto.CategoryRuleResponse, error) {
+	rules, err := s.categoryRuleRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category rules for user %s: %w", userID, err)
+	}
+
+	response := make([]dto.CategoryRuleResponse, 0, len(rules))
+	for i := range rules {
+		response = append(response, categoryRuleResponse(&rules[i]))
+	}
+	return response, nil
+}
+
+func (s *categorizationService) CreateRule(ctx context.Context, userID uuid.UUID, req dto.CategoryRuleRequest) (*dto.CategoryRuleResponse, error) {
+	rule := &domain.CategoryRule{
+		ID:     uuid.New(),
+		UserID: userID,
+	}
+	if err := s.setRule(ctx, rule, req); err != nil {
+		return nil, err
+	}
+	if err := s.categoryRuleRepo.Create(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to create category rule for user %s: %w", userID, err)
+	}
+
+	response := categoryRuleResponse(rule)
+	return &response, nil
+}
+
+func (s *categorizationService) UpdateRule(ctx context.Context, userID, ruleID uuid.UUID, req dto.CategoryRuleRequest) (*dto.CategoryRuleResponse, error) {
+	rule, err := s.ownedRule(ctx, userID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setRule(ctx, rule, req); err != nil {
+		return nil, err
+	}
+	if err := s.categoryRuleRepo.Update(ctx, rule); err != nil {
+		return nil, fmt.Errorf("failed to update category rule %s: %w", ruleID, err)
+	}
+
+	response := categoryRuleResponse(rule)
+	return &response, nil
+}
+
+func (s *categorizationService) DeleteRule(ctx context.Context, userID, ruleID uuid.UUID) error {
+	if _, err := s.ownedRule(ctx, userID, ruleID); err != nil {
+		return err
+	}
+	if err := s.categoryRuleRepo.Delete(ctx, ruleID); err != nil {
+		return fmt.Errorf("failed to delete category rule %s: %w", ruleID, err)
+	}
+	return nil
+}
+
+func (s *categorizationService) PreviewRule(ctx context.Context, userID uuid.UUID, req dto.CategoryRuleRequest) (*dto.RulePreviewResponse, error) {
+	rule := &domain.CategoryRule{UserID: userID}
+	if err := s.setRule(ctx, rule, req); err != nil {
+		return nil, err
+	}
+	rules := []domain.CategoryRule{*rule}
+
+	response := &dto.RulePreviewResponse{
+		Transactions: []dto.RulePreviewMatch{},
+	}
+	err := s.eachTransaction(ctx, userID, func(tx *domain.Transaction) error {
+		if !ruleMatches(rule, tx) {
+			return nil
+		}
+		if tx.CategorySource == constants.CATEGORY_SOURCE_USER {
+			response.Skipped++
+			return nil
+		}
+		response.Matched++
+		if len(response.Transactions) < maxRulePreviewTransactions {
+			categorized := *tx
+			categorizeTransaction(rules, &categorized)
+			response.Transactions = append(response.Transactions, dto.RulePreviewMatch{
+				Transaction: transactionResponse(tx),
+				Category:    categorized.Category,
+				Type:        categorized.Type,
+				Tags:        nonNilTags(categorized.Tags),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *categorizationService) ApplyRules(ctx context.Context, userID uuid.UUID) (int, error) {
+	rules, err := s.categoryRuleRepo.GetEnabledByUserID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get category rules for user %s: %w", userID, err)
+	}
+
+	var updated int
+	err = s.eachTransaction(ctx, userID, func(tx *domain.Transaction) error {
+		if !categorizeTransaction(rules, tx) {
+			return nil
+		}
+		if err := s.transactionRepo.UpdateCategorization(ctx, tx); err != nil {
+			return fmt.Errorf("failed to categorize transaction %s: %w", tx.ID, err)
+		}
+		updated++
+		return nil
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	log.Info("Applied category rules", "userID", userID, "rules", len(rules), "updated", updated)
+	return updated, nil
+}
+
+func (s *categorizationService) Categorize(ctx context.Context, userID uuid.UUID, transactions []*domain.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	rules, err := s.categoryRuleRepo.GetEnabledByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get category rules for user %s: %w", userID, err)
+	}
+	var uncategorized []*domain.Transaction
+	for _, tx := range transactions {
+		categorizeTransaction(rules, tx)
+		if tx.CategorySource == "" && tx.Category == "" {
+			uncategorized = append(uncategorized, tx)
+		}
+	}
+	if len(uncategorized) == 0 {
+		return nil
+	}
+
+	classifier, err := s.classifier(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, tx := range uncategorized {
+		predictions := classifier.predict(tx)
+		if len(predictions) == 0 || predictions[0].Confidence < s.cfg.AutoAssignConfidence {
+			continue
+		}
+		tx.Category = predictions[0].Category
+		tx.CategorySource = constants.CATEGORY_SOURCE_CLASSIFIER
+		tx.CategoryConfidence = predictions[0].Confidence
+	}
+	return nil
+}
+
+func (s *categorizationService) SetTransactionCategory(ctx context.Context, userID, transactionID uuid.UUID, req dto.SetCategoryRequest) (*dto.TransactionResponse, error) {
+	tx, err := s.ownedTransaction(ctx, userID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.Category = strings.TrimSpace(req.Category)
+	tx.CategoryConfidence = 0
+	if req.Tags != nil {
+		tx.Tags = cleanTags(*req.Tags)
+	}
+	if tx.Category != "" {
+		tx.CategorySource = constants.CATEGORY_SOURCE_USER
+	} else {
+		tx.CategorySource = ""
+		if err := s.Categorize(ctx, userID, []*domain.Transaction{tx}); err != nil {
+			log.Error("Failed to categorize transaction", "error", err, "transactionID", transactionID)
+		}
+	}
+
+	if err := s.transactionRepo.UpdateCategorization(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to categorize transaction %s: %w", transactionID, err)
+	}
+	s.forgetClassifier(userID)
+
+	response := transactionResponse(tx)
+	return &response, nil
+}
+
+func (s *categorizationService) SuggestCategories(ctx context.Context, userID, transactionID uuid.UUID) (*dto.CategorySuggestionsResponse, error) {
+	tx, err := s.ownedTransaction(ctx, userID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	classifier, err := s.classifier(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &dto.CategorySuggestionsResponse{
+		TransactionID: transactionID,
+		Suggestions:   []dto.CategorySuggestion{},
+	}
+	for _, prediction := range classifier.predict(tx) {
+		if len(response.Suggestions) == maxCategorySuggestions {
+			break
+		}
+		response.Suggestions = append(response.Suggestions, dto.CategorySuggestion{
+			Category:   prediction.Category,
+			Confidence: math.Round(prediction.Confidence*1000) / 1000,
+		})
+	}
+	return response, nil
+}
+
+// classifier returns the classifier of a user, trained on the transactions the
+// user categorized. Until there are enough of them it predicts nothing.
+func (s *categorizationService) classifier(ctx context.Context, userID uuid.UUID) (*categoryClassifier, error) {
+	s.classifiersMu.Lock()
+	classifier, ok := s.classifiers[userID]
+	s.classifiersMu.Unlock()
+	if ok && time.Since(classifier.trainedAt) < s.cfg.ModelTTL {
+		return classifier, nil
+	}
+
+	transactions, err := s.transactionRepo.GetUserCategorized(ctx, userID, maxTrainingTransactions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categorized transactions for user %s: %w", userID, err)
+	}
+	if len(transactions) < s.cfg.MinTrainingTransactions {
+		transactions = nil
+	}
+	classifier = trainCategoryClassifier(transactions)
+
+	s.classifiersMu.Lock()
+	s.classifiers[userID] = classifier
+	s.classifiersMu.Unlock()
+	return classifier, nil
+}
+
+// forgetClassifier drops the classifier of a user, so the next prediction learns from their latest categories
+func (s *categorizationService) forgetClassifier(userID uuid.UUID) {
+	s.classifiersMu.Lock()
+	delete(s.classifiers, userID)
+	s.classifiersMu.Unlock()
+}
+
+// ownedTransaction retrieves a transaction and checks that it belongs to the user
+func (s *categorizationService) ownedTransaction(ctx context.Context, userID, transactionID uuid.UUID) (*domain.Transaction, error) {
+	tx, err := s.transactionRepo.GetByTransactionID(ctx, transactionID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", transactionID, err)
+	}
+	if tx.UserID != userID {
+		return nil, fmt.Errorf("transaction %s does not belong to user: %w", transactionID, repository.ErrForbidden)
+	}
+	return &tx, nil
+}
+
+// eachTransaction calls fn with every transaction of a user, newest first, reading them in batches
+func (s *categorizationService) eachTransaction(ctx context.Context, userID uuid.UUID, fn func(tx *domain.Transaction) error) error {
+	filter := repository.TransactionFilter{
+		UserID: userID,
+		Sort:   constants.TRANSACTION_SORT_DATE_DESC,
+		Limit:  categorizationBatchSize,
+	}
+	for {
+		transactions, err := s.transactionRepo.List(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to list transactions for user %s: %w", userID, err)
+		}
+		for i := range transactions {
+			if err := fn(&transactions[i]); err != nil {
+				return err
+			}
+		}
+		if len(transactions) < categorizationBatchSize {
+			return nil
+		}
+		last := transactions[len(transactions)-1]
+		filter.After = &repository.TransactionCursor{Date: last.Date, ID: last.ID}
+	}
+}
+
+// ownedRule retrieves a rule and checks that it belongs to the user
+func (s *categorizationService) ownedRule(ctx context.Context, userID, ruleID uuid.UUID) (*domain.CategoryRule, error) {
+	rule, err := s.categoryRuleRepo.GetByID(ctx, ruleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category rule %s: %w", ruleID, err)
+	}
+	if rule.UserID != userID {
+		return nil, fmt.Errorf("category rule %s does not belong to user: %w", ruleID, repository.ErrForbidden)
+	}
+	return rule, nil
+}
+
+// setRule copies a rule request onto a rule after checking that it is complete
+// and that the account it is limited to belongs to the user
+func (s *categorizationService) setRule(ctx context.Context, rule *domain.CategoryRule, req dto.CategoryRuleRequest) error {
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.Priority = req.Priority
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	rule.DescriptionContains = strings.TrimSpace(req.DescriptionContains)
+	rule.CounterpartyContains = strings.TrimSpace(req.CounterpartyContains)
+	rule.CounterpartyIBAN = normalizeIBAN(req.CounterpartyIBAN)
+	rule.MinAmount = req.MinAmount
+	rule.MaxAmount = req.MaxAmount
+	rule.BankAccountID = req.BankAccountID
+	rule.Category = strings.TrimSpace(req.Category)
+	rule.Type = req.Type
+	rule.Tags = cleanTags(req.Tags)
+
+	if rule.DescriptionContains == "" && rule.CounterpartyContains == "" && rule.CounterpartyIBAN == "" &&
+		rule.MinAmount == nil && rule.MaxAmount == nil && rule.BankAccountID == nil {
+		return fmt.Errorf("%w: a rule needs at least one condition", ErrInvalidCategoryRule)
+	}
+	if rule.Category == "" && rule.Type == "" && len(rule.Tags) == 0 {
+		return fmt.Errorf("%w: a rule has to assign a category, a type or tags", ErrInvalidCategoryRule)
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return fmt.Errorf("%w: min_amount must not be greater than max_amount", ErrInvalidCategoryRule)
+	}
+
+	if rule.BankAccountID != nil {
+		account, err := s.bankAccountRepo.GetByID(ctx, *rule.BankAccountID)
+		if err != nil && !repository.IsNotFoundError(err) {
+			return fmt.Errorf("failed to get bank account %s: %w", *rule.BankAccountID, err)
+		}
+		if err != nil || account.UserID != rule.UserID {
+			return fmt.Errorf("%w: bank account %s not found", ErrInvalidCategoryRule, *rule.BankAccountID)
+		}
+	}
+	return nil
+}
+
+// categorizeTransaction assigns what the matching rules assign to a transaction
+// whose category the user has not set. Rules are in the order they are applied.
+// The category source becomes rule only when a rule supplies the category. A
+// transaction no rule matches anymore loses the category a rule gave it. It
+// reports whether the transaction changed.
+func categorizeTransaction(rules []domain.CategoryRule, tx *domain.Transaction) bool {
+	if tx.CategorySource == constants.CATEGORY_SOURCE_USER {
+		return false
+	}
+
+	var category, txType string
+	var tags domain.Tags
+	var matched bool
+	for i := range rules {
+		if !ruleMatches(&rules[i], tx) {
+			continue
+		}
+		matched = true
+		if category == "" {
+			category = rules[i].Category
+		}
+		if txType == "" {
+			txType = rules[i].Type
+		}
+		for _, tag := range rules[i].Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if !matched {
+		if tx.CategorySource != constants.CATEGORY_SOURCE_RULE {
+			return false
+		}
+		tx.Category, tx.Tags, tx.CategorySource = "", nil, ""
+		return true
+	}
+
+	if txType == "" {
+		txType = tx.Type
+	}
+	source, confidence := constants.CATEGORY_SOURCE_RULE, 0.0
+	if category == "" {
+		// Rules assigning only a type or tags keep the category the classifier
+		// gave, while one an earlier rule gave no longer applies
+		source = ""
+		if tx.CategorySource != constants.CATEGORY_SOURCE_RULE {
+			category, source, confidence = tx.Category, tx.CategorySource, tx.CategoryConfidence
+		}
+	}
+	if tx.Category == category && tx.Type == txType && slices.Equal(tx.Tags, tags) && tx.CategorySource == source {
+		return false
+	}
+	tx.Category, tx.Type, tx.Tags, tx.CategorySource = category, txType, tags, source
+	tx.CategoryConfidence = confidence
+	return true
+}
+
+// ruleMatches reports whether a transaction meets every condition of a rule
+func ruleMatches(rule *domain.CategoryRule, tx *domain.Transaction) bool {
+	if rule.BankAccountID != nil && *rule.BankAccountID != tx.BankAccountID {
+		return false
+	}
+	if rule.MinAmount != nil && tx.Amount < *rule.MinAmount {
+		return false
+	}
+	if rule.MaxAmount != nil && tx.Amount > *rule.MaxAmount {
+		return false
+	}
+	if rule.DescriptionContains != "" && !containsFold(tx.Description, rule.DescriptionContains) {
+		return false
+	}
+	if rule.CounterpartyContains != "" &&
+		!containsFold(tx.CreditorName, rule.CounterpartyContains) && !containsFold(tx.DebtorName, rule.CounterpartyContains) {
+		return false
+	}
+	if rule.CounterpartyIBAN != "" &&
+		normalizeIBAN(tx.CreditorIBAN) != rule.CounterpartyIBAN && normalizeIBAN(tx.DebtorIBAN) != rule.CounterpartyIBAN {
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// normalizeIBAN removes the spaces IBANs are often written with and upper-cases them
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
+
+// cleanTags trims tags and drops empty and repeated ones
+func cleanTags(values []string) domain.Tags {
+	var tags domain.Tags
+	for _, tag := range values {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// nonNilTags makes missing tags encode as an empty list rather than null
+func nonNilTags(tags domain.Tags) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// categoryRuleResponse converts a rule to its client representation
+func categoryRuleResponse(rule *domain.CategoryRule) dto.CategoryRuleResponse {
+	return dto.CategoryRuleResponse{
+		ID:                   rule.ID,
+		Name:                 rule.Name,
+		Priority:             rule.Priority,
+		Enabled:              rule.Enabled,
+		DescriptionContains:  rule.DescriptionContains,
+		CounterpartyContains: rule.CounterpartyContains,
+		CounterpartyIBAN:     rule.CounterpartyIBAN,
+		MinAmount:            rule.MinAmount,
+		MaxAmount:            rule.MaxAmount,
+		BankAccountID:        rule.BankAccountID,
+		Category:             rule.Category,
+		Type:                 rule.Type,
+		Tags:                 nonNilTags(rule.Tags),
+		CreatedAt:            rule.CreatedAt,
+		UpdatedAt:            rule.UpdatedAt,
+	}
+}
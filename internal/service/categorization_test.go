@@ -0,0 +1,111 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"FinMa/constants"
+	"FinMa/internal/domain"
+)
+
+func TestCategorizeTransaction(t *testing.T) {
+	groceries := domain.CategoryRule{DescriptionContains: "rewe", Category: "Groceries", Tags: domain.Tags{"food"}}
+	tagOnly := domain.CategoryRule{DescriptionContains: "amazon", Tags: domain.Tags{"online"}}
+	typeOnly := domain.CategoryRule{DescriptionContains: "amazon", Type: "expense"}
+
+	tests := []struct {
+		name        string
+		rules       []domain.CategoryRule
+		tx          domain.Transaction
+		wantChanged bool
+		want        domain.Transaction
+	}{
+		{
+			name:        "rule assigns category and tags",
+			rules:       []domain.CategoryRule{groceries},
+			tx:          domain.Transaction{Description: "REWE Markt 123"},
+			wantChanged: true,
+			want:        domain.Transaction{Category: "Groceries", Tags: domain.Tags{"food"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+		},
+		{
+			name:        "rule category replaces classifier category",
+			rules:       []domain.CategoryRule{groceries},
+			tx:          domain.Transaction{Description: "REWE Markt 123", Category: "Shopping", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.9},
+			wantChanged: true,
+			want:        domain.Transaction{Category: "Groceries", Tags: domain.Tags{"food"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+		},
+		{
+			name:        "tags only rule keeps classifier category",
+			rules:       []domain.CategoryRule{tagOnly},
+			tx:          domain.Transaction{Description: "AMAZON EU", Category: "Shopping", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.9},
+			wantChanged: true,
+			want:        domain.Transaction{Category: "Shopping", Tags: domain.Tags{"online"}, CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.9},
+		},
+		{
+			name:        "type only rule keeps classifier category",
+			rules:       []domain.CategoryRule{typeOnly},
+			tx:          domain.Transaction{Description: "AMAZON EU", Category: "Shopping", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.9},
+			wantChanged: true,
+			want:        domain.Transaction{Type: "expense", Category: "Shopping", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.9},
+		},
+		{
+			name:        "tags only rule leaves uncategorized transaction to the classifier",
+			rules:       []domain.CategoryRule{tagOnly},
+			tx:          domain.Transaction{Description: "AMAZON EU"},
+			wantChanged: true,
+			want:        domain.Transaction{Tags: domain.Tags{"online"}},
+		},
+		{
+			name:        "tags only rule drops category of a rule no longer matching",
+			rules:       []domain.CategoryRule{tagOnly},
+			tx:          domain.Transaction{Description: "AMAZON EU", Category: "Groceries", CategorySource: constants.CATEGORY_SOURCE_RULE},
+			wantChanged: true,
+			want:        domain.Transaction{Tags: domain.Tags{"online"}},
+		},
+		{
+			name:        "first rule wins the category, tags are merged",
+			rules:       []domain.CategoryRule{tagOnly, {DescriptionContains: "amazon", Category: "Shopping", Tags: domain.Tags{"online", "retail"}}},
+			tx:          domain.Transaction{Description: "AMAZON EU"},
+			wantChanged: true,
+			want:        domain.Transaction{Category: "Shopping", Tags: domain.Tags{"online", "retail"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+		},
+		{
+			name:  "user category is never changed",
+			rules: []domain.CategoryRule{groceries},
+			tx:    domain.Transaction{Description: "REWE Markt 123", Category: "Dining", CategorySource: constants.CATEGORY_SOURCE_USER},
+			want:  domain.Transaction{Category: "Dining", CategorySource: constants.CATEGORY_SOURCE_USER},
+		},
+		{
+			name:        "rule category removed when no rule matches",
+			tx:          domain.Transaction{Description: "REWE Markt 123", Category: "Groceries", Tags: domain.Tags{"food"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+			wantChanged: true,
+			want:        domain.Transaction{},
+		},
+		{
+			name: "classifier category kept when no rule matches",
+			tx:   domain.Transaction{Description: "REWE Markt 123", Category: "Groceries", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.8},
+			want: domain.Transaction{Category: "Groceries", CategorySource: constants.CATEGORY_SOURCE_CLASSIFIER, CategoryConfidence: 0.8},
+		},
+		{
+			name:  "unchanged when applied again",
+			rules: []domain.CategoryRule{groceries},
+			tx:    domain.Transaction{Description: "REWE Markt 123", Category: "Groceries", Tags: domain.Tags{"food"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+			want:  domain.Transaction{Category: "Groceries", Tags: domain.Tags{"food"}, CategorySource: constants.CATEGORY_SOURCE_RULE},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := tt.tx
+			if changed := categorizeTransaction(tt.rules, &tx); changed != tt.wantChanged {
+				t.Errorf("categorizeTransaction() = %v, want %v", changed, tt.wantChanged)
+			}
+			if tx.Category != tt.want.Category || tx.Type != tt.want.Type || !slices.Equal(tx.Tags, tt.want.Tags) ||
+				tx.CategorySource != tt.want.CategorySource || tx.CategoryConfidence != tt.want.CategoryConfidence {
+				t.Errorf("categorized to category %q, type %q, tags %v, source %q, confidence %v; want %q, %q, %v, %q, %v",
+					tx.Category, tx.Type, tx.Tags, tx.CategorySource, tx.CategoryConfidence,
+					tt.want.Category, tt.want.Type, tt.want.Tags, tt.want.CategorySource, tt.want.CategoryConfidence)
+			}
+		})
+	}
+}
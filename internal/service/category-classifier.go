@@ -0,0 +1,146 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"FinMa/internal/domain"
+)
+
+// categoryPrediction is a category suggested for a transaction with the
+// probability, between 0 and 1, the classifier gives it
+type categoryPrediction struct {
+	Category   string
+	Confidence float64
+}
+
+// categoryClassifier is a naive Bayes classifier predicting the category of a
+// transaction from the words of its description and counterparty. Each word
+// counts once per transaction, which suits the short texts banks report.
+type categoryClassifier struct {
+	categories map[string]*categoryCounts
+	examples   int
+	vocabulary map[string]bool
+	trainedAt  time.Time
+}
+
+// categoryCounts are the training statistics of one category
+type categoryCounts struct {
+	examples int
+	tokens   int
+	counts   map[string]int
+}
+
+// trainCategoryClassifier trains a classifier on categorized transactions
+func trainCategoryClassifier(transactions []domain.Transaction) *categoryClassifier {
+	c := &categoryClassifier{
+		categories: make(map[string]*categoryCounts),
+		vocabulary: make(map[string]bool),
+		trainedAt:  time.Now(),
+	}
+	for i := range transactions {
+		tx := &transactions[i]
+		if tx.Category == "" {
+			continue
+		}
+		counts, ok := c.categories[tx.Category]
+		if !ok {
+			counts = &categoryCounts{counts: make(map[string]int)}
+			c.categories[tx.Category] = counts
+		}
+		counts.examples++
+		c.examples++
+		for _, token := range transactionTokens(tx) {
+			counts.counts[token]++
+			counts.tokens++
+			c.vocabulary[token] = true
+		}
+	}
+	return c
+}
+
+// predict returns the categories of the classifier for a transaction, most
+// likely first. There is nothing to predict before two categories are known.
+func (c *categoryClassifier) predict(tx *domain.Transaction) []categoryPrediction {
+	if len(c.categories) < 2 {
+		return nil
+	}
+	// The direction alone says too little
+	tokens := transactionTokens(tx)
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	// Log probabilities with Laplace smoothing, so unseen words do not rule a category out
+	vocabulary := float64(len(c.vocabulary))
+	scores := make(map[string]float64, len(c.categories))
+	best := math.Inf(-1)
+	for category, counts := range c.categories {
+		score := math.Log(float64(counts.examples) / float64(c.examples))
+		for _, token := range tokens {
+			score += math.Log(float64(counts.counts[token]+1) / (float64(counts.tokens) + vocabulary))
+		}
+		scores[category] = score
+		best = math.Max(best, score)
+	}
+
+	// Normalize into probabilities, shifted by the best score to avoid underflow
+	var total float64
+	for category, score := range scores {
+		scores[category] = math.Exp(score - best)
+		total += scores[category]
+	}
+	predictions := make([]categoryPrediction, 0, len(scores))
+	for category, score := range scores {
+		predictions = append(predictions, categoryPrediction{
+			Category:   category,
+			Confidence: score / total,
+		})
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].Confidence != predictions[j].Confidence {
+			return predictions[i].Confidence > predictions[j].Confidence
+		}
+		return predictions[i].Category < predictions[j].Category
+	})
+	return predictions
+}
+
+// transactionTokens are the distinct features of a transaction: the words of
+// its description and counterparty, the counterparty as a whole, and whether
+// money came in or went out
+func transactionTokens(tx *domain.Transaction) []string {
+	party := tx.DebtorName
+	direction := "dir:in"
+	if tx.Amount < 0 {
+		party = tx.CreditorName
+		direction = "dir:out"
+	}
+
+	seen := map[string]bool{direction: true}
+	tokens := []string{direction}
+	add := func(token string) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	if party = strings.ToLower(strings.TrimSpace(party)); party != "" {
+		add("party:" + party)
+	}
+	words := strings.FieldsFunc(strings.ToLower(tx.Description+" "+party), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		// Single characters and numbers such as dates and references do not tell categories apart
+		if len([]rune(word)) < 2 || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		add(word)
+	}
+	return tokens
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"FinMa/internal/domain"
+)
+
+func TestCategoryClassifier(t *testing.T) {
+	expense := func(creditor, description, category string) domain.Transaction {
+		return domain.Transaction{Amount: -20, CreditorName: creditor, Description: description, Category: category}
+	}
+	training := []domain.Transaction{
+		expense("Supermarket", "Card payment supermarket", "Groceries"),
+		expense("Supermarket", "Card payment supermarket 12/03", "Groceries"),
+		expense("Organic Market", "Card payment market", "Groceries"),
+		expense("City Transit", "Monthly ticket", "Transport"),
+		expense("City Transit", "Single ticket", "Transport"),
+		expense("Fuel Station", "Card payment fuel", "Transport"),
+		expense("Unknown", "Not categorized", ""),
+		{Amount: 2500, DebtorName: "Employer", Description: "Salary March", Category: "Income"},
+	}
+	classifier := trainCategoryClassifier(training)
+
+	tests := []struct {
+		name string
+		tx   domain.Transaction
+		want string // most likely category, empty when nothing is predicted
+	}{
+		{"known counterparty", expense("Supermarket", "Card payment", ""), "Groceries"},
+		{"known words", expense("Transit Authority", "Weekly ticket", ""), "Transport"},
+		{"numbers are ignored", expense("City Transit", "Ticket 0815 12/03", ""), "Transport"},
+		{"direction", domain.Transaction{Amount: 2400, DebtorName: "Employer", Description: "Salary April"}, "Income"},
+		{"only the direction", domain.Transaction{Amount: -5}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predictions := classifier.predict(&tt.tx)
+			if tt.want == "" {
+				if len(predictions) != 0 {
+					t.Errorf("predict() = %+v, want no prediction", predictions)
+				}
+				return
+			}
+			if len(predictions) != 3 {
+				t.Fatalf("predict() = %+v, want a prediction per trained category", predictions)
+			}
+			if predictions[0].Category != tt.want {
+				t.Errorf("predict() = %+v, want %s first", predictions, tt.want)
+			}
+
+			var total float64
+			for i, prediction := range predictions {
+				total += prediction.Confidence
+				if i > 0 && prediction.Confidence > predictions[i-1].Confidence {
+					t.Errorf("predictions are not sorted by confidence: %+v", predictions)
+				}
+			}
+			if total < 0.999 || total > 1.001 {
+				t.Errorf("confidences sum to %v, want 1", total)
+			}
+		})
+	}
+
+	// A single category tells nothing apart
+	single := trainCategoryClassifier(training[:3])
+	if predictions := single.predict(&training[0]); predictions != nil {
+		t.Errorf("predict() with one category = %+v, want no prediction", predictions)
+	}
+}
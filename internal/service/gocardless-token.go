@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+
+	"FinMa/internal/aggregator"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/pkg/gocardless"
+)
+
+// gclTokenStore persists the tokens of the GoCardless client in the database
+type gclTokenStore struct {
+	tokenRepo repository.TokenRepository
+}
+
+// NewGclTokenStore creates a token store for the GoCardless client backed by the token repository
+func NewGclTokenStore(tokenRepo repository.TokenRepository) gocardless.TokenStore {
+	return &gclTokenStore{
+		tokenRepo: tokenRepo,
+	}
+}
+
+func (s *gclTokenStore) Load(ctx context.Context) (*gocardless.Tokens, error) {
+	token, err := s.tokenRepo.GetByProvider(ctx, aggregator.ProviderGoCardless)
+	if err != nil {
+		if repository.IsNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return gclTokens(token), nil
+}
+
+func (s *gclTokenStore) Update(ctx context.Context, renew func(stored *gocardless.Tokens) (*gocardless.Tokens, error)) (*gocardless.Tokens, error) {
+	token, err := s.tokenRepo.WithRefreshLock(ctx, aggregator.ProviderGoCardless, func(stored *domain.ProviderToken) (*domain.ProviderToken, error) {
+		var current *gocardless.Tokens
+		if stored != nil {
+			current = gclTokens(stored)
+		}
+
+		renewed, err := renew(current)
+		if err != nil {
+			return nil, err
+		}
+		// The stored tokens are still valid, nothing to save
+		if renewed == current {
+			return stored, nil
+		}
+
+		return &domain.ProviderToken{
+			Provider:       aggregator.ProviderGoCardless,
+			AccessToken:    renewed.Access,
+			RefreshToken:   renewed.Refresh,
+			AccessExpires:  renewed.AccessExpires,
+			RefreshExpires: renewed.RefreshExpires,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gclTokens(token), nil
+}
+
+func (s *gclTokenStore) Clear(ctx context.Context) error {
+	return s.tokenRepo.Delete(ctx, aggregator.ProviderGoCardless)
+}
+
+// gclTokens converts a stored token to the GoCardless client tokens
+func gclTokens(token *domain.ProviderToken) *gocardless.Tokens {
+	return &gocardless.Tokens{
+		Access:         token.AccessToken,
+		Refresh:        token.RefreshToken,
+		AccessExpires:  token.AccessExpires,
+		RefreshExpires: token.RefreshExpires,
+	}
+}
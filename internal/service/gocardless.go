@@ -2,15 +2,27 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"FinMa/config"
+	"FinMa/constants"
 	"FinMa/dto"
+	"FinMa/internal/aggregator"
 	"FinMa/internal/domain"
 	"FinMa/internal/repository"
-	"FinMa/pkg/gocardless"
 
+	"github.com/charmbracelet/log"
 	"github.com/google/uuid"
 )
 
@@ -19,51 +31,136 @@ type GclService interface {
 	GetValidAccessToken(ctx context.Context) (string, error)
 	RefreshTokenIfNeeded(ctx context.Context) error
 	GetTokenStatus() map[string]interface{}
-	ClearToken()
+	ClearToken(ctx context.Context) error
 
 	// LinkAccount initiates the linking of a bank account for a user with a specific institution
-	LinkAccount(ctx context.Context, userID uuid.UUID, institutionID, redirectURL string) (*dto.LinkAccountResponse, error)
+	LinkAccount(ctx context.Context, userID uuid.UUID, req dto.LinkAccountRequest, redirectURL string) (*dto.LinkAccountResponse, error)
 
-	// SyncRequisition syncs an existing requisition for a user
-	SyncRequisition(ctx context.Context, requisitionReference string, userID uuid.UUID) (*dto.GoCardlessUpdateRequisitionResponse, error)
+	// SyncRequisition syncs an existing requisition for a user. publicToken is
+	// what Plaid Link returned to the frontend, empty for other providers.
+	// Accounts are synced independently, their outcomes are part of the
+	// response and reported to progress as they happen; progress may be nil.
+	SyncRequisition(ctx context.Context, requisitionReference string, userID uuid.UUID, publicToken string, progress SyncProgress) (*dto.GoCardlessUpdateRequisitionResponse, error)
 
-	// Institutions
-	GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error)
+	// GetRequisitions lists the bank connections of a user
+	GetRequisitions(ctx context.Context, userID uuid.UUID) ([]dto.RequisitionResponse, error)
 
-	// Account Data
-	GetAccountDetails(ctx context.Context, accountID string) (*dto.AccountDetails, error)
-	GetAccountBalances(ctx context.Context, accountID string) (*dto.AccountBalances, error)
-	GetAccountTransactions(ctx context.Context, accountID string) (*dto.AccountTransactions, error)
+	// ReconnectRequisition creates a fresh requisition replacing an expired or expiring one.
+	// The bank accounts of the old requisition are moved over once the new one is linked.
+	ReconnectRequisition(ctx context.Context, userID uuid.UUID, requisitionID, redirectURL string) (*dto.LinkAccountResponse, error)
+	// UnlinkRequisition disconnects a bank, archiving or purging its accounts depending on mode
+	UnlinkRequisition(ctx context.Context, userID uuid.UUID, requisitionID, mode string) error
+
+	// GetRequisitionHistory lists the status changes of a requisition of a user
+	GetRequisitionHistory(ctx context.Context, userID uuid.UUID, requisitionID string) ([]dto.RequisitionTransitionResponse, error)
+
+	// CheckRequisitionExpiry notifies users of expiring consents and marks expired requisitions
+	CheckRequisitionExpiry(ctx context.Context) error
+	// RefreshPendingRequisitions updates the status of requisitions the user has not finished giving consent for
+	RefreshPendingRequisitions(ctx context.Context) error
+
+	// OnRequisitionStatus registers a hook run whenever a requisition enters status
+	OnRequisitionStatus(status domain.RequisitionStatus, hook RequisitionHook)
+}
+
+// SyncProgress receives updates while a requisition syncs. AccountUpdated is
+// called concurrently by the workers syncing the accounts.
+type SyncProgress interface {
+	// AccountsFound is called with the accounts of the requisition before they are synced
+	AccountsFound(accountIDs []string)
+	// AccountUpdated is called when an account starts syncing and when it is done
+	AccountUpdated(result dto.AccountSyncResult)
+}
+
+// gclTokenSource manages the API token of the GoCardless client
+type gclTokenSource interface {
+	GetValidAccessToken(ctx context.Context) (string, error)
+	GetTokenStatus() map[string]interface{}
+	ClearTokens(ctx context.Context) error
 }
 
+// pendingSettlementWindow is how long after its authorisation a pending
+// transaction may show up as booked and still be matched to it
+const pendingSettlementWindow = 10 * 24 * time.Hour
+
+// callbackStateTTL is how long the user has to give consent at the bank and be
+// redirected back to the callback. Consents given later are picked up by the
+// polling of pending requisitions.
+const callbackStateTTL = time.Hour
+
 type gclService struct {
-	bankAccountRepo repository.BankAccountRepository
-	userRepo        repository.UserRepository
-	requisitionRepo repository.RequisitionRepository
-	transactionRepo repository.TransactionRepository
-	gclClient       *gocardless.Client
+	bankAccountRepo     repository.BankAccountRepository
+	userRepo            repository.UserRepository
+	requisitionRepo     repository.RequisitionRepository
+	transactionRepo     repository.TransactionRepository
+	notificationRepo    repository.NotificationRepository
+	balanceSnapshotRepo repository.BalanceSnapshotRepository
+	providers           *aggregator.Registry
+	gclTokens           gclTokenSource
+	categorizer         transactionCategorizer
+	transfers           transferDetector
+	recurring           recurringDetector
+	cfg                 *config.Config
+
+	// statusHooks run when a requisition enters a status
+	statusHooks map[domain.RequisitionStatus][]RequisitionHook
+
+	// syncLimiter spaces out provider requests of all syncs, accountsMu
+	// serializes storing synced accounts of this instance. Syncs of the same
+	// account on any instance are serialized by the account's sync lock.
+	syncLimiter *requestLimiter
+	accountsMu  sync.Mutex
 }
 
-// NewGclService creates a new GoCardless service
+// NewGclService creates a new bank connection service. Requisitions are
+// handled by the provider they were created with. Imported transactions are
+// categorized by the categorizer before they are saved. Once a sync stored
+// any, transfers between the user's accounts are linked and recurring series
+// detected.
 func NewGclService(
 	bankAccountRepo repository.BankAccountRepository,
 	userRepo repository.UserRepository,
 	requisitionRepo repository.RequisitionRepository,
 	transactionRepo repository.TransactionRepository,
-	gclClient *gocardless.Client,
+	notificationRepo repository.NotificationRepository,
+	balanceSnapshotRepo repository.BalanceSnapshotRepository,
+	providers *aggregator.Registry,
+	gclTokens gclTokenSource,
+	categorizer transactionCategorizer,
+	transfers transferDetector,
+	recurring recurringDetector,
+	cfg *config.Config,
 ) GclService {
-	return &gclService{
-		bankAccountRepo: bankAccountRepo,
-		requisitionRepo: requisitionRepo,
-		userRepo:        userRepo,
-		transactionRepo: transactionRepo,
-		gclClient:       gclClient,
+	s := &gclService{
+		bankAccountRepo:     bankAccountRepo,
+		requisitionRepo:     requisitionRepo,
+		userRepo:            userRepo,
+		transactionRepo:     transactionRepo,
+		notificationRepo:    notificationRepo,
+		balanceSnapshotRepo: balanceSnapshotRepo,
+		providers:           providers,
+		gclTokens:           gclTokens,
+		categorizer:         categorizer,
+		transfers:           transfers,
+		recurring:           recurring,
+		cfg:                 cfg,
+		statusHooks:         make(map[domain.RequisitionStatus][]RequisitionHook),
+		syncLimiter:         newRequestLimiter(cfg.GoCardless.SyncRequestInterval),
 	}
+	s.registerStatusHooks()
+	return s
 }
 
-func (s *gclService) LinkAccount(ctx context.Context, userID uuid.UUID, institutionID, redirectURL string) (*dto.LinkAccountResponse, error) {
+func (s *gclService) LinkAccount(ctx context.Context, userID uuid.UUID, req dto.LinkAccountRequest, redirectURL string) (*dto.LinkAccountResponse, error) {
+	institutionID := req.InstitutionID
+
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
 	// verify that there is not a already an active requisition for this specific user and institution
-	existingRequisition, err := s.requisitionRepo.GetByUserIDAndInstitutionID(ctx, userID, institutionID)
+	existingRequisition, err := s.requisitionRepo.GetActiveByUserIDAndInstitutionID(ctx, userID, institutionID)
 	if err != nil {
 		// Only return error if it's not a "not found" error
 		if !repository.IsNotFoundError(err) {
@@ -72,200 +169,629 @@ func (s *gclService) LinkAccount(ctx context.Context, userID uuid.UUID, institut
 		// If it's a "not found" error, continue with existingRequisition = nil
 		existingRequisition = nil
 	}
-	// If there is an existing requisition, return the link
-	if existingRequisition != nil {
-		return &dto.LinkAccountResponse{
-			Link: existingRequisition.Link,
-		}, nil
+	// If there is an existing requisition, return the link, unless the bank
+	// could no longer redirect the user back with it
+	if existingRequisition != nil && (existingRequisition.Status == domain.RequisitionStatusLinked || awaitingCallback(existingRequisition)) {
+		return linkResponse(existingRequisition), nil
+	}
+
+	callbackURL, stateHash, err := newCallbackState(redirectURL)
+	if err != nil {
+		return nil, err
 	}
 
-	// Call the GoCardless client to create a requisition
-	response, err := s.gclClient.CreateRequisition(ctx, userID, institutionID, redirectURL)
+	// Ask for the requested history and access duration instead of the
+	// provider defaults; providers cap them to what the institution supports
+	connection, err := provider.CreateLink(ctx, s.linkRequest(userID, req.InstitutionID, req.MaxHistoricalDays, req.AccessValidForDays, callbackURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create requisition: %w", err)
 	}
 
 	// store the requisition in the database
-	err = s.requisitionRepo.Create(ctx, &domain.Requisition{
-		ID:            response.ID,
+	requisition := newRequisition(connection, provider.Name(), userID, redirectURL, stateHash)
+	if err := s.requisitionRepo.Create(ctx, requisition); err != nil {
+		return nil, fmt.Errorf("failed to store requisition: %w", err)
+	}
+
+	// Return the link to redirect the user to for linking their account
+	return linkResponse(requisition), nil
+}
+
+// linkRequest builds a provider link request, falling back to the configured
+// history and access duration
+func (s *gclService) linkRequest(userID uuid.UUID, institutionID string, maxHistoricalDays, accessValidForDays int, redirectURL string) aggregator.LinkRequest {
+	if maxHistoricalDays == 0 {
+		maxHistoricalDays = s.cfg.GoCardless.MaxHistoricalDays
+	}
+	if accessValidForDays == 0 {
+		accessValidForDays = s.cfg.GoCardless.AccessValidForDays
+	}
+	return aggregator.LinkRequest{
+		UserID:             userID,
+		InstitutionID:      institutionID,
+		RedirectURL:        redirectURL,
+		MaxHistoricalDays:  maxHistoricalDays,
+		AccessValidForDays: accessValidForDays,
+	}
+}
+
+// newRequisition creates the requisition record of a new provider connection,
+// whose callback state has the given hash
+func newRequisition(connection *aggregator.Connection, provider string, userID uuid.UUID, redirectURL, stateHash string) *domain.Requisition {
+	stateExpiresAt := time.Now().Add(callbackStateTTL)
+	return &domain.Requisition{
+		ID:            connection.ID,
 		UserID:        userID,
-		InstitutionID: institutionID,
+		InstitutionID: connection.InstitutionID,
 		RedirectURI:   redirectURL,
-		Status:        response.Status,
-		Link:          response.Link,
-		Reference:     response.Reference,
-		ExpiresAt:     func(t time.Time) *time.Time { return &t }(time.Now().Add(90 * 24 * time.Hour)), // Set expiry to 90 days from now
-	})
+		Status:        connection.Status,
+		Link:          connection.Link,
+		LinkExpiresAt: connection.LinkExpiresAt,
+		Reference:     connection.Reference,
+		Provider:      provider,
+
+		AgreementID:        connection.AgreementID,
+		MaxHistoricalDays:  connection.MaxHistoricalDays,
+		AccessValidForDays: connection.AccessValidForDays,
+		ExpiresAt:          connection.ExpiresAt,
+
+		CallbackStateHash:      stateHash,
+		CallbackStateExpiresAt: &stateExpiresAt,
+	}
+}
+
+// newCallbackState generates the single-use state authenticating the bank's
+// redirect to the callback. It returns redirectURL carrying the state, and the
+// hash of the state to store.
+func newCallbackState(redirectURL string) (string, string, error) {
+	callbackURL, err := url.Parse(redirectURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to store requisition: %w", err)
+		return "", "", fmt.Errorf("invalid redirect URL: %w", err)
 	}
 
-	// Return the link to redirect the user to for linking their account
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", fmt.Errorf("failed to generate callback state: %w", err)
+	}
+	state := base64.RawURLEncoding.EncodeToString(random)
+
+	query := callbackURL.Query()
+	query.Set("state", state)
+	callbackURL.RawQuery = query.Encode()
+	return callbackURL.String(), callbackStateHash(state), nil
+}
+
+// callbackStateHash is what is stored of a callback state
+func callbackStateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// awaitingCallback reports whether the bank can still redirect the user back
+// to the callback for a requisition
+func awaitingCallback(requisition *domain.Requisition) bool {
+	return requisition.CallbackStateHash != "" &&
+		requisition.CallbackStateExpiresAt != nil && time.Now().Before(*requisition.CallbackStateExpiresAt)
+}
+
+// linkResponse returns what the frontend needs to send the user through a provider's link flow
+func linkResponse(requisition *domain.Requisition) *dto.LinkAccountResponse {
 	return &dto.LinkAccountResponse{
-		Link: response.Link,
-	}, nil
+		Link:      requisition.Link,
+		Reference: requisition.Reference,
+		Provider:  requisition.Provider,
+	}
 }
 
-func (s *gclService) SyncRequisition(ctx context.Context, requisitionReference string, userID uuid.UUID) (*dto.GoCardlessUpdateRequisitionResponse, error) {
+func (s *gclService) SyncRequisition(ctx context.Context, requisitionReference string, userID uuid.UUID, publicToken string, progress SyncProgress) (*dto.GoCardlessUpdateRequisitionResponse, error) {
 	// Get the requisition by reference
 	requisition, err := s.requisitionRepo.GetByReference(ctx, requisitionReference)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get requisition by reference: %w", err)
 	}
+	if requisition.UserID != userID {
+		return nil, fmt.Errorf("requisition %s does not belong to user: %w", requisition.ID, repository.ErrForbidden)
+	}
 
-	if requisition.Status == "LN" {
-		// If the requisition is already linked, return early
-		return &dto.GoCardlessUpdateRequisitionResponse{
-			Status:        requisition.Status,
-			InstitutionID: requisition.InstitutionID,
-			Reference:     requisition.Reference,
-		}, nil
+	provider, err := s.providers.Get(requisition.Provider)
+	if err != nil {
+		return nil, err
 	}
 
-	// Call the GoCardless client to update the requisition
-	response, err := s.gclClient.GetRequisition(ctx, userID, requisition.ID)
+	// Ask the provider for the current state of the requisition
+	connection, err := provider.GetConnection(ctx, requisition, publicToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update requisition: %w", err)
 	}
 
-	// Update the requisition in the database
-	expiresAt := time.Now().Add(90 * 24 * time.Hour)
-	err = s.requisitionRepo.Update(ctx, &domain.Requisition{
-		ID:            response.ID,
-		UserID:        requisition.UserID,
-		InstitutionID: requisition.InstitutionID,
-		RedirectURI:   requisition.RedirectURI,
-		Status:        response.Status,
-		Link:          response.Link,
-		Reference:     response.Reference,
-		ExpiresAt:     &expiresAt,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to update requisition in database: %w", err)
+	// Update the requisition in the database. The hooks of its new status run
+	// as part of this sync, which already syncs a linked requisition.
+	ctx = withRequisitionSync(ctx, requisition.ID)
+	requisition.InstitutionID = connection.InstitutionID
+	requisition.Link = connection.Link
+	requisition.Reference = connection.Reference
+	requisition.AgreementID = connection.AgreementID
+	requisition.AgreementAcceptedAt = connection.AcceptedAt
+	requisition.ExpiresAt = connection.ExpiresAt
+	requisition.AccessToken = connection.AccessToken
+	if err := s.applyRequisitionStatus(ctx, requisition, connection.Status); err != nil {
+		return nil, err
 	}
 
 	// Process account IDs if they exist in the response
-	if len(response.Accounts) > 0 {
-		err = s.processAccountsFromRequisition(ctx, response.Accounts, requisition.ID, userID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process accounts: %w", err)
+	if progress != nil {
+		progress.AccountsFound(connection.Accounts)
+	}
+	results := s.processAccountsFromRequisition(ctx, provider, connection.Accounts, requisition, userID, progress)
+
+	var deferred []dto.DeferredAccountSync
+	var synced bool
+	for _, result := range results {
+		if result.Status == constants.SYNC_ACCOUNT_STATUS_SUCCEEDED {
+			synced = true
+		}
+		if result.Status == constants.SYNC_ACCOUNT_STATUS_DEFERRED {
+			deferred = append(deferred, dto.DeferredAccountSync{
+				AccountID: result.AccountID,
+				RetryAt:   *result.RetryAt,
+			})
+		}
+	}
+
+	// New transactions may complete transfers, and continue or start recurring
+	// series. Transfers are linked first, they are not recurring payments.
+	if synced {
+		if _, err := s.transfers.DetectTransfers(ctx, userID); err != nil {
+			log.Error("Failed to detect transfers", "error", err, "userID", userID)
+		}
+		if _, err := s.recurring.DetectRecurring(ctx, userID); err != nil {
+			log.Error("Failed to detect recurring transactions", "error", err, "userID", userID)
 		}
 	}
 
 	return &dto.GoCardlessUpdateRequisitionResponse{
-		Status:        response.Status,
-		InstitutionID: response.InstitutionID,
-		Reference:     response.Reference,
+		Status:           string(requisition.Status),
+		InstitutionID:    connection.InstitutionID,
+		Reference:        connection.Reference,
+		DeferredAccounts: deferred,
+		Accounts:         results,
 	}, nil
 }
 
-// processAccountsFromRequisition processes the account IDs from a requisition
-func (s *gclService) processAccountsFromRequisition(ctx context.Context, accountIDs []string, requisitionID string, userID uuid.UUID) error {
-	for _, accountID := range accountIDs {
-		// Fetch account details and balances
-		accountDetails, err := s.gclClient.GetAccountDetails(ctx, accountID)
-		if err != nil {
-			return fmt.Errorf("failed to get account details for %s: %w", accountID, err)
-		}
-
-		balances, err := s.gclClient.GetAccountBalances(ctx, accountID)
-		if err != nil {
-			return fmt.Errorf("failed to get account balances for %s: %w", accountID, err)
-		}
+// processAccountsFromRequisition syncs the accounts of a requisition and
+// returns the outcome of each, in the order of accountIDs. Accounts are synced
+// in parallel by up to SyncWorkers workers. A failing account does not stop the
+// others. Accounts that hit a provider rate limit are not synced; they are
+// deferred until the limit resets. Accounts ctx marks as already synced are
+// skipped.
+func (s *gclService) processAccountsFromRequisition(ctx context.Context, provider aggregator.Provider, accountIDs []string, requisition *domain.Requisition, userID uuid.UUID, progress SyncProgress) []dto.AccountSyncResult {
+	results := make([]dto.AccountSyncResult, len(accountIDs))
 
-		var balanceAvailable, balanceCurrent float64
-		for _, balance := range balances.Balances {
-			if balance.BalanceType == "interimAvailable" {
-				balanceAvailable, _ = strconv.ParseFloat(balance.BalanceAmount.Amount, 64)
-			}
-			if balance.BalanceType == "interimBooked" {
-				balanceCurrent, _ = strconv.ParseFloat(balance.BalanceAmount.Amount, 64)
-			}
-		}
+	// Once the general rate limit is reached, it applies to every account not
+	// started yet; the account limit only to the account that hit it.
+	var (
+		mu           sync.Mutex
+		generalReset *time.Time
+	)
+	limitedUntil := func() *time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return generalReset
+	}
 
-		// Check if the account already exists in our database
-		existingAccount, err := s.bankAccountRepo.GetByAccountID(ctx, accountID)
-		if err != nil {
-			// If the error is a 'not found' error, it means we can create the account.
-			if repository.IsNotFoundError(err) {
-				// Create new bank account record
-				bankAccount := &domain.BankAccount{
-					ID:               uuid.New(),
-					AccountID:        accountID,
-					Name:             accountDetails.Account.Name,
-					Type:             accountDetails.Account.Product,
-					Currency:         accountDetails.Account.Currency,
-					InstitutionName:  accountDetails.Account.InstitutionName,
-					IBAN:             accountDetails.Account.IBAN,
-					UserID:           userID,
-					RequisitionID:    requisitionID,
-					BalanceAvailable: balanceAvailable,
-					BalanceCurrent:   balanceCurrent,
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < syncWorkers(s.cfg.GoCardless.SyncWorkers, len(accountIDs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				accountID := accountIDs[i]
+				var result dto.AccountSyncResult
+				switch resetAt := limitedUntil(); {
+				case resetAt != nil:
+					result = deferredAccountSync(accountID, nil, *resetAt)
+				case ctx.Err() != nil:
+					result = failedAccountSync(accountID, nil, ctx.Err())
+				default:
+					var rateLimitErr *aggregator.RateLimitError
+					result, rateLimitErr = s.processAccount(ctx, provider, accountID, requisition, userID, progress)
+					if rateLimitErr != nil && rateLimitErr.Scope == aggregator.RateLimitScopeGeneral {
+						mu.Lock()
+						if generalReset == nil {
+							generalReset = &rateLimitErr.ResetAt
+						}
+						mu.Unlock()
+					}
 				}
 
-				err = s.bankAccountRepo.Create(ctx, bankAccount)
-				if err != nil {
-					return fmt.Errorf("failed to create bank account: %w", err)
+				results[i] = result
+				if progress != nil {
+					progress.AccountUpdated(result)
 				}
-				existingAccount = bankAccount // Set existingAccount for transaction processing
-			} else {
-				// Any other error is a real problem.
-				return fmt.Errorf("failed to check existing account: %w", err)
-			}
-		} else {
-			// If account exists, update its balances
-			existingAccount.BalanceAvailable = balanceAvailable
-			existingAccount.BalanceCurrent = balanceCurrent
-			err = s.bankAccountRepo.Update(ctx, existingAccount)
-			if err != nil {
-				return fmt.Errorf("failed to update existing bank account balances: %w", err)
 			}
+		}()
+	}
+
+	for i := range accountIDs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// syncWorkers returns how many workers sync the accounts of a requisition
+func syncWorkers(configured, accounts int) int {
+	if configured < 1 {
+		configured = 1
+	}
+	if accounts < configured {
+		return accounts
+	}
+	return configured
+}
+
+// processAccount syncs a single account of a requisition and returns its
+// outcome, with the rate limit error when the account was deferred
+func (s *gclService) processAccount(ctx context.Context, provider aggregator.Provider, accountID string, requisition *domain.Requisition, userID uuid.UUID, progress SyncProgress) (dto.AccountSyncResult, *aggregator.RateLimitError) {
+	// Syncs running on other instances, or next to this one, may hold the
+	// account; the lock keeps their balance and transaction writes apart
+	var result dto.AccountSyncResult
+	var rateLimitErr *aggregator.RateLimitError
+	err := s.bankAccountRepo.WithSyncLock(ctx, accountID, func() error {
+		result, rateLimitErr = s.processLockedAccount(ctx, provider, accountID, requisition, userID, progress)
+		return nil
+	})
+	if err != nil {
+		return failedAccountSync(accountID, nil, fmt.Errorf("failed to lock account: %w", err)), nil
+	}
+	return result, rateLimitErr
+}
+
+// processLockedAccount syncs an account its sync lock is held for
+func (s *gclService) processLockedAccount(ctx context.Context, provider aggregator.Provider, accountID string, requisition *domain.Requisition, userID uuid.UUID, progress SyncProgress) (dto.AccountSyncResult, *aggregator.RateLimitError) {
+	// Check if the account already exists in our database
+	existingAccount, err := s.bankAccountRepo.GetByAccountID(ctx, accountID)
+	if err != nil {
+		if !repository.IsNotFoundError(err) {
+			return failedAccountSync(accountID, nil, fmt.Errorf("failed to check existing account: %w", err)), nil
 		}
+		existingAccount = nil
+	}
+	var bankAccountID *uuid.UUID
+	if existingAccount != nil {
+		bankAccountID = &existingAccount.ID
+	}
 
-		// Process transactions for the account
-		err = s.processTransactionsForAccount(ctx, accountID, existingAccount.ID, userID)
+	if existingAccount != nil && syncedAccount(ctx, accountID) {
+		return dto.AccountSyncResult{
+			AccountID:     accountID,
+			BankAccountID: bankAccountID,
+			Status:        constants.SYNC_ACCOUNT_STATUS_SKIPPED,
+		}, nil
+	}
+
+	// Skip accounts still waiting for their rate limit to reset
+	if existingAccount != nil && existingAccount.SyncDeferredUntil != nil && time.Now().Before(*existingAccount.SyncDeferredUntil) {
+		return deferredAccountSync(accountID, bankAccountID, *existingAccount.SyncDeferredUntil), nil
+	}
+
+	if progress != nil {
+		progress.AccountUpdated(dto.AccountSyncResult{
+			AccountID:     accountID,
+			BankAccountID: bankAccountID,
+			Status:        constants.SYNC_ACCOUNT_STATUS_RUNNING,
+		})
+	}
+
+	account, err := s.syncAccount(ctx, provider, accountID, existingAccount, requisition, userID)
+	if account != nil {
+		bankAccountID = &account.ID
+	}
+
+	var rateLimitErr *aggregator.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
 		if err != nil {
-			return fmt.Errorf("failed to process transactions for account %s: %w", accountID, err)
+			log.Error("Failed to sync account", "error", err, "accountID", accountID, "requisitionID", requisition.ID)
+			return failedAccountSync(accountID, bankAccountID, err), nil
 		}
+		return dto.AccountSyncResult{
+			AccountID:     accountID,
+			BankAccountID: bankAccountID,
+			Status:        constants.SYNC_ACCOUNT_STATUS_SUCCEEDED,
+		}, nil
 	}
 
-	return nil
+	if existingAccount != nil {
+		existingAccount.SyncDeferredUntil = &rateLimitErr.ResetAt
+		if err := s.bankAccountRepo.Update(ctx, existingAccount); err != nil {
+			log.Error("Failed to defer sync of account", "error", err, "accountID", accountID)
+		}
+	}
+
+	return deferredAccountSync(accountID, bankAccountID, rateLimitErr.ResetAt), rateLimitErr
+}
+
+// failedAccountSync is the result of an account that could not be synced
+func failedAccountSync(accountID string, bankAccountID *uuid.UUID, err error) dto.AccountSyncResult {
+	return dto.AccountSyncResult{
+		AccountID:     accountID,
+		BankAccountID: bankAccountID,
+		Status:        constants.SYNC_ACCOUNT_STATUS_FAILED,
+		Error:         syncErrorMessage(err),
+	}
+}
+
+// deferredAccountSync is the result of an account postponed until a rate limit resets
+func deferredAccountSync(accountID string, bankAccountID *uuid.UUID, retryAt time.Time) dto.AccountSyncResult {
+	return dto.AccountSyncResult{
+		AccountID:     accountID,
+		BankAccountID: bankAccountID,
+		Status:        constants.SYNC_ACCOUNT_STATUS_DEFERRED,
+		Error:         "the bank's rate limit was reached",
+		RetryAt:       &retryAt,
+	}
 }
 
-func (s *gclService) processTransactionsForAccount(ctx context.Context, accountID string, bankAccountID uuid.UUID, userID uuid.UUID) error {
-	transactions, err := s.gclClient.GetAccountTransactions(ctx, accountID)
+// syncAccount fetches the details, balances and transactions of an account and
+// stores them. existingAccount is nil when the account is not stored yet. The
+// stored account is returned, also when its transactions failed to sync.
+func (s *gclService) syncAccount(ctx context.Context, provider aggregator.Provider, accountID string, existingAccount *domain.BankAccount, requisition *domain.Requisition, userID uuid.UUID) (*domain.BankAccount, error) {
+	// Fetch account details and balances
+	if err := s.syncLimiter.Wait(ctx); err != nil {
+		return existingAccount, err
+	}
+	accountDetails, err := provider.GetAccountDetails(ctx, requisition, accountID)
 	if err != nil {
-		return fmt.Errorf("failed to get transactions from GoCardless for account %s: %w", accountID, err)
+		return existingAccount, fmt.Errorf("failed to get account details for %s: %w", accountID, err)
 	}
 
-	var newTransactions []*domain.Transaction
-	for _, tx := range transactions.Transactions.Booked {
-		// Check if transaction already exists to avoid duplicates
-		exists, err := s.transactionRepo.ExistsByTransactionID(ctx, tx.TransactionID)
+	if err := s.syncLimiter.Wait(ctx); err != nil {
+		return existingAccount, err
+	}
+	balances, err := provider.GetAccountBalances(ctx, requisition, accountID)
+	if err != nil {
+		return existingAccount, fmt.Errorf("failed to get account balances for %s: %w", accountID, err)
+	}
+
+	var balanceAvailable, balanceCurrent float64
+	for _, balance := range balances.Balances {
+		if balance.BalanceType == aggregator.BalanceTypeAvailable {
+			balanceAvailable, _ = strconv.ParseFloat(balance.BalanceAmount.Amount, 64)
+		}
+		if balance.BalanceType == aggregator.BalanceTypeCurrent {
+			balanceCurrent, _ = strconv.ParseFloat(balance.BalanceAmount.Amount, 64)
+		}
+	}
+
+	stored, err := s.storeAccount(ctx, accountID, existingAccount, accountDetails, requisition, userID, balanceAvailable, balanceCurrent)
+	if err != nil {
+		return existingAccount, err
+	}
+	existingAccount = stored
+
+	if err := s.balanceSnapshotRepo.Upsert(ctx, balanceSnapshots(balances, existingAccount)); err != nil {
+		return existingAccount, fmt.Errorf("failed to store balance history for account %s: %w", accountID, err)
+	}
+
+	// Process transactions for the account
+	err = s.processTransactionsForAccount(ctx, provider, requisition, accountID, existingAccount.ID, userID)
+	if err != nil {
+		return existingAccount, fmt.Errorf("failed to process transactions for account %s: %w", accountID, err)
+	}
+
+	return existingAccount, nil
+}
+
+// storeAccount creates or updates the bank account row of a synced account.
+// Accounts are stored one at a time, so that parallel workers cannot both
+// adopt the same account of a previous requisition.
+func (s *gclService) storeAccount(ctx context.Context, accountID string, existingAccount *domain.BankAccount, accountDetails *dto.AccountDetails, requisition *domain.Requisition, userID uuid.UUID, balanceAvailable, balanceCurrent float64) (*domain.BankAccount, error) {
+	s.accountsMu.Lock()
+	defer s.accountsMu.Unlock()
+
+	requisitionID := requisition.ID
+
+	// A reconnected bank hands out new account IDs; keep the existing rows
+	// and their transaction history by moving them to the new requisition
+	if existingAccount == nil && requisition.PreviousRequisitionID != "" {
+		var err error
+		existingAccount, err = s.findReconnectedAccount(ctx, requisition.PreviousRequisitionID, accountDetails)
 		if err != nil {
-			return fmt.Errorf("failed to check existence of transaction %s: %w", tx.TransactionID, err)
+			return nil, err
 		}
-		if exists {
-			continue // Skip existing transactions
+	}
+
+	if existingAccount == nil {
+		// Create new bank account record
+		bankAccount := &domain.BankAccount{
+			ID:               uuid.New(),
+			AccountID:        &accountID,
+			Name:             accountDetails.Account.Name,
+			Type:             accountDetails.Account.Product,
+			Currency:         accountDetails.Account.Currency,
+			InstitutionName:  accountDetails.Account.InstitutionName,
+			IBAN:             accountDetails.Account.IBAN,
+			UserID:           userID,
+			RequisitionID:    &requisitionID,
+			BalanceAvailable: balanceAvailable,
+			BalanceCurrent:   balanceCurrent,
+		}
+
+		if err := s.bankAccountRepo.Create(ctx, bankAccount); err != nil {
+			return nil, fmt.Errorf("failed to create bank account: %w", err)
 		}
+		return bankAccount, nil
+	}
 
-		amount, _ := strconv.ParseFloat(tx.TransactionAmount.Amount, 64)
-		bookingDate, _ := time.Parse("2006-01-02", tx.BookingDate)
+	// The account belongs to the requisition it was last synced with, also when
+	// the bank hands out the same account ID again after a reconnect, so that
+	// unlinking or expiring the previous requisition leaves it alone
+	existingAccount.AccountID = &accountID
+	if existingAccount.RequisitionID == nil || *existingAccount.RequisitionID != requisitionID {
+		existingAccount.RequisitionID = &requisitionID
+		existingAccount.ArchivedAt = nil
+	}
+
+	// Update its balances
+	existingAccount.BalanceAvailable = balanceAvailable
+	existingAccount.BalanceCurrent = balanceCurrent
+	existingAccount.SyncDeferredUntil = nil
+	if err := s.bankAccountRepo.Update(ctx, existingAccount); err != nil {
+		return existingAccount, fmt.Errorf("failed to update existing bank account balances: %w", err)
+	}
+	return existingAccount, nil
+}
 
-		newTransactions = append(newTransactions, &domain.Transaction{
+// balanceSnapshots records every balance the bank reported for an account as of today
+func balanceSnapshots(balances *dto.AccountBalances, account *domain.BankAccount) []*domain.BalanceSnapshot {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	snapshots := make([]*domain.BalanceSnapshot, 0, len(balances.Balances))
+	for _, balance := range balances.Balances {
+		amount, err := strconv.ParseFloat(balance.BalanceAmount.Amount, 64)
+		if err != nil || balance.BalanceType == "" {
+			continue
+		}
+		currency := balance.BalanceAmount.Currency
+		if currency == "" {
+			currency = account.Currency
+		}
+		snapshots = append(snapshots, &domain.BalanceSnapshot{
 			ID:            uuid.New(),
-			Description:   tx.RemittanceInformation,
+			BankAccountID: account.ID,
+			BalanceType:   balance.BalanceType,
+			Date:          today,
 			Amount:        amount,
-			Date:          bookingDate,
-			Type:          "",    // You might need to infer this from category or other logic
-			IsRecurring:   false, // You might need to infer this
-			UserID:        userID,
-			BankAccountID: bankAccountID,
+			Currency:      currency,
+			ReferenceDate: parseOptionalTime("2006-01-02", balance.ReferenceDate),
+			UserID:        account.UserID,
 		})
 	}
+	return snapshots
+}
+
+func (s *gclService) processTransactionsForAccount(ctx context.Context, provider aggregator.Provider, requisition *domain.Requisition, accountID string, bankAccountID uuid.UUID, userID uuid.UUID) error {
+	if err := s.syncLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	transactions, err := provider.GetAccountTransactions(ctx, requisition, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to get transactions from %s for account %s: %w", provider.Name(), accountID, err)
+	}
+
+	existingIDs, err := s.transactionRepo.GetProviderTransactionIDs(ctx, bankAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get existing transactions for account %s: %w", accountID, err)
+	}
+
+	// Pending rows stored by a previous sync. Each one is either still pending,
+	// has been booked in the meantime, or has been dropped by the bank.
+	storedPending, err := s.transactionRepo.GetPendingByBankAccountID(ctx, bankAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get pending transactions for account %s: %w", accountID, err)
+	}
+	reconciled := make(map[uuid.UUID]bool, len(storedPending))
+	pendingByProviderID := make(map[string]*domain.Transaction, len(storedPending))
+	for i := range storedPending {
+		if storedPending[i].ProviderTransactionID != "" {
+			pendingByProviderID[storedPending[i].ProviderTransactionID] = &storedPending[i]
+		}
+	}
+
+	// Booked rows imported before provider transaction IDs were stored. They are
+	// adopted by the first sync that sees them again instead of being duplicated.
+	legacy, err := s.transactionRepo.GetWithoutProviderIDByBankAccountID(ctx, bankAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get legacy transactions for account %s: %w", accountID, err)
+	}
+	adopted := make(map[uuid.UUID]bool)
+
+	var newTransactions []*domain.Transaction
+
+	// Keep pending rows that the bank still reports as pending so they are not
+	// mistaken for the booked counterpart of another transaction below.
+	pendingIDs := providerTransactionIDs(transactions.Transactions.Pending, constants.TRANSACTION_STATUS_PENDING)
+	for i, tx := range transactions.Transactions.Pending {
+		pendingTx := newTransactionFromGcl(tx, pendingIDs[i], constants.TRANSACTION_STATUS_PENDING, userID, bankAccountID)
+		if stored := findStoredPending(storedPending, reconciled, pendingTx); stored != nil {
+			reconciled[stored.ID] = true
+			continue
+		}
+		newTransactions = append(newTransactions, pendingTx)
+	}
+
+	bookedIDs := providerTransactionIDs(transactions.Transactions.Booked, constants.TRANSACTION_STATUS_BOOKED)
+	for i, tx := range transactions.Transactions.Booked {
+		bookedTx := newTransactionFromGcl(tx, bookedIDs[i], constants.TRANSACTION_STATUS_BOOKED, userID, bankAccountID)
+
+		// If this is the booked version of a transaction we stored as pending,
+		// promote the pending row so its ID and any user edits are preserved.
+		pending := pendingByProviderID[bookedTx.ProviderTransactionID]
+		if pending == nil || reconciled[pending.ID] {
+			if existingIDs[bookedTx.ProviderTransactionID] {
+				continue // Already imported
+			}
+			pending = matchPendingTransaction(storedPending, reconciled, bookedTx)
+		}
+		if pending != nil {
+			reconciled[pending.ID] = true
+			existingIDs[bookedTx.ProviderTransactionID] = true
+			pending.ProviderTransactionID = bookedTx.ProviderTransactionID
+			pending.Status = constants.TRANSACTION_STATUS_BOOKED
+			previousAmount := pending.Amount
+			copyBankDetails(pending, bookedTx)
+			if err := s.transactionRepo.Update(ctx, pending); err != nil {
+				return fmt.Errorf("failed to promote pending transaction %s: %w", pending.ID, err)
+			}
+			if err := s.dropStaleSplits(ctx, pending, previousAmount); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if old := findLegacyTransaction(legacy, adopted, bookedTx); old != nil {
+			adopted[old.ID] = true
+			existingIDs[bookedTx.ProviderTransactionID] = true
+			old.ProviderTransactionID = bookedTx.ProviderTransactionID
+			previousAmount := old.Amount
+			copyBankDetails(old, bookedTx)
+			if err := s.transactionRepo.Update(ctx, old); err != nil {
+				return fmt.Errorf("failed to adopt transaction %s: %w", old.ID, err)
+			}
+			if err := s.dropStaleSplits(ctx, old, previousAmount); err != nil {
+				return err
+			}
+			continue
+		}
+
+		existingIDs[bookedTx.ProviderTransactionID] = true
+		newTransactions = append(newTransactions, bookedTx)
+	}
+
+	// Pending rows that are neither pending nor booked anymore were cancelled
+	// or expired at the bank.
+	var staleIDs []uuid.UUID
+	for i := range storedPending {
+		if !reconciled[storedPending[i].ID] {
+			staleIDs = append(staleIDs, storedPending[i].ID)
+		}
+	}
+	// Legacy rows left behind next to an adopted copy are duplicates created
+	// by earlier syncs.
+	staleIDs = append(staleIDs, legacyDuplicates(legacy, adopted)...)
+	if err := s.transactionRepo.DeleteByIDs(ctx, staleIDs); err != nil {
+		return fmt.Errorf("failed to delete stale transactions: %w", err)
+	}
 
 	if len(newTransactions) > 0 {
-		err = s.transactionRepo.CreateInBatches(ctx, newTransactions)
+		// Uncategorized transactions are better than none
+		if err := s.categorizer.Categorize(ctx, userID, newTransactions); err != nil {
+			log.Error("Failed to categorize transactions", "error", err, "accountID", accountID)
+		}
+		err = s.transactionRepo.UpsertInBatches(ctx, newTransactions)
 		if err != nil {
 			return fmt.Errorf("failed to save new transactions: %w", err)
 		}
@@ -274,41 +800,257 @@ func (s *gclService) processTransactionsForAccount(ctx context.Context, accountI
 	return nil
 }
 
-// GetInstitutions retrieves available financial institutions for a country
-func (s *gclService) GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error) {
-	institutions, err := s.gclClient.GetInstitutions(ctx, countryCode)
+// newTransactionFromGcl maps a GoCardless transaction to a domain transaction
+func newTransactionFromGcl(tx dto.Transaction, providerTransactionID, status string, userID, bankAccountID uuid.UUID) *domain.Transaction {
+	amount, _ := strconv.ParseFloat(tx.TransactionAmount.Amount, 64)
+
+	return &domain.Transaction{
+		ID:                    uuid.New(),
+		ProviderTransactionID: providerTransactionID,
+		Description:           tx.RemittanceInformation,
+		Amount:                amount,
+		Date:                  transactionDate(tx),
+		Type:                  transactionType(amount), // Rules may override it
+		Status:                status,
+		Currency:              tx.TransactionAmount.Currency,
+		ValueDate:             parseOptionalTime("2006-01-02", tx.ValueDate),
+		BookingDateTime:       parseOptionalTime(time.RFC3339, tx.BookingDateTime),
+		CreditorName:          tx.CreditorName,
+		CreditorIBAN:          tx.CreditorAccount.IBAN,
+		DebtorName:            tx.DebtorName,
+		DebtorIBAN:            tx.DebtorAccount.IBAN,
+		RemittanceStructured:  tx.RemittanceInformationStructured,
+		BankTransactionCode:   bankTransactionCode(tx),
+		MerchantCategoryCode:  tx.MerchantCategoryCode,
+		EndToEndID:            tx.EndToEndID,
+		RawData:               tx.Raw,
+		UserID:                userID,
+		BankAccountID:         bankAccountID,
+	}
+}
+
+// copyBankDetails overwrites the details reported by the bank, leaving user edits untouched
+func copyBankDetails(dst, src *domain.Transaction) {
+	dst.Amount = src.Amount
+	dst.Date = src.Date
+	dst.Description = src.Description
+	dst.Currency = src.Currency
+	dst.ValueDate = src.ValueDate
+	dst.BookingDateTime = src.BookingDateTime
+	dst.CreditorName = src.CreditorName
+	dst.CreditorIBAN = src.CreditorIBAN
+	dst.DebtorName = src.DebtorName
+	dst.DebtorIBAN = src.DebtorIBAN
+	dst.RemittanceStructured = src.RemittanceStructured
+	dst.BankTransactionCode = src.BankTransactionCode
+	dst.MerchantCategoryCode = src.MerchantCategoryCode
+	dst.EndToEndID = src.EndToEndID
+	dst.RawData = src.RawData
+	// Transactions imported before their type was set get it from their amount
+	if dst.Type == "" {
+		dst.Type = src.Type
+	}
+}
+
+// dropStaleSplits removes the splits of a transaction whose amount the bank
+// changed, e.g. a pending card payment booked with a tip, as they no longer
+// add up to it
+func (s *gclService) dropStaleSplits(ctx context.Context, tx *domain.Transaction, previousAmount float64) error {
+	if math.Round(tx.Amount*100) == math.Round(previousAmount*100) {
+		return nil
+	}
+	if err := s.transactionRepo.ReplaceSplits(ctx, tx.ID, nil); err != nil {
+		return fmt.Errorf("failed to remove splits of transaction %s: %w", tx.ID, err)
+	}
+	tx.Splits = nil
+	return nil
+}
+
+// bankTransactionCode returns the ISO 20022 code, or the bank's proprietary one
+func bankTransactionCode(tx dto.Transaction) string {
+	if tx.BankTransactionCode != "" {
+		return tx.BankTransactionCode
+	}
+	return tx.ProprietaryBankTransactionCode
+}
+
+// parseOptionalTime parses value with layout, returning nil when it is empty or malformed
+func parseOptionalTime(layout, value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	parsed, err := time.Parse(layout, value)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get institutions: %w", err)
+		return nil
+	}
+	return &parsed
+}
+
+// providerTransactionIDs returns the provider transaction ID of each transaction.
+// Banks that omit transactionId get a fingerprint of the transaction instead;
+// identical transactions within the same response are told apart by their
+// position among their duplicates.
+func providerTransactionIDs(transactions []dto.Transaction, status string) []string {
+	ids := make([]string, len(transactions))
+	occurrences := make(map[string]int)
+
+	for i, tx := range transactions {
+		if tx.TransactionID != "" {
+			ids[i] = tx.TransactionID
+			continue
+		}
+
+		fingerprint := transactionFingerprint(tx, status)
+		occurrences[fingerprint]++
+		ids[i] = fmt.Sprintf("fp_%s_%d", fingerprint, occurrences[fingerprint])
+	}
+
+	return ids
+}
+
+// transactionFingerprint hashes the fields of a transaction that do not change between syncs
+func transactionFingerprint(tx dto.Transaction, status string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		status,
+		tx.BookingDate,
+		tx.ValueDate,
+		tx.TransactionAmount.Amount,
+		tx.TransactionAmount.Currency,
+		tx.CreditorName,
+		tx.DebtorName,
+		tx.RemittanceInformation,
+	}, "|")))
+	return hex.EncodeToString(hash[:16])
+}
+
+// transactionDate returns the best available date of a transaction. Pending
+// transactions frequently come without a booking date.
+func transactionDate(tx dto.Transaction) time.Time {
+	for _, value := range []string{tx.BookingDate, tx.ValueDate} {
+		if date, err := time.Parse("2006-01-02", value); err == nil {
+			return date
+		}
+	}
+	for _, value := range []string{tx.BookingDateTime, tx.ValueDateTime} {
+		if date, err := time.Parse(time.RFC3339, value); err == nil {
+			return date
+		}
 	}
+	return time.Time{}
+}
 
-	return institutions, nil
+// findStoredPending returns the stored pending row describing the same pending transaction
+func findStoredPending(stored []domain.Transaction, reconciled map[uuid.UUID]bool, tx *domain.Transaction) *domain.Transaction {
+	for i := range stored {
+		candidate := &stored[i]
+		if reconciled[candidate.ID] {
+			continue
+		}
+		if candidate.ProviderTransactionID != "" {
+			if candidate.ProviderTransactionID == tx.ProviderTransactionID {
+				return candidate
+			}
+			continue
+		}
+		if sameAmount(candidate.Amount, tx.Amount) &&
+			candidate.Date.Equal(tx.Date) &&
+			candidate.Description == tx.Description {
+			return candidate
+		}
+	}
+	return nil
 }
 
-func (s *gclService) GetAccountDetails(ctx context.Context, accountID string) (*dto.AccountDetails, error) {
-	return s.gclClient.GetAccountDetails(ctx, accountID)
+// matchPendingTransaction returns the stored pending row that most likely became
+// the given booked transaction: same amount, booked shortly after it was
+// authorised, preferring an identical description and then the closest date.
+func matchPendingTransaction(stored []domain.Transaction, reconciled map[uuid.UUID]bool, booked *domain.Transaction) *domain.Transaction {
+	var best *domain.Transaction
+	var bestDistance time.Duration
+	bestSameDescription := false
+
+	for i := range stored {
+		candidate := &stored[i]
+		if reconciled[candidate.ID] || !sameAmount(candidate.Amount, booked.Amount) {
+			continue
+		}
+
+		distance := booked.Date.Sub(candidate.Date)
+		if distance < -24*time.Hour || distance > pendingSettlementWindow {
+			continue
+		}
+		if distance < 0 {
+			distance = -distance
+		}
+
+		sameDescription := candidate.Description == booked.Description
+		if best == nil ||
+			(sameDescription && !bestSameDescription) ||
+			(sameDescription == bestSameDescription && distance < bestDistance) {
+			best = candidate
+			bestDistance = distance
+			bestSameDescription = sameDescription
+		}
+	}
+
+	return best
 }
 
-func (s *gclService) GetAccountBalances(ctx context.Context, accountID string) (*dto.AccountBalances, error) {
-	return s.gclClient.GetAccountBalances(ctx, accountID)
+// findLegacyTransaction returns the booked row without provider ID describing the given transaction
+func findLegacyTransaction(legacy []domain.Transaction, adopted map[uuid.UUID]bool, tx *domain.Transaction) *domain.Transaction {
+	for i := range legacy {
+		candidate := &legacy[i]
+		if adopted[candidate.ID] || candidate.Status == constants.TRANSACTION_STATUS_PENDING {
+			continue
+		}
+		if sameAmount(candidate.Amount, tx.Amount) &&
+			candidate.Date.Equal(tx.Date) &&
+			candidate.Description == tx.Description {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// legacyDuplicates returns the IDs of legacy rows that duplicate an adopted row
+func legacyDuplicates(legacy []domain.Transaction, adopted map[uuid.UUID]bool) []uuid.UUID {
+	var duplicates []uuid.UUID
+	for i := range legacy {
+		candidate := &legacy[i]
+		if adopted[candidate.ID] || candidate.Status == constants.TRANSACTION_STATUS_PENDING {
+			continue
+		}
+		for j := range legacy {
+			if adopted[legacy[j].ID] &&
+				sameAmount(legacy[j].Amount, candidate.Amount) &&
+				legacy[j].Date.Equal(candidate.Date) &&
+				legacy[j].Description == candidate.Description {
+				duplicates = append(duplicates, candidate.ID)
+				break
+			}
+		}
+	}
+	return duplicates
 }
 
-func (s *gclService) GetAccountTransactions(ctx context.Context, accountID string) (*dto.AccountTransactions, error) {
-	return s.gclClient.GetAccountTransactions(ctx, accountID)
+// sameAmount compares two amounts to the cent
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
 }
 
 func (s *gclService) GetValidAccessToken(ctx context.Context) (string, error) {
-	return s.gclClient.GetValidAccessToken(ctx)
+	return s.gclTokens.GetValidAccessToken(ctx)
 }
 
 func (s *gclService) RefreshTokenIfNeeded(ctx context.Context) error {
-	_, err := s.gclClient.GetValidAccessToken(ctx)
+	_, err := s.gclTokens.GetValidAccessToken(ctx)
 	return err
 }
 
 func (s *gclService) GetTokenStatus() map[string]interface{} {
-	return s.gclClient.GetTokenStatus()
+	return s.gclTokens.GetTokenStatus()
 }
 
-func (s *gclService) ClearToken() {
-	s.gclClient.ClearTokens()
+func (s *gclService) ClearToken(ctx context.Context) error {
+	return s.gclTokens.ClearTokens(ctx)
 }
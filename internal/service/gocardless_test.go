@@ -0,0 +1,257 @@
+package service
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+)
+
+func TestNewCallbackState(t *testing.T) {
+	callbackURL, stateHash, err := newCallbackState("http://localhost:8080/api/gocardless/callback?lang=de")
+	if err != nil {
+		t.Fatalf("newCallbackState() error = %v", err)
+	}
+	parsed, err := url.Parse(callbackURL)
+	if err != nil {
+		t.Fatalf("callback URL %q: %v", callbackURL, err)
+	}
+	state := parsed.Query().Get("state")
+	if state == "" || parsed.Query().Get("lang") != "de" || parsed.Path != "/api/gocardless/callback" {
+		t.Fatalf("callback URL = %q, want the redirect URL with a state", callbackURL)
+	}
+	if stateHash == state || stateHash != callbackStateHash(state) {
+		t.Errorf("state hash = %q, want the hash of the state", stateHash)
+	}
+
+	other, _, _ := newCallbackState("http://localhost:8080/api/gocardless/callback")
+	if otherURL, _ := url.Parse(other); otherURL.Query().Get("state") == state {
+		t.Error("newCallbackState() returned the same state twice")
+	}
+}
+
+func TestAwaitingCallback(t *testing.T) {
+	future, past := time.Now().Add(time.Minute), time.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name        string
+		requisition domain.Requisition
+		want        bool
+	}{
+		{"valid state", domain.Requisition{CallbackStateHash: "hash", CallbackStateExpiresAt: &future}, true},
+		{"expired state", domain.Requisition{CallbackStateHash: "hash", CallbackStateExpiresAt: &past}, false},
+		{"used state", domain.Requisition{CallbackStateExpiresAt: &future}, false},
+		{"no state", domain.Requisition{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := awaitingCallback(&tt.requisition); got != tt.want {
+				t.Errorf("awaitingCallback() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderTransactionIDs(t *testing.T) {
+	transaction := func(id, date, amount, creditor string) dto.Transaction {
+		tx := dto.Transaction{TransactionID: id, BookingDate: date, CreditorName: creditor}
+		tx.TransactionAmount.Amount = amount
+		tx.TransactionAmount.Currency = "EUR"
+		return tx
+	}
+	coffee := transaction("", "2026-03-02", "-3.50", "Coffee Shop")
+
+	tests := []struct {
+		name         string
+		transactions []dto.Transaction
+		status       string
+		check        func(t *testing.T, ids []string)
+	}{
+		{
+			name:         "bank IDs are kept",
+			transactions: []dto.Transaction{transaction("tx-1", "2026-03-01", "-10.00", "Shop"), transaction("tx-2", "2026-03-01", "-10.00", "Shop")},
+			check: func(t *testing.T, ids []string) {
+				if ids[0] != "tx-1" || ids[1] != "tx-2" {
+					t.Errorf("ids = %v, want the IDs of the bank", ids)
+				}
+			},
+		},
+		{
+			name:         "fingerprint without bank ID",
+			transactions: []dto.Transaction{coffee},
+			check: func(t *testing.T, ids []string) {
+				if !strings.HasPrefix(ids[0], "fp_") || !strings.HasSuffix(ids[0], "_1") {
+					t.Errorf("id = %q, want the first occurrence of a fingerprint", ids[0])
+				}
+			},
+		},
+		{
+			name:         "identical transactions are told apart",
+			transactions: []dto.Transaction{coffee, transaction("tx-1", "2026-03-02", "-3.50", "Coffee Shop"), coffee},
+			check: func(t *testing.T, ids []string) {
+				if ids[0] == ids[2] || strings.TrimSuffix(ids[0], "_1") != strings.TrimSuffix(ids[2], "_2") {
+					t.Errorf("ids = %v, want the occurrences of the same fingerprint", ids)
+				}
+			},
+		},
+		{
+			name:         "different transactions",
+			transactions: []dto.Transaction{coffee, transaction("", "2026-03-02", "-3.60", "Coffee Shop")},
+			check: func(t *testing.T, ids []string) {
+				if ids[0] == ids[1] {
+					t.Errorf("ids = %v, want different fingerprints", ids)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := providerTransactionIDs(tt.transactions, "booked")
+			if len(ids) != len(tt.transactions) {
+				t.Fatalf("providerTransactionIDs() returned %d IDs for %d transactions", len(ids), len(tt.transactions))
+			}
+			tt.check(t, ids)
+			if again := providerTransactionIDs(tt.transactions, "booked"); !slices.Equal(again, ids) {
+				t.Errorf("IDs changed between calls: %v, then %v", ids, again)
+			}
+		})
+	}
+
+	// The same transaction pending and booked is not the same row
+	if pending, booked := providerTransactionIDs([]dto.Transaction{coffee}, "pending"), providerTransactionIDs([]dto.Transaction{coffee}, "booked"); pending[0] == booked[0] {
+		t.Errorf("pending and booked fingerprints are both %q", pending[0])
+	}
+}
+
+func TestMatchPendingTransaction(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	pending := func(id byte, amount float64, days int, description string) domain.Transaction {
+		return domain.Transaction{
+			ID:          uuid.UUID{id},
+			Amount:      amount,
+			Date:        day.AddDate(0, 0, days),
+			Description: description,
+			Status:      constants.TRANSACTION_STATUS_PENDING,
+		}
+	}
+	booked := &domain.Transaction{Amount: -42.5, Date: day, Description: "CARD PAYMENT SUPERMARKET"}
+
+	tests := []struct {
+		name       string
+		stored     []domain.Transaction
+		reconciled map[uuid.UUID]bool
+		want       byte // ID of the expected match, 0 for none
+	}{
+		{
+			name:   "same amount shortly before",
+			stored: []domain.Transaction{pending(1, -42.5, -2, "SUPERMARKET")},
+			want:   1,
+		},
+		{
+			name:   "identical description wins over a closer date",
+			stored: []domain.Transaction{pending(1, -42.5, 0, "SUPERMARKET"), pending(2, -42.5, -3, "CARD PAYMENT SUPERMARKET")},
+			want:   2,
+		},
+		{
+			name:   "closest date",
+			stored: []domain.Transaction{pending(1, -42.5, -5, "SUPERMARKET"), pending(2, -42.5, -1, "SUPERMARKET")},
+			want:   2,
+		},
+		{
+			name:   "amounts are compared in cents",
+			stored: []domain.Transaction{pending(1, -42.499999, -1, "SUPERMARKET")},
+			want:   1,
+		},
+		{
+			name:   "different amount",
+			stored: []domain.Transaction{pending(1, -42.49, -1, "CARD PAYMENT SUPERMARKET")},
+		},
+		{
+			name:   "authorised too long before",
+			stored: []domain.Transaction{pending(1, -42.5, -11, "CARD PAYMENT SUPERMARKET")},
+		},
+		{
+			name:   "booked a day before it was authorised",
+			stored: []domain.Transaction{pending(1, -42.5, 1, "CARD PAYMENT SUPERMARKET")},
+			want:   1,
+		},
+		{
+			name:   "authorised after it was booked",
+			stored: []domain.Transaction{pending(1, -42.5, 2, "CARD PAYMENT SUPERMARKET")},
+		},
+		{
+			name:       "already reconciled",
+			stored:     []domain.Transaction{pending(1, -42.5, -1, "CARD PAYMENT SUPERMARKET"), pending(2, -42.5, -4, "SUPERMARKET")},
+			reconciled: map[uuid.UUID]bool{{1}: true},
+			want:       2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchPendingTransaction(tt.stored, tt.reconciled, booked)
+			switch {
+			case tt.want == 0 && got != nil:
+				t.Errorf("matchPendingTransaction() = %s, want no match", got.ID)
+			case tt.want != 0 && (got == nil || got.ID != uuid.UUID{tt.want}):
+				t.Errorf("matchPendingTransaction() = %v, want %s", got, uuid.UUID{tt.want})
+			}
+		})
+	}
+}
+
+func TestFindStoredPending(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	tx := &domain.Transaction{ProviderTransactionID: "pending-1", Amount: -9.99, Date: day, Description: "STREAMING"}
+
+	tests := []struct {
+		name       string
+		stored     []domain.Transaction
+		reconciled map[uuid.UUID]bool
+		want       byte
+	}{
+		{
+			name:   "same provider ID",
+			stored: []domain.Transaction{{ID: uuid.UUID{1}, ProviderTransactionID: "pending-1", Amount: -12, Date: day.AddDate(0, 0, -1)}},
+			want:   1,
+		},
+		{
+			name:   "other provider ID with the same details",
+			stored: []domain.Transaction{{ID: uuid.UUID{1}, ProviderTransactionID: "pending-2", Amount: -9.99, Date: day, Description: "STREAMING"}},
+		},
+		{
+			name:   "same details without provider ID",
+			stored: []domain.Transaction{{ID: uuid.UUID{1}, Amount: -9.99, Date: day, Description: "STREAMING"}},
+			want:   1,
+		},
+		{
+			name:   "other date without provider ID",
+			stored: []domain.Transaction{{ID: uuid.UUID{1}, Amount: -9.99, Date: day.AddDate(0, 0, -1), Description: "STREAMING"}},
+		},
+		{
+			name:       "already reconciled",
+			stored:     []domain.Transaction{{ID: uuid.UUID{1}, ProviderTransactionID: "pending-1"}},
+			reconciled: map[uuid.UUID]bool{{1}: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findStoredPending(tt.stored, tt.reconciled, tx)
+			switch {
+			case tt.want == 0 && got != nil:
+				t.Errorf("findStoredPending() = %s, want no match", got.ID)
+			case tt.want != 0 && (got == nil || got.ID != uuid.UUID{tt.want}):
+				t.Errorf("findStoredPending() = %v, want %s", got, uuid.UUID{tt.want})
+			}
+		})
+	}
+}
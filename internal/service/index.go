@@ -1,9 +1,16 @@
 package service
 
 type Services struct {
-	Auth        AuthService
-	User        UserService
-	GoCardless  GclService
-	BankAccount BankAccountService
-	Validator   ValidatorService
+	Auth           AuthService
+	User           UserService
+	GoCardless     GclService
+	Institution    InstitutionService
+	Sync           SyncService
+	BankAccount    BankAccountService
+	Transaction    TransactionService
+	Categorization CategorizationService
+	Recurring      RecurringService
+	Budget         BudgetService
+	Notification   NotificationService
+	Validator      ValidatorService
 }
@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"FinMa/config"
+	"FinMa/dto"
+	"FinMa/internal/aggregator"
+)
+
+// ErrInstitutionNotFound is returned when an institution is not part of the catalogue
+var ErrInstitutionNotFound = aggregator.ErrInstitutionNotFound
+
+type InstitutionService interface {
+	// GetInstitutions retrieves the institutions of a country matching the filter, from cache when fresh
+	GetInstitutions(ctx context.Context, countryCode string, filter dto.InstitutionFilter) ([]dto.Institution, error)
+	// GetInstitution retrieves a single institution by its ID
+	GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error)
+	// GetLogo returns the logo of an institution, downloading it into the local cache on first use
+	GetLogo(ctx context.Context, institutionID string) ([]byte, string, error)
+	// RefreshInstitutions reloads every cached country that is about to expire
+	RefreshInstitutions(ctx context.Context) error
+}
+
+// institutionCacheEntry holds the institutions of one country
+type institutionCacheEntry struct {
+	institutions []dto.Institution
+	fetchedAt    time.Time
+}
+
+type institutionService struct {
+	providers  *aggregator.Registry
+	httpClient *http.Client
+	ttl        time.Duration
+	logoDir    string
+
+	mu        sync.RWMutex
+	countries map[string]institutionCacheEntry
+	// byID indexes every cached institution for logo and detail lookups
+	byID map[string]dto.Institution
+
+	// logoMu serializes logo downloads so concurrent requests don't write the same file
+	logoMu sync.Mutex
+}
+
+func NewInstitutionService(providers *aggregator.Registry, cfg *config.Config) InstitutionService {
+	return &institutionService{
+		providers:  providers,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		ttl:        cfg.GoCardless.InstitutionsCacheTTL,
+		logoDir:    cfg.GoCardless.LogoCacheDir,
+		countries:  make(map[string]institutionCacheEntry),
+		byID:       make(map[string]dto.Institution),
+	}
+}
+
+func (s *institutionService) GetInstitutions(ctx context.Context, countryCode string, filter dto.InstitutionFilter) ([]dto.Institution, error) {
+	countryCode = strings.ToUpper(countryCode)
+
+	institutions, err := s.countryInstitutions(ctx, countryCode)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]dto.Institution, 0, len(institutions))
+	for _, institution := range institutions {
+		if matchesInstitutionFilter(institution, filter) {
+			filtered = append(filtered, institution)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (s *institutionService) GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error) {
+	s.mu.RLock()
+	institution, ok := s.byID[institutionID]
+	s.mu.RUnlock()
+	if ok {
+		return &institution, nil
+	}
+
+	// Institutions that were never listed could belong to any provider
+	for _, provider := range s.providers.All() {
+		fetched, err := provider.GetInstitution(ctx, institutionID)
+		if errors.Is(err, aggregator.ErrInstitutionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get institution %s from %s: %w", institutionID, provider.Name(), err)
+		}
+		return fetched, nil
+	}
+
+	return nil, ErrInstitutionNotFound
+}
+
+func (s *institutionService) GetLogo(ctx context.Context, institutionID string) ([]byte, string, error) {
+	// Institution IDs end up in file names, keep them to a safe character set
+	if !isSafeInstitutionID(institutionID) {
+		return nil, "", ErrInstitutionNotFound
+	}
+
+	if data, contentType, ok := s.readCachedLogo(institutionID); ok {
+		return data, contentType, nil
+	}
+
+	institution, err := s.GetInstitution(ctx, institutionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if institution.Logo == "" {
+		return nil, "", ErrInstitutionNotFound
+	}
+
+	s.logoMu.Lock()
+	defer s.logoMu.Unlock()
+
+	// Another request may have downloaded the logo while we waited
+	if data, contentType, ok := s.readCachedLogo(institutionID); ok {
+		return data, contentType, nil
+	}
+
+	data, contentType, err := s.downloadLogo(ctx, institution.Logo)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download logo of institution %s: %w", institutionID, err)
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	if err := s.writeCachedLogo(institutionID, data, contentType); err != nil {
+		// The logo is still served, it will be downloaded again next time
+		log.Warn("Failed to cache institution logo", "institutionID", institutionID, "error", err)
+	}
+
+	return data, contentType, nil
+}
+
+func (s *institutionService) RefreshInstitutions(ctx context.Context) error {
+	s.mu.RLock()
+	var stale []string
+	for countryCode, entry := range s.countries {
+		// Refresh a little ahead of expiry so requests keep hitting the cache
+		if time.Since(entry.fetchedAt) >= s.ttl/2 {
+			stale = append(stale, countryCode)
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, countryCode := range stale {
+		if _, err := s.fetchCountry(ctx, countryCode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// downloadLogo fetches a logo from its URL. Providers that return logos
+// inline pass them as base64 data URLs.
+func (s *institutionService) downloadLogo(ctx context.Context, logoURL string) ([]byte, string, error) {
+	if strings.HasPrefix(logoURL, "data:") {
+		header, payload, ok := strings.Cut(strings.TrimPrefix(logoURL, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return nil, "", fmt.Errorf("unsupported logo data URL")
+		}
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode logo: %w", err)
+		}
+		return data, strings.TrimSuffix(header, ";base64"), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logoURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code downloading logo: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read logo: %w", err)
+	}
+
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// countryInstitutions returns the cached institutions of a country, fetching them when missing or expired.
+// An expired entry is still served if the provider cannot be reached.
+func (s *institutionService) countryInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error) {
+	s.mu.RLock()
+	entry, ok := s.countries[countryCode]
+	s.mu.RUnlock()
+
+	if ok && time.Since(entry.fetchedAt) < s.ttl {
+		return entry.institutions, nil
+	}
+
+	institutions, err := s.fetchCountry(ctx, countryCode)
+	if err != nil {
+		if ok {
+			log.Warn("Serving stale institutions", "countryCode", countryCode, "error", err)
+			return entry.institutions, nil
+		}
+		return nil, err
+	}
+
+	return institutions, nil
+}
+
+// fetchCountry loads the institutions of a country from its provider and stores them in the cache
+func (s *institutionService) fetchCountry(ctx context.Context, countryCode string) ([]dto.Institution, error) {
+	institutions, err := s.providers.ForCountry(countryCode).GetInstitutions(ctx, countryCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get institutions for %s: %w", countryCode, err)
+	}
+
+	sort.Slice(institutions, func(i, j int) bool {
+		return strings.ToLower(institutions[i].Name) < strings.ToLower(institutions[j].Name)
+	})
+
+	s.mu.Lock()
+	s.countries[countryCode] = institutionCacheEntry{
+		institutions: institutions,
+		fetchedAt:    time.Now(),
+	}
+	for _, institution := range institutions {
+		s.byID[institution.ID] = institution
+	}
+	s.mu.Unlock()
+
+	return institutions, nil
+}
+
+// readCachedLogo reads a logo from the local cache directory
+func (s *institutionService) readCachedLogo(institutionID string) ([]byte, string, bool) {
+	matches, err := filepath.Glob(filepath.Join(s.logoDir, institutionID+".*"))
+	if err != nil || len(matches) == 0 {
+		return nil, "", false
+	}
+
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		return nil, "", false
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(matches[0]))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	return data, contentType, true
+}
+
+// writeCachedLogo stores a logo in the local cache directory, named after the institution
+func (s *institutionService) writeCachedLogo(institutionID string, data []byte, contentType string) error {
+	if err := os.MkdirAll(s.logoDir, 0o755); err != nil {
+		return err
+	}
+
+	ext := ".img"
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	// Write to a temporary file first so a partial download is never served
+	tmp, err := os.CreateTemp(s.logoDir, institutionID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.logoDir, institutionID+ext))
+}
+
+// matchesInstitutionFilter checks an institution against the search query, features and history length
+func matchesInstitutionFilter(institution dto.Institution, filter dto.InstitutionFilter) bool {
+	if query := strings.ToLower(strings.TrimSpace(filter.Query)); query != "" {
+		if !strings.Contains(strings.ToLower(institution.Name), query) &&
+			!strings.HasPrefix(strings.ToLower(institution.BIC), query) {
+			return false
+		}
+	}
+
+	for _, feature := range filter.Features {
+		if !hasFeature(institution.SupportedFeatures, feature) {
+			return false
+		}
+	}
+
+	if filter.MinHistoryDays > 0 {
+		days, err := strconv.Atoi(institution.TransactionTotalDays)
+		if err != nil || days < filter.MinHistoryDays {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasFeature checks if a feature is in the list, ignoring case
+func hasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if strings.EqualFold(f, feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeInstitutionID checks that an institution ID only contains letters, digits, dashes and underscores
+func isSafeInstitutionID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
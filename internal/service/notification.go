@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"FinMa/dto"
+	"FinMa/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type NotificationService interface {
+	// GetNotifications retrieves the notifications a user has not dismissed
+	GetNotifications(ctx context.Context, userID uuid.UUID) ([]dto.NotificationResponse, error)
+	// DismissNotification dismisses a notification of a user
+	DismissNotification(ctx context.Context, userID, notificationID uuid.UUID) error
+}
+
+type notificationService struct {
+	notificationRepo repository.NotificationRepository
+}
+
+func NewNotificationService(notificationRepo repository.NotificationRepository) NotificationService {
+	return &notificationService{
+		notificationRepo: notificationRepo,
+	}
+}
+
+func (s *notificationService) GetNotifications(ctx context.Context, userID uuid.UUID) ([]dto.NotificationResponse, error) {
+	notifications, err := s.notificationRepo.GetActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications for user %s: %w", userID, err)
+	}
+
+	response := make([]dto.NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		response = append(response, dto.NotificationResponse{
+			ID:        notification.ID,
+			Type:      notification.Type,
+			Message:   notification.Message,
+			Reference: notification.Reference,
+			CreatedAt: notification.CreatedAt,
+		})
+	}
+
+	return response, nil
+}
+
+func (s *notificationService) DismissNotification(ctx context.Context, userID, notificationID uuid.UUID) error {
+	notification, err := s.notificationRepo.GetByID(ctx, notificationID)
+	if err != nil {
+		return err
+	}
+	if notification.UserID != userID {
+		return repository.ErrNotificationNotFound
+	}
+
+	if err := s.notificationRepo.Deactivate(ctx, notificationID); err != nil {
+		return fmt.Errorf("failed to dismiss notification %s: %w", notificationID, err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/domain"
+)
+
+// recurringCadence is an interval transactions of a series repeat at
+type recurringCadence struct {
+	name string
+	// Days between two transactions, loose enough for months of different
+	// lengths and charges moved to the next working day
+	minDays, maxDays int
+	// grace is how late a transaction may be before it counts as missed
+	grace time.Duration
+	// perMonth is how often the series repeats in a month, on average
+	perMonth float64
+	next     func(time.Time) time.Time
+}
+
+var recurringCadences = []recurringCadence{
+	{
+		name:     constants.RECURRING_CADENCE_WEEKLY,
+		minDays:  6,
+		maxDays:  8,
+		grace:    3 * 24 * time.Hour,
+		perMonth: 52.0 / 12,
+		next:     func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+	},
+	{
+		name:     constants.RECURRING_CADENCE_MONTHLY,
+		minDays:  25,
+		maxDays:  35,
+		grace:    5 * 24 * time.Hour,
+		perMonth: 1,
+		next:     func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+	},
+	{
+		name:     constants.RECURRING_CADENCE_YEARLY,
+		minDays:  350,
+		maxDays:  380,
+		grace:    14 * 24 * time.Hour,
+		perMonth: 1.0 / 12,
+		next:     func(t time.Time) time.Time { return t.AddDate(1, 0, 0) },
+	},
+}
+
+// recurringLookback is how far back transactions are searched for series, long enough for two yearly charges
+const recurringLookback = 25 // months
+
+// recurringFitRatio is the share of intervals of a series that have to match its cadence
+const recurringFitRatio = 0.75
+
+// cadenceByName returns the cadence with the given name
+func cadenceByName(name string) (recurringCadence, bool) {
+	for _, cadence := range recurringCadences {
+		if cadence.name == name {
+			return cadence, true
+		}
+	}
+	return recurringCadence{}, false
+}
+
+// detectRecurringSeries finds the recurring series among the booked transactions
+// of a user, sorted by date. Transfers between the user's accounts, such as
+// a standing order to savings, are no recurring payments and are left out.
+// Transactions are grouped by account, direction and
+// counterparty, then split into runs of similar amounts: each transaction joins
+// the run whose latest amount is closest, within tolerance, so a price change
+// continues a series while different plans of the same merchant stay apart. A
+// run is a series when enough transactions repeat at one of the cadences.
+func detectRecurringSeries(transactions []domain.Transaction, tolerance float64, minOccurrences int) []*domain.RecurringSeries {
+	groups := make(map[string][]*domain.Transaction)
+	var keys []string
+	for i := range transactions {
+		tx := &transactions[i]
+		counterpartyKey := recurringCounterpartyKey(tx)
+		if counterpartyKey == "" || tx.Amount == 0 || tx.TransferTransactionID != nil {
+			continue
+		}
+		key := tx.BankAccountID.String() + "|" + transactionType(tx.Amount) + "|" + counterpartyKey
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], tx)
+	}
+
+	var series []*domain.RecurringSeries
+	for _, key := range keys {
+		var runs [][]*domain.Transaction
+		for _, tx := range groups[key] {
+			best, bestDiff := -1, math.Inf(1)
+			for i, run := range runs {
+				last := run[len(run)-1].Amount
+				diff := math.Abs(tx.Amount - last)
+				if diff <= tolerance*math.Max(math.Abs(tx.Amount), math.Abs(last)) && diff < bestDiff {
+					best, bestDiff = i, diff
+				}
+			}
+			if best < 0 {
+				runs = append(runs, []*domain.Transaction{tx})
+			} else {
+				runs[best] = append(runs[best], tx)
+			}
+		}
+
+		for _, run := range runs {
+			cadence, ok := runCadence(run, minOccurrences)
+			if !ok {
+				continue
+			}
+			series = append(series, newRecurringSeries(run, cadence))
+		}
+	}
+	return series
+}
+
+// runCadence returns the cadence most intervals of a run of transactions match,
+// if enough do. An interval spanning two periods, a charge the bank skipped or
+// reported late, still counts for the cadence.
+func runCadence(run []*domain.Transaction, minOccurrences int) (recurringCadence, bool) {
+	if len(run) < 2 {
+		return recurringCadence{}, false
+	}
+
+	var best recurringCadence
+	var bestFits int
+	for _, cadence := range recurringCadences {
+		required := minOccurrences
+		if cadence.name == constants.RECURRING_CADENCE_YEARLY {
+			required = 2
+		}
+		if len(run) < required {
+			continue
+		}
+
+		var fits int
+		for i := 1; i < len(run); i++ {
+			days := int(math.Round(run[i].Date.Sub(run[i-1].Date).Hours() / 24))
+			if (days >= cadence.minDays && days <= cadence.maxDays) ||
+				(days >= 2*cadence.minDays && days <= 2*cadence.maxDays) {
+				fits++
+			}
+		}
+		if float64(fits) >= recurringFitRatio*float64(len(run)-1) && fits > bestFits {
+			best, bestFits = cadence, fits
+		}
+	}
+	return best, bestFits > 0
+}
+
+// newRecurringSeries describes a run of transactions repeating at a cadence
+func newRecurringSeries(run []*domain.Transaction, cadence recurringCadence) *domain.RecurringSeries {
+	first, last := run[0], run[len(run)-1]
+
+	series := &domain.RecurringSeries{
+		ID:                 uuid.New(),
+		Counterparty:       recurringCounterparty(last),
+		CounterpartyKey:    recurringCounterpartyKey(last),
+		Cadence:            cadence.name,
+		Category:           last.Category,
+		Currency:           last.Currency,
+		Amount:             last.Amount,
+		PreviousAmount:     last.Amount,
+		Occurrences:        len(run),
+		FirstDate:          first.Date,
+		LastDate:           last.Date,
+		NextExpectedDate:   cadence.next(last.Date),
+		NextExpectedAmount: last.Amount,
+		BankAccountID:      last.BankAccountID,
+		UserID:             last.UserID,
+	}
+	var total float64
+	for i, tx := range run {
+		total += tx.Amount
+		series.TransactionIDs = append(series.TransactionIDs, tx.ID)
+		// Amounts are compared in cents, so floating point noise is no change
+		if i > 0 && math.Round(tx.Amount*100) != math.Round(run[i-1].Amount*100) {
+			series.PreviousAmount = run[i-1].Amount
+			changedAt := tx.Date
+			series.PriceChangedAt = &changedAt
+		}
+	}
+	series.AverageAmount = roundCents(total / float64(len(run)))
+	return series
+}
+
+// recurringSeriesStatus tells whether the next transaction of a series is
+// overdue at now. After three missed transactions the series is considered ended.
+func recurringSeriesStatus(series *domain.RecurringSeries, now time.Time) string {
+	cadence, ok := cadenceByName(series.Cadence)
+	if !ok || !now.After(series.NextExpectedDate.Add(cadence.grace)) {
+		return constants.RECURRING_STATUS_ACTIVE
+	}
+	if now.After(cadence.next(cadence.next(series.NextExpectedDate)).Add(cadence.grace)) {
+		return constants.RECURRING_STATUS_ENDED
+	}
+	return constants.RECURRING_STATUS_MISSED
+}
+
+// recurringCounterparty names the counterparty of a transaction, falling back
+// to its IBAN and then its description
+func recurringCounterparty(tx *domain.Transaction) string {
+	if name := strings.TrimSpace(counterparty(tx)); name != "" {
+		return name
+	}
+	if iban := counterpartyIBAN(tx); iban != "" {
+		return iban
+	}
+	return strings.TrimSpace(tx.Description)
+}
+
+// recurringCounterpartyKey normalizes the counterparty of a transaction so the
+// references and dates banks add to names and descriptions do not split a
+// series: only their words are kept, lowercased
+func recurringCounterpartyKey(tx *domain.Transaction) string {
+	if strings.TrimSpace(counterparty(tx)) == "" {
+		if iban := counterpartyIBAN(tx); iban != "" {
+			return "iban:" + iban
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(recurringCounterparty(tx)), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// counterpartyIBAN returns the normalized IBAN of the counterparty of a transaction
+func counterpartyIBAN(tx *domain.Transaction) string {
+	if tx.Amount < 0 {
+		return normalizeIBAN(tx.CreditorIBAN)
+	}
+	return normalizeIBAN(tx.DebtorIBAN)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/internal/domain"
+)
+
+func TestDetectRecurringSeries(t *testing.T) {
+	account, otherAccount := uuid.New(), uuid.New()
+	start := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	// charges returns a charge of each amount, the given number of days apart
+	charges := func(creditor string, days int, amounts ...float64) []domain.Transaction {
+		transactions := make([]domain.Transaction, len(amounts))
+		for i, amount := range amounts {
+			transactions[i] = domain.Transaction{
+				ID:            uuid.New(),
+				BankAccountID: account,
+				Amount:        amount,
+				Currency:      "EUR",
+				CreditorName:  creditor,
+				Date:          start.AddDate(0, 0, i*days),
+			}
+		}
+		return transactions
+	}
+	monthly := func(creditor string, amounts ...float64) []domain.Transaction {
+		transactions := make([]domain.Transaction, len(amounts))
+		for i, amount := range amounts {
+			transactions[i] = domain.Transaction{
+				ID:            uuid.New(),
+				BankAccountID: account,
+				Amount:        amount,
+				Currency:      "EUR",
+				CreditorName:  creditor,
+				Date:          start.AddDate(0, i, 0),
+			}
+		}
+		return transactions
+	}
+
+	type wantSeries struct {
+		cadence     string
+		occurrences int
+		amount      float64
+		priceChange bool
+	}
+	tests := []struct {
+		name         string
+		transactions []domain.Transaction
+		want         []wantSeries
+	}{
+		{
+			name:         "monthly subscription",
+			transactions: monthly("Streaming Ltd", -9.99, -9.99, -9.99, -9.99),
+			want:         []wantSeries{{constants.RECURRING_CADENCE_MONTHLY, 4, -9.99, false}},
+		},
+		{
+			name:         "weekly charge",
+			transactions: charges("Vegetable Box", 7, -25, -25, -25, -25),
+			want:         []wantSeries{{constants.RECURRING_CADENCE_WEEKLY, 4, -25, false}},
+		},
+		{
+			name:         "yearly charge needs two occurrences",
+			transactions: charges("Insurance AG", 365, -120, -120),
+			want:         []wantSeries{{constants.RECURRING_CADENCE_YEARLY, 2, -120, false}},
+		},
+		{
+			name:         "price change continues the series",
+			transactions: monthly("Streaming Ltd", -9.99, -9.99, -10.99, -10.99),
+			want:         []wantSeries{{constants.RECURRING_CADENCE_MONTHLY, 4, -10.99, true}},
+		},
+		{
+			name: "plans of the same merchant stay apart",
+			transactions: append(monthly("Cloud Storage", -2.99, -2.99, -2.99),
+				monthly("Cloud Storage", -99, -99, -99)...),
+			want: []wantSeries{
+				{constants.RECURRING_CADENCE_MONTHLY, 3, -2.99, false},
+				{constants.RECURRING_CADENCE_MONTHLY, 3, -99, false},
+			},
+		},
+		{
+			name: "a skipped month still counts",
+			transactions: func() []domain.Transaction {
+				transactions := monthly("Gym", -30, -30, -30, -30)
+				return append(transactions[:2], transactions[3:]...)
+			}(),
+			want: []wantSeries{{constants.RECURRING_CADENCE_MONTHLY, 3, -30, false}},
+		},
+		{
+			name:         "too few occurrences",
+			transactions: monthly("Streaming Ltd", -9.99, -9.99),
+		},
+		{
+			name:         "irregular intervals",
+			transactions: charges("Restaurant", 11, -40, -40, -40, -40),
+		},
+		{
+			name: "transfers between own accounts are left out",
+			transactions: func() []domain.Transaction {
+				transactions := monthly("Savings", -200, -200, -200)
+				for i := range transactions {
+					other := uuid.New()
+					transactions[i].TransferTransactionID = &other
+				}
+				return transactions
+			}(),
+		},
+		{
+			name: "accounts are kept apart",
+			transactions: func() []domain.Transaction {
+				transactions := monthly("Streaming Ltd", -9.99, -9.99, -9.99, -9.99)
+				for i := 1; i < len(transactions); i += 2 {
+					transactions[i].BankAccountID = otherAccount
+				}
+				return transactions
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectRecurringSeries(tt.transactions, 0.2, 3)
+			if len(got) != len(tt.want) {
+				t.Fatalf("detectRecurringSeries() found %d series, want %d", len(got), len(tt.want))
+			}
+			for i, want := range tt.want {
+				series := got[i]
+				if series.Cadence != want.cadence || series.Occurrences != want.occurrences || series.Amount != want.amount {
+					t.Errorf("series %d = %s, %d occurrences of %v; want %s, %d of %v",
+						i, series.Cadence, series.Occurrences, series.Amount, want.cadence, want.occurrences, want.amount)
+				}
+				if (series.PriceChangedAt != nil) != want.priceChange {
+					t.Errorf("series %d price changed at %v, want a change: %v", i, series.PriceChangedAt, want.priceChange)
+				}
+				if len(series.TransactionIDs) != series.Occurrences {
+					t.Errorf("series %d has %d transactions for %d occurrences", i, len(series.TransactionIDs), series.Occurrences)
+				}
+			}
+		})
+	}
+}
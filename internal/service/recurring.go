@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/config"
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+type RecurringService interface {
+	// DetectRecurring finds the recurring series among the transactions of a
+	// user, replacing those found before, and returns how many there are
+	DetectRecurring(ctx context.Context, userID uuid.UUID) (int, error)
+	// GetRecurring lists the recurring series of a user, the next expected first
+	GetRecurring(ctx context.Context, userID uuid.UUID) ([]dto.RecurringSeriesResponse, error)
+	// GetSubscriptions lists the recurring payments of a user that have not
+	// ended, highlighting price increases and missed charges
+	GetSubscriptions(ctx context.Context, userID uuid.UUID) (*dto.SubscriptionsResponse, error)
+}
+
+// recurringDetector finds recurring series after transactions were imported
+type recurringDetector interface {
+	DetectRecurring(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+type recurringService struct {
+	recurringSeriesRepo repository.RecurringSeriesRepository
+	transactionRepo     repository.TransactionRepository
+	cfg                 config.RecurringConfig
+
+	// detectMu serializes detections, so syncs finishing together do not
+	// replace the series of a user at the same time
+	detectMu sync.Mutex
+}
+
+func NewRecurringService(recurringSeriesRepo repository.RecurringSeriesRepository, transactionRepo repository.TransactionRepository, cfg *config.Config) RecurringService {
+	return &recurringService{
+		recurringSeriesRepo: recurringSeriesRepo,
+		transactionRepo:     transactionRepo,
+		cfg:                 cfg.Recurring,
+	}
+}
+
+func (s *recurringService) DetectRecurring(ctx context.Context, userID uuid.UUID) (int, error) {
+	s.detectMu.Lock()
+	defer s.detectMu.Unlock()
+
+	since := time.Now().AddDate(0, -recurringLookback, 0)
+	transactions, err := s.transactionRepo.GetBookedByUserIDSince(ctx, userID, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transactions for user %s: %w", userID, err)
+	}
+	detected := detectRecurringSeries(transactions, s.cfg.AmountTolerance, s.cfg.MinOccurrences)
+
+	// Series detected again keep their ID, so clients can keep referring to them
+	existing, err := s.recurringSeriesRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recurring series for user %s: %w", userID, err)
+	}
+	previous := make(map[string]domain.RecurringSeries, len(existing))
+	for _, series := range existing {
+		previous[recurringSeriesKey(&series)] = series
+	}
+	for _, series := range detected {
+		key := recurringSeriesKey(series)
+		if match, ok := previous[key]; ok {
+			series.ID, series.CreatedAt = match.ID, match.CreatedAt
+			delete(previous, key)
+		}
+	}
+
+	if err := s.recurringSeriesRepo.Replace(ctx, userID, detected); err != nil {
+		return 0, fmt.Errorf("failed to save recurring series for user %s: %w", userID, err)
+	}
+
+	log.Info("Detected recurring series", "userID", userID, "transactions", len(transactions), "series", len(detected))
+	return len(detected), nil
+}
+
+func (s *recurringService) GetRecurring(ctx context.Context, userID uuid.UUID) ([]dto.RecurringSeriesResponse, error) {
+	series, err := s.recurringSeriesRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring series for user %s: %w", userID, err)
+	}
+
+	now := time.Now()
+	response := make([]dto.RecurringSeriesResponse, 0, len(series))
+	for i := range series {
+		response = append(response, recurringSeriesResponse(&series[i], now))
+	}
+	return response, nil
+}
+
+func (s *recurringService) GetSubscriptions(ctx context.Context, userID uuid.UUID) (*dto.SubscriptionsResponse, error) {
+	series, err := s.recurringSeriesRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring series for user %s: %w", userID, err)
+	}
+
+	now := time.Now()
+	response := &dto.SubscriptionsResponse{
+		Subscriptions: []dto.RecurringSeriesResponse{},
+		MonthlyCosts:  make(map[string]float64),
+	}
+	for i := range series {
+		subscription := recurringSeriesResponse(&series[i], now)
+		if subscription.Amount >= 0 || subscription.Status == constants.RECURRING_STATUS_ENDED {
+			continue
+		}
+		response.Subscriptions = append(response.Subscriptions, subscription)
+
+		if subscription.PriceIncreased {
+			response.PriceIncreases++
+		}
+		if subscription.Status == constants.RECURRING_STATUS_MISSED {
+			response.MissedCharges++
+		}
+		if cadence, ok := cadenceByName(subscription.Cadence); ok {
+			response.MonthlyCosts[subscription.Currency] += -subscription.NextExpectedAmount * cadence.perMonth
+		}
+	}
+	for currency, cost := range response.MonthlyCosts {
+		response.MonthlyCosts[currency] = roundCents(cost)
+	}
+	return response, nil
+}
+
+// recurringSeriesKey identifies a series across detections
+func recurringSeriesKey(series *domain.RecurringSeries) string {
+	return fmt.Sprintf("%s|%s|%s|%s", series.BankAccountID, transactionType(series.Amount), series.CounterpartyKey, series.Cadence)
+}
+
+// recurringSeriesResponse converts a recurring series to its client representation, with its status at now
+func recurringSeriesResponse(series *domain.RecurringSeries, now time.Time) dto.RecurringSeriesResponse {
+	return dto.RecurringSeriesResponse{
+		ID:                 series.ID,
+		BankAccountID:      series.BankAccountID,
+		Counterparty:       series.Counterparty,
+		Cadence:            series.Cadence,
+		Category:           series.Category,
+		Currency:           series.Currency,
+		Amount:             series.Amount,
+		PreviousAmount:     series.PreviousAmount,
+		AverageAmount:      series.AverageAmount,
+		Occurrences:        series.Occurrences,
+		FirstDate:          series.FirstDate.Format(time.DateOnly),
+		LastDate:           series.LastDate.Format(time.DateOnly),
+		NextExpectedDate:   series.NextExpectedDate.Format(time.DateOnly),
+		NextExpectedAmount: series.NextExpectedAmount,
+		PriceChangedAt:     series.PriceChangedAt,
+		Status:             recurringSeriesStatus(series, now),
+		PriceIncreased:     math.Abs(series.Amount) > math.Abs(series.PreviousAmount),
+		UpdatedAt:          series.UpdatedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// requestLimiter spaces out requests to a provider so that concurrent syncs do
+// not burst through its rate limits. It is shared by every sync.
+type requestLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRequestLimiter creates a limiter allowing one request per interval. A
+// zero interval does not limit requests.
+func newRequestLimiter(interval time.Duration) *requestLimiter {
+	return &requestLimiter{
+		interval: interval,
+	}
+}
+
+// Wait blocks until the next request may be sent or the context is done
+func (l *requestLimiter) Wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	// Reserve the next free slot, requests are let through in order
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// GetRequisitions lists the bank connections of a user
+func (s *gclService) GetRequisitions(ctx context.Context, userID uuid.UUID) ([]dto.RequisitionResponse, error) {
+	requisitions, err := s.requisitionRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisitions for user %s: %w", userID, err)
+	}
+
+	response := make([]dto.RequisitionResponse, 0, len(requisitions))
+	for _, requisition := range requisitions {
+		response = append(response, dto.RequisitionResponse{
+			ID:                    requisition.ID,
+			Status:                string(requisition.Status),
+			StatusDescription:     requisition.Status.Description(),
+			InstitutionID:         requisition.InstitutionID,
+			Reference:             requisition.Reference,
+			Provider:              requisition.Provider,
+			PreviousRequisitionID: requisition.PreviousRequisitionID,
+			ExpiresAt:             requisition.ExpiresAt,
+			CreatedAt:             requisition.CreatedAt,
+		})
+	}
+
+	return response, nil
+}
+
+// ReconnectRequisition creates a fresh requisition for the institution of an
+// existing one, with the same history and access duration
+func (s *gclService) ReconnectRequisition(ctx context.Context, userID uuid.UUID, requisitionID, redirectURL string) (*dto.LinkAccountResponse, error) {
+	previous, err := s.requisitionRepo.GetByID(ctx, requisitionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisition: %w", err)
+	}
+	if previous.UserID != userID {
+		return nil, fmt.Errorf("requisition %s does not belong to user: %w", requisitionID, repository.ErrForbidden)
+	}
+
+	provider, err := s.providers.Get(previous.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse a reconnect the user started but did not finish
+	pending, err := s.requisitionRepo.GetActiveByUserIDAndInstitutionID(ctx, userID, previous.InstitutionID)
+	if err != nil && !repository.IsNotFoundError(err) {
+		return nil, fmt.Errorf("failed to check existing requisition: %w", err)
+	}
+	if err == nil && pending.PreviousRequisitionID == previous.ID && pending.Status != domain.RequisitionStatusLinked && awaitingCallback(pending) {
+		return linkResponse(pending), nil
+	}
+
+	callbackURL, stateHash, err := newCallbackState(redirectURL)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := provider.CreateLink(ctx, s.linkRequest(userID, previous.InstitutionID, previous.MaxHistoricalDays, previous.AccessValidForDays, callbackURL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create requisition: %w", err)
+	}
+
+	requisition := newRequisition(connection, provider.Name(), userID, redirectURL, stateHash)
+	requisition.PreviousRequisitionID = previous.ID
+	if err := s.requisitionRepo.Create(ctx, requisition); err != nil {
+		return nil, fmt.Errorf("failed to store requisition: %w", err)
+	}
+
+	return linkResponse(requisition), nil
+}
+
+// UnlinkRequisition removes a requisition at its provider, then archives or purges
+// its bank accounts and their transactions. An already unlinked requisition can
+// still be purged to drop its archived accounts.
+func (s *gclService) UnlinkRequisition(ctx context.Context, userID uuid.UUID, requisitionID, mode string) error {
+	requisition, err := s.requisitionRepo.GetByID(ctx, requisitionID)
+	if err != nil {
+		return fmt.Errorf("failed to get requisition: %w", err)
+	}
+	if requisition.UserID != userID {
+		return fmt.Errorf("requisition %s does not belong to user: %w", requisitionID, repository.ErrForbidden)
+	}
+
+	if requisition.UnlinkedAt == nil {
+		provider, err := s.providers.Get(requisition.Provider)
+		if err != nil {
+			return err
+		}
+		if err := provider.Unlink(ctx, requisition); err != nil {
+			return fmt.Errorf("failed to unlink requisition at %s: %w", provider.Name(), err)
+		}
+	}
+
+	if err := s.requisitionRepo.Unlink(ctx, requisitionID, mode == constants.UNLINK_MODE_PURGE); err != nil {
+		return fmt.Errorf("failed to unlink requisition: %w", err)
+	}
+
+	if err := s.notificationRepo.DeactivateByReference(ctx, userID, requisitionID); err != nil {
+		log.Warn("Failed to dismiss notifications of unlinked requisition", "requisition_id", requisitionID, "error", err)
+	}
+
+	return nil
+}
+
+// CheckRequisitionExpiry goes through the linked requisitions, marks those whose
+// consent ended as expired and notifies their users, and warns users whose
+// consent ends within the configured warning period
+func (s *gclService) CheckRequisitionExpiry(ctx context.Context) error {
+	requisitions, err := s.requisitionRepo.GetByStatus(ctx, domain.RequisitionStatusLinked)
+	if err != nil {
+		return fmt.Errorf("failed to get linked requisitions: %w", err)
+	}
+
+	now := time.Now()
+	warnBefore := now.Add(time.Duration(s.cfg.GoCardless.ExpiryWarningDays) * 24 * time.Hour)
+
+	for i := range requisitions {
+		requisition := &requisitions[i]
+
+		// The user may revoke consent at the bank before it runs out
+		status := requisition.Status
+		provider, err := s.providers.Get(requisition.Provider)
+		if err != nil {
+			return err
+		}
+		remote, err := provider.GetConnection(ctx, requisition, "")
+		if err != nil {
+			log.Warn("Failed to refresh requisition status", "requisition_id", requisition.ID, "error", err)
+		} else {
+			status = remote.Status
+		}
+
+		if status == domain.RequisitionStatusExpired || (requisition.ExpiresAt != nil && now.After(*requisition.ExpiresAt)) {
+			// Users are notified by the hook of the expired status
+			if err := s.applyRequisitionStatus(ctx, requisition, domain.RequisitionStatusExpired); err != nil {
+				return fmt.Errorf("failed to mark requisition %s as expired: %w", requisition.ID, err)
+			}
+			continue
+		}
+
+		if requisition.ExpiresAt != nil && requisition.ExpiresAt.Before(warnBefore) {
+			message := fmt.Sprintf("Your connection to %s expires on %s. Reconnect it to keep your accounts up to date.",
+				s.institutionName(ctx, requisition), requisition.ExpiresAt.Format("2006-01-02"))
+			if err := s.notifyOnce(ctx, requisition, constants.NOTIFICATION_REQUISITION_EXPIRING, message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// notifyOnce creates a notification about a requisition unless one of the same type already exists
+func (s *gclService) notifyOnce(ctx context.Context, requisition *domain.Requisition, notificationType, message string) error {
+	exists, err := s.notificationRepo.ExistsByReference(ctx, requisition.UserID, notificationType, requisition.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check existing notification: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	err = s.notificationRepo.Create(ctx, &domain.Notification{
+		ID:        uuid.New(),
+		UserID:    requisition.UserID,
+		Type:      notificationType,
+		Message:   message,
+		IsActive:  true,
+		Reference: requisition.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+// institutionName returns a readable name for the institution of a requisition
+func (s *gclService) institutionName(ctx context.Context, requisition *domain.Requisition) string {
+	accounts, err := s.bankAccountRepo.GetByRequisitionID(ctx, requisition.ID)
+	if err == nil {
+		for _, account := range accounts {
+			if account.InstitutionName != "" {
+				return account.InstitutionName
+			}
+		}
+	}
+	return requisition.InstitutionID
+}
+
+// findReconnectedAccount finds the account of a previous requisition that the
+// given account details describe, matching on IBAN or, for accounts without
+// one, on name and currency
+func (s *gclService) findReconnectedAccount(ctx context.Context, previousRequisitionID string, details *dto.AccountDetails) (*domain.BankAccount, error) {
+	accounts, err := s.bankAccountRepo.GetByRequisitionID(ctx, previousRequisitionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get accounts of previous requisition: %w", err)
+	}
+
+	for i := range accounts {
+		account := &accounts[i]
+		if details.Account.IBAN != "" {
+			if account.IBAN == details.Account.IBAN {
+				return account, nil
+			}
+			continue
+		}
+		if account.IBAN == "" && account.Name == details.Account.Name && account.Currency == details.Account.Currency {
+			return account, nil
+		}
+	}
+
+	return nil, nil
+}
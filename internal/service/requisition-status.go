@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// pendingRequisitionMaxAge is how long requisitions the user has not finished
+// giving consent for are polled; abandoned ones are left alone after that
+const pendingRequisitionMaxAge = 7 * 24 * time.Hour
+
+// RequisitionHook runs after a requisition entered a status. from is the status it left.
+type RequisitionHook func(ctx context.Context, requisition *domain.Requisition, from domain.RequisitionStatus) error
+
+// syncingRequisitionKey marks the context of a requisition sync, so the hook
+// of the linked status does not start another sync of the same requisition
+type syncingRequisitionKey struct{}
+
+// withRequisitionSync marks ctx as belonging to the sync of a requisition
+func withRequisitionSync(ctx context.Context, requisitionID string) context.Context {
+	return context.WithValue(ctx, syncingRequisitionKey{}, requisitionID)
+}
+
+// syncingRequisition reports whether ctx belongs to the sync of the requisition
+func syncingRequisition(ctx context.Context, requisitionID string) bool {
+	id, ok := ctx.Value(syncingRequisitionKey{}).(string)
+	return ok && id == requisitionID
+}
+
+// syncedAccountsKey carries the accounts an automatic sync of a requisition
+// skips, because the job that ran just before already synced them
+type syncedAccountsKey struct{}
+
+// withSyncedAccounts marks the accounts in accountIDs as already synced
+func withSyncedAccounts(ctx context.Context, accountIDs map[string]bool) context.Context {
+	return context.WithValue(ctx, syncedAccountsKey{}, accountIDs)
+}
+
+// syncedAccount reports whether ctx marks the account as already synced
+func syncedAccount(ctx context.Context, accountID string) bool {
+	accountIDs, _ := ctx.Value(syncedAccountsKey{}).(map[string]bool)
+	return accountIDs[accountID]
+}
+
+// OnRequisitionStatus registers a hook run whenever a requisition enters status.
+// Hooks are registered at startup, before requisitions are synced.
+func (s *gclService) OnRequisitionStatus(status domain.RequisitionStatus, hook RequisitionHook) {
+	s.statusHooks[status] = append(s.statusHooks[status], hook)
+}
+
+// registerStatusHooks registers the behaviour of the service on status changes
+func (s *gclService) registerStatusHooks() {
+	s.OnRequisitionStatus(domain.RequisitionStatusLinked, s.dismissReplacedRequisition)
+	s.OnRequisitionStatus(domain.RequisitionStatusExpired, s.notifyStatus(constants.NOTIFICATION_REQUISITION_EXPIRED,
+		"Your connection to %s has expired. Reconnect it to keep your accounts up to date."))
+	s.OnRequisitionStatus(domain.RequisitionStatusRejected, s.notifyStatus(constants.NOTIFICATION_REQUISITION_REJECTED,
+		"Your bank rejected the connection to %s. Check your login details and try again."))
+	s.OnRequisitionStatus(domain.RequisitionStatusInstitutionError, s.notifyStatus(constants.NOTIFICATION_REQUISITION_FAILED,
+		"Connecting to %s failed because of an error at your bank. Try again later."))
+}
+
+// applyRequisitionStatus saves a requisition with the status its provider
+// reported. A change the state machine allows is recorded and runs the hooks of
+// the new status; a change it does not allow is logged and the stored status kept.
+// The other fields of the requisition are saved either way.
+func (s *gclService) applyRequisitionStatus(ctx context.Context, requisition *domain.Requisition, status domain.RequisitionStatus) error {
+	from := requisition.Status
+	if status == from || !from.CanTransitionTo(status) {
+		if status != from {
+			log.Warn("Ignoring invalid requisition status transition", "requisition_id", requisition.ID, "from", from, "to", status)
+		}
+		if err := s.requisitionRepo.Update(ctx, requisition); err != nil {
+			return fmt.Errorf("failed to update requisition in database: %w", err)
+		}
+		return nil
+	}
+
+	requisition.Status = status
+	err := s.requisitionRepo.Transition(ctx, requisition, &domain.RequisitionTransition{
+		ID:            uuid.New(),
+		RequisitionID: requisition.ID,
+		FromStatus:    from,
+		ToStatus:      status,
+	})
+	if err != nil {
+		requisition.Status = from
+		return fmt.Errorf("failed to update requisition status: %w", err)
+	}
+
+	// The status change is stored, a failing hook must not undo it
+	for _, hook := range s.statusHooks[status] {
+		if err := hook(ctx, requisition, from); err != nil {
+			log.Error("Requisition status hook failed", "error", err, "requisition_id", requisition.ID, "status", status)
+		}
+	}
+	return nil
+}
+
+// notifyStatus returns a hook notifying the user once about the new status of a
+// requisition. message is formatted with the name of the institution.
+func (s *gclService) notifyStatus(notificationType, message string) RequisitionHook {
+	return func(ctx context.Context, requisition *domain.Requisition, _ domain.RequisitionStatus) error {
+		return s.notifyOnce(ctx, requisition, notificationType, fmt.Sprintf(message, s.institutionName(ctx, requisition)))
+	}
+}
+
+// dismissReplacedRequisition dismisses the notifications of the connection a
+// linked requisition replaces, they no longer need attention
+func (s *gclService) dismissReplacedRequisition(ctx context.Context, requisition *domain.Requisition, _ domain.RequisitionStatus) error {
+	if requisition.PreviousRequisitionID == "" {
+		return nil
+	}
+	if err := s.notificationRepo.DeactivateByReference(ctx, requisition.UserID, requisition.PreviousRequisitionID); err != nil {
+		return fmt.Errorf("failed to dismiss notifications of previous requisition: %w", err)
+	}
+	return nil
+}
+
+// RefreshPendingRequisitions asks the providers for the status of requisitions
+// the user has not finished giving consent for. Users who closed the bank's page
+// before being redirected back still get their accounts once consent is given.
+func (s *gclService) RefreshPendingRequisitions(ctx context.Context) error {
+	requisitions, err := s.requisitionRepo.GetByStatus(ctx, domain.PendingRequisitionStatuses()...)
+	if err != nil {
+		return fmt.Errorf("failed to get pending requisitions: %w", err)
+	}
+
+	now := time.Now()
+	for i := range requisitions {
+		requisition := &requisitions[i]
+		if now.Sub(requisition.CreatedAt) > pendingRequisitionMaxAge {
+			continue
+		}
+		if requisition.LinkExpiresAt != nil && now.After(*requisition.LinkExpiresAt) {
+			continue
+		}
+
+		provider, err := s.providers.Get(requisition.Provider)
+		if err != nil {
+			return err
+		}
+		connection, err := provider.GetConnection(ctx, requisition, "")
+		if err != nil {
+			log.Warn("Failed to refresh requisition status", "requisition_id", requisition.ID, "error", err)
+			continue
+		}
+		if err := s.applyRequisitionStatus(ctx, requisition, connection.Status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRequisitionHistory lists the status changes of a requisition of a user
+func (s *gclService) GetRequisitionHistory(ctx context.Context, userID uuid.UUID, requisitionID string) ([]dto.RequisitionTransitionResponse, error) {
+	requisition, err := s.requisitionRepo.GetByID(ctx, requisitionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisition: %w", err)
+	}
+	if requisition.UserID != userID {
+		return nil, fmt.Errorf("requisition %s does not belong to user: %w", requisitionID, repository.ErrForbidden)
+	}
+
+	transitions, err := s.requisitionRepo.GetTransitions(ctx, requisitionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisition history: %w", err)
+	}
+
+	response := make([]dto.RequisitionTransitionResponse, 0, len(transitions))
+	for _, transition := range transitions {
+		response = append(response, dto.RequisitionTransitionResponse{
+			FromStatus:  string(transition.FromStatus),
+			ToStatus:    string(transition.ToStatus),
+			Description: transition.ToStatus.Description(),
+			CreatedAt:   transition.CreatedAt,
+		})
+	}
+	return response, nil
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/aggregator"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// syncJobTimeout bounds how long a background sync may run
+const syncJobTimeout = 10 * time.Minute
+
+// recentSyncWindow is how long the accounts a job synced are skipped by the
+// automatic syncs that follow it, e.g. when the bank redirects the user back
+// after the linked requisition was already picked up by polling
+const recentSyncWindow = 15 * time.Minute
+
+// A running job renews its heartbeat every syncJobHeartbeatInterval. Jobs whose
+// heartbeat is older than syncJobStaleAfter were interrupted, e.g. because the
+// instance running them stopped.
+const (
+	syncJobHeartbeatInterval = 30 * time.Second
+	syncJobStaleAfter        = 4 * syncJobHeartbeatInterval
+)
+
+type SyncService interface {
+	// StartRequisitionSync checks that the requisition with the given reference
+	// belongs to the user and syncs it in the background. The returned job is
+	// polled for the outcome. When the requisition is already being synced, the
+	// running job is returned instead of starting another one. publicToken is
+	// what Plaid Link returned to the frontend, empty for other providers.
+	StartRequisitionSync(ctx context.Context, userID uuid.UUID, reference, publicToken string) (*domain.SyncJob, error)
+	// StartCallbackSync syncs the requisition a bank redirected the user back for.
+	// The redirect is authenticated by the single-use state it carries instead of
+	// the session of the user.
+	StartCallbackSync(ctx context.Context, reference, state string) (*domain.SyncJob, error)
+	// RefreshLinkedRequisitions syncs every linked requisition whose last sync
+	// started at least minAge ago
+	RefreshLinkedRequisitions(ctx context.Context, minAge time.Duration) error
+	// GetJob retrieves a sync job of a user with the results of its accounts
+	GetJob(ctx context.Context, userID, jobID uuid.UUID) (*domain.SyncJob, error)
+	// FailStaleJobs marks the jobs whose instance stopped renewing their
+	// heartbeat as failed. Jobs of other running instances are left alone.
+	FailStaleJobs(ctx context.Context) error
+}
+
+type syncService struct {
+	gclService      GclService
+	requisitionRepo repository.RequisitionRepository
+	syncJobRepo     repository.SyncJobRepository
+
+	// instanceID identifies this server instance as the owner of the jobs it runs
+	instanceID string
+}
+
+// NewSyncService creates a sync service. Requisitions that become linked
+// outside of a sync are synced in the background.
+func NewSyncService(gclService GclService, requisitionRepo repository.RequisitionRepository, syncJobRepo repository.SyncJobRepository) SyncService {
+	s := &syncService{
+		gclService:      gclService,
+		requisitionRepo: requisitionRepo,
+		syncJobRepo:     syncJobRepo,
+		instanceID:      newInstanceID(),
+	}
+	gclService.OnRequisitionStatus(domain.RequisitionStatusLinked, s.syncLinkedRequisition)
+	return s
+}
+
+func (s *syncService) StartRequisitionSync(ctx context.Context, userID uuid.UUID, reference, publicToken string) (*domain.SyncJob, error) {
+	requisition, err := s.requisitionRepo.GetByReference(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get requisition by reference: %w", err)
+	}
+	if requisition.UserID != userID {
+		return nil, fmt.Errorf("requisition %s does not belong to user: %w", requisition.ID, repository.ErrForbidden)
+	}
+	return s.startSync(ctx, requisition, publicToken, nil)
+}
+
+func (s *syncService) StartCallbackSync(ctx context.Context, reference, state string) (*domain.SyncJob, error) {
+	requisition, err := s.requisitionRepo.ConsumeCallbackState(ctx, reference, callbackStateHash(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify callback state: %w", err)
+	}
+	return s.startSync(ctx, requisition, "", s.recentlySyncedAccounts(ctx, requisition.ID))
+}
+
+// syncLinkedRequisition starts a sync of a requisition that became linked,
+// unless it became linked while it was being synced
+func (s *syncService) syncLinkedRequisition(ctx context.Context, requisition *domain.Requisition, _ domain.RequisitionStatus) error {
+	if syncingRequisition(ctx, requisition.ID) {
+		return nil
+	}
+	job, err := s.startSync(ctx, requisition, "", s.recentlySyncedAccounts(ctx, requisition.ID))
+	if err != nil {
+		return err
+	}
+	log.Info("Started sync of linked requisition", "requisitionID", requisition.ID, "jobID", job.ID)
+	return nil
+}
+
+func (s *syncService) RefreshLinkedRequisitions(ctx context.Context, minAge time.Duration) error {
+	requisitions, err := s.requisitionRepo.GetByStatus(ctx, domain.RequisitionStatusLinked)
+	if err != nil {
+		return fmt.Errorf("failed to get linked requisitions: %w", err)
+	}
+
+	var started int
+	for i := range requisitions {
+		requisition := &requisitions[i]
+		// Requisitions synced since the last refresh, e.g. by the user or by
+		// another instance, are left until the next one
+		latest, err := s.syncJobRepo.GetLatestByRequisitionID(ctx, requisition.ID)
+		if err != nil && !repository.IsNotFoundError(err) {
+			log.Error("Failed to get latest sync job", "error", err, "requisitionID", requisition.ID)
+			continue
+		}
+		if latest != nil && time.Since(latest.CreatedAt) < minAge {
+			continue
+		}
+
+		if _, err := s.startSync(ctx, requisition, "", nil); err != nil {
+			log.Error("Failed to start sync of linked requisition", "error", err, "requisitionID", requisition.ID)
+			continue
+		}
+		started++
+	}
+	if started > 0 {
+		log.Info("Started scheduled syncs of linked requisitions", "count", started)
+	}
+	return nil
+}
+
+// startSync syncs a requisition in the background, or returns the job already
+// syncing it. The accounts in synced are skipped. Another request or instance
+// may start a job of the requisition at the same time; only one job is created.
+func (s *syncService) startSync(ctx context.Context, requisition *domain.Requisition, publicToken string, synced map[string]bool) (*domain.SyncJob, error) {
+	active, err := s.syncJobRepo.GetActiveByRequisitionID(ctx, requisition.ID)
+	if err == nil {
+		return active, nil
+	}
+	if !repository.IsNotFoundError(err) {
+		return nil, fmt.Errorf("failed to check running sync jobs: %w", err)
+	}
+
+	now := time.Now()
+	job := &domain.SyncJob{
+		ID:            uuid.New(),
+		Status:        constants.SYNC_JOB_STATUS_QUEUED,
+		RequisitionID: requisition.ID,
+		UserID:        requisition.UserID,
+		Owner:         s.instanceID,
+		HeartbeatAt:   &now,
+	}
+	if err := s.syncJobRepo.Create(ctx, job); err != nil {
+		if errors.Is(err, repository.ErrSyncJobAlreadyActive) {
+			if active, err := s.syncJobRepo.GetActiveByRequisitionID(ctx, requisition.ID); err == nil {
+				return active, nil
+			}
+		}
+		return nil, fmt.Errorf("failed to create sync job: %w", err)
+	}
+
+	// The request that started the job ends before the sync does
+	go s.run(*job, requisition.Reference, publicToken, synced)
+
+	return job, nil
+}
+
+// recentlySyncedAccounts returns the accounts the latest sync of a requisition
+// synced, if it finished within recentSyncWindow. Automatic syncs skip them, as
+// the bank has nothing new for them yet and every request counts against its
+// rate limits; syncs the user asks for fetch every account.
+func (s *syncService) recentlySyncedAccounts(ctx context.Context, requisitionID string) map[string]bool {
+	latest, err := s.syncJobRepo.GetLatestByRequisitionID(ctx, requisitionID)
+	if err != nil {
+		if !repository.IsNotFoundError(err) {
+			log.Error("Failed to get latest sync job", "error", err, "requisitionID", requisitionID)
+		}
+		return nil
+	}
+	if latest.FinishedAt == nil || time.Since(*latest.FinishedAt) > recentSyncWindow {
+		return nil
+	}
+
+	synced := make(map[string]bool)
+	for _, account := range latest.Accounts {
+		if account.Status == constants.SYNC_ACCOUNT_STATUS_SUCCEEDED {
+			synced[account.AccountID] = true
+		}
+	}
+	return synced
+}
+
+func (s *syncService) GetJob(ctx context.Context, userID, jobID uuid.UUID) (*domain.SyncJob, error) {
+	job, err := s.syncJobRepo.GetByID(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, fmt.Errorf("sync job %s does not belong to user: %w", jobID, repository.ErrForbidden)
+	}
+	return job, nil
+}
+
+func (s *syncService) FailStaleJobs(ctx context.Context) error {
+	count, err := s.syncJobRepo.FailStale(ctx, time.Now().Add(-syncJobStaleAfter), "interrupted, the server running it stopped")
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Warn("Marked interrupted sync jobs as failed", "count", count)
+	}
+	return nil
+}
+
+// run syncs the requisition of a job, skipping the accounts in synced, and
+// records the outcome
+func (s *syncService) run(job domain.SyncJob, reference, publicToken string, synced map[string]bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), syncJobTimeout)
+	defer cancel()
+	if len(synced) > 0 {
+		ctx = withSyncedAccounts(ctx, synced)
+	}
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	defer stopHeartbeat()
+	go s.heartbeat(heartbeatCtx, job.ID)
+
+	startedAt := time.Now()
+	job.Status = constants.SYNC_JOB_STATUS_RUNNING
+	job.StartedAt = &startedAt
+	if err := s.syncJobRepo.Update(ctx, &job); err != nil {
+		log.Error("Failed to update sync job", "error", err, "jobID", job.ID)
+	}
+
+	progress := &jobProgress{ctx: ctx, syncJobRepo: s.syncJobRepo, job: &job}
+	response, syncErr := s.gclService.SyncRequisition(ctx, reference, job.UserID, publicToken, progress)
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	if syncErr != nil {
+		log.Error("Sync job failed", "error", syncErr, "jobID", job.ID, "requisitionID", job.RequisitionID)
+		job.Status = constants.SYNC_JOB_STATUS_FAILED
+		job.Error = syncErrorMessage(syncErr)
+	} else {
+		job.Status, job.Error = syncJobOutcome(response.Accounts)
+	}
+
+	// The sync context may have timed out, saving the outcome must not
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer saveCancel()
+	if err := s.syncJobRepo.Update(saveCtx, &job); err != nil {
+		log.Error("Failed to update sync job", "error", err, "jobID", job.ID)
+	}
+}
+
+// heartbeat renews the heartbeat of a job until ctx is done, so other instances
+// see it is still running
+func (s *syncService) heartbeat(ctx context.Context, jobID uuid.UUID) {
+	ticker := time.NewTicker(syncJobHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.syncJobRepo.Heartbeat(ctx, jobID, s.instanceID); err != nil {
+				log.Error("Failed to renew sync job heartbeat", "error", err, "jobID", jobID)
+			}
+		}
+	}
+}
+
+// newInstanceID returns an ID for this server instance, readable in the sync
+// jobs it owns
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+	return hostname + "-" + uuid.NewString()[:8]
+}
+
+// syncJobOutcome derives the status of a finished job from the results of its accounts
+func syncJobOutcome(results []dto.AccountSyncResult) (string, string) {
+	var failed int
+	for _, result := range results {
+		if result.Status == constants.SYNC_ACCOUNT_STATUS_FAILED || result.Status == constants.SYNC_ACCOUNT_STATUS_DEFERRED {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		return constants.SYNC_JOB_STATUS_SUCCEEDED, ""
+	case failed == len(results):
+		return constants.SYNC_JOB_STATUS_FAILED, "no account could be synced"
+	default:
+		return constants.SYNC_JOB_STATUS_PARTIAL, fmt.Sprintf("%d of %d accounts could not be synced", failed, len(results))
+	}
+}
+
+// jobProgress records the progress of a sync job while its accounts are synced.
+// Accounts are synced in parallel, so updates of the job are serialized.
+type jobProgress struct {
+	ctx         context.Context
+	syncJobRepo repository.SyncJobRepository
+
+	mu  sync.Mutex
+	job *domain.SyncJob
+}
+
+func (p *jobProgress) AccountsFound(accountIDs []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.TotalAccounts = len(accountIDs)
+	if err := p.syncJobRepo.Update(p.ctx, p.job); err != nil {
+		log.Error("Failed to update sync job", "error", err, "jobID", p.job.ID)
+	}
+}
+
+func (p *jobProgress) AccountUpdated(result dto.AccountSyncResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	account := &domain.SyncJobAccount{
+		ID:            uuid.New(),
+		SyncJobID:     p.job.ID,
+		AccountID:     result.AccountID,
+		BankAccountID: result.BankAccountID,
+		Status:        result.Status,
+		Error:         result.Error,
+		RetryAt:       result.RetryAt,
+	}
+	if err := p.syncJobRepo.SaveAccount(p.ctx, account); err != nil {
+		log.Error("Failed to save sync job account", "error", err, "jobID", p.job.ID, "accountID", result.AccountID)
+	}
+
+	if result.Status == constants.SYNC_ACCOUNT_STATUS_RUNNING {
+		return
+	}
+	p.job.CompletedAccounts++
+	if err := p.syncJobRepo.Update(p.ctx, p.job); err != nil {
+		log.Error("Failed to update sync job", "error", err, "jobID", p.job.ID)
+	}
+}
+
+// syncErrorMessage describes why a sync failed without exposing internal errors
+func syncErrorMessage(err error) string {
+	var rateLimitErr *aggregator.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return fmt.Sprintf("the bank's rate limit was reached, retry after %s", rateLimitErr.ResetAt.Format(time.RFC3339))
+	}
+	switch {
+	case errors.Is(err, aggregator.ErrConsentExpired):
+		return "access to the bank has expired, the bank has to be reconnected"
+	case errors.Is(err, aggregator.ErrAccountSuspended):
+		return "the bank has suspended access to the account"
+	case errors.Is(err, aggregator.ErrInstitutionDown):
+		return "the bank could not be reached, retry later"
+	case errors.Is(err, aggregator.ErrNotFound):
+		return "the bank data provider no longer knows the connection"
+	case errors.Is(err, aggregator.ErrProviderAuth):
+		return "the bank data provider rejected the request"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "the sync took too long"
+	}
+	return "the bank connection could not be synced"
+}
@@ -0,0 +1,454 @@
+package service
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/config"
+	"FinMa/constants"
+	"FinMa/internal/aggregator"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+	"FinMa/pkg/gocardless"
+	"FinMa/pkg/gocardless/fake"
+)
+
+// The in-memory repositories below implement what a sync uses. The embedded
+// interfaces are nil, so a sync calling anything else fails the test loudly.
+
+type memRequisitionRepo struct {
+	repository.RequisitionRepository
+
+	mu           sync.Mutex
+	requisitions map[string]domain.Requisition
+}
+
+func (r *memRequisitionRepo) GetByReference(_ context.Context, reference string) (*domain.Requisition, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, requisition := range r.requisitions {
+		if requisition.Reference == reference {
+			return &requisition, nil
+		}
+	}
+	return nil, repository.ErrRequisitionNotFound
+}
+
+func (r *memRequisitionRepo) Update(_ context.Context, requisition *domain.Requisition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requisitions[requisition.ID] = *requisition
+	return nil
+}
+
+func (r *memRequisitionRepo) Transition(ctx context.Context, requisition *domain.Requisition, _ *domain.RequisitionTransition) error {
+	return r.Update(ctx, requisition)
+}
+
+type memBankAccountRepo struct {
+	repository.BankAccountRepository
+
+	mu       sync.Mutex
+	accounts map[uuid.UUID]domain.BankAccount
+	locks    map[string]*sync.Mutex
+}
+
+func (r *memBankAccountRepo) WithSyncLock(_ context.Context, accountID string, run func() error) error {
+	r.mu.Lock()
+	lock, ok := r.locks[accountID]
+	if !ok {
+		lock = new(sync.Mutex)
+		r.locks[accountID] = lock
+	}
+	r.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	return run()
+}
+
+func (r *memBankAccountRepo) GetByAccountID(_ context.Context, accountID string) (*domain.BankAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, account := range r.accounts {
+		if account.AccountID != nil && *account.AccountID == accountID {
+			return &account, nil
+		}
+	}
+	return nil, repository.ErrBankAccountNotFound
+}
+
+func (r *memBankAccountRepo) Create(_ context.Context, account *domain.BankAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[account.ID] = *account
+	return nil
+}
+
+func (r *memBankAccountRepo) Update(ctx context.Context, account *domain.BankAccount) error {
+	return r.Create(ctx, account)
+}
+
+type memTransactionRepo struct {
+	repository.TransactionRepository
+
+	mu           sync.Mutex
+	transactions map[uuid.UUID]domain.Transaction
+}
+
+func (r *memTransactionRepo) byAccount(bankAccountID uuid.UUID, keep func(*domain.Transaction) bool) []domain.Transaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var transactions []domain.Transaction
+	for _, tx := range r.transactions {
+		if tx.BankAccountID == bankAccountID && keep(&tx) {
+			transactions = append(transactions, tx)
+		}
+	}
+	return transactions
+}
+
+func (r *memTransactionRepo) GetProviderTransactionIDs(_ context.Context, bankAccountID uuid.UUID) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	for _, tx := range r.byAccount(bankAccountID, func(tx *domain.Transaction) bool { return tx.ProviderTransactionID != "" }) {
+		ids[tx.ProviderTransactionID] = true
+	}
+	return ids, nil
+}
+
+func (r *memTransactionRepo) GetPendingByBankAccountID(_ context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error) {
+	return r.byAccount(bankAccountID, func(tx *domain.Transaction) bool {
+		return tx.Status == constants.TRANSACTION_STATUS_PENDING
+	}), nil
+}
+
+func (r *memTransactionRepo) GetWithoutProviderIDByBankAccountID(_ context.Context, bankAccountID uuid.UUID) ([]domain.Transaction, error) {
+	return r.byAccount(bankAccountID, func(tx *domain.Transaction) bool { return tx.ProviderTransactionID == "" }), nil
+}
+
+func (r *memTransactionRepo) UpsertInBatches(_ context.Context, transactions []*domain.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tx := range transactions {
+		r.transactions[tx.ID] = *tx
+	}
+	return nil
+}
+
+func (r *memTransactionRepo) Update(_ context.Context, tx *domain.Transaction) error {
+	return r.UpsertInBatches(context.Background(), []*domain.Transaction{tx})
+}
+
+func (r *memTransactionRepo) DeleteByIDs(_ context.Context, ids []uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		delete(r.transactions, id)
+	}
+	return nil
+}
+
+func (r *memTransactionRepo) ReplaceSplits(context.Context, uuid.UUID, []domain.TransactionSplit) error {
+	return nil
+}
+
+type memBalanceSnapshotRepo struct {
+	repository.BalanceSnapshotRepository
+}
+
+func (memBalanceSnapshotRepo) Upsert(context.Context, []*domain.BalanceSnapshot) error {
+	return nil
+}
+
+// noopSyncHelpers stands in for the categorizer and the detectors run after a sync
+type noopSyncHelpers struct{}
+
+func (noopSyncHelpers) Categorize(context.Context, uuid.UUID, []*domain.Transaction) error {
+	return nil
+}
+
+func (noopSyncHelpers) DetectTransfers(context.Context, uuid.UUID) (int, error) { return 0, nil }
+
+func (noopSyncHelpers) DetectRecurring(context.Context, uuid.UUID) (int, error) { return 0, nil }
+
+// syncFixture is a bank connection service syncing from a fake GoCardless API
+type syncFixture struct {
+	service      *gclService
+	client       *gocardless.Client
+	server       *fake.Server
+	requisitions *memRequisitionRepo
+	accounts     *memBankAccountRepo
+	transactions *memTransactionRepo
+	userID       uuid.UUID
+	reference    string
+	accountIDs   []string
+}
+
+// newSyncFixture creates a service and a requisition the user gave consent for at the fake bank
+func newSyncFixture(t *testing.T, opts fake.Options) *syncFixture {
+	t.Helper()
+	server := fake.NewServer(opts)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client := gocardless.NewClient("secret-id", "secret-key")
+	client.BaseURL = srv.URL
+	client.MaxRetries = 0
+
+	f := &syncFixture{
+		client:       client,
+		server:       server,
+		requisitions: &memRequisitionRepo{requisitions: make(map[string]domain.Requisition)},
+		accounts:     &memBankAccountRepo{accounts: make(map[uuid.UUID]domain.BankAccount), locks: make(map[string]*sync.Mutex)},
+		transactions: &memTransactionRepo{transactions: make(map[uuid.UUID]domain.Transaction)},
+		userID:       uuid.New(),
+	}
+	f.service = f.newInstance()
+
+	ctx := context.Background()
+	created, err := client.CreateRequisition(ctx, f.userID, "SANDBOXFINANCE_SFIN0000", "http://localhost/callback", "")
+	if err != nil {
+		t.Fatalf("CreateRequisition() error = %v", err)
+	}
+	if err := server.Link(created.ID); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	f.reference = created.Reference
+	f.requisitions.requisitions[created.ID] = domain.Requisition{
+		ID:        created.ID,
+		Reference: created.Reference,
+		Provider:  aggregator.ProviderGoCardless,
+		Status:    domain.RequisitionStatusCreated,
+		UserID:    f.userID,
+	}
+	return f
+}
+
+// newInstance creates a service sharing the repositories of the fixture, as
+// another instance of the server would
+func (f *syncFixture) newInstance() *gclService {
+	cfg := &config.Config{GoCardless: config.GoCardlessConfig{SyncWorkers: 2}}
+	return NewGclService(f.accounts, nil, f.requisitions, f.transactions, nil, memBalanceSnapshotRepo{},
+		aggregator.NewRegistry(aggregator.NewGoCardless(f.client, nil)), f.client,
+		noopSyncHelpers{}, noopSyncHelpers{}, noopSyncHelpers{}, cfg).(*gclService)
+}
+
+// sync syncs the requisition and returns the status of each account
+func (f *syncFixture) sync(t *testing.T, ctx context.Context) map[string]string {
+	t.Helper()
+	response, err := f.service.SyncRequisition(ctx, f.reference, f.userID, "", nil)
+	if err != nil {
+		t.Fatalf("SyncRequisition() error = %v", err)
+	}
+	if response.Status != string(domain.RequisitionStatusLinked) {
+		t.Errorf("requisition status = %s, want %s", response.Status, domain.RequisitionStatusLinked)
+	}
+	statuses := make(map[string]string, len(response.Accounts))
+	f.accountIDs = f.accountIDs[:0]
+	for _, result := range response.Accounts {
+		statuses[result.AccountID] = result.Status
+		f.accountIDs = append(f.accountIDs, result.AccountID)
+	}
+	return statuses
+}
+
+func TestSyncRequisition(t *testing.T) {
+	f := newSyncFixture(t, fake.Options{})
+	ctx := context.Background()
+
+	statuses := f.sync(t, ctx)
+	if len(statuses) == 0 {
+		t.Fatal("SyncRequisition() synced no accounts")
+	}
+	for accountID, status := range statuses {
+		if status != constants.SYNC_ACCOUNT_STATUS_SUCCEEDED {
+			t.Errorf("account %s status = %s, want %s", accountID, status, constants.SYNC_ACCOUNT_STATUS_SUCCEEDED)
+		}
+	}
+	if len(f.accounts.accounts) != len(statuses) {
+		t.Errorf("stored %d accounts, want %d", len(f.accounts.accounts), len(statuses))
+	}
+	imported := len(f.transactions.transactions)
+	if imported == 0 {
+		t.Fatal("SyncRequisition() imported no transactions")
+	}
+	for _, tx := range f.transactions.transactions {
+		if tx.Type != transactionType(tx.Amount) {
+			t.Errorf("transaction %s of %.2f has type %q, want %q", tx.ProviderTransactionID, tx.Amount, tx.Type, transactionType(tx.Amount))
+		}
+	}
+	requisition, _ := f.requisitions.GetByReference(ctx, f.reference)
+	if requisition.Status != domain.RequisitionStatusLinked || requisition.ExpiresAt == nil {
+		t.Errorf("stored requisition = %+v, want it linked with its consent expiry", requisition)
+	}
+	for _, account := range f.accounts.accounts {
+		if account.RequisitionID == nil || *account.RequisitionID != requisition.ID || account.UserID != f.userID {
+			t.Errorf("account %s belongs to requisition %v, want %s of the user", account.ID, account.RequisitionID, requisition.ID)
+		}
+	}
+
+	// Syncing the linked requisition again fetches every account, and imports
+	// nothing twice
+	for accountID, status := range f.sync(t, ctx) {
+		if status != constants.SYNC_ACCOUNT_STATUS_SUCCEEDED {
+			t.Errorf("account %s status on the second sync = %s, want %s", accountID, status, constants.SYNC_ACCOUNT_STATUS_SUCCEEDED)
+		}
+	}
+	if len(f.transactions.transactions) != imported {
+		t.Errorf("second sync left %d transactions, want %d", len(f.transactions.transactions), imported)
+	}
+
+	// Accounts the job just before synced are skipped
+	skipped := f.accountIDs[0]
+	statuses = f.sync(t, withSyncedAccounts(ctx, map[string]bool{skipped: true}))
+	for accountID, status := range statuses {
+		want := constants.SYNC_ACCOUNT_STATUS_SUCCEEDED
+		if accountID == skipped {
+			want = constants.SYNC_ACCOUNT_STATUS_SKIPPED
+		}
+		if status != want {
+			t.Errorf("account %s status = %s, want %s", accountID, status, want)
+		}
+	}
+}
+
+func TestSyncRequisitionConcurrently(t *testing.T) {
+	f := newSyncFixture(t, fake.Options{})
+	ctx := context.Background()
+
+	// The same requisition synced by two instances at once stores every
+	// account and transaction once
+	instances := []*gclService{f.service, f.newInstance()}
+	errs := make(chan error, len(instances))
+	for _, instance := range instances {
+		go func() {
+			_, err := instance.SyncRequisition(ctx, f.reference, f.userID, "", nil)
+			errs <- err
+		}()
+	}
+	for range instances {
+		if err := <-errs; err != nil {
+			t.Fatalf("SyncRequisition() error = %v", err)
+		}
+	}
+
+	accountIDs := make(map[string]bool)
+	for _, account := range f.accounts.accounts {
+		if accountIDs[*account.AccountID] {
+			t.Errorf("account %s stored twice", *account.AccountID)
+		}
+		accountIDs[*account.AccountID] = true
+	}
+	providerIDs := make(map[string]bool)
+	for _, tx := range f.transactions.transactions {
+		key := tx.BankAccountID.String() + "/" + tx.ProviderTransactionID
+		if providerIDs[key] {
+			t.Errorf("transaction %s imported twice", tx.ProviderTransactionID)
+		}
+		providerIDs[key] = true
+	}
+	if len(accountIDs) == 0 || len(providerIDs) == 0 {
+		t.Errorf("concurrent syncs stored %d accounts and %d transactions, want both", len(accountIDs), len(providerIDs))
+	}
+}
+
+func TestSyncRequisitionAccountFailures(t *testing.T) {
+	t.Run("rate limited accounts are deferred", func(t *testing.T) {
+		f := newSyncFixture(t, fake.Options{AccountDailyLimit: 1})
+		ctx := context.Background()
+		f.sync(t, ctx)
+
+		for accountID, status := range f.sync(t, ctx) {
+			if status != constants.SYNC_ACCOUNT_STATUS_DEFERRED {
+				t.Errorf("account %s status = %s, want %s", accountID, status, constants.SYNC_ACCOUNT_STATUS_DEFERRED)
+			}
+		}
+		for _, account := range f.accounts.accounts {
+			if account.SyncDeferredUntil == nil || !account.SyncDeferredUntil.After(time.Now()) {
+				t.Errorf("account %s deferred until %v, want the reset of the limit", account.ID, account.SyncDeferredUntil)
+			}
+		}
+
+		// Deferred accounts are not requested again before the limit resets
+		for accountID, status := range f.sync(t, ctx) {
+			if status != constants.SYNC_ACCOUNT_STATUS_DEFERRED {
+				t.Errorf("account %s status on the third sync = %s, want %s", accountID, status, constants.SYNC_ACCOUNT_STATUS_DEFERRED)
+			}
+		}
+	})
+
+	t.Run("a suspended account does not stop the others", func(t *testing.T) {
+		f := newSyncFixture(t, fake.Options{})
+		ctx := context.Background()
+		f.sync(t, ctx)
+		if len(f.accountIDs) < 2 {
+			t.Skip("the sandbox institution has a single account")
+		}
+
+		suspended := f.accountIDs[0]
+		if err := f.server.SuspendAccount(suspended); err != nil {
+			t.Fatal(err)
+		}
+		for accountID, status := range f.sync(t, ctx) {
+			want := constants.SYNC_ACCOUNT_STATUS_SUCCEEDED
+			if accountID == suspended {
+				want = constants.SYNC_ACCOUNT_STATUS_FAILED
+			}
+			if status != want {
+				t.Errorf("account %s status = %s, want %s", accountID, status, want)
+			}
+		}
+	})
+}
+
+type latestSyncJobRepo struct {
+	repository.SyncJobRepository
+	latest *domain.SyncJob
+}
+
+func (r latestSyncJobRepo) GetLatestByRequisitionID(context.Context, string) (*domain.SyncJob, error) {
+	if r.latest == nil {
+		return nil, repository.ErrSyncJobNotFound
+	}
+	return r.latest, nil
+}
+
+func TestRecentlySyncedAccounts(t *testing.T) {
+	recently, long := time.Now().Add(-time.Minute), time.Now().Add(-recentSyncWindow-time.Minute)
+	accounts := []domain.SyncJobAccount{
+		{AccountID: "synced", Status: constants.SYNC_ACCOUNT_STATUS_SUCCEEDED},
+		{AccountID: "failed", Status: constants.SYNC_ACCOUNT_STATUS_FAILED},
+		{AccountID: "deferred", Status: constants.SYNC_ACCOUNT_STATUS_DEFERRED},
+	}
+
+	tests := []struct {
+		name   string
+		latest *domain.SyncJob
+		want   []string
+	}{
+		{"never synced", nil, nil},
+		{"still running", &domain.SyncJob{Accounts: accounts}, nil},
+		{"finished long ago", &domain.SyncJob{FinishedAt: &long, Accounts: accounts}, nil},
+		{"finished recently", &domain.SyncJob{FinishedAt: &recently, Accounts: accounts}, []string{"synced"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &syncService{syncJobRepo: latestSyncJobRepo{latest: tt.latest}}
+			got := s.recentlySyncedAccounts(context.Background(), "requisition")
+			if len(got) != len(tt.want) {
+				t.Fatalf("recentlySyncedAccounts() = %v, want %v", got, tt.want)
+			}
+			for _, accountID := range tt.want {
+				if !got[accountID] {
+					t.Errorf("recentlySyncedAccounts() = %v, want %s", got, accountID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,468 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/config"
+	"FinMa/constants"
+	"FinMa/dto"
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// Page sizes of transaction listings
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 200
+)
+
+// ErrInvalidCursor is returned when a pagination cursor was not issued by a previous page
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidSplits is returned when the splits of a transaction do not add up to its amount
+var ErrInvalidSplits = errors.New("invalid splits")
+
+// maxSplits bounds the splits of a transaction
+const maxSplits = 20
+
+// ErrNotManualTransaction is returned when a transaction synced from a bank is changed or deleted
+var ErrNotManualTransaction = errors.New("transaction is synced from a bank")
+
+type TransactionService interface {
+	// ListTransactions returns a page of the user's transactions matching the query
+	ListTransactions(ctx context.Context, userID uuid.UUID, query dto.TransactionQuery) (*dto.TransactionListResponse, error)
+	// CreateTransaction adds a transaction to a manual account of the user and moves its balance by the amount
+	CreateTransaction(ctx context.Context, userID uuid.UUID, req dto.CreateTransactionRequest) (*dto.TransactionResponse, error)
+	// UpdateTransaction changes a manual transaction, moving the balance of its account by the change of the amount
+	UpdateTransaction(ctx context.Context, userID, transactionID uuid.UUID, req dto.UpdateTransactionRequest) (*dto.TransactionResponse, error)
+	// DeleteTransaction deletes a manual transaction and takes its amount back out of the balance of its account
+	DeleteTransaction(ctx context.Context, userID, transactionID uuid.UUID) error
+	// SplitTransaction replaces the splits of a transaction of the user, synced or manual
+	SplitTransaction(ctx context.Context, userID, transactionID uuid.UUID, req dto.SplitTransactionRequest) (*dto.TransactionResponse, error)
+	// GetCategorySummary sums the income and expenses of the user by category between from and to inclusive
+	GetCategorySummary(ctx context.Context, userID uuid.UUID, from, to time.Time) (*dto.CategorySummaryResponse, error)
+	// DetectTransfers links the transactions moving money between accounts of the user and returns how many transfers it linked
+	DetectTransfers(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+type transactionService struct {
+	transactionRepo     repository.TransactionRepository
+	bankAccountRepo     repository.BankAccountRepository
+	balanceSnapshotRepo repository.BalanceSnapshotRepository
+	categorizer         transactionCategorizer
+	// transferWindow is how far apart the two sides of a transfer may be booked
+	transferWindow time.Duration
+}
+
+// NewTransactionService creates a transaction service. Manual transactions
+// entered without a category are categorized by the categorizer.
+func NewTransactionService(transactionRepo repository.TransactionRepository, bankAccountRepo repository.BankAccountRepository, balanceSnapshotRepo repository.BalanceSnapshotRepository, categorizer transactionCategorizer, cfg *config.Config) TransactionService {
+	return &transactionService{
+		transactionRepo:     transactionRepo,
+		bankAccountRepo:     bankAccountRepo,
+		balanceSnapshotRepo: balanceSnapshotRepo,
+		categorizer:         categorizer,
+		transferWindow:      cfg.Transfer.DateWindow,
+	}
+}
+
+func (s *transactionService) ListTransactions(ctx context.Context, userID uuid.UUID, query dto.TransactionQuery) (*dto.TransactionListResponse, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultTransactionPageSize
+	}
+	if limit > maxTransactionPageSize {
+		limit = maxTransactionPageSize
+	}
+
+	filter := repository.TransactionFilter{
+		UserID:         userID,
+		BankAccountIDs: query.BankAccountIDs,
+		From:           query.From,
+		To:             query.To,
+		MinAmount:      query.MinAmount,
+		MaxAmount:      query.MaxAmount,
+		Category:       query.Category,
+		Type:           query.Type,
+		Status:         query.Status,
+		Search:         query.Search,
+		Sort:           query.Sort,
+		// One more than the page tells whether there is a next page
+		Limit: limit + 1,
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeTransactionCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+
+	transactions, err := s.transactionRepo.List(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transactions for user %s: %w", userID, err)
+	}
+
+	response := &dto.TransactionListResponse{
+		Transactions: make([]dto.TransactionResponse, 0, limit),
+	}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		response.NextCursor = encodeTransactionCursor(repository.TransactionCursor{
+			Date:   last.Date,
+			Amount: last.Amount,
+			ID:     last.ID,
+		})
+	}
+	for i := range transactions {
+		response.Transactions = append(response.Transactions, transactionResponse(&transactions[i]))
+	}
+
+	return response, nil
+}
+
+func (s *transactionService) CreateTransaction(ctx context.Context, userID uuid.UUID, req dto.CreateTransactionRequest) (*dto.TransactionResponse, error) {
+	account, err := s.bankAccountRepo.GetByID(ctx, req.BankAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bank account %s: %w", req.BankAccountID, err)
+	}
+	if account.UserID != userID {
+		return nil, fmt.Errorf("bank account %s does not belong to user: %w", req.BankAccountID, repository.ErrForbidden)
+	}
+	// Transactions of synced accounts come from the bank
+	if !account.IsManual() {
+		return nil, fmt.Errorf("cannot add transactions to bank account %s: %w", req.BankAccountID, ErrNotManualAccount)
+	}
+
+	date, err := time.Parse(time.DateOnly, req.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date: %v", repository.ErrInvalidTransactionData, err)
+	}
+
+	tx := &domain.Transaction{
+		ID:            uuid.New(),
+		Date:          date,
+		Amount:        roundCents(req.Amount),
+		Currency:      account.Currency,
+		Description:   strings.TrimSpace(req.Description),
+		Category:      req.Category,
+		Type:          req.Type,
+		Status:        constants.TRANSACTION_STATUS_BOOKED,
+		Manual:        true,
+		UserID:        userID,
+		BankAccountID: account.ID,
+	}
+	setCounterparty(tx, strings.TrimSpace(req.Counterparty))
+	if tx.Category != "" {
+		tx.CategorySource = constants.CATEGORY_SOURCE_USER
+	} else if err := s.categorizer.Categorize(ctx, userID, []*domain.Transaction{tx}); err != nil {
+		log.Error("Failed to categorize transaction", "error", err, "userID", userID)
+	}
+	if tx.Type == "" {
+		tx.Type = transactionType(tx.Amount)
+	}
+
+	if err := s.transactionRepo.CreateManual(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to create transaction on bank account %s: %w", account.ID, err)
+	}
+	if err := s.recordBalance(ctx, account.ID); err != nil {
+		return nil, err
+	}
+
+	response := transactionResponse(tx)
+	return &response, nil
+}
+
+func (s *transactionService) UpdateTransaction(ctx context.Context, userID, transactionID uuid.UUID, req dto.UpdateTransactionRequest) (*dto.TransactionResponse, error) {
+	tx, err := s.manualTransaction(ctx, userID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	previousAmount := tx.Amount
+	currentCounterparty := counterparty(tx)
+
+	if req.Date != nil {
+		date, err := time.Parse(time.DateOnly, *req.Date)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date: %v", repository.ErrInvalidTransactionData, err)
+		}
+		tx.Date = date
+	}
+	if req.Amount != nil {
+		tx.Amount = roundCents(*req.Amount)
+		// A type derived from the previous sign no longer applies
+		if req.Type == nil && tx.Type == transactionType(previousAmount) {
+			tx.Type = transactionType(tx.Amount)
+		}
+	}
+	if req.Description != nil {
+		tx.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Category != nil {
+		tx.Category = *req.Category
+		tx.CategorySource, tx.CategoryConfidence = "", 0
+		if tx.Category != "" {
+			tx.CategorySource = constants.CATEGORY_SOURCE_USER
+		}
+	}
+	if req.Type != nil {
+		tx.Type = *req.Type
+	}
+	if req.Counterparty != nil {
+		currentCounterparty = strings.TrimSpace(*req.Counterparty)
+	}
+	setCounterparty(tx, currentCounterparty)
+
+	if err := s.transactionRepo.UpdateManual(ctx, tx, previousAmount); err != nil {
+		return nil, fmt.Errorf("failed to update transaction %s: %w", transactionID, err)
+	}
+	if err := s.recordBalance(ctx, tx.BankAccountID); err != nil {
+		return nil, err
+	}
+
+	response := transactionResponse(tx)
+	return &response, nil
+}
+
+func (s *transactionService) DeleteTransaction(ctx context.Context, userID, transactionID uuid.UUID) error {
+	tx, err := s.manualTransaction(ctx, userID, transactionID)
+	if err != nil {
+		return err
+	}
+	if err := s.transactionRepo.DeleteManual(ctx, tx); err != nil {
+		return fmt.Errorf("failed to delete transaction %s: %w", transactionID, err)
+	}
+	return s.recordBalance(ctx, tx.BankAccountID)
+}
+
+func (s *transactionService) SplitTransaction(ctx context.Context, userID, transactionID uuid.UUID, req dto.SplitTransactionRequest) (*dto.TransactionResponse, error) {
+	tx, err := s.transactionRepo.GetByTransactionID(ctx, transactionID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", transactionID, err)
+	}
+	if tx.UserID != userID {
+		return nil, fmt.Errorf("transaction %s does not belong to user: %w", transactionID, repository.ErrForbidden)
+	}
+
+	splits, err := transactionSplits(&tx, req.Splits)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transactionRepo.ReplaceSplits(ctx, tx.ID, splits); err != nil {
+		return nil, fmt.Errorf("failed to split transaction %s: %w", transactionID, err)
+	}
+	tx.Splits = splits
+
+	response := transactionResponse(&tx)
+	return &response, nil
+}
+
+func (s *transactionService) GetCategorySummary(ctx context.Context, userID uuid.UUID, from, to time.Time) (*dto.CategorySummaryResponse, error) {
+	totals, err := s.transactionRepo.GetCategoryTotals(ctx, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category totals for user %s: %w", userID, err)
+	}
+
+	response := &dto.CategorySummaryResponse{
+		From:       from.Format(time.DateOnly),
+		To:         to.Format(time.DateOnly),
+		Categories: make([]dto.CategoryTotal, 0, len(totals)),
+		Totals:     []dto.CurrencyTotal{},
+	}
+	index := make(map[string]int)
+	for _, total := range totals {
+		response.Categories = append(response.Categories, dto.CategoryTotal{
+			Category:     total.Category,
+			Currency:     total.Currency,
+			Income:       roundCents(total.Income),
+			Expense:      roundCents(total.Expense),
+			Transactions: total.Transactions,
+		})
+
+		i, ok := index[total.Currency]
+		if !ok {
+			i = len(response.Totals)
+			index[total.Currency] = i
+			response.Totals = append(response.Totals, dto.CurrencyTotal{Currency: total.Currency})
+		}
+		response.Totals[i].Income += total.Income
+		response.Totals[i].Expense += total.Expense
+	}
+	for i := range response.Totals {
+		currencyTotal := &response.Totals[i]
+		currencyTotal.Net = roundCents(currencyTotal.Income - currencyTotal.Expense)
+		currencyTotal.Income = roundCents(currencyTotal.Income)
+		currencyTotal.Expense = roundCents(currencyTotal.Expense)
+	}
+	sort.Slice(response.Totals, func(i, j int) bool {
+		return response.Totals[i].Currency < response.Totals[j].Currency
+	})
+	return response, nil
+}
+
+// transactionSplits checks that requested splits add up to the amount of a
+// transaction, compared in cents, and have its sign. A split needs a second one.
+func transactionSplits(tx *domain.Transaction, requested []dto.TransactionSplitRequest) ([]domain.TransactionSplit, error) {
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	if len(requested) == 1 {
+		return nil, fmt.Errorf("%w: a transaction is split in at least two parts", ErrInvalidSplits)
+	}
+	if len(requested) > maxSplits {
+		return nil, fmt.Errorf("%w: a transaction is split in at most %d parts", ErrInvalidSplits, maxSplits)
+	}
+
+	splits := make([]domain.TransactionSplit, 0, len(requested))
+	var cents int64
+	for i, req := range requested {
+		amount := roundCents(req.Amount)
+		if amount == 0 || (amount < 0) != (tx.Amount < 0) {
+			return nil, fmt.Errorf("%w: the amount of split %d must be non-zero and have the sign of the transaction", ErrInvalidSplits, i+1)
+		}
+		cents += int64(math.Round(amount * 100))
+		splits = append(splits, domain.TransactionSplit{
+			ID:            uuid.New(),
+			TransactionID: tx.ID,
+			Position:      i,
+			Amount:        amount,
+			Category:      strings.TrimSpace(req.Category),
+			Note:          strings.TrimSpace(req.Note),
+		})
+	}
+	if cents != int64(math.Round(tx.Amount*100)) {
+		return nil, fmt.Errorf("%w: the splits sum to %.2f instead of %.2f", ErrInvalidSplits, float64(cents)/100, tx.Amount)
+	}
+	return splits, nil
+}
+
+// manualTransaction retrieves a transaction and checks that the user entered it
+func (s *transactionService) manualTransaction(ctx context.Context, userID, transactionID uuid.UUID) (*domain.Transaction, error) {
+	tx, err := s.transactionRepo.GetByTransactionID(ctx, transactionID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction %s: %w", transactionID, err)
+	}
+	if tx.UserID != userID {
+		return nil, fmt.Errorf("transaction %s does not belong to user: %w", transactionID, repository.ErrForbidden)
+	}
+	if !tx.Manual {
+		return nil, fmt.Errorf("cannot change transaction %s: %w", transactionID, ErrNotManualTransaction)
+	}
+	return &tx, nil
+}
+
+// recordBalance snapshots the balance of a manual account after its transactions changed
+func (s *transactionService) recordBalance(ctx context.Context, bankAccountID uuid.UUID) error {
+	account, err := s.bankAccountRepo.GetByID(ctx, bankAccountID)
+	if err != nil {
+		return fmt.Errorf("failed to get bank account %s: %w", bankAccountID, err)
+	}
+	if err := s.balanceSnapshotRepo.Upsert(ctx, manualBalanceSnapshots(&account)); err != nil {
+		return fmt.Errorf("failed to save balance of manual account %s: %w", bankAccountID, err)
+	}
+	return nil
+}
+
+// transactionType derives the type of a transaction from the sign of its amount
+func transactionType(amount float64) string {
+	if amount < 0 {
+		return constants.TRANSACTION_TYPE_EXPENSE
+	}
+	return constants.TRANSACTION_TYPE_INCOME
+}
+
+// counterparty returns who was paid by an outgoing transaction, or who paid an incoming one
+func counterparty(tx *domain.Transaction) string {
+	if tx.Amount < 0 {
+		return tx.CreditorName
+	}
+	return tx.DebtorName
+}
+
+// setCounterparty records the counterparty of a manual transaction on the side its amount implies
+func setCounterparty(tx *domain.Transaction, name string) {
+	tx.CreditorName, tx.DebtorName = "", ""
+	if tx.Amount < 0 {
+		tx.CreditorName = name
+	} else {
+		tx.DebtorName = name
+	}
+}
+
+// transactionResponse converts a transaction to its client representation
+func transactionResponse(tx *domain.Transaction) dto.TransactionResponse {
+	return dto.TransactionResponse{
+		ID:                    tx.ID,
+		BankAccountID:         tx.BankAccountID,
+		Date:                  tx.Date,
+		ValueDate:             tx.ValueDate,
+		Amount:                tx.Amount,
+		Currency:              tx.Currency,
+		Description:           tx.Description,
+		Category:              tx.Category,
+		CategorySource:        tx.CategorySource,
+		CategoryConfidence:    tx.CategoryConfidence,
+		Tags:                  tx.Tags,
+		Type:                  tx.Type,
+		Status:                tx.Status,
+		IsRecurring:           tx.IsRecurring,
+		RecurringSeriesID:     tx.RecurringSeriesID,
+		TransferTransactionID: tx.TransferTransactionID,
+		Splits:                transactionSplitResponses(tx.Splits),
+		Manual:                tx.Manual,
+		CreditorName:          tx.CreditorName,
+		CreditorIBAN:          tx.CreditorIBAN,
+		DebtorName:            tx.DebtorName,
+		DebtorIBAN:            tx.DebtorIBAN,
+		CreatedAt:             tx.CreatedAt,
+		UpdatedAt:             tx.UpdatedAt,
+	}
+}
+
+// transactionSplitResponses converts the splits of a transaction, nil when it has none
+func transactionSplitResponses(splits []domain.TransactionSplit) []dto.TransactionSplitResponse {
+	if len(splits) == 0 {
+		return nil
+	}
+	responses := make([]dto.TransactionSplitResponse, 0, len(splits))
+	for _, split := range splits {
+		responses = append(responses, dto.TransactionSplitResponse{
+			ID:       split.ID,
+			Amount:   split.Amount,
+			Category: split.Category,
+			Note:     split.Note,
+		})
+	}
+	return responses
+}
+
+// encodeTransactionCursor encodes the position of a transaction as an opaque string
+func encodeTransactionCursor(cursor repository.TransactionCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTransactionCursor decodes a cursor returned by encodeTransactionCursor
+func decodeTransactionCursor(value string) (*repository.TransactionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor repository.TransactionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
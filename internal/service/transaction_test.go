@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/internal/domain"
+)
+
+func TestTransactionSplits(t *testing.T) {
+	expense := &domain.Transaction{ID: uuid.New(), Amount: -100}
+	income := &domain.Transaction{ID: uuid.New(), Amount: 50.5}
+
+	tests := []struct {
+		name      string
+		tx        *domain.Transaction
+		requested []dto.TransactionSplitRequest
+		wantErr   bool
+		wantParts int
+	}{
+		{
+			name: "no splits",
+			tx:   expense,
+		},
+		{
+			name: "expense split in two",
+			tx:   expense,
+			requested: []dto.TransactionSplitRequest{
+				{Amount: -60, Category: " Groceries "},
+				{Amount: -40, Category: "Household", Note: " cleaning "},
+			},
+			wantParts: 2,
+		},
+		{
+			name: "income split in two",
+			tx:   income,
+			requested: []dto.TransactionSplitRequest{
+				{Amount: 25.25, Category: "Refunds"},
+				{Amount: 25.25, Category: "Gifts"},
+			},
+			wantParts: 2,
+		},
+		{
+			name: "sums are compared in cents",
+			tx:   expense,
+			requested: []dto.TransactionSplitRequest{
+				{Amount: -33.33}, {Amount: -33.33}, {Amount: -33.34},
+			},
+			wantParts: 3,
+		},
+		{
+			name:      "a single split",
+			tx:        expense,
+			requested: []dto.TransactionSplitRequest{{Amount: -100}},
+			wantErr:   true,
+		},
+		{
+			name:      "too many splits",
+			tx:        expense,
+			requested: make([]dto.TransactionSplitRequest, maxSplits+1),
+			wantErr:   true,
+		},
+		{
+			name:      "sum differs",
+			tx:        expense,
+			requested: []dto.TransactionSplitRequest{{Amount: -60}, {Amount: -39.99}},
+			wantErr:   true,
+		},
+		{
+			name:      "wrong sign",
+			tx:        expense,
+			requested: []dto.TransactionSplitRequest{{Amount: -120}, {Amount: 20}},
+			wantErr:   true,
+		},
+		{
+			name:      "zero amount",
+			tx:        expense,
+			requested: []dto.TransactionSplitRequest{{Amount: -100}, {Amount: 0.001}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splits, err := transactionSplits(tt.tx, tt.requested)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSplits) {
+					t.Errorf("transactionSplits() error = %v, want %v", err, ErrInvalidSplits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transactionSplits() error = %v", err)
+			}
+			if len(splits) != tt.wantParts {
+				t.Fatalf("transactionSplits() = %d splits, want %d", len(splits), tt.wantParts)
+			}
+			for i, split := range splits {
+				if split.TransactionID != tt.tx.ID || split.Position != i || split.Amount != tt.requested[i].Amount {
+					t.Errorf("split %d = %+v, want position %d of the transaction", i, split, i)
+				}
+			}
+		})
+	}
+
+	splits, _ := transactionSplits(expense, []dto.TransactionSplitRequest{{Amount: -60, Category: " Groceries "}, {Amount: -40, Note: " cleaning "}})
+	if splits[0].Category != "Groceries" || splits[1].Note != "cleaning" {
+		t.Errorf("splits = %+v, want trimmed categories and notes", splits)
+	}
+}
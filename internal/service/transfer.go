@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/google/uuid"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+// transferDetector links transfers between accounts of a user after transactions were imported
+type transferDetector interface {
+	DetectTransfers(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+func (s *transactionService) DetectTransfers(ctx context.Context, userID uuid.UUID) (int, error) {
+	accounts, err := s.bankAccountRepo.GetUserAccountsWithBalance(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get bank accounts for user %s: %w", userID, err)
+	}
+	transactions, err := s.transactionRepo.GetBookedByUserIDSince(ctx, userID, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transactions for user %s: %w", userID, err)
+	}
+
+	pairs := matchTransfers(transactions, accounts, s.transferWindow)
+	if err := s.transactionRepo.LinkTransfers(ctx, pairs); err != nil {
+		return 0, fmt.Errorf("failed to link transfers for user %s: %w", userID, err)
+	}
+
+	if len(pairs) > 0 {
+		log.Info("Linked transfers between accounts", "userID", userID, "transfers", len(pairs))
+	}
+	return len(pairs), nil
+}
+
+// matchTransfers pairs transactions not yet linked that move money between
+// accounts of the user. A transaction whose counterparty IBAN is that of
+// another of the accounts is paired with the transaction of that account with
+// the opposite amount in the same currency, booked closest to it within window.
+func matchTransfers(transactions []domain.Transaction, accounts []domain.BankAccount, window time.Duration) []repository.TransferPair {
+	accountsByIBAN := make(map[string]uuid.UUID, len(accounts))
+	for _, account := range accounts {
+		if iban := normalizeIBAN(account.IBAN); iban != "" {
+			accountsByIBAN[iban] = account.ID
+		}
+	}
+	if len(accountsByIBAN) == 0 {
+		return nil
+	}
+
+	// Only transactions not linked yet take part, by account
+	byAccount := make(map[uuid.UUID][]*domain.Transaction)
+	for i := range transactions {
+		tx := &transactions[i]
+		if tx.TransferTransactionID == nil && tx.Amount != 0 {
+			byAccount[tx.BankAccountID] = append(byAccount[tx.BankAccountID], tx)
+		}
+	}
+
+	paired := make(map[uuid.UUID]bool)
+	var pairs []repository.TransferPair
+	for i := range transactions {
+		tx := &transactions[i]
+		if tx.TransferTransactionID != nil || tx.Amount == 0 || paired[tx.ID] {
+			continue
+		}
+		otherAccountID, ok := accountsByIBAN[counterpartyIBAN(tx)]
+		if !ok || otherAccountID == tx.BankAccountID {
+			continue
+		}
+
+		// Amounts are compared in cents, so floating point noise does not prevent a match
+		cents := math.Round(tx.Amount * 100)
+		var match *domain.Transaction
+		var matchGap time.Duration
+		for _, other := range byAccount[otherAccountID] {
+			if paired[other.ID] || math.Round(other.Amount*100) != -cents {
+				continue
+			}
+			if tx.Currency != "" && other.Currency != "" && other.Currency != tx.Currency {
+				continue
+			}
+			gap := other.Date.Sub(tx.Date).Abs()
+			if gap <= window && (match == nil || gap < matchGap) {
+				match, matchGap = other, gap
+			}
+		}
+		if match == nil {
+			continue
+		}
+
+		paired[tx.ID], paired[match.ID] = true, true
+		pair := repository.TransferPair{OutgoingID: tx.ID, IncomingID: match.ID}
+		if tx.Amount > 0 {
+			pair = repository.TransferPair{OutgoingID: match.ID, IncomingID: tx.ID}
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/internal/domain"
+	"FinMa/internal/repository"
+)
+
+func TestMatchTransfers(t *testing.T) {
+	checking := domain.BankAccount{ID: uuid.New(), IBAN: "DE89 3704 0044 0532 0130 00"}
+	savings := domain.BankAccount{ID: uuid.New(), IBAN: "DE02120300000000202051"}
+	accounts := []domain.BankAccount{checking, savings}
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	outgoing := func(amount float64, currency string, date time.Time) domain.Transaction {
+		return domain.Transaction{ID: uuid.New(), BankAccountID: checking.ID, Amount: amount, Currency: currency, Date: date, CreditorIBAN: savings.IBAN}
+	}
+	incoming := func(amount float64, currency string, date time.Time) domain.Transaction {
+		return domain.Transaction{ID: uuid.New(), BankAccountID: savings.ID, Amount: amount, Currency: currency, Date: date, DebtorIBAN: "DE89370400440532013000"}
+	}
+
+	tests := []struct {
+		name         string
+		transactions func() ([]domain.Transaction, []repository.TransferPair)
+	}{
+		{
+			name: "opposite amounts between own accounts",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				out, in := outgoing(-100, "EUR", day), incoming(100, "EUR", day.AddDate(0, 0, 1))
+				return []domain.Transaction{out, in}, []repository.TransferPair{{OutgoingID: out.ID, IncomingID: in.ID}}
+			},
+		},
+		{
+			name: "amounts compared in cents",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				out, in := outgoing(-0.1-0.2, "EUR", day), incoming(0.3, "EUR", day)
+				return []domain.Transaction{out, in}, []repository.TransferPair{{OutgoingID: out.ID, IncomingID: in.ID}}
+			},
+		},
+		{
+			name: "closest date wins",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				out := outgoing(-50, "EUR", day)
+				far, near := incoming(50, "EUR", day.AddDate(0, 0, 3)), incoming(50, "EUR", day.AddDate(0, 0, 1))
+				return []domain.Transaction{out, far, near}, []repository.TransferPair{{OutgoingID: out.ID, IncomingID: near.ID}}
+			},
+		},
+		{
+			name: "different currencies",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				return []domain.Transaction{outgoing(-100, "EUR", day), incoming(100, "USD", day)}, nil
+			},
+		},
+		{
+			name: "unknown currency",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				out, in := outgoing(-100, "EUR", day), incoming(100, "", day)
+				return []domain.Transaction{out, in}, []repository.TransferPair{{OutgoingID: out.ID, IncomingID: in.ID}}
+			},
+		},
+		{
+			name: "outside the window",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				return []domain.Transaction{outgoing(-100, "EUR", day), incoming(100, "EUR", day.AddDate(0, 0, 10))}, nil
+			},
+		},
+		{
+			name: "different amounts",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				return []domain.Transaction{outgoing(-100, "EUR", day), incoming(99.99, "EUR", day)}, nil
+			},
+		},
+		{
+			name: "already linked",
+			transactions: func() ([]domain.Transaction, []repository.TransferPair) {
+				out, in := outgoing(-100, "EUR", day), incoming(100, "EUR", day)
+				linked := uuid.New()
+				out.TransferTransactionID = &linked
+				return []domain.Transaction{out, in}, nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transactions, want := tt.transactions()
+			got := matchTransfers(transactions, accounts, 3*24*time.Hour)
+			if len(got) != len(want) {
+				t.Fatalf("matchTransfers() = %v, want %v", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("pair %d = %v, want %v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
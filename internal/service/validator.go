@@ -85,6 +85,8 @@ func formatValidationError(err validator.FieldError) string {
 		return fmt.Sprintf("%s must be one of: %s", field, err.Param())
 	case "eqfield":
 		return fmt.Sprintf("%s must be equal to %s", field, err.Param())
+	case "ne":
+		return fmt.Sprintf("%s must not be %s", field, err.Param())
 	case "gt":
 		return fmt.Sprintf("%s must be greater than %s", field, err.Param())
 	case "gte":
@@ -2,11 +2,10 @@ package gocardless
 
 import (
 	"FinMa/dto"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -20,15 +19,48 @@ const (
 	RefreshEndpoint      = "/token/refresh/"
 	InstitutionsEndpoint = "/institutions/"
 	RequisitionsEndpoint = "/requisitions/"
+	AgreementsEndpoint   = "/agreements/enduser/"
 	AccountsEndpoint     = "/accounts/"
 )
 
+// tokenExpiryMargin is how long before its expiry an access token is renewed
+const tokenExpiryMargin = 5 * time.Minute
+
+// Tokens is the token pair of the GoCardless API
+type Tokens struct {
+	Access         string
+	Refresh        string
+	AccessExpires  time.Time
+	RefreshExpires time.Time
+}
+
+// TokenStore persists the token pair so it survives restarts and is shared by
+// every instance using the same store
+type TokenStore interface {
+	// Load returns the stored tokens, nil if there are none
+	Load(ctx context.Context) (*Tokens, error)
+	// Update runs renew while holding a lock shared by every instance, then
+	// stores the tokens it returns. renew receives the stored tokens, which
+	// another instance may have renewed while this one waited for the lock.
+	Update(ctx context.Context, renew func(stored *Tokens) (*Tokens, error)) (*Tokens, error)
+	Clear(ctx context.Context) error
+}
+
 type Client struct {
 	HTTPClient *http.Client
 	BaseURL    string
 	SecretID   string
 	SecretKey  string
 
+	// Retry policy for network errors and 5xx responses
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Store persists the tokens when set. Tokens are only requested from
+	// GoCardless when the stored ones expired.
+	Store TokenStore
+
 	// Token management with mutex for thread safety
 	mu             sync.RWMutex
 	AccessToken    string
@@ -42,95 +74,89 @@ func NewClient(secretID, secretKey string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		BaseURL:   BaseURL,
-		SecretID:  secretID,
-		SecretKey: secretKey,
+		BaseURL:        BaseURL,
+		SecretID:       secretID,
+		SecretKey:      secretKey,
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
 	}
 }
 
-func (c *Client) CreateRequisition(ctx context.Context, UserID uuid.UUID, institutionID, redirectURL string) (*dto.GoCardlessCreateRequisitionResponse, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
+// CreateEndUserAgreement creates the agreement defining how much history and
+// for how long the requisition built on it may access the user's accounts
+func (c *Client) CreateEndUserAgreement(ctx context.Context, agreement dto.GoCardlessCreateAgreementRequest) (*dto.GoCardlessAgreement, error) {
+	var agreementResp dto.GoCardlessAgreement
+	err := c.do(ctx, request{
+		method:        http.MethodPost,
+		path:          AgreementsEndpoint,
+		body:          agreement,
+		authenticated: true,
+	}, &agreementResp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
+		return nil, err
 	}
 
-	url := fmt.Sprintf("%s%s", c.BaseURL, RequisitionsEndpoint)
-
-	// Create a unique reference by combining UserID and institutionID
-	uniqueReference := fmt.Sprintf("%s_%s", UserID.String(), institutionID)
-
-	jsonData, err := json.Marshal(dto.GoCardlessCreateRequisitionRequest{
-		InstitutionID: institutionID,
-		RedirectURL:   redirectURL,
-		Reference:     uniqueReference, // Now unique per user-institution combination
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
+	return &agreementResp, nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+// GetEndUserAgreement retrieves an end-user agreement, including when the user accepted it
+func (c *Client) GetEndUserAgreement(ctx context.Context, agreementID string) (*dto.GoCardlessAgreement, error) {
+	var agreement dto.GoCardlessAgreement
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/", AgreementsEndpoint, agreementID),
+		authenticated: true,
+	}, &agreement)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
+	return &agreement, nil
+}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, parseGoCardlessError(resp)
-	}
+// CreateRequisition creates a requisition bound to the given end-user agreement.
+// An empty agreementID makes GoCardless apply its default agreement.
+func (c *Client) CreateRequisition(ctx context.Context, UserID uuid.UUID, institutionID, redirectURL, agreementID string) (*dto.GoCardlessCreateRequisitionResponse, error) {
+	// Create a unique reference by combining UserID and institutionID. The random
+	// suffix keeps it unique when the user links the same institution again.
+	uniqueReference := fmt.Sprintf("%s_%s_%s", UserID.String(), institutionID, uuid.NewString()[:8])
 
 	var linkResp dto.GoCardlessCreateRequisitionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&linkResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   RequisitionsEndpoint,
+		body: dto.GoCardlessCreateRequisitionRequest{
+			InstitutionID: institutionID,
+			RedirectURL:   redirectURL,
+			Reference:     uniqueReference,
+			Agreement:     agreementID,
+		},
+		authenticated: true,
+	}, &linkResp)
+	if err != nil {
+		return nil, err
 	}
 
 	return &linkResp, nil
 }
 
 func (c *Client) GetRequisition(ctx context.Context, userID uuid.UUID, requisitionID string) (*dto.GoCardlessGetRequisitionResponse, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
-	url := fmt.Sprintf("%s%s%s/", c.BaseURL, RequisitionsEndpoint, requisitionID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, parseGoCardlessError(resp)
-	}
-
 	var requisition dto.GoCardlessGetRequisitionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&requisition); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/", RequisitionsEndpoint, requisitionID),
+		authenticated: true,
+	}, &requisition)
+	if err != nil {
+		return nil, err
 	}
 
 	// Security check: Verify the requisition belongs to the user
-	// The reference should start with the userID (format: "userID_institutionID")
+	// The reference should start with the userID (format: "userID_institutionID_suffix")
 	expectedPrefix := userID.String() + "_"
 	if !strings.HasPrefix(requisition.Reference, expectedPrefix) {
-		return nil, fmt.Errorf("access denied: requisition does not belong to user")
+		return nil, fmt.Errorf("requisition %s does not belong to user: %w", requisitionID, ErrNotFound)
 	}
 
 	return &requisition, nil
@@ -140,7 +166,7 @@ func (c *Client) GetRequisition(ctx context.Context, userID uuid.UUID, requisiti
 func (c *Client) GetValidAccessToken(ctx context.Context) (string, error) {
 	c.mu.RLock()
 	// Check if we have a valid access token (with 5 minute buffer)
-	if c.AccessToken != "" && time.Now().Add(5*time.Minute).Before(c.AccessExpires) {
+	if c.accessTokenValid() {
 		token := c.AccessToken
 		c.mu.RUnlock()
 		return token, nil
@@ -152,10 +178,65 @@ func (c *Client) GetValidAccessToken(ctx context.Context) (string, error) {
 	defer c.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if c.AccessToken != "" && time.Now().Add(5*time.Minute).Before(c.AccessExpires) {
+	if c.accessTokenValid() {
 		return c.AccessToken, nil
 	}
 
+	if c.Store != nil {
+		return c.renewStoredTokensInternal(ctx)
+	}
+
+	return c.renewTokensInternal(ctx)
+}
+
+// LoadTokens loads the stored tokens into the client
+func (c *Client) LoadTokens(ctx context.Context) error {
+	if c.Store == nil {
+		return nil
+	}
+
+	tokens, err := c.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	if tokens == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setTokensInternal(*tokens)
+
+	return nil
+}
+
+// Internal method to renew the tokens through the store, so only one instance
+// calls GoCardless at a time (must be called with write lock)
+func (c *Client) renewStoredTokensInternal(ctx context.Context) (string, error) {
+	tokens, err := c.Store.Update(ctx, func(stored *Tokens) (*Tokens, error) {
+		if stored != nil {
+			c.setTokensInternal(*stored)
+			if c.accessTokenValid() {
+				return stored, nil
+			}
+		}
+
+		if _, err := c.renewTokensInternal(ctx); err != nil {
+			return nil, err
+		}
+		return c.tokensInternal(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.setTokensInternal(*tokens)
+	return c.AccessToken, nil
+}
+
+// Internal method to refresh the access token, or get a new token pair when
+// the refresh token expired (must be called with write lock)
+func (c *Client) renewTokensInternal(ctx context.Context) (string, error) {
 	// Try to refresh if we have a valid refresh token
 	if c.RefreshToken != "" && time.Now().Before(c.RefreshExpires) {
 		if err := c.refreshAccessTokenInternal(ctx); err == nil {
@@ -168,6 +249,29 @@ func (c *Client) GetValidAccessToken(ctx context.Context) (string, error) {
 	return c.getNewAccessTokenInternal(ctx)
 }
 
+// accessTokenValid checks if the access token is valid for at least tokenExpiryMargin (must be called with a lock)
+func (c *Client) accessTokenValid() bool {
+	return c.AccessToken != "" && time.Now().Add(tokenExpiryMargin).Before(c.AccessExpires)
+}
+
+// Internal method returning the current tokens (must be called with a lock)
+func (c *Client) tokensInternal() *Tokens {
+	return &Tokens{
+		Access:         c.AccessToken,
+		Refresh:        c.RefreshToken,
+		AccessExpires:  c.AccessExpires,
+		RefreshExpires: c.RefreshExpires,
+	}
+}
+
+// Internal method replacing the current tokens (must be called with write lock)
+func (c *Client) setTokensInternal(tokens Tokens) {
+	c.AccessToken = tokens.Access
+	c.RefreshToken = tokens.Refresh
+	c.AccessExpires = tokens.AccessExpires
+	c.RefreshExpires = tokens.RefreshExpires
+}
+
 // Internal method to get new access token (must be called with write lock)
 func (c *Client) getNewAccessTokenInternal(ctx context.Context) (string, error) {
 	tokenResp, err := c.getAccessTokenRequest(ctx)
@@ -191,149 +295,100 @@ func (c *Client) refreshAccessTokenInternal(ctx context.Context) error {
 	}
 
 	c.AccessToken = tokenResp.Access
-	c.RefreshToken = tokenResp.Refresh
 	c.AccessExpires = time.Now().Add(time.Duration(tokenResp.AccessExpires) * time.Second)
-	c.RefreshExpires = time.Now().Add(time.Duration(tokenResp.RefreshExpires) * time.Second)
+	// GoCardless only returns a new access token, the refresh token stays valid
+	if tokenResp.Refresh != "" {
+		c.RefreshToken = tokenResp.Refresh
+		c.RefreshExpires = time.Now().Add(time.Duration(tokenResp.RefreshExpires) * time.Second)
+	}
 
 	return nil
 }
 
 // Raw token request methods
 func (c *Client) getAccessTokenRequest(ctx context.Context) (*dto.TokenResponse, error) {
-	jsonData, err := json.Marshal(dto.TokenRequest{
-		SecretID:  c.SecretID,
-		SecretKey: c.SecretKey,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal token request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+TokenEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var tokenResp dto.TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   TokenEndpoint,
+		body: dto.TokenRequest{
+			SecretID:  c.SecretID,
+			SecretKey: c.SecretKey,
+		},
+		idempotent: true,
+	}, &tokenResp)
+	if err != nil {
+		return nil, err
 	}
 
 	return &tokenResp, nil
 }
 
 func (c *Client) refreshAccessTokenRequest(ctx context.Context, refreshToken string) (*dto.TokenResponse, error) {
-	refreshReq := dto.RefreshTokenRequest{
-		RefreshToken: refreshToken,
-	}
-
-	jsonData, err := json.Marshal(refreshReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal refresh request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+RefreshEndpoint, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
 	var tokenResp dto.TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   RefreshEndpoint,
+		body: dto.GoCardlessRefreshTokenRequest{
+			Refresh: refreshToken,
+		},
+		idempotent: true,
+	}, &tokenResp)
+	if err != nil {
+		return nil, err
 	}
 
 	return &tokenResp, nil
 }
 
 func (c *Client) GetInstitutions(ctx context.Context, countryCode string) ([]dto.Institution, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
-	url := fmt.Sprintf("%s%s?country=%s", c.BaseURL, InstitutionsEndpoint, countryCode)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	var institutions []dto.Institution
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s?country=%s", InstitutionsEndpoint, url.QueryEscape(countryCode)),
+		authenticated: true,
+	}, &institutions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return institutions, nil
+}
 
-	resp, err := c.HTTPClient.Do(req)
+// GetInstitution retrieves a single institution, including its history and access limits
+func (c *Client) GetInstitution(ctx context.Context, institutionID string) (*dto.Institution, error) {
+	var institution dto.Institution
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/", InstitutionsEndpoint, institutionID),
+		authenticated: true,
+	}, &institution)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var institutions []dto.Institution
-	if err := json.NewDecoder(resp.Body).Decode(&institutions); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+	return &institution, nil
+}
 
-	return institutions, nil
+// DeleteRequisition deletes a requisition and the access to its accounts
+func (c *Client) DeleteRequisition(ctx context.Context, requisitionID string) error {
+	return c.do(ctx, request{
+		method:        http.MethodDelete,
+		path:          fmt.Sprintf("%s%s/", RequisitionsEndpoint, requisitionID),
+		authenticated: true,
+	}, nil)
 }
 
 // GetAccountDetails retrieves the details of a specific bank account
 func (c *Client) GetAccountDetails(ctx context.Context, accountID string) (*dto.AccountDetails, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
-	url := fmt.Sprintf("%s%s%s/details/", c.BaseURL, AccountsEndpoint, accountID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, parseGoCardlessError(resp)
-	}
-
 	var details dto.AccountDetails
-	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/details/", AccountsEndpoint, accountID),
+		authenticated: true,
+	}, &details)
+	if err != nil {
+		return nil, err
 	}
 
 	return &details, nil
@@ -341,34 +396,14 @@ func (c *Client) GetAccountDetails(ctx context.Context, accountID string) (*dto.
 
 // GetAccountBalances retrieves the balances of a specific bank account
 func (c *Client) GetAccountBalances(ctx context.Context, accountID string) (*dto.AccountBalances, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
-	url := fmt.Sprintf("%s%s%s/balances/", c.BaseURL, AccountsEndpoint, accountID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, parseGoCardlessError(resp)
-	}
-
 	var balances dto.AccountBalances
-	if err := json.NewDecoder(resp.Body).Decode(&balances); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/balances/", AccountsEndpoint, accountID),
+		authenticated: true,
+	}, &balances)
+	if err != nil {
+		return nil, err
 	}
 
 	return &balances, nil
@@ -376,40 +411,19 @@ func (c *Client) GetAccountBalances(ctx context.Context, accountID string) (*dto
 
 // GetAccountTransactions retrieves the transactions of a specific bank account
 func (c *Client) GetAccountTransactions(ctx context.Context, accountID string) (*dto.AccountTransactions, error) {
-	accessToken, err := c.GetValidAccessToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get access token: %w", err)
-	}
-
-	url := fmt.Sprintf("%s%s%s/transactions/", c.BaseURL, AccountsEndpoint, accountID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, parseGoCardlessError(resp)
-	}
-
 	var transactions dto.AccountTransactions
-	if err := json.NewDecoder(resp.Body).Decode(&transactions); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	err := c.do(ctx, request{
+		method:        http.MethodGet,
+		path:          fmt.Sprintf("%s%s/transactions/", AccountsEndpoint, accountID),
+		authenticated: true,
+	}, &transactions)
+	if err != nil {
+		return nil, err
 	}
 
 	return &transactions, nil
 }
 
-
 // GetTokenStatus returns the current token status
 func (c *Client) GetTokenStatus() map[string]interface{} {
 	c.mu.RLock()
@@ -431,15 +445,20 @@ func (c *Client) GetTokenStatus() map[string]interface{} {
 	}
 }
 
-// ClearTokens clears stored tokens
-func (c *Client) ClearTokens() {
+// ClearTokens clears the tokens, including the stored ones
+func (c *Client) ClearTokens(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.AccessToken = ""
-	c.RefreshToken = ""
-	c.AccessExpires = time.Time{}
-	c.RefreshExpires = time.Time{}
+	c.setTokensInternal(Tokens{})
+
+	if c.Store != nil {
+		if err := c.Store.Clear(ctx); err != nil {
+			return fmt.Errorf("failed to clear stored tokens: %w", err)
+		}
+	}
+
+	return nil
 }
 
 // Legacy methods for backward compatibility
@@ -0,0 +1,192 @@
+package gocardless_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+	"FinMa/pkg/gocardless"
+	"FinMa/pkg/gocardless/fake"
+)
+
+const sandboxInstitution = "SANDBOXFINANCE_SFIN0000"
+
+// newTestClient returns a client of a fake server that retries without waiting
+func newTestClient(t *testing.T, opts fake.Options) (*gocardless.Client, *fake.Server) {
+	t.Helper()
+	server := fake.NewServer(opts)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	client := gocardless.NewClient("secret-id", "secret-key")
+	client.BaseURL = srv.URL
+	client.InitialBackoff = time.Millisecond
+	client.MaxBackoff = time.Millisecond
+	return client, server
+}
+
+// linkedRequisition creates a requisition at the sandbox institution and links it
+func linkedRequisition(t *testing.T, client *gocardless.Client, server *fake.Server, userID uuid.UUID) *dto.GoCardlessGetRequisitionResponse {
+	t.Helper()
+	ctx := context.Background()
+
+	agreement, err := client.CreateEndUserAgreement(ctx, dto.GoCardlessCreateAgreementRequest{
+		InstitutionID:      sandboxInstitution,
+		MaxHistoricalDays:  90,
+		AccessValidForDays: 30,
+		AccessScope:        []string{"balances", "details", "transactions"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEndUserAgreement() error = %v", err)
+	}
+	created, err := client.CreateRequisition(ctx, userID, sandboxInstitution, "http://localhost/callback", agreement.ID)
+	if err != nil {
+		t.Fatalf("CreateRequisition() error = %v", err)
+	}
+	if created.Status != fake.StatusCreated || created.Link == "" {
+		t.Fatalf("created requisition = %+v, want status %s with a link", created, fake.StatusCreated)
+	}
+	if err := server.Link(created.ID); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+
+	requisition, err := client.GetRequisition(ctx, userID, created.ID)
+	if err != nil {
+		t.Fatalf("GetRequisition() error = %v", err)
+	}
+	return requisition
+}
+
+func TestClientLinkAndAccountData(t *testing.T) {
+	client, server := newTestClient(t, fake.Options{SecretID: "secret-id", SecretKey: "secret-key"})
+	ctx := context.Background()
+	userID := uuid.New()
+
+	requisition := linkedRequisition(t, client, server, userID)
+	if requisition.Status != fake.StatusLinked || len(requisition.Accounts) == 0 {
+		t.Fatalf("linked requisition = %+v, want status %s with accounts", requisition, fake.StatusLinked)
+	}
+
+	// The requisition of another user is not returned
+	if _, err := client.GetRequisition(ctx, uuid.New(), requisition.ID); !errors.Is(err, gocardless.ErrNotFound) {
+		t.Errorf("GetRequisition() of another user error = %v, want %v", err, gocardless.ErrNotFound)
+	}
+
+	accountID := requisition.Accounts[0]
+	details, err := client.GetAccountDetails(ctx, accountID)
+	if err != nil {
+		t.Fatalf("GetAccountDetails() error = %v", err)
+	}
+	if details.Account.IBAN == "" || details.Account.Currency == "" {
+		t.Errorf("account details = %+v, want an IBAN and a currency", details.Account)
+	}
+	balances, err := client.GetAccountBalances(ctx, accountID)
+	if err != nil {
+		t.Fatalf("GetAccountBalances() error = %v", err)
+	}
+	if len(balances.Balances) == 0 {
+		t.Error("GetAccountBalances() returned no balances")
+	}
+	transactions, err := client.GetAccountTransactions(ctx, accountID)
+	if err != nil {
+		t.Fatalf("GetAccountTransactions() error = %v", err)
+	}
+	if len(transactions.Transactions.Booked) == 0 {
+		t.Error("GetAccountTransactions() returned no booked transactions")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		client, _ := newTestClient(t, fake.Options{SecretID: "other-id", SecretKey: "other-key"})
+		if _, err := client.GetInstitutions(ctx, "GB"); !errors.Is(err, gocardless.ErrUnauthorized) {
+			t.Errorf("GetInstitutions() error = %v, want %v", err, gocardless.ErrUnauthorized)
+		}
+	})
+
+	t.Run("server errors are retried", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		server.InjectError(gocardless.InstitutionsEndpoint, http.StatusInternalServerError)
+		server.InjectError(gocardless.InstitutionsEndpoint, http.StatusServiceUnavailable)
+		institutions, err := client.GetInstitutions(ctx, "GB")
+		if err != nil || len(institutions) == 0 {
+			t.Errorf("GetInstitutions() = %d institutions, %v; want the institutions after retrying", len(institutions), err)
+		}
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		for i := 0; i <= client.MaxRetries; i++ {
+			server.InjectError(gocardless.InstitutionsEndpoint, http.StatusInternalServerError)
+		}
+		if _, err := client.GetInstitutions(ctx, "GB"); err == nil {
+			t.Error("GetInstitutions() error = nil, want the last server error")
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		server.InjectError(gocardless.InstitutionsEndpoint, http.StatusTooManyRequests)
+		_, err := client.GetInstitutions(ctx, "GB")
+		var rateLimitErr *gocardless.RateLimitError
+		if !errors.As(err, &rateLimitErr) || !errors.Is(err, gocardless.ErrRateLimited) {
+			t.Fatalf("GetInstitutions() error = %v, want a rate limit error", err)
+		}
+		if rateLimitErr.Scope != gocardless.RateLimitScopeGeneral || rateLimitErr.RetryAfter() <= 0 {
+			t.Errorf("rate limit error = %+v, want the general scope with a reset in the future", rateLimitErr)
+		}
+	})
+
+	t.Run("account daily limit", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{AccountDailyLimit: 1})
+		accountID := linkedRequisition(t, client, server, uuid.New()).Accounts[0]
+		if _, err := client.GetAccountBalances(ctx, accountID); err != nil {
+			t.Fatalf("first GetAccountBalances() error = %v", err)
+		}
+		_, err := client.GetAccountBalances(ctx, accountID)
+		var rateLimitErr *gocardless.RateLimitError
+		if !errors.As(err, &rateLimitErr) || rateLimitErr.Scope != gocardless.RateLimitScopeAccount || rateLimitErr.Limit != 1 {
+			t.Errorf("second GetAccountBalances() error = %v, want the account rate limit", err)
+		}
+	})
+
+	t.Run("suspended account", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		accountID := linkedRequisition(t, client, server, uuid.New()).Accounts[0]
+		if err := server.SuspendAccount(accountID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetAccountDetails(ctx, accountID); !errors.Is(err, gocardless.ErrAccountSuspended) {
+			t.Errorf("GetAccountDetails() error = %v, want %v", err, gocardless.ErrAccountSuspended)
+		}
+	})
+
+	t.Run("expired consent", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		requisition := linkedRequisition(t, client, server, uuid.New())
+		if err := server.SetRequisitionStatus(requisition.ID, fake.StatusExpired); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetAccountTransactions(ctx, requisition.Accounts[0]); !errors.Is(err, gocardless.ErrConsentExpired) {
+			t.Errorf("GetAccountTransactions() error = %v, want %v", err, gocardless.ErrConsentExpired)
+		}
+	})
+
+	t.Run("institution down", func(t *testing.T) {
+		client, server := newTestClient(t, fake.Options{})
+		client.MaxRetries = 0
+		accountID := linkedRequisition(t, client, server, uuid.New()).Accounts[0]
+		server.SetInstitutionDown(sandboxInstitution, true)
+		if _, err := client.GetAccountBalances(ctx, accountID); !errors.Is(err, gocardless.ErrInstitutionDown) {
+			t.Errorf("GetAccountBalances() error = %v, want %v", err, gocardless.ErrInstitutionDown)
+		}
+	})
+}
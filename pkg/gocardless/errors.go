@@ -2,9 +2,38 @@ package gocardless
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors classifying failed requests. Every error returned by the Client for an
+// API response matches one of them with errors.Is, except for unexpected
+// responses such as validation errors.
+var (
+	// ErrUnauthorized means GoCardless rejected the secret or the access token
+	ErrUnauthorized = errors.New("gocardless: authentication failed")
+	// ErrRateLimited means a rate limit was reached, see RateLimitError
+	ErrRateLimited = errors.New("gocardless: rate limit exceeded")
+	// ErrNotFound means the requested resource does not exist, or does not belong to the user
+	ErrNotFound = errors.New("gocardless: not found")
+	// ErrConsentExpired means the end-user agreement expired and the user has to reconnect
+	ErrConsentExpired = errors.New("gocardless: end-user consent expired")
+	// ErrAccountSuspended means the account can no longer be accessed
+	ErrAccountSuspended = errors.New("gocardless: account suspended")
+	// ErrInstitutionDown means the bank cannot be reached at the moment
+	ErrInstitutionDown = errors.New("gocardless: institution unavailable")
+)
+
+// GoCardless error types reported in the type field of error responses
+const (
+	errorTypeAccessExpired    = "AccessExpiredError"
+	errorTypeAccountSuspended = "AccountSuspendedError"
+	errorTypeService          = "ServiceError"
+	errorTypeConnection       = "ConnectionError"
 )
 
 // GoCardlessError represents an error response from the GoCardless API
@@ -36,6 +65,42 @@ func (e *GoCardlessError) Error() string {
 	return fmt.Sprintf("GoCardless API error (status %d)", e.StatusCode)
 }
 
+// Unwrap returns the error classifying the response, nil for unexpected
+// responses, so that errors.Is matches the sentinel errors of this package
+func (e *GoCardlessError) Unwrap() error {
+	switch {
+	case e.Type == errorTypeAccessExpired:
+		return ErrConsentExpired
+	case e.Type == errorTypeAccountSuspended:
+		return ErrAccountSuspended
+	case e.Type == errorTypeService || e.Type == errorTypeConnection:
+		return ErrInstitutionDown
+	}
+
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// Not every expired agreement is reported with its type
+		if strings.Contains(e.summary(), "End User Agreement") {
+			return ErrConsentExpired
+		}
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	}
+	return nil
+}
+
+// summary returns the summary of the error, which GoCardless reports either at
+// the top level or in the reference of a field
+func (e *GoCardlessError) summary() string {
+	if e.Reference != nil {
+		if summary, ok := e.Reference["summary"].(string); ok {
+			return summary
+		}
+	}
+	return e.Summary
+}
+
 // IsConflictError checks if the error is a conflict (409) or reference already exists (400)
 func (e *GoCardlessError) IsConflictError() bool {
 	if e.StatusCode == http.StatusConflict {
@@ -60,10 +125,81 @@ func parseGoCardlessError(resp *http.Response) error {
 
 	var gcError GoCardlessError
 	if err := json.Unmarshal(body, &gcError); err != nil {
-		// If we can't parse the error response, return a generic error
-		return fmt.Errorf("GoCardless API error (status %d): %s", resp.StatusCode, string(body))
+		// Not a JSON error response, e.g. from a proxy; keep the status to classify it
+		return &GoCardlessError{
+			StatusCode: resp.StatusCode,
+			Summary:    http.StatusText(resp.StatusCode),
+			Detail:     strings.TrimSpace(string(body)),
+		}
 	}
 
 	gcError.StatusCode = resp.StatusCode
 	return &gcError
 }
+
+// RateLimitError is returned when GoCardless rejects a request with 429 Too Many Requests
+type RateLimitError struct {
+	Scope   string    // RateLimitScopeGeneral or RateLimitScopeAccount
+	Limit   int       // Number of requests allowed in the current window
+	ResetAt time.Time // When requests will be accepted again
+	Detail  string
+}
+
+func (e *RateLimitError) Error() string {
+	msg := fmt.Sprintf("GoCardless rate limit exceeded (%s scope, limit %d), resets at %s",
+		e.Scope, e.Limit, e.ResetAt.Format(time.RFC3339))
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap makes errors.Is match ErrRateLimited
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// RetryAfter returns how long to wait before the request can be retried
+func (e *RateLimitError) RetryAfter() time.Duration {
+	if wait := time.Until(e.ResetAt); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// defaultRateLimitWait is used when a 429 response carries no reset information
+const defaultRateLimitWait = time.Minute
+
+// newRateLimitError builds a RateLimitError from a 429 response. The account
+// scope is reported when it is exhausted since it is the stricter limit.
+func newRateLimitError(resp *http.Response) *RateLimitError {
+	rateLimitErr := &RateLimitError{
+		Scope: RateLimitScopeGeneral,
+	}
+
+	for _, limit := range parseRateLimits(resp.Header) {
+		if limit.Scope == RateLimitScopeAccount && limit.Remaining > 0 {
+			continue
+		}
+		rateLimitErr.Scope = limit.Scope
+		rateLimitErr.Limit = limit.Limit
+		rateLimitErr.ResetAt = limit.ResetAt
+	}
+
+	if rateLimitErr.ResetAt.IsZero() {
+		wait, ok := parseRetryAfter(resp.Header)
+		if !ok {
+			wait = defaultRateLimitWait
+		}
+		rateLimitErr.ResetAt = time.Now().Add(wait)
+	}
+
+	if body, err := io.ReadAll(resp.Body); err == nil {
+		var gcError GoCardlessError
+		if json.Unmarshal(body, &gcError) == nil {
+			rateLimitErr.Detail = gcError.Detail
+		}
+	}
+
+	return rateLimitErr
+}
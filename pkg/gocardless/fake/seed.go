@@ -0,0 +1,452 @@
+package fake
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+)
+
+// institution is a seeded institution and the currency of its accounts
+type institution struct {
+	dto.Institution
+	currency string
+}
+
+var allFeatures = []string{
+	"account_selection", "business_accounts", "card_accounts", "corporate_accounts",
+	"payments", "pending_transactions", "private_accounts",
+}
+
+// seedInstitutions are the institutions served by the fake. Sandbox Finance
+// mirrors the sandbox institution of the real API.
+var seedInstitutions = []institution{
+	{
+		Institution: dto.Institution{
+			ID:                    "SANDBOXFINANCE_SFIN0000",
+			Name:                  "Sandbox Finance",
+			BIC:                   "SFIN0000",
+			TransactionTotalDays:  "90",
+			MaxAccessValidForDays: "90",
+			Countries:             []string{"XX"},
+			SupportedFeatures:     []string{},
+		},
+		currency: "EUR",
+	},
+	{
+		Institution: dto.Institution{
+			ID:                    "FAKEBANK_FBNKBEBB",
+			Name:                  "Fake Bank",
+			BIC:                   "FBNKBEBB",
+			TransactionTotalDays:  "730",
+			MaxAccessValidForDays: "180",
+			Countries:             []string{"BE", "NL", "LU"},
+			SupportedFeatures:     allFeatures,
+		},
+		currency: "EUR",
+	},
+	{
+		Institution: dto.Institution{
+			ID:                    "DEMOBANQUE_DMBQFRPP",
+			Name:                  "Demo Banque",
+			BIC:                   "DMBQFRPP",
+			TransactionTotalDays:  "540",
+			MaxAccessValidForDays: "180",
+			Countries:             []string{"FR", "BE"},
+			SupportedFeatures:     []string{"account_selection", "pending_transactions", "private_accounts"},
+		},
+		currency: "EUR",
+	},
+	{
+		Institution: dto.Institution{
+			ID:                    "TESTSPARKASSE_TSPKDEFF",
+			Name:                  "Test Sparkasse",
+			BIC:                   "TSPKDEFF",
+			TransactionTotalDays:  "365",
+			MaxAccessValidForDays: "90",
+			Countries:             []string{"DE", "AT"},
+			SupportedFeatures:     []string{"card_accounts", "private_accounts"},
+		},
+		currency: "EUR",
+	},
+	{
+		Institution: dto.Institution{
+			ID:                    "MOCKBANK_MOCKGB2L",
+			Name:                  "Mock Bank",
+			BIC:                   "MOCKGB2L",
+			TransactionTotalDays:  "730",
+			MaxAccessValidForDays: "90",
+			Countries:             []string{"GB", "IE"},
+			SupportedFeatures:     []string{"account_selection", "business_accounts", "pending_transactions", "private_accounts"},
+		},
+		currency: "GBP",
+	},
+}
+
+const accountOwner = "Jane Doe"
+
+// Counterparties of the generated transactions
+var (
+	employer = counterparty{name: "Acme Industries", iban: "BE71096123456769"}
+	landlord = counterparty{name: "Parkside Residences", iban: "BE62510007547061"}
+	gym      = counterparty{name: "FitLife Gym", iban: "NL91ABNA0417164300"}
+	utility  = counterparty{name: "Volta Energy", iban: "BE68539007547034"}
+
+	groceries   = []string{"Delhaize", "Carrefour Market", "Aldi", "Lidl", "Colruyt"}
+	restaurants = []string{"Pizza Roma", "Le Petit Bistro", "Sushi Bar Koi", "Burger Lab"}
+	fuel        = []string{"TotalEnergies", "Shell", "Q8"}
+)
+
+// Bank transaction codes (ISO 20022 domain, family and sub-family)
+const (
+	codeCardPayment    = "PMNT-CCRD-POSD"
+	codeDirectDebit    = "PMNT-IDDT-ESDD"
+	codeStandingOrder  = "PMNT-ICDT-STDO"
+	codeSentTransfer   = "PMNT-ICDT-ESCT"
+	codeReceivedCredit = "PMNT-RCDT-ESCT"
+	codeInterest       = "ACMT-MCOP-INTR"
+)
+
+type counterparty struct {
+	name string
+	iban string
+}
+
+// account is a generated bank account with its full history
+type account struct {
+	requisitionID string
+	institutionID string
+	details       accountDetails
+	balances      []balance
+	booked        []transaction
+	pending       []transaction
+	suspended     bool
+}
+
+type accountDetails struct {
+	ResourceID      string `json:"resourceId"`
+	IBAN            string `json:"iban"`
+	BIC             string `json:"bic"`
+	Currency        string `json:"currency"`
+	OwnerName       string `json:"ownerName"`
+	Name            string `json:"name"`
+	Product         string `json:"product"`
+	CashAccountType string `json:"cashAccountType"`
+	Status          string `json:"status"`
+}
+
+type amount struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type balance struct {
+	BalanceAmount      amount `json:"balanceAmount"`
+	BalanceType        string `json:"balanceType"`
+	ReferenceDate      string `json:"referenceDate"`
+	LastChangeDateTime string `json:"lastChangeDateTime,omitempty"`
+}
+
+type accountReference struct {
+	IBAN string `json:"iban"`
+}
+
+// transaction has the fields GoCardless returns for most institutions
+type transaction struct {
+	TransactionID                     string            `json:"transactionId,omitempty"`
+	InternalTransactionID             string            `json:"internalTransactionId,omitempty"`
+	EntryReference                    string            `json:"entryReference,omitempty"`
+	EndToEndID                        string            `json:"endToEndId,omitempty"`
+	BookingDate                       string            `json:"bookingDate,omitempty"`
+	ValueDate                         string            `json:"valueDate,omitempty"`
+	BookingDateTime                   string            `json:"bookingDateTime,omitempty"`
+	TransactionAmount                 amount            `json:"transactionAmount"`
+	CreditorName                      string            `json:"creditorName,omitempty"`
+	CreditorAccount                   *accountReference `json:"creditorAccount,omitempty"`
+	DebtorName                        string            `json:"debtorName,omitempty"`
+	DebtorAccount                     *accountReference `json:"debtorAccount,omitempty"`
+	RemittanceInformationUnstructured string            `json:"remittanceInformationUnstructured,omitempty"`
+	RemittanceInformationStructured   string            `json:"remittanceInformationStructured,omitempty"`
+	BankTransactionCode               string            `json:"bankTransactionCode,omitempty"`
+	ProprietaryBankTransactionCode    string            `json:"proprietaryBankTransactionCode,omitempty"`
+	MerchantCategoryCode              string            `json:"merchantCategoryCode,omitempty"`
+
+	cents int64
+}
+
+// generateAccounts creates the current and savings accounts linked by a
+// requisition, with a history of historyDays up to now. The history is
+// derived from the requisition ID, so it is the same every time a
+// requisition is linked on a given day.
+func generateAccounts(requisitionID string, inst institution, historyDays int, now time.Time) []*account {
+	hash := fnv.New64a()
+	hash.Write([]byte(requisitionID))
+	rng := rand.New(rand.NewSource(int64(hash.Sum64())))
+
+	current := newAccount(rng, requisitionID, inst, "Current Account", "CACC")
+	savings := newAccount(rng, requisitionID, inst, "Savings Account", "SVGS")
+	currentIBAN := &accountReference{IBAN: current.details.IBAN}
+	savingsIBAN := &accountReference{IBAN: savings.details.IBAN}
+
+	today := now.Truncate(24 * time.Hour)
+	for day := today.AddDate(0, 0, -historyDays+1); !day.After(today); day = day.AddDate(0, 0, 1) {
+		month := day.Format("January 2006")
+
+		switch day.Day() {
+		case 1:
+			current.book(rng, day, transaction{
+				cents:                             -95000,
+				CreditorName:                      landlord.name,
+				CreditorAccount:                   &accountReference{IBAN: landlord.iban},
+				RemittanceInformationUnstructured: "Rent " + month,
+				BankTransactionCode:               codeStandingOrder,
+			})
+		case 3:
+			current.book(rng, day, transaction{
+				cents:                             -2990,
+				CreditorName:                      gym.name,
+				CreditorAccount:                   &accountReference{IBAN: gym.iban},
+				RemittanceInformationUnstructured: "Membership " + month,
+				BankTransactionCode:               codeDirectDebit,
+			})
+		case 7:
+			// The streaming service raised its price two months ago
+			cents := int64(-1399)
+			if day.After(today.AddDate(0, -2, 0)) {
+				cents = -1599
+			}
+			current.card(rng, day, "Streamly", "4899", cents)
+		case 15:
+			current.card(rng, day, "Tunewave", "5815", -1099)
+		case 20:
+			current.book(rng, day, transaction{
+				cents:                           -(8000 + rng.Int63n(2500)),
+				CreditorName:                    utility.name,
+				CreditorAccount:                 &accountReference{IBAN: utility.iban},
+				RemittanceInformationStructured: structuredReference(rng),
+				BankTransactionCode:             codeDirectDebit,
+			})
+		case 25:
+			current.book(rng, day, transaction{
+				cents:                             285000,
+				DebtorName:                        employer.name,
+				DebtorAccount:                     &accountReference{IBAN: employer.iban},
+				RemittanceInformationUnstructured: "Salary " + month,
+				BankTransactionCode:               codeReceivedCredit,
+			})
+		case 26:
+			current.book(rng, day, transaction{
+				cents:                             -30000,
+				CreditorName:                      accountOwner,
+				CreditorAccount:                   savingsIBAN,
+				RemittanceInformationUnstructured: "Monthly savings",
+				BankTransactionCode:               codeSentTransfer,
+			})
+			savings.book(rng, day, transaction{
+				cents:                             30000,
+				DebtorName:                        accountOwner,
+				DebtorAccount:                     currentIBAN,
+				RemittanceInformationUnstructured: "Monthly savings",
+				BankTransactionCode:               codeReceivedCredit,
+			})
+		}
+
+		if day.YearDay() == 1 {
+			savings.book(rng, day, transaction{
+				cents:                             1500 + rng.Int63n(4500),
+				RemittanceInformationUnstructured: fmt.Sprintf("Interest %d", day.Year()-1),
+				BankTransactionCode:               codeInterest,
+			})
+		}
+
+		if rng.Float64() < 0.4 {
+			current.card(rng, day, pick(rng, groceries), "5411", -(1500 + rng.Int63n(10500)))
+		}
+		if rng.Float64() < 0.15 {
+			current.card(rng, day, pick(rng, restaurants), "5812", -(1200 + rng.Int63n(5300)))
+		}
+		if rng.Float64() < 0.07 {
+			current.card(rng, day, pick(rng, fuel), "5541", -(4000 + rng.Int63n(5000)))
+		}
+	}
+
+	// Card payments that are not booked yet
+	for i := 0; i < 2; i++ {
+		cents := -(500 + rng.Int63n(6000))
+		current.pending = append(current.pending, transaction{
+			cents:                             cents,
+			InternalTransactionID:             newID(rng),
+			ValueDate:                         today.Format("2006-01-02"),
+			TransactionAmount:                 amount{Amount: formatCents(cents)},
+			CreditorName:                      pick(rng, groceries),
+			RemittanceInformationUnstructured: "Card payment",
+			BankTransactionCode:               codeCardPayment,
+			MerchantCategoryCode:              "5411",
+		})
+	}
+
+	current.finish(rng, 150000+rng.Int63n(350000), inst.currency, now)
+	savings.finish(rng, 500000+rng.Int63n(1500000), inst.currency, now)
+
+	return []*account{current, savings}
+}
+
+func newAccount(rng *rand.Rand, requisitionID string, inst institution, name, cashAccountType string) *account {
+	country := inst.Countries[0]
+	if country == "XX" {
+		country = "NL"
+	}
+
+	return &account{
+		requisitionID: requisitionID,
+		institutionID: inst.ID,
+		details: accountDetails{
+			ResourceID:      uuid.Must(uuid.NewRandomFromReader(rng)).String(),
+			IBAN:            generateIBAN(rng, country, inst.BIC[:4]),
+			BIC:             inst.BIC,
+			Currency:        inst.currency,
+			OwnerName:       accountOwner,
+			Name:            name,
+			Product:         name,
+			CashAccountType: cashAccountType,
+			Status:          "enabled",
+		},
+	}
+}
+
+// book adds a booked transfer or direct debit to the account
+func (a *account) book(rng *rand.Rand, day time.Time, tx transaction) {
+	n := len(a.booked) + 1
+	tx.TransactionID = fmt.Sprintf("%s-%05d", strings.ToUpper(a.details.ResourceID[:8]), n)
+	tx.InternalTransactionID = newID(rng)
+	tx.EntryReference = fmt.Sprintf("%s%05d", day.Format("20060102"), n)
+	tx.BookingDate = day.Format("2006-01-02")
+	tx.BookingDateTime = day.Add(time.Duration(6+rng.Intn(14))*time.Hour + time.Duration(rng.Intn(60))*time.Minute).Format(time.RFC3339)
+	if tx.ValueDate == "" {
+		tx.ValueDate = tx.BookingDate
+	}
+	if tx.EndToEndID == "" {
+		tx.EndToEndID = "NOTPROVIDED"
+		if tx.BankTransactionCode != codeCardPayment && tx.BankTransactionCode != codeInterest {
+			tx.EndToEndID = fmt.Sprintf("E2E%s%06d", day.Format("20060102"), rng.Intn(1000000))
+		}
+	}
+	tx.TransactionAmount.Amount = formatCents(tx.cents)
+	tx.ProprietaryBankTransactionCode = tx.BankTransactionCode
+	a.booked = append(a.booked, tx)
+}
+
+// card adds a card payment, booked the day after it was made
+func (a *account) card(rng *rand.Rand, day time.Time, merchant, mcc string, cents int64) {
+	a.book(rng, day, transaction{
+		cents:                             cents,
+		ValueDate:                         day.AddDate(0, 0, -1).Format("2006-01-02"),
+		CreditorName:                      merchant,
+		RemittanceInformationUnstructured: "Card payment " + merchant,
+		BankTransactionCode:               codeCardPayment,
+		MerchantCategoryCode:              mcc,
+	})
+}
+
+// finish sets the currency and balances of the account, starting from its
+// opening balance, and orders the transactions newest first like GoCardless
+func (a *account) finish(rng *rand.Rand, opening int64, currency string, now time.Time) {
+	booked := opening
+	for i := range a.booked {
+		a.booked[i].TransactionAmount.Currency = currency
+		booked += a.booked[i].cents
+	}
+	available := booked
+	for i := range a.pending {
+		a.pending[i].TransactionAmount.Currency = currency
+		available += a.pending[i].cents
+	}
+
+	sort.SliceStable(a.booked, func(i, j int) bool {
+		return a.booked[i].BookingDateTime > a.booked[j].BookingDateTime
+	})
+
+	today := now.Format("2006-01-02")
+	lastChange := now.Add(-time.Duration(rng.Intn(120)) * time.Minute).Format(time.RFC3339)
+	a.balances = []balance{
+		{BalanceAmount: amount{Amount: formatCents(available), Currency: currency}, BalanceType: "interimAvailable", ReferenceDate: today, LastChangeDateTime: lastChange},
+		{BalanceAmount: amount{Amount: formatCents(booked), Currency: currency}, BalanceType: "interimBooked", ReferenceDate: today, LastChangeDateTime: lastChange},
+		{BalanceAmount: amount{Amount: formatCents(booked), Currency: currency}, BalanceType: "closingBooked", ReferenceDate: now.AddDate(0, 0, -1).Format("2006-01-02")},
+	}
+}
+
+// formatCents formats an amount in cents the way GoCardless does, e.g. "-12.50"
+func formatCents(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// generateIBAN creates an IBAN with valid check digits from a bank code and random account number
+func generateIBAN(rng *rand.Rand, country, bankCode string) string {
+	bban := strings.ToUpper(bankCode) + fmt.Sprintf("%012d", rng.Int63n(1_000_000_000_000))
+	return country + fmt.Sprintf("%02d", 98-ibanMod97(bban+country+"00")) + bban
+}
+
+// ibanMod97 computes the ISO 7064 remainder of an IBAN, letters counting as 10 to 35
+func ibanMod97(s string) int {
+	remainder := 0
+	for _, r := range s {
+		var digits string
+		if r >= 'A' && r <= 'Z' {
+			digits = fmt.Sprint(int(r-'A') + 10)
+		} else {
+			digits = string(r)
+		}
+		for _, d := range digits {
+			remainder = (remainder*10 + int(d-'0')) % 97
+		}
+	}
+	return remainder
+}
+
+// structuredReference creates a Belgian structured communication, e.g. +++123/4567/89002+++
+func structuredReference(rng *rand.Rand) string {
+	base := rng.Int63n(10_000_000_000)
+	check := base % 97
+	if check == 0 {
+		check = 97
+	}
+	ref := fmt.Sprintf("%010d%02d", base, check)
+	return fmt.Sprintf("+++%s/%s/%s+++", ref[:3], ref[3:7], ref[7:])
+}
+
+// newID creates a hexadecimal ID like the internal transaction IDs of GoCardless
+func newID(rng *rand.Rand) string {
+	return fmt.Sprintf("%016x%016x", rng.Uint64(), rng.Uint64())
+}
+
+func pick(rng *rand.Rand, values []string) string {
+	return values[rng.Intn(len(values))]
+}
+
+// logoSVG draws a logo with the initials of an institution
+func logoSVG(inst institution) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(inst.ID))
+	hue := hash.Sum32() % 360
+
+	var initials string
+	for _, word := range strings.Fields(inst.Name) {
+		initials += string([]rune(word)[0])
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="64" height="64" viewBox="0 0 64 64">`+
+		`<rect width="64" height="64" rx="12" fill="hsl(%d,55%%,45%%)"/>`+
+		`<text x="32" y="40" font-family="sans-serif" font-size="22" font-weight="bold" fill="#fff" text-anchor="middle">%s</text>`+
+		`</svg>`, hue, initials)
+}
@@ -0,0 +1,819 @@
+// Package fake implements an in-memory GoCardless Bank Account Data API for
+// development and tests. It serves seeded sandbox institutions, issues tokens,
+// agreements and requisitions, and generates accounts with a deterministic
+// transaction history once a requisition is linked.
+//
+// In tests, serve it with httptest and point a client at it:
+//
+//	srv := httptest.NewServer(fake.NewServer(fake.Options{}))
+//	defer srv.Close()
+//	client := gocardless.NewClient("secret-id", "secret-key")
+//	client.BaseURL = srv.URL
+//
+// Requisitions are linked by visiting their link, like a user giving consent
+// at the bank, or directly with Server.Link.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"FinMa/dto"
+)
+
+// Requisition statuses
+const (
+	StatusCreated  = "CR"
+	StatusLinked   = "LN"
+	StatusRejected = "RJ"
+	StatusExpired  = "EX"
+)
+
+// Rate limit headers, as sent by GoCardless
+const (
+	headerRateLimit                 = "HTTP_X_RATELIMIT_LIMIT"
+	headerRateLimitRemaining        = "HTTP_X_RATELIMIT_REMAINING"
+	headerRateLimitReset            = "HTTP_X_RATELIMIT_RESET"
+	headerAccountRateLimit          = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_LIMIT"
+	headerAccountRateLimitRemaining = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_REMAINING"
+	headerAccountRateLimitReset     = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET"
+)
+
+// Simulated general rate limit, reported on random 429 responses
+const (
+	generalRateLimit       = 100
+	generalRateLimitWindow = time.Minute
+)
+
+// Options configures the fake server. The zero value serves every request
+// immediately and without failures.
+type Options struct {
+	// SecretID and SecretKey are the credentials accepted by the token
+	// endpoint. Any credentials are accepted when they are empty.
+	SecretID  string
+	SecretKey string
+
+	// BaseURL is the public URL of the server, used in requisition links and
+	// institution logos. Defaults to the host of each request.
+	BaseURL string
+
+	// Latency is added to every response, plus a random delay of up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// RateLimitRate and ErrorRate are the fractions of API requests, between 0
+	// and 1, answered with 429 Too Many Requests and 500 Internal Server Error
+	RateLimitRate float64
+	ErrorRate     float64
+
+	// AccountDailyLimit is the number of successful calls allowed per day to
+	// each endpoint of an account, like the GoCardless account success limit.
+	// Zero means unlimited.
+	AccountDailyLimit int
+
+	// Token lifetimes, defaulting to the GoCardless ones of 24 hours and 30 days
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Seed makes the random latency and failures reproducible
+	Seed int64
+}
+
+// Server is the fake GoCardless API. It implements http.Handler.
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu            sync.Mutex
+	rng           *rand.Rand
+	institutions  map[string]institution
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]time.Time
+	agreements    map[string]*dto.GoCardlessAgreement
+	requisitions  map[string]*dto.GoCardlessGetRequisitionResponse
+	accounts      map[string]*account
+	// accountCalls counts successful calls per account endpoint and day
+	accountCalls map[string]int
+	// down lists institutions whose accounts cannot be reached
+	down   map[string]bool
+	faults []fault
+}
+
+// fault is an error injected into the next request matching a path prefix
+type fault struct {
+	pathPrefix string
+	status     int
+}
+
+// apiError is the error body returned by GoCardless
+type apiError struct {
+	Summary    string `json:"summary"`
+	Detail     string `json:"detail"`
+	Type       string `json:"type,omitempty"`
+	StatusCode int    `json:"status_code"`
+}
+
+// NewServer creates a fake server seeded with the sandbox institutions
+func NewServer(opts Options) *Server {
+	if opts.AccessTokenTTL <= 0 {
+		opts.AccessTokenTTL = 24 * time.Hour
+	}
+	if opts.RefreshTokenTTL <= 0 {
+		opts.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := &Server{
+		opts:          opts,
+		mux:           http.NewServeMux(),
+		rng:           rand.New(rand.NewSource(seed)),
+		institutions:  make(map[string]institution),
+		accessTokens:  make(map[string]time.Time),
+		refreshTokens: make(map[string]time.Time),
+		agreements:    make(map[string]*dto.GoCardlessAgreement),
+		requisitions:  make(map[string]*dto.GoCardlessGetRequisitionResponse),
+		accounts:      make(map[string]*account),
+		accountCalls:  make(map[string]int),
+		down:          make(map[string]bool),
+	}
+	for _, inst := range seedInstitutions {
+		s.institutions[inst.ID] = inst
+	}
+
+	s.mux.HandleFunc("POST /token/new/", s.api(s.handleNewToken))
+	s.mux.HandleFunc("POST /token/refresh/", s.api(s.handleRefreshToken))
+	s.mux.HandleFunc("GET /institutions/{$}", s.authenticated(s.handleListInstitutions))
+	s.mux.HandleFunc("GET /institutions/{id}/", s.authenticated(s.handleGetInstitution))
+	s.mux.HandleFunc("POST /agreements/enduser/", s.authenticated(s.handleCreateAgreement))
+	s.mux.HandleFunc("GET /agreements/enduser/{id}/", s.authenticated(s.handleGetAgreement))
+	s.mux.HandleFunc("POST /requisitions/", s.authenticated(s.handleCreateRequisition))
+	s.mux.HandleFunc("GET /requisitions/{id}/", s.authenticated(s.handleGetRequisition))
+	s.mux.HandleFunc("DELETE /requisitions/{id}/", s.authenticated(s.handleDeleteRequisition))
+	s.mux.HandleFunc("GET /accounts/{id}/details/", s.authenticated(s.accountEndpoint("details", s.handleAccountDetails)))
+	s.mux.HandleFunc("GET /accounts/{id}/balances/", s.authenticated(s.accountEndpoint("balances", s.handleAccountBalances)))
+	s.mux.HandleFunc("GET /accounts/{id}/transactions/", s.authenticated(s.accountEndpoint("transactions", s.handleAccountTransactions)))
+
+	// Not part of the API: the consent page of the bank and the institution logos
+	s.mux.HandleFunc("GET /link/{id}/", s.handleConsent)
+	s.mux.HandleFunc("GET /logos/{file}", s.handleLogo)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Link links a requisition as if the user gave consent at the bank
+func (s *Server) Link(requisitionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requisition, ok := s.requisitions[requisitionID]
+	if !ok {
+		return fmt.Errorf("requisition %s not found", requisitionID)
+	}
+	return s.link(requisition)
+}
+
+// SetRequisitionStatus changes the status of a requisition, e.g. to expire or reject it
+func (s *Server) SetRequisitionStatus(requisitionID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requisition, ok := s.requisitions[requisitionID]
+	if !ok {
+		return fmt.Errorf("requisition %s not found", requisitionID)
+	}
+	requisition.Status = status
+	return nil
+}
+
+// SuspendAccount makes every call to an account fail as suspended
+func (s *Server) SuspendAccount(accountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("account %s not found", accountID)
+	}
+	acc.suspended = true
+	return nil
+}
+
+// SetInstitutionDown makes the accounts of an institution unreachable, or reachable again
+func (s *Server) SetInstitutionDown(institutionID string, down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.down[institutionID] = down
+}
+
+// InjectError makes the next API request whose path starts with pathPrefix
+// fail with the given status code. Errors are consumed in the order they were injected.
+func (s *Server) InjectError(pathPrefix string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, fault{pathPrefix: pathPrefix, status: status})
+}
+
+// api wraps an API endpoint with the simulated latency and failures
+func (s *Server) api(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.delay(r) {
+			return
+		}
+
+		s.mu.Lock()
+		status := s.nextFault(r.URL.Path)
+		s.mu.Unlock()
+
+		switch status {
+		case 0:
+			next(w, r)
+		case http.StatusTooManyRequests:
+			w.Header().Set(headerRateLimit, strconv.Itoa(generalRateLimit))
+			w.Header().Set(headerRateLimitRemaining, "0")
+			w.Header().Set(headerRateLimitReset, strconv.Itoa(int(generalRateLimitWindow.Seconds())))
+			writeError(w, status, "RateLimitError", "Rate limit exceeded",
+				fmt.Sprintf("Rate limit exceeded. Please try again in %d seconds.", int(generalRateLimitWindow.Seconds())))
+		default:
+			writeError(w, status, "", http.StatusText(status), "Simulated failure")
+		}
+	}
+}
+
+// authenticated wraps an API endpoint that requires an access token
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return s.api(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		s.mu.Lock()
+		expires, ok := s.accessTokens[token]
+		s.mu.Unlock()
+
+		if !ok || time.Now().After(expires) {
+			writeError(w, http.StatusUnauthorized, "", "Invalid token", "Token is invalid or expired")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// delay sleeps for the simulated latency. It returns false if the request was cancelled meanwhile.
+func (s *Server) delay(r *http.Request) bool {
+	d := s.opts.Latency
+	if s.opts.Jitter > 0 {
+		s.mu.Lock()
+		d += time.Duration(s.rng.Int63n(int64(s.opts.Jitter)))
+		s.mu.Unlock()
+	}
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// nextFault returns the status code a request must fail with, or 0 (must be called with the lock held)
+func (s *Server) nextFault(path string) int {
+	for i, f := range s.faults {
+		if strings.HasPrefix(path, f.pathPrefix) {
+			s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			return f.status
+		}
+	}
+
+	if s.opts.ErrorRate > 0 && s.rng.Float64() < s.opts.ErrorRate {
+		return http.StatusInternalServerError
+	}
+	if s.opts.RateLimitRate > 0 && s.rng.Float64() < s.opts.RateLimitRate {
+		return http.StatusTooManyRequests
+	}
+	return 0
+}
+
+func (s *Server) handleNewToken(w http.ResponseWriter, r *http.Request) {
+	var req dto.TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "", "Invalid request body", err.Error())
+		return
+	}
+
+	if s.opts.SecretID != "" && (req.SecretID != s.opts.SecretID || req.SecretKey != s.opts.SecretKey) {
+		writeError(w, http.StatusUnauthorized, "", "Authentication failed", "No active account found with the given credentials")
+		return
+	}
+
+	s.mu.Lock()
+	access := issueToken(s.accessTokens, s.opts.AccessTokenTTL)
+	refresh := issueToken(s.refreshTokens, s.opts.RefreshTokenTTL)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, dto.TokenResponse{
+		Access:         access,
+		AccessExpires:  int(s.opts.AccessTokenTTL.Seconds()),
+		Refresh:        refresh,
+		RefreshExpires: int(s.opts.RefreshTokenTTL.Seconds()),
+	})
+}
+
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req dto.GoCardlessRefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "", "Invalid request body", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	expires, ok := s.refreshTokens[req.Refresh]
+	var access string
+	if ok && time.Now().Before(expires) {
+		access = issueToken(s.accessTokens, s.opts.AccessTokenTTL)
+	}
+	s.mu.Unlock()
+
+	if access == "" {
+		writeError(w, http.StatusUnauthorized, "", "Invalid token", "Token is invalid or expired")
+		return
+	}
+
+	// Refreshing only issues a new access token, the refresh token stays the same
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access":         access,
+		"access_expires": int(s.opts.AccessTokenTTL.Seconds()),
+	})
+}
+
+func (s *Server) handleListInstitutions(w http.ResponseWriter, r *http.Request) {
+	country := strings.ToUpper(r.URL.Query().Get("country"))
+
+	institutions := make([]dto.Institution, 0, len(seedInstitutions))
+	for _, inst := range seedInstitutions {
+		if country == "" || containsFold(inst.Countries, country) {
+			institutions = append(institutions, s.publicInstitution(r, inst))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, institutions)
+}
+
+func (s *Server) handleGetInstitution(w http.ResponseWriter, r *http.Request) {
+	inst, ok := s.institutions[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Not found.", "Institution not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.publicInstitution(r, inst))
+}
+
+func (s *Server) handleCreateAgreement(w http.ResponseWriter, r *http.Request) {
+	var req dto.GoCardlessCreateAgreementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "", "Invalid request body", err.Error())
+		return
+	}
+
+	inst, ok := s.institutions[req.InstitutionID]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "", "Unknown Institution ID", fmt.Sprintf("Get Institution IDs from /institutions/?country=%s", "{$COUNTRY_CODE}"))
+		return
+	}
+
+	if req.MaxHistoricalDays == 0 {
+		req.MaxHistoricalDays = 90
+	}
+	if req.AccessValidForDays == 0 {
+		req.AccessValidForDays = 90
+	}
+	if len(req.AccessScope) == 0 {
+		req.AccessScope = []string{"balances", "details", "transactions"}
+	}
+
+	if maxDays, _ := strconv.Atoi(inst.TransactionTotalDays); req.MaxHistoricalDays < 1 || req.MaxHistoricalDays > maxDays {
+		writeError(w, http.StatusBadRequest, "", "Incorrect max_historical_days",
+			fmt.Sprintf("max_historical_days must be > 0 and <= %d for %s", maxDays, inst.ID))
+		return
+	}
+	if maxDays, _ := strconv.Atoi(inst.MaxAccessValidForDays); req.AccessValidForDays < 1 || req.AccessValidForDays > maxDays {
+		writeError(w, http.StatusBadRequest, "", "Incorrect access_valid_for_days",
+			fmt.Sprintf("access_valid_for_days must be > 0 and <= %d for %s", maxDays, inst.ID))
+		return
+	}
+
+	agreement := &dto.GoCardlessAgreement{
+		ID:                 uuid.NewString(),
+		Created:            time.Now().UTC(),
+		InstitutionID:      req.InstitutionID,
+		MaxHistoricalDays:  req.MaxHistoricalDays,
+		AccessValidForDays: req.AccessValidForDays,
+		AccessScope:        req.AccessScope,
+	}
+
+	s.mu.Lock()
+	s.agreements[agreement.ID] = agreement
+	response := *agreement
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) handleGetAgreement(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	agreement, ok := s.agreements[r.PathValue("id")]
+	var response dto.GoCardlessAgreement
+	if ok {
+		response = *agreement
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Not found.", "End user agreement not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleCreateRequisition(w http.ResponseWriter, r *http.Request) {
+	var req dto.GoCardlessCreateRequisitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "", "Invalid request body", err.Error())
+		return
+	}
+
+	if _, ok := s.institutions[req.InstitutionID]; !ok {
+		writeError(w, http.StatusBadRequest, "", "Unknown Institution ID", "Get Institution IDs from /institutions/")
+		return
+	}
+	if req.RedirectURL == "" {
+		writeError(w, http.StatusBadRequest, "", "Invalid redirect", "The redirect URL is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.requisitions {
+		if req.Reference != "" && existing.Reference == req.Reference {
+			// GoCardless reports field errors keyed by the field name
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"reference": map[string]string{
+					"summary": "Client reference must be unique",
+					"detail":  fmt.Sprintf("Client reference '%s' already exists", req.Reference),
+				},
+				"status_code": http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	agreementID := req.Agreement
+	if agreementID == "" {
+		// Without an agreement GoCardless applies a default one of 90 days
+		agreement := &dto.GoCardlessAgreement{
+			ID:                 uuid.NewString(),
+			Created:            time.Now().UTC(),
+			InstitutionID:      req.InstitutionID,
+			MaxHistoricalDays:  90,
+			AccessValidForDays: 90,
+			AccessScope:        []string{"balances", "details", "transactions"},
+		}
+		s.agreements[agreement.ID] = agreement
+		agreementID = agreement.ID
+	} else if agreement, ok := s.agreements[agreementID]; !ok || agreement.InstitutionID != req.InstitutionID {
+		writeError(w, http.StatusBadRequest, "", "Invalid agreement",
+			fmt.Sprintf("Agreement %s does not exist or does not belong to institution %s", agreementID, req.InstitutionID))
+		return
+	}
+
+	id := uuid.NewString()
+	requisition := &dto.GoCardlessGetRequisitionResponse{
+		ID:            id,
+		Created:       time.Now().UTC().Format(time.RFC3339),
+		RedirectURL:   req.RedirectURL,
+		Status:        StatusCreated,
+		InstitutionID: req.InstitutionID,
+		Agreement:     agreementID,
+		Reference:     req.Reference,
+		Accounts:      []string{},
+		UserLanguage:  "EN",
+		Link:          s.baseURL(r) + "/link/" + id + "/",
+	}
+	s.requisitions[id] = requisition
+
+	writeJSON(w, http.StatusCreated, dto.GoCardlessCreateRequisitionResponse(*requisition))
+}
+
+func (s *Server) handleGetRequisition(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	requisition, ok := s.requisitions[r.PathValue("id")]
+	var response dto.GoCardlessGetRequisitionResponse
+	if ok {
+		response = *requisition
+		response.Accounts = append([]string{}, requisition.Accounts...)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Not found.", "Requisition not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleDeleteRequisition(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	s.mu.Lock()
+	requisition, ok := s.requisitions[id]
+	if ok {
+		for _, accountID := range requisition.Accounts {
+			delete(s.accounts, accountID)
+		}
+		delete(s.agreements, requisition.Agreement)
+		delete(s.requisitions, id)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "", "Not found.", "Requisition not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"summary": "Requisition deleted",
+		"detail":  fmt.Sprintf("Requisition %s deleted with all its End User Agreements", id),
+	})
+}
+
+// accountEndpoint wraps an account endpoint with the checks GoCardless makes
+// before returning account data, and counts successful calls against the daily limit
+func (s *Server) accountEndpoint(endpoint string, next func(http.ResponseWriter, *http.Request, *account)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := r.PathValue("id")
+
+		s.mu.Lock()
+		acc, status, body := s.checkAccount(accountID)
+		if acc == nil {
+			s.mu.Unlock()
+			writeJSON(w, status, body)
+			return
+		}
+
+		now := time.Now().UTC()
+		resetIn := now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+		callsKey := fmt.Sprintf("%s/%s/%s", accountID, endpoint, now.Format("2006-01-02"))
+
+		if limit := s.opts.AccountDailyLimit; limit > 0 {
+			used := s.accountCalls[callsKey]
+			w.Header().Set(headerAccountRateLimit, strconv.Itoa(limit))
+			w.Header().Set(headerAccountRateLimitReset, strconv.Itoa(int(resetIn.Seconds())))
+
+			if used >= limit {
+				s.mu.Unlock()
+				w.Header().Set(headerAccountRateLimitRemaining, "0")
+				writeError(w, http.StatusTooManyRequests, "RateLimitError", "Rate limit exceeded",
+					fmt.Sprintf("The daily request limit set by the Institution has been exceeded. Please try again in %d seconds.", int(resetIn.Seconds())))
+				return
+			}
+
+			s.accountCalls[callsKey] = used + 1
+			w.Header().Set(headerAccountRateLimitRemaining, strconv.Itoa(limit-used-1))
+		}
+		s.mu.Unlock()
+
+		next(w, r, acc)
+	}
+}
+
+// checkAccount returns an account if its data can be accessed, or the status
+// and error body GoCardless would answer with (must be called with the lock held)
+func (s *Server) checkAccount(accountID string) (*account, int, interface{}) {
+	acc, ok := s.accounts[accountID]
+	if !ok {
+		return nil, http.StatusNotFound, apiError{
+			Summary:    "Not found.",
+			Detail:     fmt.Sprintf("Account ID %s not found", accountID),
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	requisition := s.requisitions[acc.requisitionID]
+	agreement := s.agreements[requisition.Agreement]
+	expired := requisition.Status == StatusExpired ||
+		(agreement.Accepted != nil && time.Now().After(agreement.Accepted.AddDate(0, 0, agreement.AccessValidForDays)))
+	if expired {
+		return nil, http.StatusUnauthorized, apiError{
+			Summary:    "End User Agreement (EUA) " + agreement.ID + " has expired",
+			Detail:     "EUA was valid for " + strconv.Itoa(agreement.AccessValidForDays) + " days and it expired. The end user must be reconnected.",
+			Type:       "AccessExpiredError",
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+
+	if acc.suspended {
+		return nil, http.StatusConflict, apiError{
+			Summary:    "Account suspended",
+			Detail:     fmt.Sprintf("Account %s is suspended. Data can no longer be accessed.", accountID),
+			Type:       "AccountSuspendedError",
+			StatusCode: http.StatusConflict,
+		}
+	}
+
+	if s.down[acc.institutionID] {
+		return nil, http.StatusServiceUnavailable, apiError{
+			Summary:    "Institution service unavailable",
+			Detail:     fmt.Sprintf("Couldn't connect to %s. Please try again later.", acc.institutionID),
+			Type:       "ServiceError",
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	return acc, 0, nil
+}
+
+func (s *Server) handleAccountDetails(w http.ResponseWriter, _ *http.Request, acc *account) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"account": acc.details,
+	})
+}
+
+func (s *Server) handleAccountBalances(w http.ResponseWriter, _ *http.Request, acc *account) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"balances": acc.balances,
+	})
+}
+
+// handleAccountTransactions returns the transactions of an account, optionally between date_from and date_to
+func (s *Server) handleAccountTransactions(w http.ResponseWriter, r *http.Request, acc *account) {
+	dateFrom := r.URL.Query().Get("date_from")
+	dateTo := r.URL.Query().Get("date_to")
+	for _, date := range []string{dateFrom, dateTo} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			writeError(w, http.StatusBadRequest, "", "Invalid date", fmt.Sprintf("%s is not a valid date, use YYYY-MM-DD", date))
+			return
+		}
+	}
+
+	filter := func(transactions []transaction) []transaction {
+		filtered := make([]transaction, 0, len(transactions))
+		for _, tx := range transactions {
+			if (dateFrom == "" || tx.BookingDate >= dateFrom) && (dateTo == "" || tx.BookingDate <= dateTo) {
+				filtered = append(filtered, tx)
+			}
+		}
+		return filtered
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"transactions": map[string]interface{}{
+			"booked":  filter(acc.booked),
+			"pending": filter(acc.pending),
+		},
+	})
+}
+
+// handleConsent stands in for the bank's consent page. It links the
+// requisition, or rejects it when called with ?reject=1, and redirects to the
+// requisition's redirect URL like GoCardless does.
+func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	requisition, ok := s.requisitions[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "Requisition not found", http.StatusNotFound)
+		return
+	}
+
+	callback, err := url.Parse(requisition.RedirectURL)
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, "Invalid redirect URL", http.StatusBadRequest)
+		return
+	}
+
+	query := callback.Query()
+	query.Set("ref", requisition.Reference)
+	if r.URL.Query().Get("reject") != "" {
+		requisition.Status = StatusRejected
+		query.Set("error", "UserCancelledSession")
+		query.Set("details", "User cancelled the session.")
+	} else if err := s.link(requisition); err != nil {
+		query.Set("error", "InvalidRequisition")
+		query.Set("details", err.Error())
+	}
+	s.mu.Unlock()
+
+	callback.RawQuery = query.Encode()
+	http.Redirect(w, r, callback.String(), http.StatusFound)
+}
+
+// handleLogo serves a generated SVG logo for an institution
+func (s *Server) handleLogo(w http.ResponseWriter, r *http.Request) {
+	inst, ok := s.institutions[strings.TrimSuffix(r.PathValue("file"), ".svg")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write([]byte(logoSVG(inst)))
+}
+
+// link links a requisition and generates its accounts (must be called with the lock held)
+func (s *Server) link(requisition *dto.GoCardlessGetRequisitionResponse) error {
+	switch requisition.Status {
+	case StatusLinked:
+		return nil
+	case StatusCreated:
+	default:
+		return fmt.Errorf("requisition %s cannot be linked in status %s", requisition.ID, requisition.Status)
+	}
+
+	agreement := s.agreements[requisition.Agreement]
+	now := time.Now().UTC()
+	agreement.Accepted = &now
+
+	for _, acc := range generateAccounts(requisition.ID, s.institutions[requisition.InstitutionID], agreement.MaxHistoricalDays, now) {
+		s.accounts[acc.details.ResourceID] = acc
+		requisition.Accounts = append(requisition.Accounts, acc.details.ResourceID)
+	}
+	requisition.Status = StatusLinked
+
+	return nil
+}
+
+// publicInstitution returns an institution as served by the API, with its logo URL
+func (s *Server) publicInstitution(r *http.Request, inst institution) dto.Institution {
+	public := inst.Institution
+	public.Logo = s.baseURL(r) + "/logos/" + inst.ID + ".svg"
+	return public
+}
+
+// baseURL returns the public URL of the server
+func (s *Server) baseURL(r *http.Request) string {
+	if s.opts.BaseURL != "" {
+		return strings.TrimSuffix(s.opts.BaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// issueToken creates a token valid for ttl (must be called with the lock held)
+func issueToken(tokens map[string]time.Time, ttl time.Duration) string {
+	token := strings.ReplaceAll(uuid.NewString(), "-", "")
+	tokens[token] = time.Now().Add(ttl)
+	return token
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, errType, summary, detail string) {
+	writeJSON(w, status, apiError{
+		Summary:    summary,
+		Detail:     detail,
+		Type:       errType,
+		StatusCode: status,
+	})
+}
+
+// containsFold checks if a value is in the list, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
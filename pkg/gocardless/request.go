@@ -0,0 +1,242 @@
+package gocardless
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Rate limit headers sent by GoCardless. The general limit applies to the
+// whole integration, the account success limit to each account endpoint
+// (details, balances, transactions) of a single bank account per day.
+const (
+	headerRateLimit                 = "HTTP_X_RATELIMIT_LIMIT"
+	headerRateLimitRemaining        = "HTTP_X_RATELIMIT_REMAINING"
+	headerRateLimitReset            = "HTTP_X_RATELIMIT_RESET"
+	headerAccountRateLimit          = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_LIMIT"
+	headerAccountRateLimitRemaining = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_REMAINING"
+	headerAccountRateLimitReset     = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET"
+)
+
+// Rate limit scopes
+const (
+	RateLimitScopeGeneral = "general"
+	RateLimitScopeAccount = "account"
+)
+
+// RateLimit is the rate limit state reported by GoCardless for one scope
+type RateLimit struct {
+	Scope     string
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// request describes a call to the GoCardless API
+type request struct {
+	method        string
+	path          string
+	body          interface{}
+	authenticated bool
+	// idempotent marks requests that are safe to send more than once. GET and
+	// DELETE requests are always considered idempotent.
+	idempotent bool
+}
+
+// do sends a request to the GoCardless API and decodes a successful response
+// into out. Network errors and 5xx responses of idempotent requests are retried
+// with jittered exponential backoff; 429 responses are returned as a
+// *RateLimitError so callers can defer their work until the limit resets.
+func (c *Client) do(ctx context.Context, r request, out interface{}) error {
+	var payload []byte
+	if r.body != nil {
+		var err error
+		payload, err = json.Marshal(r.body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	retryable := r.idempotent || r.method == http.MethodGet || r.method == http.MethodDelete
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, r, payload)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			if ctx.Err() == nil && retryable && attempt < c.MaxRetries && isTemporaryNetworkError(err) {
+				if err := c.sleep(ctx, c.backoff(attempt)); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("failed to execute request: %w", err)
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				return nil
+			}
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			return nil
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			defer resp.Body.Close()
+			return newRateLimitError(resp)
+		}
+
+		if retryable && attempt < c.MaxRetries && isRetryableStatus(resp.StatusCode) {
+			wait := c.backoff(attempt)
+			if retryAfter, ok := parseRetryAfter(resp.Header); ok {
+				wait = retryAfter
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err := c.sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		return parseGoCardlessError(resp)
+	}
+}
+
+// newRequest builds the HTTP request for an attempt
+func (c *Client) newRequest(ctx context.Context, r request, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, c.BaseURL+r.path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if r.authenticated {
+		accessToken, err := c.GetValidAccessToken(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	return req, nil
+}
+
+// backoff returns the delay before the given retry attempt using full jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.InitialBackoff << attempt
+	if delay <= 0 || delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)))
+}
+
+// sleep waits for the given duration or until the context is done
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTemporaryNetworkError reports whether a transport error is likely transient
+func isTemporaryNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// parseRetryAfter reads a Retry-After header expressed in seconds
+func parseRetryAfter(header http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// parseRateLimits reads the rate limit headers of a response. Scopes that are
+// absent from the response are omitted.
+func parseRateLimits(header http.Header) []RateLimit {
+	now := time.Now()
+	var limits []RateLimit
+
+	scopes := []struct {
+		scope, limit, remaining, reset string
+	}{
+		{RateLimitScopeGeneral, headerRateLimit, headerRateLimitRemaining, headerRateLimitReset},
+		{RateLimitScopeAccount, headerAccountRateLimit, headerAccountRateLimitRemaining, headerAccountRateLimitReset},
+	}
+
+	for _, s := range scopes {
+		limit, errLimit := strconv.Atoi(header.Get(s.limit))
+		remaining, errRemaining := strconv.Atoi(header.Get(s.remaining))
+		reset, errReset := strconv.Atoi(header.Get(s.reset))
+		if errLimit != nil && errRemaining != nil && errReset != nil {
+			continue
+		}
+
+		rateLimit := RateLimit{
+			Scope:     s.scope,
+			Limit:     limit,
+			Remaining: remaining,
+		}
+		if errReset == nil {
+			rateLimit.ResetAt = now.Add(time.Duration(reset) * time.Second)
+		}
+		limits = append(limits, rateLimit)
+	}
+
+	return limits
+}
@@ -0,0 +1,198 @@
+package gocardless
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    []RateLimit // ResetAt holds the seconds until the reset
+	}{
+		{
+			name: "no headers",
+		},
+		{
+			name: "general limit",
+			headers: map[string]string{
+				headerRateLimit:          "100",
+				headerRateLimitRemaining: "42",
+				headerRateLimitReset:     "60",
+			},
+			want: []RateLimit{{Scope: RateLimitScopeGeneral, Limit: 100, Remaining: 42, ResetAt: time.Unix(60, 0)}},
+		},
+		{
+			name: "both limits",
+			headers: map[string]string{
+				headerRateLimit:                 "100",
+				headerRateLimitRemaining:        "99",
+				headerRateLimitReset:            "30",
+				headerAccountRateLimit:          "4",
+				headerAccountRateLimitRemaining: "0",
+				headerAccountRateLimitReset:     "3600",
+			},
+			want: []RateLimit{
+				{Scope: RateLimitScopeGeneral, Limit: 100, Remaining: 99, ResetAt: time.Unix(30, 0)},
+				{Scope: RateLimitScopeAccount, Limit: 4, Remaining: 0, ResetAt: time.Unix(3600, 0)},
+			},
+		},
+		{
+			name: "without reset",
+			headers: map[string]string{
+				headerAccountRateLimit:          "4",
+				headerAccountRateLimitRemaining: "3",
+			},
+			want: []RateLimit{{Scope: RateLimitScopeAccount, Limit: 4, Remaining: 3}},
+		},
+		{
+			name: "invalid values",
+			headers: map[string]string{
+				headerRateLimit:          "many",
+				headerRateLimitRemaining: "",
+				headerRateLimitReset:     "soon",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+
+			before := time.Now()
+			got := parseRateLimits(header)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseRateLimits() = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				limit := got[i]
+				if limit.Scope != want.Scope || limit.Limit != want.Limit || limit.Remaining != want.Remaining {
+					t.Errorf("limit %d = %+v, want %+v", i, limit, want)
+				}
+				if want.ResetAt.IsZero() != limit.ResetAt.IsZero() {
+					t.Errorf("limit %d reset = %v, want it set: %v", i, limit.ResetAt, !want.ResetAt.IsZero())
+					continue
+				}
+				if resetIn := time.Duration(want.ResetAt.Unix()) * time.Second; !want.ResetAt.IsZero() &&
+					(limit.ResetAt.Before(before.Add(resetIn)) || limit.ResetAt.After(time.Now().Add(resetIn))) {
+					t.Errorf("limit %d reset = %v, want %v from now", i, limit.ResetAt, resetIn)
+				}
+			}
+		})
+	}
+}
+
+func TestNewRateLimitError(t *testing.T) {
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		wantScope string
+		wantLimit int
+		wantWait  time.Duration
+	}{
+		{
+			name: "general limit",
+			headers: map[string]string{
+				headerRateLimit:          "100",
+				headerRateLimitRemaining: "0",
+				headerRateLimitReset:     "60",
+			},
+			wantScope: RateLimitScopeGeneral,
+			wantLimit: 100,
+			wantWait:  time.Minute,
+		},
+		{
+			name: "exhausted account limit",
+			headers: map[string]string{
+				headerRateLimit:                 "100",
+				headerRateLimitRemaining:        "50",
+				headerRateLimitReset:            "60",
+				headerAccountRateLimit:          "4",
+				headerAccountRateLimitRemaining: "0",
+				headerAccountRateLimitReset:     "7200",
+			},
+			wantScope: RateLimitScopeAccount,
+			wantLimit: 4,
+			wantWait:  2 * time.Hour,
+		},
+		{
+			name: "account limit left",
+			headers: map[string]string{
+				headerRateLimit:                 "100",
+				headerRateLimitRemaining:        "0",
+				headerRateLimitReset:            "60",
+				headerAccountRateLimit:          "4",
+				headerAccountRateLimitRemaining: "2",
+				headerAccountRateLimitReset:     "7200",
+			},
+			wantScope: RateLimitScopeGeneral,
+			wantLimit: 100,
+			wantWait:  time.Minute,
+		},
+		{
+			name:      "retry after",
+			headers:   map[string]string{"Retry-After": "120"},
+			wantScope: RateLimitScopeGeneral,
+			wantWait:  2 * time.Minute,
+		},
+		{
+			name:      "no reset information",
+			wantScope: RateLimitScopeGeneral,
+			wantWait:  defaultRateLimitWait,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(`{"summary":"Rate limit exceeded","detail":"Try again later","status_code":429}`)),
+			}
+			for key, value := range tt.headers {
+				resp.Header.Set(key, value)
+			}
+
+			got := newRateLimitError(resp)
+			if got.Scope != tt.wantScope || got.Limit != tt.wantLimit {
+				t.Errorf("newRateLimitError() = %+v, want scope %s and limit %d", got, tt.wantScope, tt.wantLimit)
+			}
+			if wait := got.RetryAfter(); wait > tt.wantWait || wait < tt.wantWait-time.Second {
+				t.Errorf("RetryAfter() = %v, want %v", wait, tt.wantWait)
+			}
+			if got.Detail != "Try again later" {
+				t.Errorf("Detail = %q, want the detail of the response", got.Detail)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"Wed, 21 Oct 2026 07:28:00 GMT", 0, false},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set("Retry-After", tt.value)
+		got, ok := parseRetryAfter(header)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}